@@ -0,0 +1,245 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/trstringer/comment-sentiment/pkg/analytics"
+	"github.com/trstringer/comment-sentiment/pkg/store"
+)
+
+const (
+	defaultPerPage int = 30
+	maxPerPage     int = 100
+)
+
+var (
+	analyticsTokenFile string
+	analyticsToken     []byte
+)
+
+// page is a page of a paginated response.
+type page struct {
+	Items   interface{} `json:"items"`
+	Page    int         `json:"page"`
+	PerPage int         `json:"per_page"`
+	Total   int         `json:"total"`
+}
+
+// analyticsHandler serves a report on the stored analyses selected by the
+// request's filters.
+type analyticsHandler func(req *http.Request, records []store.AnalysisRecord) ([]interface{}, error)
+
+func registerAnalyticsHandlers() {
+	http.HandleFunc("/api/v1/analytics/sentiment", serveAnalytics(sentimentOverTimeReport))
+	http.HandleFunc("/api/v1/analytics/authors", serveAnalytics(authorsReport))
+	http.HandleFunc("/api/v1/analytics/threads", serveAnalytics(negativeThreadsReport))
+	http.HandleFunc("/api/v1/analytics/comment-types", serveAnalytics(commentTypesReport))
+	http.HandleFunc("/api/v1/analytics/conversions", serveAnalytics(conversionsReport))
+	http.HandleFunc("/api/v1/analytics/shadow", serveAnalytics(shadowEditsReport))
+	http.HandleFunc("/api/v1/export", handleExportRequest)
+}
+
+func serveAnalytics(handler analyticsHandler) http.HandlerFunc {
+	return func(resp http.ResponseWriter, req *http.Request) {
+		adminToken, analyticsToken := currentTokens()
+		if !hasBearerToken(req, analyticsToken, adminToken) {
+			writeJSONError(resp, http.StatusUnauthorized, "Unauthorized access denied")
+			return
+		}
+		if req.Method != http.MethodGet {
+			writeJSONError(resp, http.StatusMethodNotAllowed, "Only GET supported")
+			return
+		}
+		if analysisStore == nil {
+			writeJSONError(resp, http.StatusNotFound, "No database configured")
+			return
+		}
+
+		filter, err := filterFromQuery(req)
+		if err != nil {
+			writeJSONError(resp, http.StatusBadRequest, err.Error())
+			return
+		}
+		pageNumber, perPage, err := paginationFromQuery(req)
+		if err != nil {
+			writeJSONError(resp, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		records, err := analysisStore.ListAnalyses(req.Context(), filter)
+		if err != nil {
+			writeJSONError(resp, http.StatusInternalServerError, "Error reading analyses")
+			log.Error().Err(err).Msg("Error reading analyses")
+			return
+		}
+		items, err := handler(req, records)
+		if err != nil {
+			writeJSONError(resp, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		start, end := pageBounds(len(items), pageNumber, perPage)
+		writeJSON(resp, http.StatusOK, page{
+			Items:   items[start:end],
+			Page:    pageNumber,
+			PerPage: perPage,
+			Total:   len(items),
+		})
+	}
+}
+
+func sentimentOverTimeReport(req *http.Request, records []store.AnalysisRecord) ([]interface{}, error) {
+	interval := analytics.Day
+	if rawInterval := req.URL.Query().Get("interval"); rawInterval != "" {
+		var err error
+		interval, err = analytics.ParseInterval(rawInterval)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	items := []interface{}{}
+	for _, bucket := range analytics.SentimentOverTime(records, interval) {
+		items = append(items, bucket)
+	}
+	return items, nil
+}
+
+func authorsReport(req *http.Request, records []store.AnalysisRecord) ([]interface{}, error) {
+	items := []interface{}{}
+	for _, author := range analytics.Authors(records) {
+		items = append(items, author)
+	}
+	return items, nil
+}
+
+func negativeThreadsReport(req *http.Request, records []store.AnalysisRecord) ([]interface{}, error) {
+	items := []interface{}{}
+	for _, thread := range analytics.NegativeThreads(records) {
+		items = append(items, thread)
+	}
+	return items, nil
+}
+
+func commentTypesReport(req *http.Request, records []store.AnalysisRecord) ([]interface{}, error) {
+	items := []interface{}{}
+	for _, commentType := range analytics.CommentTypes(records) {
+		items = append(items, commentType)
+	}
+	return items, nil
+}
+
+func conversionsReport(req *http.Request, records []store.AnalysisRecord) ([]interface{}, error) {
+	items := []interface{}{}
+	for _, conversion := range analytics.Conversions(records) {
+		items = append(items, conversion)
+	}
+	return items, nil
+}
+
+func shadowEditsReport(req *http.Request, records []store.AnalysisRecord) ([]interface{}, error) {
+	items := []interface{}{}
+	for _, edit := range analytics.ShadowEdits(records) {
+		items = append(items, edit)
+	}
+	return items, nil
+}
+
+// filterFromQuery reads the owner, repo, author, comment_type, sentiment,
+// shadow, since and until query parameters. Dates are RFC 3339 timestamps or
+// YYYY-MM-DD days.
+func filterFromQuery(req *http.Request) (store.Filter, error) {
+	query := req.URL.Query()
+	filter := store.Filter{
+		Owner:       query.Get("owner"),
+		Repo:        query.Get("repo"),
+		Author:      query.Get("author"),
+		CommentType: query.Get("comment_type"),
+		Sentiment:   query.Get("sentiment"),
+	}
+
+	if rawShadow := query.Get("shadow"); rawShadow != "" {
+		shadow, err := strconv.ParseBool(rawShadow)
+		if err != nil {
+			return filter, fmt.Errorf("invalid shadow %s", rawShadow)
+		}
+		filter.Shadow = &shadow
+	}
+
+	var err error
+	if filter.Since, err = parseQueryTime(query.Get("since")); err != nil {
+		return filter, fmt.Errorf("invalid since: %w", err)
+	}
+	if filter.Until, err = parseQueryTime(query.Get("until")); err != nil {
+		return filter, fmt.Errorf("invalid until: %w", err)
+	}
+	return filter, nil
+}
+
+func parseQueryTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// paginationFromQuery reads the page and per_page query parameters, which
+// work like the GitHub API's.
+func paginationFromQuery(req *http.Request) (int, int, error) {
+	pageNumber, perPage := 1, defaultPerPage
+	query := req.URL.Query()
+
+	if rawPage := query.Get("page"); rawPage != "" {
+		parsed, err := strconv.Atoi(rawPage)
+		if err != nil || parsed < 1 {
+			return 0, 0, fmt.Errorf("invalid page %s", rawPage)
+		}
+		pageNumber = parsed
+	}
+	if rawPerPage := query.Get("per_page"); rawPerPage != "" {
+		parsed, err := strconv.Atoi(rawPerPage)
+		if err != nil || parsed < 1 {
+			return 0, 0, fmt.Errorf("invalid per_page %s", rawPerPage)
+		}
+		perPage = parsed
+		if perPage > maxPerPage {
+			perPage = maxPerPage
+		}
+	}
+	return pageNumber, perPage, nil
+}
+
+// pageBounds returns the range of the items of a page, which is empty for
+// the pages after the last one.
+func pageBounds(total, pageNumber, perPage int) (int, int) {
+	// Checked before multiplying, so that large page numbers do not overflow.
+	if pageNumber-1 >= (total+perPage-1)/perPage {
+		return total, total
+	}
+	start := (pageNumber - 1) * perPage
+	end := start + perPage
+	if end > total {
+		end = total
+	}
+	return start, end
+}
+
+func writeJSON(resp http.ResponseWriter, status int, value interface{}) {
+	resp.Header().Set("Content-Type", "application/json")
+	resp.WriteHeader(status)
+	// nolint: errcheck
+	json.NewEncoder(resp).Encode(value)
+}
+
+func writeJSONError(resp http.ResponseWriter, status int, message string) {
+	writeJSON(resp, status, map[string]string{"error": message})
+}
@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPageBounds(t *testing.T) {
+	testCases := []struct {
+		name          string
+		total         int
+		pageNumber    int
+		perPage       int
+		expectedStart int
+		expectedEnd   int
+	}{
+		{name: "first_page", total: 25, pageNumber: 1, perPage: 10, expectedStart: 0, expectedEnd: 10},
+		{name: "last_page", total: 25, pageNumber: 3, perPage: 10, expectedStart: 20, expectedEnd: 25},
+		{name: "after_last_page", total: 25, pageNumber: 4, perPage: 10, expectedStart: 25, expectedEnd: 25},
+		{name: "no_items", total: 0, pageNumber: 1, perPage: 10, expectedStart: 0, expectedEnd: 0},
+		{name: "very_large_page", total: 25, pageNumber: math.MaxInt, perPage: 100, expectedStart: 25, expectedEnd: 25},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			start, end := pageBounds(testCase.total, testCase.pageNumber, testCase.perPage)
+			if start != testCase.expectedStart || end != testCase.expectedEnd {
+				t.Fatalf("Unexpected bounds %d:%d, expected %d:%d", start, end, testCase.expectedStart, testCase.expectedEnd)
+			}
+		})
+	}
+}
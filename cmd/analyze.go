@@ -0,0 +1,311 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	gh "github.com/trstringer/comment-sentiment/pkg/github"
+	sa "github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer"
+)
+
+const (
+	analyzeOutputFooter string = "footer"
+	analyzeOutputTable  string = "table"
+	analyzeOutputJSON   string = "json"
+)
+
+var (
+	analyzeCorpusFile string
+	analyzeOutput     string
+	analyzeTrigger    string
+)
+
+var analyzeCmd = &cobra.Command{
+	Use:   "analyze [file...]",
+	Short: "Analyze comments from the terminal",
+	Long: `Analyze comments without running the server, with the same markdown
+preprocessing and provider flags as the server. Every file is a comment, and
+stdin is read when there are no files or a file is "-". With --corpus, every
+line of a JSONL file is a comment such as {"id": "1", "text": "...", "label":
+"negative"}, where id and label are optional.
+
+The output is one of:
+
+  footer  the comment as the server would leave it on GitHub
+  table   a row per comment, with the accuracy if the corpus has labels
+  json    a JSON object per comment
+
+--trigger decides whether a comment gets the analysis, like the trigger of
+the repo configuration.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		switch analyzeOutput {
+		case analyzeOutputFooter, analyzeOutputTable, analyzeOutputJSON:
+		default:
+			return fmt.Errorf("invalid --output %s, expected footer, table or json", analyzeOutput)
+		}
+		repoConfig, err := gh.ParseRepoConfig([]byte(fmt.Sprintf("trigger: %q", analyzeTrigger)))
+		if err != nil {
+			return fmt.Errorf("invalid --trigger: %w", err)
+		}
+
+		var inputs []analyzeInput
+		if analyzeCorpusFile != "" {
+			inputs, err = readAnalyzeCorpus(analyzeCorpusFile)
+		} else {
+			inputs, err = readAnalyzeFiles(args)
+		}
+		if err != nil {
+			return err
+		}
+
+		sentimentSvc, err = newSentimentAnalyzer(providerName)
+		if err != nil {
+			return fmt.Errorf("error setting up sentiment provider: %w", err)
+		}
+
+		results := []analyzeResult{}
+		for _, input := range inputs {
+			result, err := analyzeInputComment(context.Background(), repoConfig, input)
+			if err != nil {
+				return fmt.Errorf("error analyzing %s: %w", input.ID, err)
+			}
+			results = append(results, result)
+		}
+		if err := writeAnalyzeResults(os.Stdout, analyzeOutput, results); err != nil {
+			return fmt.Errorf("error writing results: %w", err)
+		}
+		return nil
+	},
+}
+
+func init() {
+	analyzeCmd.Flags().StringVar(&analyzeCorpusFile, "corpus", "", "JSONL file with a comment per line, instead of files")
+	analyzeCmd.Flags().StringVarP(&analyzeOutput, "output", "o", analyzeOutputFooter, "footer, table or json")
+	analyzeCmd.Flags().StringVar(&analyzeTrigger, "trigger", string(gh.TriggerAll), "which comments get the analysis: all, negative or incivility")
+	addProviderFlags(analyzeCmd)
+	rootCmd.AddCommand(analyzeCmd)
+}
+
+// analyzeInput is a comment to analyze.
+type analyzeInput struct {
+	ID    string `json:"id"`
+	Text  string `json:"text"`
+	Label string `json:"label"`
+}
+
+// analyzeResult is the analysis of a comment, as printed by the analyze
+// command.
+type analyzeResult struct {
+	ID         string             `json:"id"`
+	Label      string             `json:"label,omitempty"`
+	Analyzed   bool               `json:"analyzed"`
+	Sentiment  string             `json:"sentiment,omitempty"`
+	Confidence float32            `json:"confidence,omitempty"`
+	Sentences  []analyzeSentence  `json:"sentences,omitempty"`
+	Toxicity   map[string]float32 `json:"toxicity,omitempty"`
+	Degraded   bool               `json:"degraded,omitempty"`
+	Annotate   bool               `json:"annotate"`
+	// Comment is the comment as the server would leave it.
+	Comment string `json:"comment"`
+}
+
+type analyzeSentence struct {
+	Text             string  `json:"text"`
+	Sentiment        string  `json:"sentiment"`
+	Confidence       float32 `json:"confidence"`
+	SuggestedRewrite string  `json:"suggested_rewrite,omitempty"`
+}
+
+func readAnalyzeFiles(paths []string) ([]analyzeInput, error) {
+	if len(paths) == 0 {
+		paths = []string{"-"}
+	}
+	inputs := []analyzeInput{}
+	for _, path := range paths {
+		var text []byte
+		var err error
+		if path == "-" {
+			text, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			text, err = ioutil.ReadFile(path)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", path, err)
+		}
+		id := path
+		if path == "-" {
+			id = "stdin"
+		}
+		inputs = append(inputs, analyzeInput{ID: id, Text: string(text)})
+	}
+	return inputs, nil
+}
+
+func readAnalyzeCorpus(path string) ([]analyzeInput, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening corpus: %w", err)
+	}
+	defer file.Close()
+
+	inputs := []analyzeInput{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		input := analyzeInput{}
+		if err := json.Unmarshal([]byte(line), &input); err != nil {
+			return nil, fmt.Errorf("error parsing corpus line %d: %w", lineNumber, err)
+		}
+		if input.Label != "" {
+			label, err := sa.ParseSentiment(input.Label)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing corpus line %d: %w", lineNumber, err)
+			}
+			input.Label = label.String()
+		}
+		if input.ID == "" {
+			input.ID = fmt.Sprintf("line %d", lineNumber)
+		}
+		inputs = append(inputs, input)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading corpus: %w", err)
+	}
+	return inputs, nil
+}
+
+// analyzeInputComment analyzes the comment the way processComment does, and
+// renders the comment the server would leave on GitHub.
+func analyzeInputComment(ctx context.Context, repoConfig gh.RepoConfig, input analyzeInput) (analyzeResult, error) {
+	result := analyzeResult{ID: input.ID, Label: input.Label}
+	bodyTrimmed, analysis, err := analyzeComment(ctx, input.Text)
+	if err != nil {
+		return result, err
+	}
+	result.Comment = bodyTrimmed
+	if analysis == nil {
+		return result, nil
+	}
+
+	result.Analyzed = true
+	result.Sentiment = analysis.Sentiment.String()
+	result.Confidence = analysis.Confidence
+	result.Degraded = analysis.Degraded
+	for _, sentence := range analysis.SentenceAnalyses {
+		result.Sentences = append(result.Sentences, analyzeSentence{
+			Text:             sentence.Text,
+			Sentiment:        sentence.Sentiment.String(),
+			Confidence:       sentence.Confidence,
+			SuggestedRewrite: sentence.SuggestedRewrite,
+		})
+	}
+	if len(analysis.Toxicity) > 0 {
+		result.Toxicity = map[string]float32{}
+		for _, score := range analysis.Toxicity {
+			result.Toxicity[score.Category.String()] = score.Score
+		}
+	}
+
+	result.Annotate = repoConfig.ShouldAnnotate(*analysis)
+	if result.Annotate {
+		result.Comment, err = gh.UpdateCommentWithSentiment(input.Text, *analysis)
+		if err != nil {
+			return result, fmt.Errorf("error updating comment text with sentiment: %w", err)
+		}
+	}
+	return result, nil
+}
+
+func writeAnalyzeResults(out io.Writer, output string, results []analyzeResult) error {
+	switch output {
+	case analyzeOutputJSON:
+		encoder := json.NewEncoder(out)
+		encoder.SetEscapeHTML(false)
+		for _, result := range results {
+			if err := encoder.Encode(result); err != nil {
+				return err
+			}
+		}
+		return nil
+	case analyzeOutputTable:
+		return writeAnalyzeTable(out, results)
+	default:
+		for i, result := range results {
+			if len(results) > 1 {
+				if i > 0 {
+					fmt.Fprintln(out)
+				}
+				fmt.Fprintf(out, "==> %s <==\n", result.ID)
+			}
+			if _, err := fmt.Fprintln(out, result.Comment); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func writeAnalyzeTable(out io.Writer, results []analyzeResult) error {
+	writer := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "ID\tSENTIMENT\tCONFIDENCE\tNEGATIVE SENTENCES\tINCIVILITY\tANNOTATE\tLABEL")
+	labeled, correct := 0, 0
+	for _, result := range results {
+		negativeSentences := 0
+		for _, sentence := range result.Sentences {
+			if sentence.Sentiment == sa.Negative.String() {
+				negativeSentences++
+			}
+		}
+		incivility := []string{}
+		for category, score := range result.Toxicity {
+			if score >= sa.DefaultToxicityThreshold {
+				incivility = append(incivility, fmt.Sprintf("%s=%.2f", category, score))
+			}
+		}
+		sort.Strings(incivility)
+		sentiment := result.Sentiment
+		if !result.Analyzed {
+			sentiment = "-"
+		}
+		fmt.Fprintf(
+			writer,
+			"%s\t%s\t%.2f\t%d\t%s\t%t\t%s\n",
+			result.ID,
+			sentiment,
+			result.Confidence,
+			negativeSentences,
+			strings.Join(incivility, ","),
+			result.Annotate,
+			result.Label,
+		)
+		if result.Label != "" {
+			labeled++
+			if result.Label == result.Sentiment {
+				correct++
+			}
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	if labeled > 0 {
+		fmt.Fprintf(out, "\nLabeled: %d\nAccuracy: %.3f\n", labeled, float64(correct)/float64(labeled))
+	}
+	return nil
+}
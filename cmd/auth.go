@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer/azure"
+)
+
+const (
+	languageAuthKey              string = "key"
+	languageAuthClientSecret     string = "client-secret"
+	languageAuthClientCert       string = "client-certificate"
+	languageAuthWorkloadIdentity string = "workload-identity"
+)
+
+// languageAuthOption builds the authentication for the language service from
+// the --language-auth flag and the corresponding credential flags.
+func languageAuthOption() (azure.Option, error) {
+	if languageAuth == languageAuthKey {
+		if languageKeyFile == "" {
+			return nil, fmt.Errorf("required parameter --language-keyfile not supplied")
+		}
+		languageKeyFilePath, err := filepath.Abs(languageKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error getting file path for language key: %w", err)
+		}
+		languageKeyBytes, err := ioutil.ReadFile(languageKeyFilePath)
+		if err != nil {
+			return nil, fmt.Errorf("error reading language key file: %w", err)
+		}
+		languageKey = string(languageKeyBytes)
+		return azure.WithAuthorizer(azure.KeyAuthorizer(languageKey)), nil
+	}
+
+	if aadTenantID == "" {
+		return nil, fmt.Errorf("required parameter --azure-tenant-id not supplied")
+	}
+	if aadClientID == "" {
+		return nil, fmt.Errorf("required parameter --azure-client-id not supplied")
+	}
+	aadConfig := azure.AADConfig{
+		AuthorityHost: aadAuthorityHost,
+		TenantID:      aadTenantID,
+		ClientID:      aadClientID,
+	}
+
+	log.Info().Msgf("Using %s authentication for the language service", languageAuth)
+	switch languageAuth {
+	case languageAuthClientSecret:
+		if aadSecretFile == "" {
+			return nil, fmt.Errorf("required parameter --azure-client-secretfile not supplied")
+		}
+		secret, err := ioutil.ReadFile(aadSecretFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading client secret file: %w", err)
+		}
+		return azure.WithAuthorizer(azure.NewClientSecretAuthorizer(
+			aadConfig,
+			strings.TrimSpace(string(secret)),
+		)), nil
+	case languageAuthClientCert:
+		if aadCertFile == "" {
+			return nil, fmt.Errorf("required parameter --azure-client-certfile not supplied")
+		}
+		certPEM, err := ioutil.ReadFile(aadCertFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading client certificate file: %w", err)
+		}
+		authorizer, err := azure.NewClientCertificateAuthorizer(aadConfig, certPEM)
+		if err != nil {
+			return nil, err
+		}
+		return azure.WithAuthorizer(authorizer), nil
+	case languageAuthWorkloadIdentity:
+		if aadTokenFile == "" {
+			return nil, fmt.Errorf("required parameter --azure-federated-tokenfile not supplied")
+		}
+		return azure.WithAuthorizer(azure.NewWorkloadIdentityAuthorizer(aadConfig, aadTokenFile)), nil
+	default:
+		return nil, fmt.Errorf("unknown language authentication %s", languageAuth)
+	}
+}
+
+func envOrDefault(name, defaultValue string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// hasBearerToken checks the bearer token of the request against the tokens.
+// Tokens that are not configured never match.
+func hasBearerToken(req *http.Request, tokens ...[]byte) bool {
+	header := req.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return false
+	}
+	token := []byte(strings.TrimPrefix(header, "Bearer "))
+
+	matched := false
+	for _, expected := range tokens {
+		if len(expected) > 0 && subtle.ConstantTimeCompare(token, expected) == 1 {
+			matched = true
+		}
+	}
+	return matched
+}
+
+// requestToken returns the bearer token of the request, or else its X-API-Key
+// header.
+func requestToken(req *http.Request) []byte {
+	if header := req.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return []byte(strings.TrimPrefix(header, "Bearer "))
+	}
+	return []byte(req.Header.Get("X-API-Key"))
+}
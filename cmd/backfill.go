@@ -0,0 +1,306 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	ghapi "github.com/google/go-github/v44/github"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"github.com/trstringer/comment-sentiment/pkg/backfill"
+	"github.com/trstringer/comment-sentiment/pkg/budget"
+	gh "github.com/trstringer/comment-sentiment/pkg/github"
+	"github.com/trstringer/comment-sentiment/pkg/store"
+)
+
+// installationTokenTTL is how long an installation client is used before a
+// new token is created. GitHub expires installation tokens after an hour.
+const installationTokenTTL time.Duration = 50 * time.Minute
+
+var (
+	backfillOwner          string
+	backfillRepos          []string
+	backfillKinds          []string
+	backfillCheckpointFile string
+	backfillConcurrency    int
+	backfillAnnotate       bool
+	backfillMinRateLimit   int
+)
+
+var backfillCmd = &cobra.Command{
+	Use:   "backfill",
+	Short: "Analyze the comment history of an installation's repos",
+	Long: `Walk the repos of the GitHub App installation of --owner and analyze their
+historical issue, pull request review and discussion comments into the
+database, oldest first. Comments are only analyzed, not edited, unless
+--annotate is set.
+
+Progress is saved to --checkpoint after every page of comments, so an
+interrupted backfill continues where it stopped when run again. Comments that
+are already in the database are skipped. The backfill stops at a page with a
+comment that could not be analyzed, so that the page is retried when it is run
+again. When few GitHub API calls are left, the backfill waits for the rate
+limit to reset, and it stops when a budget quota is exceeded.
+
+The database can only be opened by one process at a time, so stop the server
+or use a copy of its database file.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if databaseFile == "" {
+			return fmt.Errorf("required parameter --database not supplied")
+		}
+		if backfillOwner == "" {
+			return fmt.Errorf("required parameter --owner not supplied")
+		}
+		if appID <= 0 || appKeyFile == "" {
+			return fmt.Errorf("required parameters --app-id and --app-keyfile not supplied")
+		}
+		if backfillConcurrency < 1 {
+			return fmt.Errorf("parameter --concurrency has to be at least 1")
+		}
+		kinds := []gh.CommentKind{}
+		for _, kind := range backfillKinds {
+			switch gh.CommentKind(kind) {
+			case gh.IssueComments, gh.ReviewComments, gh.DiscussionComments:
+				kinds = append(kinds, gh.CommentKind(kind))
+			default:
+				return fmt.Errorf("invalid --kinds %s", kind)
+			}
+		}
+
+		var err error
+		appKey, err = ioutil.ReadFile(appKeyFile)
+		if err != nil {
+			return fmt.Errorf("error reading app key file: %w", err)
+		}
+		checkpoint, err := backfill.LoadCheckpoint(backfillCheckpointFile)
+		if err != nil {
+			return fmt.Errorf("error loading checkpoint: %w", err)
+		}
+
+		database, err = store.OpenBolt(databaseFile)
+		if err != nil {
+			return fmt.Errorf("error opening database: %w", err)
+		}
+		defer database.Close()
+		analysisStore = database
+
+		sentimentSvc, err = newSentimentAnalyzer(providerName)
+		if err != nil {
+			return fmt.Errorf("error setting up sentiment provider: %w", err)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		if err := runBackfill(ctx, checkpoint, kinds); err != nil {
+			if backfillCheckpointFile != "" {
+				return fmt.Errorf("backfill stopped, run it again to continue from %s: %w", backfillCheckpointFile, err)
+			}
+			return fmt.Errorf("backfill stopped: %w", err)
+		}
+		return nil
+	},
+}
+
+func init() {
+	backfillCmd.Flags().StringVar(&databaseFile, "database", "", "database file of the server")
+	backfillCmd.Flags().IntVar(&appID, "app-id", 0, "GitHub App ID")
+	backfillCmd.Flags().StringVarP(&appKeyFile, "app-keyfile", "a", "", "GitHub App key file path")
+	backfillCmd.Flags().StringVar(&backfillOwner, "owner", "", "user or organization of the installation to backfill")
+	backfillCmd.Flags().StringSliceVar(&backfillRepos, "repo", nil, "only backfill these repos, such as octo/repo")
+	backfillCmd.Flags().StringSliceVar(&backfillKinds, "kinds", nil, "only backfill these kinds of comments: issue_comments, review_comments or discussion_comments")
+	backfillCmd.Flags().StringVar(&backfillCheckpointFile, "checkpoint", "", "file to save the progress in, to resume an interrupted backfill")
+	backfillCmd.Flags().IntVar(&backfillConcurrency, "concurrency", 4, "number of comments analyzed at the same time")
+	backfillCmd.Flags().BoolVar(&backfillAnnotate, "annotate", false, "also add the analysis to the comments that the repo configuration asks for")
+	backfillCmd.Flags().IntVar(&backfillMinRateLimit, "min-rate-limit", backfill.DefaultMinRemaining, "GitHub API calls to leave for the server, the backfill waits for the rate limit to reset below it")
+	addProviderFlags(backfillCmd)
+	addShadowFlags(backfillCmd)
+	rootCmd.AddCommand(backfillCmd)
+}
+
+// installationClient creates clients of an installation, with a new token
+// before the previous one expires.
+type installationClient struct {
+	owner     gh.RepositoryOwner
+	mu        sync.Mutex
+	client    *ghapi.Client
+	id        int64
+	createdAt time.Time
+}
+
+func (i *installationClient) get() (*ghapi.Client, int64, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.client != nil && time.Since(i.createdAt) < installationTokenTTL {
+		return i.client, i.id, nil
+	}
+
+	appID, appKey := currentAppCredentials()
+	client, id, err := gh.NewInstallationGitHubClientWithID(appID, appKey, i.owner)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error creating GitHub client: %w", err)
+	}
+	i.client, i.id, i.createdAt = client, id, time.Now()
+	return client, id, nil
+}
+
+func runBackfill(ctx context.Context, checkpoint *backfill.Checkpoint, kinds []gh.CommentKind) error {
+	clients := &installationClient{owner: gh.RepositoryOwner{Login: backfillOwner}}
+	client, _, err := clients.get()
+	if err != nil {
+		return err
+	}
+	repos, err := gh.ListInstallationRepos(ctx, client)
+	if err != nil {
+		return err
+	}
+	if len(backfillRepos) > 0 {
+		selected := []gh.Repository{}
+		for _, repo := range repos {
+			for _, name := range backfillRepos {
+				if strings.EqualFold(repo.FullName, name) {
+					selected = append(selected, repo)
+				}
+			}
+		}
+		repos = selected
+	}
+	log.Info().Msgf("Backfilling %d repos of %s", len(repos), backfillOwner)
+
+	runner := &backfill.Backfill{
+		Checkpoint:   checkpoint,
+		Kinds:        kinds,
+		MinRemaining: backfillMinRateLimit,
+		List: func(ctx context.Context, repo gh.Repository, kind gh.CommentKind, cursor string) (gh.CommentPage, error) {
+			client, _, err := clients.get()
+			if err != nil {
+				return gh.CommentPage{}, err
+			}
+			return gh.ListCommentPage(ctx, client, repo, kind, cursor)
+		},
+		Process: func(ctx context.Context, comments []gh.CommentPayload) error {
+			return backfillComments(ctx, clients, comments)
+		},
+	}
+	return runner.Run(ctx, repos)
+}
+
+// backfillComments analyzes a page of comments with --concurrency workers. It
+// fails when a quota is exceeded or any comment could not be analyzed, so that
+// the page is not checkpointed. The comments of the page that were analyzed
+// are in the database, so they are skipped when the page is retried.
+func backfillComments(ctx context.Context, clients *installationClient, comments []gh.CommentPayload) error {
+	client, installationID, err := clients.get()
+	if err != nil {
+		return err
+	}
+
+	work := make(chan gh.CommentPayload)
+	var mu sync.Mutex
+	var exceeded *budget.ExceededError
+	failed := 0
+	wg := sync.WaitGroup{}
+	for i := 0; i < backfillConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for commentPayload := range work {
+				commentPayload.Installation = &gh.Installation{ID: installationID}
+				err := backfillComment(ctx, client, commentPayload)
+				if err == nil {
+					continue
+				}
+				mu.Lock()
+				if budgetErr, ok := asBudgetExceeded(err); ok {
+					exceeded = budgetErr
+				} else {
+					log.Error().Err(err).Msgf("Error backfilling comment %s", commentPayload.Comment.HTMLURL)
+					failed++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, commentPayload := range comments {
+		mu.Lock()
+		stop := exceeded != nil
+		mu.Unlock()
+		if stop || ctx.Err() != nil {
+			break
+		}
+		work <- commentPayload
+	}
+	close(work)
+	wg.Wait()
+
+	switch {
+	case exceeded != nil:
+		return exceeded
+	case ctx.Err() != nil:
+		return ctx.Err()
+	case failed > 0:
+		return fmt.Errorf("%d of %d comments of the page failed", failed, len(comments))
+	default:
+		return nil
+	}
+}
+
+// backfillComment analyzes and saves a comment that is not in the database
+// yet, and adds the analysis to it if --annotate is set and the repo
+// configuration asks for it.
+func backfillComment(ctx context.Context, client *ghapi.Client, commentPayload gh.CommentPayload) error {
+	commentType, _ := commentPayload.CommentType()
+	key := store.AnalysisRecord{
+		Repo:        commentPayload.Repository.FullName,
+		CommentType: commentType.String(),
+		CommentID:   commentPayload.Comment.ID,
+	}.CommentKey()
+	history, err := analysisStore.CommentHistory(ctx, key)
+	if err != nil {
+		return fmt.Errorf("error getting comment history: %w", err)
+	}
+	if len(history) > 0 {
+		log.Debug().Msgf("Comment %s is already analyzed, skipping", key)
+		return nil
+	}
+
+	ctx = budget.WithInstallation(ctx, commentPayload.InstallationKey())
+	_, analysis, err := analyzeComment(ctx, commentPayload.Comment.Body)
+	if err != nil || analysis == nil {
+		return err
+	}
+
+	annotate, shadow := false, false
+	if backfillAnnotate {
+		repoConfig, err := repoConfigs.Get(ctx, client, commentPayload.Repository)
+		if err != nil {
+			log.Warn().Err(err).Msgf("Error loading config for repo %s, using defaults", commentPayload.Repository.FullName)
+		}
+		annotate = repoConfig.ShouldAnnotate(*analysis)
+		shadow = inShadowMode(commentPayload.Repository, repoConfig)
+	}
+	record := newAnalysisRecord(commentPayload, *analysis, annotate)
+	if !annotate {
+		return storeAnalysis(ctx, record)
+	}
+
+	updatedComment, err := gh.UpdateCommentWithSentiment(commentPayload.Comment.Body, *analysis)
+	if err != nil {
+		return fmt.Errorf("error updating comment text with sentiment: %w", err)
+	}
+	if shadow {
+		record.Shadow = true
+		record.ShadowComment = updatedComment
+	}
+	if err := storeAnalysis(ctx, record); err != nil {
+		return err
+	}
+	return editComment(client, commentPayload, updatedComment, shadow)
+}
@@ -0,0 +1,235 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/trstringer/comment-sentiment/pkg/budget"
+	gh "github.com/trstringer/comment-sentiment/pkg/github"
+	"github.com/trstringer/comment-sentiment/pkg/metrics"
+	sa "github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer"
+	"github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer/provider"
+)
+
+// maxQueuedComments bounds the comments waiting for a quota to reset.
+const maxQueuedComments int = 1000
+
+var (
+	budgetGlobal       []string
+	budgetInstallation []string
+	budgetActionName   string
+	budgetUsageFile    string
+	offlineProvider    string
+	adminTokenFile     string
+	adminToken         []byte
+	analysisBudget     *budget.Budget
+	budgetAction       budget.Action
+	budgetQueue        = &commentQueue{name: "budget", max: maxQueuedComments}
+	// budgetMemoryUsage is kept when the provider is reloaded, so that the
+	// usage is not reset.
+	budgetMemoryUsage = budget.NewMemoryStore()
+)
+
+// newBudget creates the budget from the command line flags. It returns nil
+// when no quota is configured.
+func newBudget() (*budget.Budget, error) {
+	if len(budgetGlobal) == 0 && len(budgetInstallation) == 0 {
+		return nil, nil
+	}
+
+	action, err := budget.ParseAction(budgetActionName)
+	if err != nil {
+		return nil, err
+	}
+	budgetAction = action
+
+	globalQuotas, err := parseQuotas(budgetGlobal)
+	if err != nil {
+		return nil, err
+	}
+	installationQuotas, err := parseQuotas(budgetInstallation)
+	if err != nil {
+		return nil, err
+	}
+
+	var usageStore budget.UsageStore = budgetMemoryUsage
+	switch {
+	case budgetUsageFile != "":
+		usageStore, err = budget.NewFileStore(budgetUsageFile)
+		if err != nil {
+			return nil, err
+		}
+	case database != nil:
+		usageStore = database
+	}
+
+	return budget.NewBudget(usageStore, globalQuotas, installationQuotas), nil
+}
+
+func parseQuotas(rawQuotas []string) ([]budget.Quota, error) {
+	quotas := []budget.Quota{}
+	for _, rawQuota := range rawQuotas {
+		quota, err := budget.ParseQuota(rawQuota)
+		if err != nil {
+			return nil, err
+		}
+		quotas = append(quotas, quota)
+	}
+	return quotas, nil
+}
+
+// withBudget wraps the paid analyzer with the budget, if there is one.
+func withBudget(analyzer sa.Analyzer, providerConfig provider.Config) (sa.Analyzer, error) {
+	var err error
+	analysisBudget, err = newBudget()
+	if err != nil {
+		return nil, fmt.Errorf("error setting up budget: %w", err)
+	}
+	if analysisBudget == nil {
+		return analyzer, nil
+	}
+
+	var fallback sa.Analyzer
+	if budgetAction == budget.Fallback {
+		fallback, err = provider.New(offlineProvider, providerConfig)
+		if err != nil {
+			return nil, fmt.Errorf("error setting up offline provider: %w", err)
+		}
+	}
+	return budget.NewAnalyzer(analyzer, analysisBudget, fallback), nil
+}
+
+// asBudgetExceeded returns the quota error, if err is one.
+func asBudgetExceeded(err error) (*budget.ExceededError, bool) {
+	var exceeded *budget.ExceededError
+	ok := errors.As(err, &exceeded)
+	return exceeded, ok
+}
+
+// handleBudgetExceeded skips or queues a comment that exceeded a quota.
+func handleBudgetExceeded(commentPayload gh.CommentPayload, exceeded *budget.ExceededError) {
+	reloadMu.RLock()
+	action := budgetAction
+	reloadMu.RUnlock()
+	if action != budget.Queue {
+		log.Warn().Err(exceeded).Msgf("Skipping comment %d", commentPayload.Comment.ID)
+		return
+	}
+	if !budgetQueue.add(commentPayload, exceeded.ResetAt) {
+		log.Warn().Err(exceeded).Msgf("Queue is full, skipping comment %d", commentPayload.Comment.ID)
+		return
+	}
+	log.Info().Err(exceeded).Msgf("Queued comment %d until the quota resets", commentPayload.Comment.ID)
+}
+
+// commentQueue holds comments in memory until their quota resets. Queued
+// comments are lost on restart.
+type commentQueue struct {
+	name    string
+	max     int
+	mu      sync.Mutex
+	pending int
+}
+
+func (q *commentQueue) add(commentPayload gh.CommentPayload, at time.Time) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.pending >= q.max {
+		return false
+	}
+	q.pending++
+	metrics.QueuedComments.WithLabelValues(q.name).Set(float64(q.pending))
+
+	// A little delay spreads out the comments queued on the same quota.
+	delay := time.Until(at) + time.Duration(q.pending)*time.Second
+	time.AfterFunc(delay, func() {
+		q.mu.Lock()
+		q.pending--
+		metrics.QueuedComments.WithLabelValues(q.name).Set(float64(q.pending))
+		q.mu.Unlock()
+		reprocessComment(commentPayload)
+	})
+	return true
+}
+
+func (q *commentQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.pending
+}
+
+// reprocessComment processes a comment again with its current text, as it
+// may have been edited while it was queued.
+func reprocessComment(commentPayload gh.CommentPayload) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	client, err := installationGitHubClient(commentPayload.Repository.Owner)
+	if err != nil {
+		log.Error().Err(err).Msg("Error creating github client for queued comment")
+		return
+	}
+	body, err := commentPayload.CurrentBody(ctx, client)
+	if err != nil {
+		log.Error().Err(err).Msg("Error getting queued comment")
+		return
+	}
+	commentPayload.Comment.Body = body
+
+	if err := processComment(ctx, client, commentPayload); err != nil {
+		log.Error().Err(err).Msgf("Error processing queued comment %d", commentPayload.Comment.ID)
+	}
+}
+
+func handleBudgetRequest(resp http.ResponseWriter, req *http.Request) {
+	adminToken, _ := currentTokens()
+	if !hasBearerToken(req, adminToken) {
+		resp.WriteHeader(http.StatusUnauthorized)
+		// nolint: errcheck
+		resp.Write([]byte("Unauthorized access denied"))
+		return
+	}
+	if req.Method != http.MethodGet {
+		resp.WriteHeader(http.StatusMethodNotAllowed)
+		// nolint: errcheck
+		resp.Write([]byte("Only GET supported"))
+		return
+	}
+	reloadMu.RLock()
+	currentBudget, action := analysisBudget, budgetAction
+	reloadMu.RUnlock()
+	if currentBudget == nil {
+		resp.WriteHeader(http.StatusNotFound)
+		// nolint: errcheck
+		resp.Write([]byte("No budget configured"))
+		return
+	}
+
+	status, err := currentBudget.Status()
+	if err != nil {
+		resp.WriteHeader(http.StatusInternalServerError)
+		// nolint: errcheck
+		resp.Write([]byte("Error getting budget status"))
+		log.Error().Err(err).Msg("Error getting budget status")
+		return
+	}
+
+	resp.Header().Set("Content-Type", "application/json")
+	// nolint: errcheck
+	json.NewEncoder(resp).Encode(struct {
+		Action string                          `json:"action"`
+		Scopes map[string][]budget.QuotaStatus `json:"scopes"`
+		Queued int                             `json:"queued"`
+	}{
+		Action: string(action),
+		Scopes: status,
+		Queued: budgetQueue.len(),
+	})
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/trstringer/comment-sentiment/pkg/config"
+)
+
+// configEnv names the config file when --config is not supplied.
+var configEnv = config.EnvName("config")
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Work with the configuration",
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the server configuration without starting the server",
+	Long: `Check the server configuration from its flags, environment variables and
+--config file, the same way serve does, and report every problem found
+without starting the server.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := validateServeConfig(); err != nil {
+			return err
+		}
+		fmt.Println("Configuration is valid")
+		return nil
+	},
+}
+
+func init() {
+	addServeFlags(configValidateCmd)
+	configCmd.AddCommand(configValidateCmd)
+	rootCmd.AddCommand(configCmd)
+}
+
+// configLoader applies the environment variables and the --config file to
+// the flags of the command that runs, and applies them again on reload.
+var configLoader *config.Loader
+
+// applyConfig sets the flags of cmd that were not supplied from their
+// environment variables and the --config file. A key of the file only has
+// to be a flag of some command, so that one file configures every command.
+func applyConfig(cmd *cobra.Command) error {
+	configLoader = config.NewLoader(cmd.Flags(), configFile, func(name string) bool {
+		return isFlagName(cmd.Root(), name)
+	})
+	_, err := configLoader.Load(nil)
+	return err
+}
+
+// isFlagName returns whether name is a flag of root or any of its
+// subcommands.
+func isFlagName(root *cobra.Command, name string) bool {
+	var found bool
+	var visit func(cmd *cobra.Command)
+	visit = func(cmd *cobra.Command) {
+		if cmd.Flags().Lookup(name) != nil || cmd.PersistentFlags().Lookup(name) != nil {
+			found = true
+			return
+		}
+		for _, child := range cmd.Commands() {
+			visit(child)
+		}
+	}
+	visit(root)
+	return found
+}
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/oauth2"
+	oauthgithub "golang.org/x/oauth2/github"
+
+	"github.com/trstringer/comment-sentiment/pkg/dashboard"
+)
+
+var (
+	dashboardURL             string
+	dashboardSessionKeyFile  string
+	oauthClientID            string
+	oauthClientSecretFile    string
+	communityHealthDashboard *dashboard.Dashboard
+)
+
+// newDashboard sets up the dashboard when a GitHub OAuth app is configured.
+// It returns nil when the dashboard is disabled.
+func newDashboard() (*dashboard.Dashboard, error) {
+	if oauthClientID == "" {
+		return nil, nil
+	}
+	if analysisStore == nil {
+		return nil, fmt.Errorf("the dashboard requires --database")
+	}
+	if oauthClientSecretFile == "" {
+		return nil, fmt.Errorf("required parameter --github-oauth-client-secretfile not supplied")
+	}
+	if dashboardURL == "" {
+		return nil, fmt.Errorf("required parameter --dashboard-url not supplied")
+	}
+	parsedURL, err := url.Parse(dashboardURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dashboard URL: %w", err)
+	}
+
+	clientSecret, err := ioutil.ReadFile(oauthClientSecretFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading OAuth client secret file: %w", err)
+	}
+
+	var sessionKey []byte
+	if dashboardSessionKeyFile != "" {
+		sessionKeyRaw, err := ioutil.ReadFile(dashboardSessionKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading dashboard session key file: %w", err)
+		}
+		sessionKey = []byte(strings.TrimSpace(string(sessionKeyRaw)))
+	} else {
+		log.Warn().Msg("No dashboard session key supplied, sessions will not survive restarts or be shared by replicas")
+		sessionKey, err = dashboard.NewSessionKey()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	path := strings.TrimSuffix(parsedURL.Path, "/")
+	if path == "" {
+		path = dashboard.DefaultPath
+		parsedURL.Path = path
+	}
+	return dashboard.New(dashboard.Config{
+		Store: analysisStore,
+		OAuth: &oauth2.Config{
+			ClientID:     oauthClientID,
+			ClientSecret: strings.TrimSpace(string(clientSecret)),
+			Endpoint:     oauthgithub.Endpoint,
+			RedirectURL:  strings.TrimSuffix(parsedURL.String(), "/") + "/callback",
+			Scopes:       []string{dashboard.Scope},
+		},
+		SessionKey: sessionKey,
+		Path:       path,
+	})
+}
+
+func registerDashboardHandler() {
+	if communityHealthDashboard == nil {
+		return
+	}
+	log.Info().Msgf("Serving the dashboard on %s", communityHealthDashboard.Path())
+	http.Handle(communityHealthDashboard.Path(), communityHealthDashboard)
+	http.Handle(communityHealthDashboard.Path()+"/", communityHealthDashboard)
+}
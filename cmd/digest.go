@@ -0,0 +1,213 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	ghapi "github.com/google/go-github/v44/github"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"github.com/trstringer/comment-sentiment/pkg/digest"
+	gh "github.com/trstringer/comment-sentiment/pkg/github"
+	"github.com/trstringer/comment-sentiment/pkg/store"
+)
+
+var (
+	digestScheduleExpression string
+	digestTemplateFile       string
+	digestRepo               string
+	digestEnd                string
+	digestDryRun             bool
+)
+
+var digestCmd = &cobra.Command{
+	Use:   "digest",
+	Short: "Post the weekly community health digest now",
+	Long: `Compile the community health digest of the week from the analyses in the
+database, and post it to every repo that enables it in its
+.github/comment-sentiment.yaml:
+
+  digest:
+    post: discussion  # or issue
+    category: General # discussion category
+    labels: []        # issue labels
+
+The database can only be opened by one process at a time, so stop the server
+or use a copy of its database file. With --dry-run the digests are printed
+instead, for every repo with comments, and no GitHub App is needed.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if databaseFile == "" {
+			return fmt.Errorf("required parameter --database not supplied")
+		}
+		if !digestDryRun {
+			if appID <= 0 || appKeyFile == "" {
+				return fmt.Errorf("required parameters --app-id and --app-keyfile not supplied")
+			}
+			var err error
+			appKey, err = ioutil.ReadFile(appKeyFile)
+			if err != nil {
+				return fmt.Errorf("error reading app key file: %w", err)
+			}
+		}
+
+		end := time.Now().UTC()
+		if digestEnd != "" {
+			var err error
+			end, err = time.Parse("2006-01-02", digestEnd)
+			if err != nil {
+				return fmt.Errorf("invalid --end %s, expected YYYY-MM-DD", digestEnd)
+			}
+		}
+
+		template, err := loadDigestTemplate()
+		if err != nil {
+			return fmt.Errorf("error loading digest template: %w", err)
+		}
+		db, err := store.OpenBolt(databaseFile)
+		if err != nil {
+			return fmt.Errorf("error opening database: %w", err)
+		}
+		defer db.Close()
+
+		var out io.Writer
+		if digestDryRun {
+			out = os.Stdout
+		}
+		if err := runDigests(context.Background(), db, template, end, digestRepo, out); err != nil {
+			return fmt.Errorf("error posting digests: %w", err)
+		}
+		return nil
+	},
+}
+
+func init() {
+	digestCmd.Flags().StringVar(&databaseFile, "database", "", "database file of the server")
+	digestCmd.Flags().IntVar(&appID, "app-id", 0, "GitHub App ID")
+	digestCmd.Flags().StringVarP(&appKeyFile, "app-keyfile", "a", "", "GitHub App key file path")
+	digestCmd.Flags().StringVar(&digestTemplateFile, "digest-template", "", "Go template file that defines the \"title\" and \"body\" of the digest")
+	digestCmd.Flags().StringVar(&digestRepo, "repo", "", "only compile the digest of this repo, such as octo/repo")
+	digestCmd.Flags().StringVar(&digestEnd, "end", "", "end of the week as YYYY-MM-DD, now by default")
+	digestCmd.Flags().BoolVar(&digestDryRun, "dry-run", false, "print the digests instead of posting them")
+	addShadowFlags(digestCmd)
+	rootCmd.AddCommand(digestCmd)
+}
+
+func loadDigestTemplate() (*digest.Template, error) {
+	if digestTemplateFile == "" {
+		return digest.DefaultTemplate(), nil
+	}
+	text, err := ioutil.ReadFile(digestTemplateFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading digest template: %w", err)
+	}
+	return digest.ParseTemplate(string(text))
+}
+
+// runDigests compiles the digest of the week that ends at end for every repo
+// with comments in it, or only for onlyRepo if it is set. The digests are
+// posted to the repos that enable them, or written to out instead if it is
+// not nil.
+func runDigests(ctx context.Context, analyses store.AnalysisRepository, template *digest.Template, end time.Time, onlyRepo string, out io.Writer) error {
+	records, err := analyses.ListAnalyses(ctx, store.Filter{
+		Repo:  onlyRepo,
+		Since: end.Add(-2 * digest.Period),
+		Until: end,
+	})
+	if err != nil {
+		return fmt.Errorf("error reading analyses: %w", err)
+	}
+
+	repos := map[string]bool{}
+	for _, record := range records {
+		if !record.AnalyzedAt.Before(end.Add(-digest.Period)) {
+			repos[record.Repo] = true
+		}
+	}
+	repoNames := []string{}
+	for repo := range repos {
+		repoNames = append(repoNames, repo)
+	}
+	sort.Strings(repoNames)
+
+	clients := map[string]*ghapi.Client{}
+	failed := 0
+	for _, repoName := range repoNames {
+		title, body, err := template.Render(digest.Compile(repoName, records, end))
+		if err != nil {
+			return err
+		}
+		if out != nil {
+			fmt.Fprintf(out, "# %s\n\n%s\n", title, body)
+			continue
+		}
+
+		if err := postDigest(ctx, clients, repoName, title, body); err != nil {
+			log.Error().Err(err).Msgf("Error posting digest of %s", repoName)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d digests failed", failed, len(repoNames))
+	}
+	return nil
+}
+
+func postDigest(ctx context.Context, clients map[string]*ghapi.Client, repoName, title, body string) error {
+	ownerLogin, name, _ := strings.Cut(repoName, "/")
+	repo := gh.Repository{FullName: repoName, Name: name, Owner: gh.RepositoryOwner{Login: ownerLogin}}
+
+	client, ok := clients[ownerLogin]
+	if !ok {
+		var err error
+		appID, appKey := currentAppCredentials()
+		client, err = gh.NewInstallationGitHubClient(appID, appKey, repo.Owner)
+		if err != nil {
+			return fmt.Errorf("error creating GitHub client: %w", err)
+		}
+		clients[ownerLogin] = client
+	}
+
+	repoConfig, err := gh.LoadRepoConfig(ctx, client, repo)
+	if err != nil {
+		return err
+	}
+	if repoConfig.Digest.Post == "" {
+		log.Debug().Msgf("Digest is not enabled for %s, skipping", repoName)
+		return nil
+	}
+	if inShadowMode(repo, repoConfig) {
+		log.Info().Msgf("Shadow mode, not posting digest of %s: %q\n%s", repoName, title, body)
+		return nil
+	}
+
+	url, err := gh.PostDigest(ctx, client, repo, repoConfig.Digest, title, body)
+	if err != nil {
+		return err
+	}
+	log.Info().Msgf("Posted digest of %s to %s", repoName, url)
+	return nil
+}
+
+// scheduleDigests posts the digests on the schedule until the server stops.
+func scheduleDigests(schedule digest.Schedule, template *digest.Template) {
+	for {
+		next := schedule.Next(time.Now())
+		if next.IsZero() {
+			log.Error().Msg("Digest schedule never matches, no digests will be posted")
+			return
+		}
+		log.Info().Msgf("Next digest at %s", next)
+		time.Sleep(time.Until(next))
+
+		if err := runDigests(context.Background(), analysisStore, template, next, "", nil); err != nil {
+			log.Error().Err(err).Msg("Error posting scheduled digests")
+		}
+	}
+}
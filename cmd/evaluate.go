@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	sa "github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer"
+	"github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer/bayes"
+)
+
+var (
+	evaluateModelFile  string
+	evaluateCorpusFile string
+)
+
+var evaluateCmd = &cobra.Command{
+	Use:   "evaluate",
+	Short: "Evaluate a bayes model against a held-out corpus",
+	Long: `Evaluate a model created by the train command against a held-out corpus
+and report the precision, recall and F1 of each sentiment. The corpus has the
+same format as the one used for training.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if evaluateModelFile == "" || evaluateCorpusFile == "" {
+			return fmt.Errorf("required parameters --model and --corpus not supplied")
+		}
+
+		model, err := bayes.LoadFile(evaluateModelFile)
+		if err != nil {
+			return fmt.Errorf("error loading model: %w", err)
+		}
+		examples, err := bayes.LoadCorpus(evaluateCorpusFile)
+		if err != nil {
+			return fmt.Errorf("error loading corpus: %w", err)
+		}
+
+		evaluation := model.Evaluate(examples)
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "SENTIMENT\tPRECISION\tRECALL\tF1\tSUPPORT")
+		for _, sentiment := range []sa.Sentiment{sa.Positive, sa.Negative, sa.Neutral} {
+			metrics := evaluation.Classes[sentiment]
+			fmt.Fprintf(
+				writer,
+				"%s\t%.3f\t%.3f\t%.3f\t%d\n",
+				sentiment,
+				metrics.Precision,
+				metrics.Recall,
+				metrics.F1,
+				metrics.Support,
+			)
+		}
+		// nolint: errcheck
+		writer.Flush()
+
+		fmt.Printf("\nExamples: %d\nAccuracy: %.3f\nMacro F1: %.3f\n", evaluation.Examples, evaluation.Accuracy, evaluation.MacroF1)
+		return nil
+	},
+}
+
+func init() {
+	evaluateCmd.Flags().StringVar(&evaluateModelFile, "model", "", "model file created by the train command")
+	evaluateCmd.Flags().StringVar(&evaluateCorpusFile, "corpus", "", "held-out labeled corpus file (.jsonl or .csv)")
+	rootCmd.AddCommand(evaluateCmd)
+}
@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"github.com/trstringer/comment-sentiment/pkg/export"
+	"github.com/trstringer/comment-sentiment/pkg/store"
+)
+
+var (
+	exportFormat     string
+	exportOutputFile string
+	exportRepo       string
+	exportAuthor     string
+	exportSentiment  string
+	exportSince      string
+	exportUntil      string
+	exportAnonymize  bool
+	anonymizeKeyFile string
+	anonymizeKey     []byte
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the stored analyses as CSV or JSONL",
+	Long: `Export the analyses in the database as CSV or JSONL, oldest first. The
+server has the same export at /api/v1/export for the analytics token.
+
+With --anonymize, logins are hashed and the text of the comments is left out.
+Hashes are keyed with --anonymize-keyfile if it is supplied, so that they
+cannot be reversed by hashing known logins.
+
+The database can only be opened by one process at a time, so stop the server
+or use a copy of its database file.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if databaseFile == "" {
+			return fmt.Errorf("required parameter --database not supplied")
+		}
+		format, err := export.ParseFormat(exportFormat)
+		if err != nil {
+			return fmt.Errorf("invalid --format: %w", err)
+		}
+		filter := store.Filter{Repo: exportRepo, Author: exportAuthor, Sentiment: exportSentiment}
+		if filter.Since, err = parseQueryTime(exportSince); err != nil {
+			return fmt.Errorf("invalid --since: %w", err)
+		}
+		if filter.Until, err = parseQueryTime(exportUntil); err != nil {
+			return fmt.Errorf("invalid --until: %w", err)
+		}
+		if err := readAnonymizeKey(); err != nil {
+			return err
+		}
+
+		db, err := store.OpenBolt(databaseFile)
+		if err != nil {
+			return fmt.Errorf("error opening database: %w", err)
+		}
+		defer db.Close()
+
+		var out io.Writer = os.Stdout
+		if exportOutputFile != "" && exportOutputFile != "-" {
+			file, err := os.Create(exportOutputFile)
+			if err != nil {
+				return fmt.Errorf("error creating output file: %w", err)
+			}
+			defer file.Close()
+			out = file
+		}
+		buffered := bufio.NewWriter(out)
+
+		count, err := exportAnalyses(context.Background(), db, filter, buffered, format, exportAnonymize)
+		if err == nil {
+			err = buffered.Flush()
+		}
+		if err != nil {
+			return fmt.Errorf("error exporting analyses: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Exported %d analyses\n", count)
+		return nil
+	},
+}
+
+func init() {
+	exportCmd.Flags().StringVar(&databaseFile, "database", "", "database file of the server")
+	exportCmd.Flags().StringVar(&exportFormat, "format", string(export.CSV), "csv or jsonl")
+	exportCmd.Flags().StringVarP(&exportOutputFile, "output", "o", "", "file to write the export to, stdout by default")
+	exportCmd.Flags().StringVar(&exportRepo, "repo", "", "only export the analyses of this repo, such as octo/repo")
+	exportCmd.Flags().StringVar(&exportAuthor, "author", "", "only export the analyses of comments by this login")
+	exportCmd.Flags().StringVar(&exportSentiment, "sentiment", "", "only export analyses with this sentiment")
+	exportCmd.Flags().StringVar(&exportSince, "since", "", "only export analyses from this date on, as YYYY-MM-DD or RFC 3339")
+	exportCmd.Flags().StringVar(&exportUntil, "until", "", "only export analyses before this date, as YYYY-MM-DD or RFC 3339")
+	exportCmd.Flags().BoolVar(&exportAnonymize, "anonymize", false, "hash logins and leave out the comment text")
+	exportCmd.Flags().StringVar(&anonymizeKeyFile, "anonymize-keyfile", "", "file storing the key that anonymized logins are hashed with")
+	rootCmd.AddCommand(exportCmd)
+}
+
+func readAnonymizeKey() error {
+	if anonymizeKeyFile == "" {
+		return nil
+	}
+	key, err := ioutil.ReadFile(anonymizeKeyFile)
+	if err != nil {
+		return fmt.Errorf("error reading anonymize key file: %w", err)
+	}
+	anonymizeKey = []byte(strings.TrimSpace(string(key)))
+	return nil
+}
+
+// exportAnalyses writes the analyses selected by the filter to out, and
+// returns how many were written.
+func exportAnalyses(ctx context.Context, analyses store.AnalysisRepository, filter store.Filter, out io.Writer, format export.Format, anonymize bool) (int, error) {
+	var anonymizer *export.Anonymizer
+	if anonymize {
+		anonymizer = export.NewAnonymizer(anonymizeKey)
+	}
+	writer := export.NewWriter(out, format, anonymizer)
+
+	count := 0
+	err := analyses.EachAnalysis(ctx, filter, func(record store.AnalysisRecord) error {
+		count++
+		return writer.Write(record)
+	})
+	if err != nil {
+		return count, err
+	}
+	return count, writer.Flush()
+}
+
+func handleExportRequest(resp http.ResponseWriter, req *http.Request) {
+	adminToken, analyticsToken := currentTokens()
+	if !hasBearerToken(req, analyticsToken, adminToken) {
+		writeJSONError(resp, http.StatusUnauthorized, "Unauthorized access denied")
+		return
+	}
+	if req.Method != http.MethodGet {
+		writeJSONError(resp, http.StatusMethodNotAllowed, "Only GET supported")
+		return
+	}
+	if analysisStore == nil {
+		writeJSONError(resp, http.StatusNotFound, "No database configured")
+		return
+	}
+
+	query := req.URL.Query()
+	format := export.CSV
+	if rawFormat := query.Get("format"); rawFormat != "" {
+		var err error
+		if format, err = export.ParseFormat(rawFormat); err != nil {
+			writeJSONError(resp, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	anonymize := false
+	if rawAnonymize := query.Get("anonymize"); rawAnonymize != "" {
+		var err error
+		if anonymize, err = strconv.ParseBool(rawAnonymize); err != nil {
+			writeJSONError(resp, http.StatusBadRequest, fmt.Sprintf("invalid anonymize %s", rawAnonymize))
+			return
+		}
+	}
+	filter, err := filterFromQuery(req)
+	if err != nil {
+		writeJSONError(resp, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	resp.Header().Set("Content-Type", format.ContentType())
+	resp.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=analyses.%s", format))
+	// The status is sent with the first record, so an error while streaming
+	// can only cut the export short.
+	count, err := exportAnalyses(req.Context(), analysisStore, filter, resp, format, anonymize)
+	if err != nil {
+		log.Error().Err(err).Msgf("Error exporting analyses after %d records", count)
+		return
+	}
+	log.Info().Msgf("Exported %d analyses", count)
+}
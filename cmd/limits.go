@@ -0,0 +1,256 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	gh "github.com/trstringer/comment-sentiment/pkg/github"
+	"github.com/trstringer/comment-sentiment/pkg/metrics"
+	"github.com/trstringer/comment-sentiment/pkg/ratelimit"
+	sa "github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer"
+	"github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer/provider"
+	"github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer/toxicity"
+)
+
+// overflowAction is what happens to a comment over a rate limit.
+type overflowAction string
+
+const (
+	// overflowDrop rejects the delivery. GitHub does not redeliver failed
+	// deliveries by itself, so the comment is not analyzed unless it is
+	// redelivered by hand.
+	overflowDrop overflowAction = "drop"
+	// overflowQueue processes the comment once it is within the limits.
+	// Queued comments are lost on restart.
+	overflowQueue overflowAction = "queue"
+	// overflowOffline analyzes the comment with the offline provider.
+	overflowOffline overflowAction = "offline"
+)
+
+func parseOverflowAction(name string) (overflowAction, error) {
+	switch action := overflowAction(name); action {
+	case overflowDrop, overflowQueue, overflowOffline:
+		return action, nil
+	}
+	return "", fmt.Errorf("unknown action %s, expected drop, queue or offline", name)
+}
+
+var (
+	webhookMaxBodyBytes   int64
+	installationRateLimit string
+	repoRateLimit         string
+	rateLimitActionName   string
+	installationLimiter   = ratelimit.NewLimiter(ratelimit.Rate{})
+	repoLimiter           = ratelimit.NewLimiter(ratelimit.Rate{})
+	rateLimitAction       = overflowDrop
+	// rateLimitOfflineSvc analyzes the comments over a rate limit with
+	// --rate-limit-action offline.
+	rateLimitOfflineSvc sa.Analyzer
+	rateLimitQueue      = &commentQueue{name: "rate_limit", max: maxQueuedComments}
+)
+
+// addLimitFlags adds the flags that limit the size of webhook deliveries and
+// how many comments each installation and repo can have analyzed.
+func addLimitFlags(cmd *cobra.Command) {
+	cmd.Flags().Int64Var(&webhookMaxBodyBytes, "webhook-max-body-bytes", 1024*1024, "largest webhook delivery accepted, raise it up to GitHub's 25 MB cap if larger deliveries are rejected")
+	cmd.Flags().StringVar(&installationRateLimit, "installation-rate-limit", "", "comments analyzed for each installation, such as '600/hour', empty for no limit")
+	cmd.Flags().StringVar(&repoRateLimit, "repo-rate-limit", "", "comments analyzed for each repo, such as '100/hour', empty for no limit")
+	cmd.Flags().StringVar(&rateLimitActionName, "rate-limit-action", string(overflowDrop), "what to do with comments over a rate limit: drop them with 429 Too Many Requests (GitHub does not redeliver them, so they are never analyzed), queue them until they are within the limits (queued comments are lost on restart), or analyze them with the offline provider")
+}
+
+// newRateLimiters creates the installation and repo rate limiters from the
+// flags.
+func newRateLimiters() (*ratelimit.Limiter, *ratelimit.Limiter, error) {
+	installationRate, err := ratelimit.ParseRate(installationRateLimit)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid --installation-rate-limit: %w", err)
+	}
+	repoRate, err := ratelimit.ParseRate(repoRateLimit)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid --repo-rate-limit: %w", err)
+	}
+	return ratelimit.NewLimiter(installationRate), ratelimit.NewLimiter(repoRate), nil
+}
+
+// newRateLimitOfflineAnalyzer creates the offline provider that analyzes the
+// comments over a rate limit, or returns nil unless --rate-limit-action is
+// offline.
+func newRateLimitOfflineAnalyzer() (sa.Analyzer, error) {
+	if rateLimitAction != overflowOffline {
+		return nil, nil
+	}
+	providerConfig, err := providerConfigFromFlags()
+	if err != nil {
+		return nil, err
+	}
+	analyzer, err := provider.New(offlineProvider, providerConfig)
+	if err != nil {
+		return nil, fmt.Errorf("error setting up offline provider: %w", err)
+	}
+	if localToxicity {
+		analyzer = toxicity.NewAnalyzer(analyzer, toxicity.NewClassifier())
+	}
+	return analyzer, nil
+}
+
+// setupRateLimits sets the rate limiters, the overflow action and its offline
+// provider from the flags.
+func setupRateLimits() error {
+	action, err := parseOverflowAction(rateLimitActionName)
+	if err != nil {
+		return fmt.Errorf("invalid --rate-limit-action: %w", err)
+	}
+	installation, repo, err := newRateLimiters()
+	if err != nil {
+		return err
+	}
+	rateLimitAction = action
+	offline, err := newRateLimitOfflineAnalyzer()
+	if err != nil {
+		return err
+	}
+	installationLimiter, repoLimiter, rateLimitOfflineSvc = installation, repo, offline
+	return nil
+}
+
+// rateLimit is a limit that a comment counts towards.
+type rateLimit struct {
+	name    string
+	limiter *ratelimit.Limiter
+	key     string
+}
+
+// commentRateLimits returns the installation and repo limits of the comment.
+func commentRateLimits(commentPayload gh.CommentPayload) []rateLimit {
+	reloadMu.RLock()
+	installation, repo := installationLimiter, repoLimiter
+	reloadMu.RUnlock()
+
+	return []rateLimit{
+		{"installation", installation, commentPayload.InstallationKey()},
+		{"repo", repo, strings.ToLower(commentPayload.Repository.FullName)},
+	}
+}
+
+// takeRateLimits takes a token from each of the limits. Unless reserve is
+// set, it stops at the first limit that has no token left. It returns the
+// limit that was hit, installation or repo, and how long until the comment is
+// within it, or an empty limit when the comment is within every limit.
+func takeRateLimits(limits []rateLimit, reserve bool) (string, time.Duration) {
+	hit, longest := "", time.Duration(0)
+	for _, limit := range limits {
+		wait := time.Duration(0)
+		if reserve {
+			wait = limit.limiter.Reserve(limit.key)
+		} else if ok, next := limit.limiter.Allow(limit.key); !ok {
+			wait = next
+		}
+		if wait > longest {
+			hit, longest = limit.name, wait
+		}
+		if hit != "" && !reserve {
+			break
+		}
+	}
+	return hit, longest
+}
+
+// cancelRateLimits gives back the tokens reserved from each of the limits.
+func cancelRateLimits(limits []rateLimit) {
+	for _, limit := range limits {
+		limit.limiter.Cancel(limit.key)
+	}
+}
+
+// limitComment applies the rate limits to the comment of a delivery. A
+// comment over a limit is dropped or queued, and the response is written, or
+// it is analyzed offline with the returned context. It indicates if the
+// delivery was handled.
+func limitComment(ctx context.Context, resp http.ResponseWriter, commentPayload gh.CommentPayload) (context.Context, bool) {
+	reloadMu.RLock()
+	action, offline := rateLimitAction, rateLimitOfflineSvc
+	reloadMu.RUnlock()
+
+	// Queued comments reserve their tokens, so that they are processed at the
+	// rate once they are released.
+	limits := commentRateLimits(commentPayload)
+	limit, wait := takeRateLimits(limits, action == overflowQueue)
+	if limit == "" {
+		return ctx, false
+	}
+
+	switch {
+	case action == overflowQueue && rateLimitQueue.add(commentPayload, time.Now().Add(wait)):
+		metrics.WebhookLimitHits.WithLabelValues(limit, string(overflowQueue)).Inc()
+		log.Info().Msgf("Comment %d is over the %s rate limit, queued for %s", commentPayload.Comment.ID, limit, wait.Round(time.Second))
+		resp.WriteHeader(http.StatusAccepted)
+		// nolint: errcheck
+		resp.Write([]byte("queued"))
+		return ctx, true
+	case action == overflowQueue:
+		// The queue is full, so the comment is dropped and its reserved
+		// tokens are given back, so that a flood does not keep the limits
+		// throttled after it stops.
+		cancelRateLimits(limits)
+	case action == overflowOffline && offline != nil:
+		metrics.WebhookLimitHits.WithLabelValues(limit, string(overflowOffline)).Inc()
+		log.Warn().Msgf("Comment %d is over the %s rate limit, using the offline provider", commentPayload.Comment.ID, limit)
+		return withOfflineAnalyzer(ctx, offline), false
+	}
+
+	metrics.WebhookLimitHits.WithLabelValues(limit, string(overflowDrop)).Inc()
+	log.Warn().Msgf("Comment %d is over the %s rate limit, dropping it", commentPayload.Comment.ID, limit)
+	resp.Header().Set("Retry-After", retryAfter(wait))
+	resp.WriteHeader(http.StatusTooManyRequests)
+	// nolint: errcheck
+	resp.Write([]byte(fmt.Sprintf("Rate limit of the %s exceeded, retry in %s", limit, wait.Round(time.Second))))
+	return ctx, true
+}
+
+type offlineAnalyzerKey struct{}
+
+// withOfflineAnalyzer makes the comment analyzed in ctx be analyzed by the
+// offline analyzer instead of the configured provider.
+func withOfflineAnalyzer(ctx context.Context, analyzer sa.Analyzer) context.Context {
+	return context.WithValue(ctx, offlineAnalyzerKey{}, analyzer)
+}
+
+func offlineAnalyzerFromContext(ctx context.Context) (sa.Analyzer, bool) {
+	analyzer, ok := ctx.Value(offlineAnalyzerKey{}).(sa.Analyzer)
+	return analyzer, ok
+}
+
+// retryAfter formats a wait as the seconds of a Retry-After header.
+func retryAfter(wait time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(wait.Seconds())))
+}
+
+// errBodyTooLarge is returned by readBody for bodies over the limit.
+var errBodyTooLarge = errors.New("request body is too large")
+
+// readBody reads the body of the request, or returns errBodyTooLarge without
+// reading more than maxBytes of it.
+func readBody(req *http.Request, maxBytes int64) ([]byte, error) {
+	if req.ContentLength > maxBytes {
+		return nil, errBodyTooLarge
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(req.Body, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > maxBytes {
+		return nil, errBodyTooLarge
+	}
+	return body, nil
+}
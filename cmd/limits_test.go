@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	gh "github.com/trstringer/comment-sentiment/pkg/github"
+	"github.com/trstringer/comment-sentiment/pkg/ratelimit"
+	sa "github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer"
+)
+
+func TestLimitComment(t *testing.T) {
+	commentPayload := gh.CommentPayload{
+		Comment:      gh.Comment{ID: 1},
+		Repository:   gh.Repository{FullName: "octo/repo"},
+		Installation: &gh.Installation{ID: 2},
+	}
+
+	testCases := []struct {
+		name              string
+		action            overflowAction
+		exceeded          bool
+		queueMax          int
+		expectedHandled   bool
+		expectedOffline   bool
+		expectedStatus    int
+		expectedRetryWait string
+		expectedNextWait  time.Duration
+	}{
+		{
+			name:   "within_limits",
+			action: overflowDrop,
+		},
+		{
+			name:              "drop",
+			action:            overflowDrop,
+			exceeded:          true,
+			expectedHandled:   true,
+			expectedStatus:    http.StatusTooManyRequests,
+			expectedRetryWait: "3600",
+			expectedNextWait:  time.Hour,
+		},
+		{
+			name:             "queue",
+			action:           overflowQueue,
+			exceeded:         true,
+			queueMax:         1,
+			expectedHandled:  true,
+			expectedStatus:   http.StatusAccepted,
+			expectedNextWait: 2 * time.Hour,
+		},
+		{
+			name:              "queue_full",
+			action:            overflowQueue,
+			exceeded:          true,
+			expectedHandled:   true,
+			expectedStatus:    http.StatusTooManyRequests,
+			expectedRetryWait: "3600",
+			// The reserved token is given back when the comment is dropped.
+			expectedNextWait: time.Hour,
+		},
+		{
+			name:            "offline",
+			action:          overflowOffline,
+			exceeded:        true,
+			expectedOffline: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			previousInstallation, previousRepo := installationLimiter, repoLimiter
+			previousAction, previousOffline, previousQueue := rateLimitAction, rateLimitOfflineSvc, rateLimitQueue
+			t.Cleanup(func() {
+				installationLimiter, repoLimiter = previousInstallation, previousRepo
+				rateLimitAction, rateLimitOfflineSvc, rateLimitQueue = previousAction, previousOffline, previousQueue
+			})
+
+			installationLimiter = ratelimit.NewLimiter(ratelimit.Rate{Limit: 1, Period: time.Hour})
+			repoLimiter = ratelimit.NewLimiter(ratelimit.Rate{})
+			if testCase.exceeded {
+				installationLimiter.Allow(commentPayload.InstallationKey())
+			}
+			rateLimitAction = testCase.action
+			rateLimitOfflineSvc = &fakeAnalyzer{analysis: sa.Analysis{Sentiment: sa.Neutral}}
+			// The queued comment is only reprocessed after the test is done.
+			rateLimitQueue = &commentQueue{name: "rate_limit", max: testCase.queueMax}
+
+			resp := httptest.NewRecorder()
+			ctx, handled := limitComment(context.Background(), resp, commentPayload)
+
+			if handled != testCase.expectedHandled {
+				t.Fatalf("Unexpected handled %t", handled)
+			}
+			if _, offline := offlineAnalyzerFromContext(ctx); offline != testCase.expectedOffline {
+				t.Fatalf("Unexpected offline analyzer %t", offline)
+			}
+			if !handled {
+				return
+			}
+			if resp.Code != testCase.expectedStatus {
+				t.Fatalf("Unexpected status %d, expected %d: %s", resp.Code, testCase.expectedStatus, resp.Body.String())
+			}
+			if retryAfter := resp.Header().Get("Retry-After"); retryAfter != testCase.expectedRetryWait {
+				t.Fatalf("Unexpected Retry-After %q, expected %q", retryAfter, testCase.expectedRetryWait)
+			}
+			if _, next := installationLimiter.Allow(commentPayload.InstallationKey()); next.Round(time.Minute) != testCase.expectedNextWait {
+				t.Fatalf("Unexpected next wait %s, expected %s", next, testCase.expectedNextWait)
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"github.com/trstringer/comment-sentiment/pkg/ratelimit"
+	sa "github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer"
+)
+
+var (
+	manualDisabled     bool
+	manualKeysFile     string
+	manualKeys         []byte
+	manualRateLimit    string
+	manualMaxBodyBytes int64
+	manualLimiter      = ratelimit.NewLimiter(ratelimit.Rate{})
+)
+
+// addManualFlags adds the flags of the /manual endpoint, which analyzes text
+// sent to it with the configured provider.
+func addManualFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&manualDisabled, "disable-manual", false, "disable the /manual endpoint")
+	cmd.Flags().StringVar(&manualKeysFile, "manual-keysfile", "", "file storing the API keys of the /manual endpoint, one '<name> <key>' per line, the admin token is also accepted")
+	cmd.Flags().StringVar(&manualRateLimit, "manual-rate-limit", "60/minute", "requests to the /manual endpoint allowed for each API key, such as '60/minute', 0 for no limit")
+	cmd.Flags().Int64Var(&manualMaxBodyBytes, "manual-max-body-bytes", 64*1024, "largest request body the /manual endpoint accepts")
+}
+
+// newManualLimiter creates the rate limiter of the API keys from
+// --manual-rate-limit.
+func newManualLimiter() (*ratelimit.Limiter, error) {
+	rate, err := ratelimit.ParseRate(manualRateLimit)
+	if err != nil {
+		return nil, err
+	}
+	return ratelimit.NewLimiter(rate), nil
+}
+
+// apiKey is a key of the /manual endpoint. The name identifies the key in
+// logs and rate limits without revealing it.
+type apiKey struct {
+	name string
+	key  []byte
+}
+
+// parseAPIKeys parses one '<name> <key>' per line. Empty lines and lines
+// starting with # are skipped.
+func parseAPIKeys(data []byte) ([]apiKey, error) {
+	keys := []apiKey{}
+	names := map[string]bool{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d of API keys: expected '<name> <key>'", line)
+		}
+		if names[fields[0]] {
+			return nil, fmt.Errorf("line %d of API keys: duplicate name %s", line, fields[0])
+		}
+		names[fields[0]] = true
+		keys = append(keys, apiKey{name: fields[0], key: []byte(fields[1])})
+	}
+	return keys, scanner.Err()
+}
+
+// matchAPIKey returns the name of the key that matches token, comparing
+// every key in constant time.
+func matchAPIKey(token []byte, keys []apiKey) (string, bool) {
+	name, matched := "", false
+	for _, key := range keys {
+		if len(token) > 0 && subtle.ConstantTimeCompare(token, key.key) == 1 && !matched {
+			name, matched = key.name, true
+		}
+	}
+	return name, matched
+}
+
+// manualResponse is the JSON response of the /manual endpoint.
+type manualResponse struct {
+	Sentiment  string             `json:"sentiment"`
+	Confidence float32            `json:"confidence"`
+	Sentences  []analyzeSentence  `json:"sentences"`
+	Toxicity   map[string]float32 `json:"toxicity,omitempty"`
+	Degraded   bool               `json:"degraded,omitempty"`
+}
+
+// handleManualSentimentRequest analyzes the text of the request body, or the
+// text field of a JSON body. It requires an API key, as a bearer token or in
+// the X-API-Key header, and responds with JSON when the request is JSON or
+// accepts it.
+func handleManualSentimentRequest(resp http.ResponseWriter, req *http.Request) {
+	reloadMu.RLock()
+	disabled, rawKeys, maxBodyBytes, admin, limiter := manualDisabled, manualKeys, manualMaxBodyBytes, adminToken, manualLimiter
+	reloadMu.RUnlock()
+
+	jsonRequest := hasMediaType(req.Header.Get("Content-Type"), "application/json")
+	jsonResponse := jsonRequest || strings.Contains(req.Header.Get("Accept"), "application/json")
+	writeError := func(status int, message string) {
+		if jsonResponse {
+			writeJSONError(resp, status, message)
+			return
+		}
+		resp.WriteHeader(status)
+		// nolint: errcheck
+		resp.Write([]byte(message))
+	}
+
+	if disabled {
+		http.NotFound(resp, req)
+		return
+	}
+	if req.Method != http.MethodPost {
+		resp.Header().Set("Allow", http.MethodPost)
+		writeError(http.StatusMethodNotAllowed, "Only POST supported")
+		return
+	}
+
+	// The keys were checked when they were loaded.
+	keys, _ := parseAPIKeys(rawKeys)
+	if len(admin) > 0 {
+		keys = append(keys, apiKey{name: "admin", key: admin})
+	}
+	keyName, ok := matchAPIKey(requestToken(req), keys)
+	if !ok {
+		writeError(http.StatusUnauthorized, "Unauthorized access denied")
+		return
+	}
+
+	if allowed, wait := limiter.Allow(keyName); !allowed {
+		resp.Header().Set("Retry-After", retryAfter(wait))
+		writeError(http.StatusTooManyRequests, fmt.Sprintf("Rate limit exceeded, retry in %s", wait.Round(time.Second)))
+		log.Warn().Msgf("API key %s exceeded the /manual rate limit", keyName)
+		return
+	}
+
+	if req.Body == nil {
+		writeError(http.StatusBadRequest, "Missing request body")
+		return
+	}
+	defer req.Body.Close()
+	body, err := readBody(req, maxBodyBytes)
+	if errors.Is(err, errBodyTooLarge) {
+		writeError(http.StatusRequestEntityTooLarge, fmt.Sprintf("Request body is larger than %d bytes", maxBodyBytes))
+		return
+	}
+	if err != nil {
+		writeError(http.StatusInternalServerError, "Error reading body of request")
+		return
+	}
+
+	text := string(body)
+	if jsonRequest {
+		request := struct {
+			Text *string `json:"text"`
+		}{}
+		if err := json.Unmarshal(body, &request); err != nil || request.Text == nil {
+			writeError(http.StatusBadRequest, "Expected a JSON object with a text field")
+			return
+		}
+		text = *request.Text
+	}
+	log.Info().Msgf("Received manual request to handle sentiment with API key %s", keyName)
+
+	analysis, err := currentAnalyzer().AnalyzeSentiment(req.Context(), sa.NormalizeComment(text))
+	if exceeded, ok := asBudgetExceeded(err); ok {
+		writeError(http.StatusTooManyRequests, exceeded.Error())
+		return
+	}
+	if err != nil {
+		writeError(http.StatusInternalServerError, "Error getting sentiment")
+		return
+	}
+	if analysis == nil {
+		writeError(http.StatusInternalServerError, "Unexpectedly no analysis returned")
+		return
+	}
+
+	if jsonResponse {
+		writeJSON(resp, http.StatusOK, newManualResponse(*analysis))
+		return
+	}
+	// nolint: errcheck
+	resp.Write([]byte(fmt.Sprintf(
+		"Analysis: %s - Confidence: %.2f",
+		analysis.Sentiment,
+		analysis.Confidence,
+	)))
+}
+
+func newManualResponse(analysis sa.Analysis) manualResponse {
+	response := manualResponse{
+		Sentiment:  analysis.Sentiment.String(),
+		Confidence: analysis.Confidence,
+		Sentences:  []analyzeSentence{},
+		Degraded:   analysis.Degraded,
+	}
+	for _, sentence := range analysis.SentenceAnalyses {
+		response.Sentences = append(response.Sentences, analyzeSentence{
+			Text:             sentence.Text,
+			Sentiment:        sentence.Sentiment.String(),
+			Confidence:       sentence.Confidence,
+			SuggestedRewrite: sentence.SuggestedRewrite,
+		})
+	}
+	if len(analysis.Toxicity) > 0 {
+		response.Toxicity = map[string]float32{}
+		for _, score := range analysis.Toxicity {
+			response.Toxicity[score.Category.String()] = score.Score
+		}
+	}
+	return response
+}
+
+func hasMediaType(contentType string, mediaType string) bool {
+	parsed, _, err := mime.ParseMediaType(contentType)
+	return err == nil && parsed == mediaType
+}
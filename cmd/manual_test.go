@@ -0,0 +1,248 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/trstringer/comment-sentiment/pkg/ratelimit"
+	sa "github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer"
+)
+
+type fakeAnalyzer struct {
+	analysis sa.Analysis
+}
+
+func (f *fakeAnalyzer) AnalyzeSentiment(ctx context.Context, text string) (*sa.Analysis, error) {
+	analysis := f.analysis
+	return &analysis, nil
+}
+
+// setManualConfig sets the configuration of the /manual endpoint for a test,
+// and restores it when the test is done.
+func setManualConfig(t *testing.T, disabled bool, maxBodyBytes int64, limiter *ratelimit.Limiter) {
+	previousDisabled, previousKeys, previousMaxBodyBytes := manualDisabled, manualKeys, manualMaxBodyBytes
+	previousAdmin, previousLimiter, previousSvc := adminToken, manualLimiter, sentimentSvc
+	t.Cleanup(func() {
+		manualDisabled, manualKeys, manualMaxBodyBytes = previousDisabled, previousKeys, previousMaxBodyBytes
+		adminToken, manualLimiter, sentimentSvc = previousAdmin, previousLimiter, previousSvc
+	})
+
+	manualDisabled, manualKeys, manualMaxBodyBytes = disabled, []byte("ci key1\n"), maxBodyBytes
+	adminToken, manualLimiter = []byte("admin1"), limiter
+	sentimentSvc = &fakeAnalyzer{analysis: sa.Analysis{Sentiment: sa.Positive, Confidence: 0.9}}
+}
+
+func TestHandleManualSentimentRequest(t *testing.T) {
+	testCases := []struct {
+		name           string
+		method         string
+		headers        map[string]string
+		body           string
+		unknownLength  bool
+		disabled       bool
+		rateLimited    bool
+		expectedStatus int
+		expectedBody   string
+		expectedHeader map[string]string
+	}{
+		{
+			name:           "missing_key",
+			method:         http.MethodPost,
+			body:           "thanks",
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   "Unauthorized access denied",
+		},
+		{
+			name:           "wrong_key",
+			method:         http.MethodPost,
+			headers:        map[string]string{"X-API-Key": "key2"},
+			body:           "thanks",
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   "Unauthorized access denied",
+		},
+		{
+			name:           "wrong_key_json",
+			method:         http.MethodPost,
+			headers:        map[string]string{"Authorization": "Bearer key2", "Accept": "application/json"},
+			body:           "thanks",
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   `{"error":"Unauthorized access denied"}`,
+		},
+		{
+			name:           "bearer_key",
+			method:         http.MethodPost,
+			headers:        map[string]string{"Authorization": "Bearer key1"},
+			body:           "thanks",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "Analysis: Positive - Confidence: 0.90",
+		},
+		{
+			name:           "x_api_key",
+			method:         http.MethodPost,
+			headers:        map[string]string{"X-API-Key": "key1"},
+			body:           "thanks",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "Analysis: Positive - Confidence: 0.90",
+		},
+		{
+			name:           "admin_token",
+			method:         http.MethodPost,
+			headers:        map[string]string{"Authorization": "Bearer admin1"},
+			body:           "thanks",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "Analysis: Positive - Confidence: 0.90",
+		},
+		{
+			name:           "get",
+			method:         http.MethodGet,
+			headers:        map[string]string{"X-API-Key": "key1"},
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectedBody:   "Only POST supported",
+			expectedHeader: map[string]string{"Allow": http.MethodPost},
+		},
+		{
+			name:           "too_large",
+			method:         http.MethodPost,
+			headers:        map[string]string{"X-API-Key": "key1"},
+			body:           "this is longer than the limit",
+			expectedStatus: http.StatusRequestEntityTooLarge,
+			expectedBody:   "Request body is larger than 24 bytes",
+		},
+		{
+			name:           "too_large_without_content_length",
+			method:         http.MethodPost,
+			headers:        map[string]string{"X-API-Key": "key1"},
+			body:           "this is longer than the limit",
+			unknownLength:  true,
+			expectedStatus: http.StatusRequestEntityTooLarge,
+			expectedBody:   "Request body is larger than 24 bytes",
+		},
+		{
+			name:           "rate_limited",
+			method:         http.MethodPost,
+			headers:        map[string]string{"X-API-Key": "key1"},
+			body:           "thanks",
+			rateLimited:    true,
+			expectedStatus: http.StatusTooManyRequests,
+			expectedBody:   "Rate limit exceeded, retry in 1h0m0s",
+			expectedHeader: map[string]string{"Retry-After": "3600"},
+		},
+		{
+			name:           "json_request",
+			method:         http.MethodPost,
+			headers:        map[string]string{"X-API-Key": "key1", "Content-Type": "application/json; charset=utf-8"},
+			body:           `{"text": "thanks"}`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"sentiment":"Positive","confidence":0.9,"sentences":[]}`,
+			expectedHeader: map[string]string{"Content-Type": "application/json"},
+		},
+		{
+			name:           "json_accept",
+			method:         http.MethodPost,
+			headers:        map[string]string{"X-API-Key": "key1", "Accept": "application/json"},
+			body:           "thanks",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"sentiment":"Positive","confidence":0.9,"sentences":[]}`,
+			expectedHeader: map[string]string{"Content-Type": "application/json"},
+		},
+		{
+			name:           "json_without_text",
+			method:         http.MethodPost,
+			headers:        map[string]string{"X-API-Key": "key1", "Content-Type": "application/json"},
+			body:           `{"body": "thanks"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"Expected a JSON object with a text field"}`,
+		},
+		{
+			name:           "disabled",
+			method:         http.MethodPost,
+			headers:        map[string]string{"X-API-Key": "key1"},
+			body:           "thanks",
+			disabled:       true,
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			limiter := ratelimit.NewLimiter(ratelimit.Rate{Limit: 1, Period: time.Hour})
+			if testCase.rateLimited {
+				limiter.Allow("ci")
+			}
+			setManualConfig(t, testCase.disabled, 24, limiter)
+
+			req := httptest.NewRequest(testCase.method, "/manual", strings.NewReader(testCase.body))
+			for name, value := range testCase.headers {
+				req.Header.Set(name, value)
+			}
+			if testCase.unknownLength {
+				req.ContentLength = -1
+			}
+			resp := httptest.NewRecorder()
+			handleManualSentimentRequest(resp, req)
+
+			if resp.Code != testCase.expectedStatus {
+				t.Fatalf("Unexpected status %d, expected %d: %s", resp.Code, testCase.expectedStatus, resp.Body.String())
+			}
+			if body := strings.TrimSpace(resp.Body.String()); testCase.expectedBody != "" && body != testCase.expectedBody {
+				t.Fatalf("Unexpected body %q, expected %q", body, testCase.expectedBody)
+			}
+			for name, value := range testCase.expectedHeader {
+				if header := resp.Header().Get(name); !strings.HasPrefix(header, value) {
+					t.Fatalf("Unexpected %s header %q, expected %q", name, header, value)
+				}
+			}
+		})
+	}
+}
+
+func TestReadBody(t *testing.T) {
+	testCases := []struct {
+		name          string
+		body          string
+		unknownLength bool
+		expectedErr   error
+	}{
+		{name: "within_limit", body: "12345"},
+		{name: "within_limit_without_content_length", body: "12345", unknownLength: true},
+		{name: "over_limit", body: "123456", expectedErr: errBodyTooLarge},
+		{name: "over_limit_without_content_length", body: "123456", unknownLength: true, expectedErr: errBodyTooLarge},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(testCase.body))
+			if testCase.unknownLength {
+				req.ContentLength = -1
+			}
+			body, err := readBody(req, 5)
+			if !errors.Is(err, testCase.expectedErr) {
+				t.Fatalf("Unexpected error %v, expected %v", err, testCase.expectedErr)
+			}
+			if err == nil && string(body) != testCase.body {
+				t.Fatalf("Unexpected body %q", body)
+			}
+		})
+	}
+}
+
+func TestReadBodyStopsAtLimit(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.ContentLength = -1
+	reader := strings.NewReader(strings.Repeat("a", 100))
+	req.Body = ioutil.NopCloser(reader)
+	if _, err := readBody(req, 5); !errors.Is(err, errBodyTooLarge) {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if read := 100 - reader.Len(); read != 6 {
+		t.Fatalf("Unexpected %d bytes read, expected 6", read)
+	}
+}
@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	gh "github.com/trstringer/comment-sentiment/pkg/github"
+	"github.com/trstringer/comment-sentiment/pkg/metrics"
+	sa "github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer"
+)
+
+var (
+	metricsPort     int
+	metricsMaxRepos int
+	// repoLabels bounds the repos that sentiments are counted by.
+	repoLabels = metrics.NewLabelLimit(0)
+)
+
+// webhookEvents are the webhook events that deliveries are counted by. Other
+// events are counted as other.
+var webhookEvents = map[string]bool{
+	"ping":                        true,
+	"issue_comment":               true,
+	"pull_request_review_comment": true,
+	"discussion_comment":          true,
+}
+
+// addMetricsFlags adds the flags of the /metrics endpoint.
+func addMetricsFlags(cmd *cobra.Command) {
+	cmd.Flags().IntVar(&metricsPort, "metrics-port", 0, "port to serve /metrics on without authentication, such as for scraping inside the cluster, 0 serves it on --port with the analytics or admin token")
+	cmd.Flags().IntVar(&metricsMaxRepos, "metrics-max-repos", 100, "repos that sentiments are counted by in the metrics, the comments of further repos are counted as other")
+}
+
+// registerMetricsHandler serves the Prometheus metrics at /metrics, on
+// --metrics-port if it is set, or else on the server's port to the holders
+// of the analytics or admin token, as the metrics name repos.
+func registerMetricsHandler() {
+	if metricsPort == 0 {
+		http.Handle("/metrics", requireMetricsToken(metrics.Handler()))
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	go func() {
+		log.Info().Msgf("Serving metrics on port %d", metricsPort)
+		if err := http.ListenAndServe(fmt.Sprintf(":%d", metricsPort), mux); err != nil {
+			log.Fatal().Msgf("Error creating metrics server: %v", err)
+		}
+	}()
+}
+
+// requireMetricsToken only lets requests with the analytics or admin token
+// through to handler.
+func requireMetricsToken(handler http.Handler) http.HandlerFunc {
+	return func(resp http.ResponseWriter, req *http.Request) {
+		adminToken, analyticsToken := currentTokens()
+		if !hasBearerToken(req, analyticsToken, adminToken) {
+			resp.WriteHeader(http.StatusUnauthorized)
+			// nolint: errcheck
+			resp.Write([]byte("Unauthorized access denied"))
+			return
+		}
+		handler.ServeHTTP(resp, req)
+	}
+}
+
+// statusRecorder records the status code of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// instrumentWebhook counts the deliveries that handler handles by event and
+// outcome, and records how long they take.
+func instrumentWebhook(handler http.HandlerFunc) http.HandlerFunc {
+	return func(resp http.ResponseWriter, req *http.Request) {
+		event := req.Header.Get(gh.EventHeader)
+		if !webhookEvents[event] {
+			event = metrics.OtherLabel
+		}
+
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: resp, status: http.StatusOK}
+		handler(recorder, req)
+
+		metrics.WebhookDeliverySeconds.WithLabelValues(event).Observe(time.Since(start).Seconds())
+		metrics.WebhookDeliveries.WithLabelValues(event, deliveryOutcome(recorder.status)).Inc()
+	}
+}
+
+// deliveryOutcome names the outcome of a delivery by the status code of its
+// response.
+func deliveryOutcome(status int) string {
+	switch {
+	case status == http.StatusAccepted:
+		return "queued"
+	case status < http.StatusBadRequest:
+		return "processed"
+	case status == http.StatusUnauthorized:
+		return "rejected"
+	case status == http.StatusRequestEntityTooLarge:
+		return "too_large"
+	case status == http.StatusTooManyRequests:
+		return "rate_limited"
+	case status < http.StatusInternalServerError:
+		return "invalid"
+	default:
+		return "error"
+	}
+}
+
+// countSentiment counts the analyzed comment by its repo and sentiment.
+func countSentiment(repo gh.Repository, analysis sa.Analysis) {
+	metrics.CommentSentiments.WithLabelValues(
+		repoLabels.Value(strings.ToLower(repo.FullName)),
+		strings.ToLower(analysis.Sentiment.String()),
+	).Inc()
+}
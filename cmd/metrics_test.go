@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireMetricsToken(t *testing.T) {
+	testCases := []struct {
+		name           string
+		authorization  string
+		expectedStatus int
+	}{
+		{name: "missing_token", expectedStatus: http.StatusUnauthorized},
+		{name: "wrong_token", authorization: "Bearer wrong", expectedStatus: http.StatusUnauthorized},
+		{name: "analytics_token", authorization: "Bearer analytics1", expectedStatus: http.StatusOK},
+		{name: "admin_token", authorization: "Bearer admin1", expectedStatus: http.StatusOK},
+	}
+
+	previousAdmin, previousAnalytics := adminToken, analyticsToken
+	t.Cleanup(func() {
+		adminToken, analyticsToken = previousAdmin, previousAnalytics
+	})
+	adminToken, analyticsToken = []byte("admin1"), []byte("analytics1")
+	handler := requireMetricsToken(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {}))
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if testCase.authorization != "" {
+				req.Header.Set("Authorization", testCase.authorization)
+			}
+			resp := httptest.NewRecorder()
+			handler(resp, req)
+			if resp.Code != testCase.expectedStatus {
+				t.Fatalf("Unexpected status %d, expected %d", resp.Code, testCase.expectedStatus)
+			}
+		})
+	}
+}
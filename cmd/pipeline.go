@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	ghapi "github.com/google/go-github/v44/github"
+	"github.com/rs/zerolog/log"
+
+	"github.com/trstringer/comment-sentiment/pkg/analytics"
+	"github.com/trstringer/comment-sentiment/pkg/budget"
+	gh "github.com/trstringer/comment-sentiment/pkg/github"
+	"github.com/trstringer/comment-sentiment/pkg/metrics"
+	sa "github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer"
+	"github.com/trstringer/comment-sentiment/pkg/store"
+)
+
+const repoConfigTTL time.Duration = 5 * time.Minute
+
+var repoConfigs = gh.NewRepoConfigCache(repoConfigTTL)
+
+// processComment analyzes the comment and updates it on GitHub when the repo
+// configuration asks for it. When the comment no longer qualifies, an analysis
+// from a previous version of the comment is removed. In shadow mode the edit is
+// recorded instead of made.
+func processComment(ctx context.Context, client *ghapi.Client, commentPayload gh.CommentPayload) error {
+	ctx = budget.WithInstallation(ctx, commentPayload.InstallationKey())
+
+	repoConfig, err := repoConfigs.Get(ctx, client, commentPayload.Repository)
+	if err != nil {
+		log.Warn().Err(err).Msgf("Error loading config for repo %s, using defaults", commentPayload.Repository.FullName)
+	}
+
+	log.Debug().Msg("Analyzing sentiment")
+	_, analysis, err := analyzeComment(ctx, commentPayload.Comment.Body)
+	if exceeded, ok := asBudgetExceeded(err); ok {
+		handleBudgetExceeded(commentPayload, exceeded)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if analysis == nil {
+		log.Debug().Msg("Comment has no text to analyze, skipping")
+		return nil
+	}
+	log.Debug().Msgf("Analysis result: %s", analysis.Sentiment.String())
+	countSentiment(commentPayload.Repository, *analysis)
+
+	annotate := repoConfig.ShouldAnnotate(*analysis)
+	shadow := inShadowMode(commentPayload.Repository, repoConfig)
+	newComment, edit, err := commentEdit(commentPayload.Comment.Body, *analysis, annotate)
+	if err != nil {
+		return err
+	}
+
+	record := newAnalysisRecord(commentPayload, *analysis, annotate)
+	if shadow {
+		record.Shadow = true
+		if edit {
+			record.ShadowComment = newComment
+		}
+	}
+	saveAnalysis(ctx, record)
+
+	switch {
+	case !edit:
+		log.Debug().Msgf("Comment does not match trigger %s, skipping", repoConfig.Trigger)
+		return nil
+	case annotate:
+		log.Debug().Msg("Updating comment")
+	default:
+		log.Debug().Msgf("Comment no longer matches trigger %s, removing analysis", repoConfig.Trigger)
+	}
+	return editComment(client, commentPayload, newComment, shadow)
+}
+
+// commentEdit returns the new text of the comment and whether it changed. An
+// annotated comment gets the analysis footer, and a comment that is not
+// annotated only loses the footer of a previous analysis, if it has one, so
+// that comments without one are left exactly as they were written.
+func commentEdit(body string, analysis sa.Analysis, annotate bool) (string, bool, error) {
+	if annotate {
+		newComment, err := gh.UpdateCommentWithSentiment(body, analysis)
+		if err != nil {
+			return "", false, fmt.Errorf("error updating comment text with sentiment: %w", err)
+		}
+		return newComment, newComment != body, nil
+	}
+	if !gh.HasCommentSentimentAnalysis(body) {
+		return body, false, nil
+	}
+	newComment, err := gh.TrimCommentSentimentAnalysis(body)
+	if err != nil {
+		return "", false, fmt.Errorf("error removing analysis from comment: %w", err)
+	}
+	return newComment, newComment != body, nil
+}
+
+// analyzeComment removes a previous analysis from the comment body, strips
+// its markdown and analyzes the text that is left. It returns the body without
+// the previous analysis, and a nil analysis if there is no text to analyze.
+func analyzeComment(ctx context.Context, body string) (string, *sa.Analysis, error) {
+	bodyTrimmed, err := gh.TrimCommentSentimentAnalysis(body)
+	if err != nil {
+		return "", nil, fmt.Errorf("error trimming comment body: %w", err)
+	}
+	text := sa.NormalizeComment(bodyTrimmed)
+	if text == "" {
+		return bodyTrimmed, nil, nil
+	}
+	analyzer, degraded := offlineAnalyzerFromContext(ctx)
+	if !degraded {
+		analyzer = currentAnalyzer()
+	}
+	analysis, err := analyzer.AnalyzeSentiment(ctx, text)
+	if err != nil {
+		return bodyTrimmed, nil, fmt.Errorf("error getting sentiment analysis: %w", err)
+	}
+	if degraded && analysis != nil {
+		analysis.Degraded = true
+	}
+	return bodyTrimmed, analysis, nil
+}
+
+// newAnalysisRecord creates the record of the analysis, with the provider
+// that made it.
+func newAnalysisRecord(commentPayload gh.CommentPayload, analysis sa.Analysis, annotated bool) store.AnalysisRecord {
+	reloadMu.RLock()
+	analysisProvider := providerName
+	if analysis.Degraded {
+		analysisProvider = offlineProvider
+	}
+	reloadMu.RUnlock()
+	return store.NewAnalysisRecord(commentPayload, analysis, analysisProvider, annotated)
+}
+
+// saveAnalysis records the analysis in the database, if there is one. Errors
+// are logged so that a database problem does not stop comments from being
+// analyzed.
+func saveAnalysis(ctx context.Context, record store.AnalysisRecord) {
+	if err := storeAnalysis(ctx, record); err != nil {
+		log.Error().Err(err).Msgf("Error saving analysis of comment %d", record.CommentID)
+	}
+}
+
+// storeAnalysis records the analysis in the database, if there is one.
+func storeAnalysis(ctx context.Context, record store.AnalysisRecord) error {
+	if analysisStore == nil {
+		return nil
+	}
+
+	if err := analysisStore.SaveAnalysis(ctx, &record); err != nil {
+		return err
+	}
+	recordOutcome(ctx, record)
+	return nil
+}
+
+// recordOutcome compares the analysis with the previous versions of the
+// comment, to track whether authors improve negative comments.
+func recordOutcome(ctx context.Context, record store.AnalysisRecord) {
+	history, err := analysisStore.CommentHistory(ctx, record.CommentKey())
+	if err != nil {
+		log.Error().Err(err).Msgf("Error getting history of comment %d", record.CommentID)
+		return
+	}
+
+	outcome := analytics.LatestOutcome(history)
+	switch {
+	case outcome.BecameNegative:
+		metrics.NegativeComments.Inc()
+	case outcome.Converted:
+		log.Info().Msgf(
+			"Negative comment %d was edited to be %s after %s",
+			record.CommentID,
+			outcome.Sentiment,
+			outcome.Duration,
+		)
+		metrics.NegativeCommentConversions.WithLabelValues(strings.ToLower(outcome.Sentiment)).Inc()
+		metrics.NegativeCommentConversionSeconds.Observe(outcome.Duration.Seconds())
+	}
+}
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	sa "github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer"
+)
+
+func TestCommentEdit(t *testing.T) {
+	footer := "<!-- ANALYSIS START -->\n**Overall sentiment analysis**: Negative\n<!-- ANALYSIS END -->"
+	testCases := []struct {
+		name             string
+		body             string
+		annotate         bool
+		expectedEdit     bool
+		expectedComment  string
+		expectedContains string
+	}{
+		{
+			name:            "not_annotated_trailing_newline",
+			body:            "this is fine\n",
+			expectedComment: "this is fine\n",
+		},
+		{
+			name:            "not_annotated_trailing_crlf",
+			body:            "this is fine\r\n",
+			expectedComment: "this is fine\r\n",
+		},
+		{
+			name:            "not_annotated_previous_analysis",
+			body:            "this is fine\n\n" + footer,
+			expectedEdit:    true,
+			expectedComment: "this is fine",
+		},
+		{
+			name:             "annotated",
+			body:             "this is terrible\n",
+			annotate:         true,
+			expectedEdit:     true,
+			expectedContains: "<!-- ANALYSIS START -->",
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			analysis := sa.Analysis{Sentiment: sa.Negative, Confidence: 0.9}
+			newComment, edit, err := commentEdit(testCase.body, analysis, testCase.annotate)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if edit != testCase.expectedEdit {
+				t.Fatalf("Expected edit %t, got %t with %q", testCase.expectedEdit, edit, newComment)
+			}
+			if testCase.expectedComment != "" && newComment != testCase.expectedComment {
+				t.Fatalf("Unexpected comment: expected %q, got %q", testCase.expectedComment, newComment)
+			}
+			if !strings.Contains(newComment, testCase.expectedContains) {
+				t.Fatalf("Expected comment to contain %q, got %q", testCase.expectedContains, newComment)
+			}
+		})
+	}
+}
@@ -0,0 +1,256 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	sa "github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer"
+	"github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer/aws"
+	"github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer/azure"
+	"github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer/cache"
+	"github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer/ensemble"
+	"github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer/google"
+	"github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer/openai"
+	"github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer/provider"
+	"github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer/toxicity"
+)
+
+// memoryCache is kept when the provider is reloaded with the same cache size.
+// Cached analyses are keyed by the provider, so they are not reused across
+// providers.
+var (
+	memoryCache     *cache.Memory
+	memoryCacheSize int
+	// diskCache is kept when the provider is reloaded with the same directory
+	// and size, so that writes keep counting towards its pruning.
+	diskCache           *cache.Disk
+	diskCacheDir        string
+	diskCacheMaxEntries int
+)
+
+// diskCacheSweepInterval is how often the server deletes the expired analyses
+// cached on disk.
+const diskCacheSweepInterval time.Duration = 10 * time.Minute
+
+// newSentimentAnalyzer creates the named provider from the command line
+// flags. Credentials are only read for the providers that are configured.
+func newSentimentAnalyzer(name string) (sa.Analyzer, error) {
+	providerConfig, err := providerConfigFromFlags()
+	if err != nil {
+		return nil, err
+	}
+	analyzer, err := provider.New(name, providerConfig)
+	if err != nil {
+		return nil, err
+	}
+	analyzer, err = withBudget(analyzer, providerConfig)
+	if err != nil {
+		return nil, err
+	}
+	if localToxicity {
+		analyzer = toxicity.NewAnalyzer(analyzer, toxicity.NewClassifier())
+	}
+
+	stores := []cache.Store{}
+	if cacheSize > 0 {
+		if memoryCacheSize != cacheSize {
+			memoryCache = cache.NewMemory(cacheSize)
+			memoryCacheSize = cacheSize
+		}
+		stores = append(stores, memoryCache)
+	}
+	if cacheDir != "" {
+		if diskCache == nil || diskCacheDir != cacheDir || diskCacheMaxEntries != cacheMaxEntries {
+			disk, err := cache.NewDisk(cacheDir, cacheMaxEntries)
+			if err != nil {
+				return nil, err
+			}
+			diskCache, diskCacheDir, diskCacheMaxEntries = disk, cacheDir, cacheMaxEntries
+		}
+		stores = append(stores, diskCache)
+	}
+	if len(stores) > 0 {
+		providerID, err := cacheProviderID(name)
+		if err != nil {
+			return nil, err
+		}
+		analyzer = cache.NewAnalyzer(analyzer, providerID, stores, cache.WithTTL(cacheTTL))
+	}
+
+	return analyzer, nil
+}
+
+// sweepDiskCache deletes the expired analyses cached on disk every
+// diskCacheSweepInterval, so that they do not stay on disk until they are
+// read.
+func sweepDiskCache() {
+	for range time.Tick(diskCacheSweepInterval) {
+		reloadMu.RLock()
+		disk := diskCache
+		reloadMu.RUnlock()
+		if disk == nil {
+			continue
+		}
+		if deleted, err := disk.Prune(); err != nil {
+			log.Error().Err(err).Msg("Error pruning the analysis cache")
+		} else if deleted > 0 {
+			log.Debug().Msgf("Pruned %d cached analyses", deleted)
+		}
+	}
+}
+
+// cacheProviderID identifies the provider and the settings that change its
+// results, so that cached analyses are not reused across them. The bayes
+// model is identified by its content, so that a retrained model at the same
+// path does not reuse the analyses of the previous one.
+func cacheProviderID(name string) (string, error) {
+	id := name
+	usesBayes := name == provider.Bayes
+	switch name {
+	case provider.OpenAI:
+		id = fmt.Sprintf("%s:%s:%t", name, openAIModel, openAIRewrites)
+	case provider.Ensemble:
+		id = fmt.Sprintf(
+			"%s:%s:%s:%s",
+			name,
+			strings.Join(ensembleProviders, ","),
+			strings.Join(ensembleWeights, ","),
+			ensembleStrategy,
+		)
+		for _, member := range ensembleProviders {
+			usesBayes = usesBayes || member == provider.Bayes
+		}
+	}
+
+	if usesBayes {
+		model, err := ioutil.ReadFile(bayesModelFile)
+		if err != nil {
+			return "", fmt.Errorf("error reading bayes model file: %w", err)
+		}
+		id = fmt.Sprintf("%s:bayes-model=%x", id, sha256.Sum256(model))
+	}
+	if localToxicity {
+		id = fmt.Sprintf("%s:local-toxicity", id)
+	}
+	return id, nil
+}
+
+func providerConfigFromFlags() (provider.Config, error) {
+	providerConfig := provider.Config{}
+
+	if languageEndpoint != "" {
+		languageAuthOpt, err := languageAuthOption()
+		if err != nil {
+			return providerConfig, fmt.Errorf("error setting up language service authentication: %w", err)
+		}
+		providerConfig.Azure = provider.AzureConfig{
+			Endpoint: languageEndpoint,
+			Options: []azure.Option{
+				azure.WithTimeout(languageTimeout),
+				azure.WithMaxRetries(languageRetries),
+				languageAuthOpt,
+			},
+		}
+	}
+
+	if openAIEndpoint != "" {
+		openAIKey := ""
+		if openAIKeyFile != "" {
+			openAIKeyBytes, err := ioutil.ReadFile(openAIKeyFile)
+			if err != nil {
+				return providerConfig, fmt.Errorf("error reading OpenAI key file: %w", err)
+			}
+			openAIKey = strings.TrimSpace(string(openAIKeyBytes))
+		}
+		providerConfig.OpenAI = provider.OpenAIConfig{
+			Endpoint: openAIEndpoint,
+			Model:    openAIModel,
+			Key:      openAIKey,
+			Options: []openai.Option{
+				openai.WithSuggestedRewrites(openAIRewrites),
+			},
+		}
+	}
+
+	if awsRegion != "" {
+		providerConfig.AWS = provider.AWSConfig{
+			Region: awsRegion,
+			Credentials: aws.Credentials{
+				AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+				SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+				SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+			},
+		}
+		if awsEndpoint != "" {
+			providerConfig.AWS.Options = append(providerConfig.AWS.Options, aws.WithEndpoint(awsEndpoint))
+		}
+	}
+
+	if googleKeyFile != "" || googleTokenFile != "" {
+		googleOpts := []google.Option{}
+		if googleEndpoint != "" {
+			googleOpts = append(googleOpts, google.WithEndpoint(googleEndpoint))
+		}
+		googleKey := ""
+		if googleKeyFile != "" {
+			googleKeyBytes, err := ioutil.ReadFile(googleKeyFile)
+			if err != nil {
+				return providerConfig, fmt.Errorf("error reading Google key file: %w", err)
+			}
+			googleKey = strings.TrimSpace(string(googleKeyBytes))
+		}
+		providerConfig.Google = provider.GoogleConfig{
+			APIKey:    googleKey,
+			TokenFile: googleTokenFile,
+			Options:   googleOpts,
+		}
+	}
+
+	if len(ensembleProviders) > 0 {
+		strategy, err := ensemble.ParseStrategy(ensembleStrategy)
+		if err != nil {
+			return providerConfig, err
+		}
+		weights, err := parseWeights(ensembleWeights)
+		if err != nil {
+			return providerConfig, err
+		}
+		providerConfig.Ensemble = provider.EnsembleConfig{
+			Providers: ensembleProviders,
+			Weights:   weights,
+			Options: []ensemble.Option{
+				ensemble.WithStrategy(strategy),
+				ensemble.WithTimeout(ensembleTimeout),
+				ensemble.WithQuorum(ensembleQuorum),
+			},
+		}
+	}
+
+	providerConfig.Bayes = provider.BayesConfig{ModelFile: bayesModelFile}
+
+	return providerConfig, nil
+}
+
+// parseWeights parses provider weights in the form name=weight.
+func parseWeights(rawWeights []string) (map[string]float32, error) {
+	weights := map[string]float32{}
+	for _, rawWeight := range rawWeights {
+		parts := strings.SplitN(rawWeight, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid ensemble weight %s, expected name=weight", rawWeight)
+		}
+		weight, err := strconv.ParseFloat(parts[1], 32)
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("invalid ensemble weight for %s: %s", parts[0], parts[1])
+		}
+		weights[strings.TrimSpace(parts[0])] = float32(weight)
+	}
+	return weights, nil
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer/provider"
+)
+
+func TestCacheProviderID(t *testing.T) {
+	previousModelFile, previousToxicity, previousEnsemble := bayesModelFile, localToxicity, ensembleProviders
+	t.Cleanup(func() {
+		bayesModelFile, localToxicity, ensembleProviders = previousModelFile, previousToxicity, previousEnsemble
+	})
+	bayesModelFile = filepath.Join(t.TempDir(), "model.json")
+	writeModel := func(model string) {
+		if err := ioutil.WriteFile(bayesModelFile, []byte(model), 0600); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	providerID := func(name string) string {
+		id, err := cacheProviderID(name)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return id
+	}
+
+	localToxicity = false
+	if id := providerID(provider.Azure); id != "azure" {
+		t.Fatalf("Unexpected ID %s", id)
+	}
+	localToxicity = true
+	if id := providerID(provider.Azure); id != "azure:local-toxicity" {
+		t.Fatalf("Expected the local toxicity to change the ID, got %s", id)
+	}
+
+	writeModel("model 1")
+	first := providerID(provider.Bayes)
+	ensembleProviders = []string{provider.Azure, provider.Bayes}
+	firstEnsemble := providerID(provider.Ensemble)
+	writeModel("model 2")
+	if id := providerID(provider.Bayes); id == first || !strings.HasPrefix(id, "bayes:bayes-model=") {
+		t.Fatalf("Expected a retrained model to change the ID, got %s", id)
+	}
+	if id := providerID(provider.Ensemble); id == firstEnsemble {
+		t.Fatalf("Expected a retrained model to change the ensemble ID, got %s", id)
+	}
+}
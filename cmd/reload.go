@@ -0,0 +1,272 @@
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/trstringer/comment-sentiment/pkg/config"
+	sa "github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer"
+)
+
+// reloadMu guards the settings and credentials that the server reloads while
+// it handles requests. Requests read them once, so that a reload does not
+// change them while a request is in flight.
+var reloadMu sync.RWMutex
+
+var reloadInterval time.Duration
+
+// restartFlags are the settings that are only read when the server starts.
+var restartFlags = map[string]bool{
+	"port":                           true,
+	"database":                       true,
+	"retention":                      true,
+	"github-oauth-client-id":         true,
+	"github-oauth-client-secretfile": true,
+	"dashboard-url":                  true,
+	"dashboard-session-keyfile":      true,
+	"digest-schedule":                true,
+	"digest-template":                true,
+	"anonymize-keyfile":              true,
+	"reload-interval":                true,
+	"metrics-port":                   true,
+	"metrics-max-repos":              true,
+}
+
+// reloadableSecret is a secret file that is read again when it changes.
+type reloadableSecret struct {
+	name  string
+	path  *string
+	value *[]byte
+	trim  bool
+}
+
+func reloadableSecrets() []reloadableSecret {
+	return []reloadableSecret{
+		{name: "app key", path: &appKeyFile, value: &appKey},
+		{name: "admin token", path: &adminTokenFile, value: &adminToken, trim: true},
+		{name: "analytics token", path: &analyticsTokenFile, value: &analyticsToken, trim: true},
+		{name: "manual API keys", path: &manualKeysFile, value: &manualKeys},
+	}
+}
+
+// providerFiles are the files that the sentiment provider is created from,
+// by flag.
+func providerFiles() map[string]string {
+	return map[string]string{
+		"language-keyfile":        languageKeyFile,
+		"azure-client-secretfile": aadSecretFile,
+		"azure-client-certfile":   aadCertFile,
+		"openai-keyfile":          openAIKeyFile,
+		"google-keyfile":          googleKeyFile,
+		"google-tokenfile":        googleTokenFile,
+		"bayes-model":             bayesModelFile,
+	}
+}
+
+// reloadPaths are the files that the server watches.
+func reloadPaths() []string {
+	paths := append([]string{configFile}, webhookSecretFiles...)
+	for _, secret := range reloadableSecrets() {
+		paths = append(paths, *secret.path)
+	}
+	for _, path := range providerFiles() {
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// watchReload reloads the server when a watched file changes, checking every
+// --reload-interval, or when the process receives SIGHUP.
+func watchReload() {
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+
+	reloadMu.RLock()
+	watcher := config.NewWatcher(reloadPaths())
+	reloadMu.RUnlock()
+
+	var ticks <-chan time.Time
+	if reloadInterval > 0 {
+		ticker := time.NewTicker(reloadInterval)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+
+	for {
+		select {
+		case <-hangups:
+			log.Info().Msg("Received SIGHUP, reloading")
+			reloadServer(watcher, watcher.Changed(), true)
+		case <-ticks:
+			if changed := watcher.Changed(); len(changed) > 0 {
+				log.Info().Msgf("Files changed, reloading: %s", strings.Join(changed, ", "))
+				reloadServer(watcher, changed, false)
+			}
+		}
+	}
+}
+
+// reloadServer applies the config again if it changed or forced is set, reads
+// the secrets again and recreates the sentiment provider if its settings or
+// files changed. A config that is not valid is not applied, but the secrets
+// are still reloaded, and a provider that cannot be created does not replace
+// the current one.
+func reloadServer(watcher *config.Watcher, changed []string, forced bool) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	changedFiles := map[string]bool{}
+	for _, path := range changed {
+		changedFiles[path] = true
+	}
+	reloaded := []string{}
+
+	configChanged := false
+	if forced || (configFile != "" && changedFiles[configFile]) {
+		changedFlags, err := reloadConfig()
+		if err != nil {
+			log.Error().Err(err).Msg("Error reloading config, keeping the current config")
+		}
+		for _, name := range changedFlags {
+			switch name {
+			case "manual-rate-limit":
+				// The rate was validated with the config, and the limits start over.
+				manualLimiter, _ = newManualLimiter()
+			case "installation-rate-limit", "repo-rate-limit":
+				installationLimiter, repoLimiter, _ = newRateLimiters()
+			case "rate-limit-action":
+				rateLimitAction, _ = parseOverflowAction(rateLimitActionName)
+			}
+		}
+		if len(changedFlags) > 0 {
+			configChanged = true
+			reloaded = append(reloaded, "config ("+strings.Join(changedFlags, ", ")+")")
+		}
+		watcher.Watch(reloadPaths())
+	}
+
+	secrets, err := readWebhookSecrets()
+	if err != nil {
+		log.Error().Err(err).Msg("Error reloading webhook secrets, keeping the current ones")
+	} else if !sameSecrets(secrets, webhookSecrets) {
+		webhookSecrets = secrets
+		reloaded = append(reloaded, "webhook secrets")
+	}
+
+	for _, secret := range reloadableSecrets() {
+		value, err := readSecretFile(*secret.path, secret.trim)
+		if err != nil {
+			log.Error().Err(err).Msgf("Error reloading %s, keeping the current one", secret.name)
+			continue
+		}
+		if !bytes.Equal(value, *secret.value) {
+			*secret.value = value
+			reloaded = append(reloaded, secret.name)
+		}
+	}
+
+	providerChanged := forced || configChanged
+	files := providerFiles()
+	names := []string{}
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if path := files[name]; path != "" && changedFiles[path] {
+			providerChanged = true
+			reloaded = append(reloaded, name)
+		}
+	}
+	if providerChanged {
+		analyzer, err := newSentimentAnalyzer(providerName)
+		if err != nil {
+			log.Error().Err(err).Msg("Error reloading sentiment provider, keeping the current one")
+		} else {
+			sentimentSvc = analyzer
+			reloaded = append(reloaded, "sentiment provider")
+		}
+		offline, err := newRateLimitOfflineAnalyzer()
+		if err != nil {
+			log.Error().Err(err).Msg("Error reloading offline provider of the rate limits, keeping the current one")
+		} else {
+			rateLimitOfflineSvc = offline
+		}
+	}
+
+	if len(reloaded) == 0 {
+		log.Info().Msg("Nothing to reload")
+		return
+	}
+	log.Info().Msgf("Reloaded %s", strings.Join(reloaded, ", "))
+}
+
+// reloadConfig applies the config again and returns the names of the
+// settings that changed. The settings in restartFlags keep the value they
+// had when the server started.
+func reloadConfig() ([]string, error) {
+	flags := configLoader.Flags()
+	started := map[string]string{}
+	for name := range restartFlags {
+		if flag := flags.Lookup(name); flag != nil {
+			started[name] = flag.Value.String()
+		}
+	}
+
+	changedFlags, err := configLoader.Load(validateServeConfig)
+	for _, name := range changedFlags {
+		if value, ok := started[name]; ok {
+			log.Warn().Msgf("Setting %s changed, it only applies after a restart", name)
+			// The value was valid when the server started.
+			// nolint: errcheck
+			flags.Lookup(name).Value.Set(value)
+		}
+	}
+	return changedFlags, err
+}
+
+// readSecretFile reads a secret, or returns nil if path is empty.
+func readSecretFile(path string, trim bool) ([]byte, error) {
+	if path == "" {
+		return nil, nil
+	}
+	value, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if trim {
+		value = bytes.TrimSpace(value)
+	}
+	return value, nil
+}
+
+// currentAppCredentials returns the GitHub App ID and key.
+func currentAppCredentials() (int, []byte) {
+	reloadMu.RLock()
+	defer reloadMu.RUnlock()
+	return appID, appKey
+}
+
+// currentTokens returns the admin and analytics bearer tokens.
+func currentTokens() ([]byte, []byte) {
+	reloadMu.RLock()
+	defer reloadMu.RUnlock()
+	return adminToken, analyticsToken
+}
+
+// currentAnalyzer returns the sentiment provider. A request keeps using it
+// when the provider is reloaded.
+func currentAnalyzer() sa.Analyzer {
+	reloadMu.RLock()
+	defer reloadMu.RUnlock()
+	return sentimentSvc
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReloadConfig(t *testing.T) {
+	previousConfigFile := configFile
+	t.Cleanup(func() {
+		// Set the flags back to their defaults.
+		configFile = ""
+		// nolint: errcheck
+		applyConfig(serveCmd)
+		configFile = previousConfigFile
+	})
+
+	dir := t.TempDir()
+	for _, name := range []string{"app.pem", "webhook-secret", "language-key"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("secret"), 0600); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	configFile = filepath.Join(dir, "config.toml")
+	writeConfig := func(retention, manualRate string) {
+		data := `app-id = 1
+app-keyfile = "` + filepath.Join(dir, "app.pem") + `"
+webhook-secretfile = ["` + filepath.Join(dir, "webhook-secret") + `"]
+language-endpoint = "https://example.com"
+language-keyfile = "` + filepath.Join(dir, "language-key") + `"
+retention = "` + retention + `"
+manual-rate-limit = "` + manualRate + `"
+`
+		if err := ioutil.WriteFile(configFile, []byte(data), 0600); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	writeConfig("720h", "60/minute")
+	if err := applyConfig(serveCmd); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if retention != 720*time.Hour {
+		t.Fatalf("Unexpected retention %s", retention)
+	}
+
+	writeConfig("1h", "5/minute")
+	changed, err := reloadConfig()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if retention != 720*time.Hour {
+		t.Fatalf("Expected the retention to only change after a restart, got %s", retention)
+	}
+	if manualRateLimit != "5/minute" {
+		t.Fatalf("Expected the manual rate limit to be reloaded, got %s", manualRateLimit)
+	}
+	if len(changed) != 2 {
+		t.Fatalf("Unexpected changed settings %v", changed)
+	}
+}
@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"time"
+
+	ghapi "github.com/google/go-github/v44/github"
+	"github.com/spf13/cobra"
+
+	gh "github.com/trstringer/comment-sentiment/pkg/github"
+	"github.com/trstringer/comment-sentiment/pkg/replay"
+)
+
+// replayTimeout bounds the request to the server, which analyzes the comment
+// before it responds.
+const replayTimeout time.Duration = 2 * time.Minute
+
+var (
+	replayURL            string
+	replaySecretFile     string
+	replayDryRun         bool
+	replayRepoConfigFile string
+)
+
+var replayCmd = &cobra.Command{
+	Use:   "replay <delivery file>",
+	Short: "Send a saved webhook delivery to the server again",
+	Long: `Send a saved webhook delivery to a running server, signed with
+--webhook-secretfile like GitHub signs it, or with its saved signature if no
+secret is supplied. The delivery file, or "-" for stdin, is either:
+
+  - the headers and payload from the advanced tab of the GitHub App settings,
+    as "Name: value" lines, a blank line and the JSON payload
+  - the JSON of a delivery from the GitHub API /app/hook/deliveries/{id}
+  - the JSON payload alone
+
+With --dry-run the delivery is handled in-process instead, with the provider
+flags, against a fake GitHub API that serves --repo-config as the repo
+configuration. The edits that the server would make are printed, and nothing
+is written to GitHub.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return fmt.Errorf("required argument delivery file not supplied")
+		}
+
+		var data []byte
+		var err error
+		if args[0] == "-" {
+			data, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			data, err = ioutil.ReadFile(args[0])
+		}
+		if err != nil {
+			return fmt.Errorf("error reading delivery: %w", err)
+		}
+		delivery, err := replay.ParseDelivery(data)
+		if err != nil {
+			return err
+		}
+
+		var secret []byte
+		if replaySecretFile != "" {
+			secret, err = ioutil.ReadFile(replaySecretFile)
+			if err != nil {
+				return fmt.Errorf("error reading webhook secret file: %w", err)
+			}
+		}
+
+		if replayDryRun {
+			return replayInProcess(delivery, secret)
+		}
+		return replayToServer(delivery, secret)
+	},
+}
+
+func init() {
+	replayCmd.Flags().StringVar(&replayURL, "url", "http://localhost:8080/", "webhook URL of the server")
+	replayCmd.Flags().StringVarP(&replaySecretFile, "webhook-secretfile", "w", "", "file storing the webhook secret to sign the delivery with")
+	replayCmd.Flags().BoolVar(&replayDryRun, "dry-run", false, "handle the delivery in-process against a fake GitHub API and print the edits")
+	replayCmd.Flags().StringVar(&replayRepoConfigFile, "repo-config", "", "repo configuration the fake GitHub API serves with --dry-run, the defaults if not supplied")
+	addProviderFlags(replayCmd)
+	rootCmd.AddCommand(replayCmd)
+}
+
+func replayToServer(delivery replay.Delivery, secret []byte) error {
+	req, err := delivery.NewRequest(replayURL, secret)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: replayTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending delivery: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading response: %w", err)
+	}
+	fmt.Printf("%s\n%s\n", resp.Status, body)
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("server did not accept the delivery")
+	}
+	return nil
+}
+
+// replayInProcess handles the delivery with the webhook handler, against a
+// fake GitHub API, and prints the edits it made.
+func replayInProcess(delivery replay.Delivery, secret []byte) error {
+	repoConfig := ""
+	if replayRepoConfigFile != "" {
+		data, err := ioutil.ReadFile(replayRepoConfigFile)
+		if err != nil {
+			return fmt.Errorf("error reading repo config: %w", err)
+		}
+		if _, err := gh.ParseRepoConfig(data); err != nil {
+			return err
+		}
+		repoConfig = string(data)
+	}
+
+	if len(secret) == 0 {
+		// The saved signature cannot be checked without the secret, so sign
+		// the delivery with a throwaway one.
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return fmt.Errorf("error generating webhook secret: %w", err)
+		}
+	}
+	webhookSecrets = [][]byte{secret}
+
+	var err error
+	sentimentSvc, err = newSentimentAnalyzer(providerName)
+	if err != nil {
+		return fmt.Errorf("error setting up sentiment provider: %w", err)
+	}
+
+	fake := replay.NewFakeGitHub(repoConfig)
+	defer fake.Close()
+	installationGitHubClient = func(repoOwner gh.RepositoryOwner) (*ghapi.Client, error) {
+		return fake.Client(), nil
+	}
+
+	req, err := delivery.NewRequest("http://localhost/", secret)
+	if err != nil {
+		return err
+	}
+	recorder := httptest.NewRecorder()
+	handleSentimentRequest(recorder, req)
+	fmt.Printf("%d %s\n%s\n", recorder.Code, http.StatusText(recorder.Code), recorder.Body)
+
+	edits := fake.Edits()
+	if len(edits) == 0 {
+		fmt.Println("\nNo edits would be made")
+	}
+	for _, edit := range edits {
+		fmt.Printf("\n==> %s %s <==\n%s\n", edit.Method, edit.Path, edit.Body)
+	}
+	if recorder.Code >= http.StatusBadRequest {
+		return fmt.Errorf("server would not accept the delivery")
+	}
+	return nil
+}
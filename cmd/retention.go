@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// pruneInterval is how often the server deletes the analyses older than
+// --retention.
+const pruneInterval time.Duration = time.Hour
+
+var retention time.Duration
+
+// schedulePruning deletes the analyses older than --retention from the
+// database now and every pruneInterval.
+func schedulePruning() {
+	for {
+		pruneAnalyses()
+		time.Sleep(pruneInterval)
+	}
+}
+
+func pruneAnalyses() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	reloadMu.RLock()
+	keep := retention
+	reloadMu.RUnlock()
+
+	pruned, err := database.PruneAnalyses(ctx, time.Now().Add(-keep))
+	if err != nil {
+		log.Error().Err(err).Msg("Error pruning analyses")
+		return
+	}
+	if pruned > 0 {
+		log.Info().Msgf("Pruned %d analyses older than %s", pruned, keep)
+	}
+}
@@ -6,20 +6,27 @@ Copyright © 2022 Thomas Stringer <thomas@trstringer.com>
 package cmd
 
 import (
-	"crypto/hmac"
-	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"os"
-	"path/filepath"
+	"strings"
+	"time"
 
+	ghapi "github.com/google/go-github/v44/github"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 
+	"github.com/trstringer/comment-sentiment/pkg/budget"
 	gh "github.com/trstringer/comment-sentiment/pkg/github"
+	"github.com/trstringer/comment-sentiment/pkg/metrics"
+	sa "github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer"
 	"github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer/azure"
+	"github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer/cache"
+	"github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer/ensemble"
+	"github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer/provider"
+	"github.com/trstringer/comment-sentiment/pkg/store"
 	"github.com/trstringer/comment-sentiment/pkg/version"
 )
 
@@ -27,83 +34,76 @@ var (
 	port              int
 	languageKeyFile   string
 	languageKey       string
-	webhookSecret     []byte
-	webhookSecretFile string
 	languageEndpoint  string
 	appID             int
 	appKeyFile        string
 	appKey            []byte
 	showVersion       bool
+	configFile        string
+	languageTimeout   time.Duration
+	languageRetries   int
+	languageAuth      string
+	aadAuthorityHost  string
+	aadTenantID       string
+	aadClientID       string
+	aadSecretFile     string
+	aadCertFile       string
+	aadTokenFile      string
+	providerName      string
+	openAIEndpoint    string
+	openAIModel       string
+	openAIKeyFile     string
+	openAIRewrites    bool
+	awsRegion         string
+	awsEndpoint       string
+	googleKeyFile     string
+	googleTokenFile   string
+	googleEndpoint    string
+	ensembleProviders []string
+	ensembleWeights   []string
+	ensembleStrategy  string
+	ensembleTimeout   time.Duration
+	ensembleQuorum    int
+	localToxicity     bool
+	bayesModelFile    string
+	cacheSize         int
+	cacheDir          string
+	cacheMaxEntries   int
+	cacheTTL          time.Duration
+	databaseFile      string
+	database          *store.Bolt
+	analysisStore     store.AnalysisRepository
+	sentimentSvc      sa.Analyzer
 )
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "comment-sentiment",
-	Short: "A brief description of your application",
-	Long: `A longer description that spans multiple lines and likely contains
-examples and usage of using your application. For example:
-
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
+	Short: "Annotate GitHub comments with their sentiment",
+	Long: `comment-sentiment is a GitHub App that analyzes the sentiment of issue,
+pull request and discussion comments, and annotates them with it.
+
+Every flag can also be set with an environment variable, such as
+COMMENT_SENTIMENT_APP_ID for --app-id, or in the YAML, JSON or TOML file
+passed with --config. Flags win over environment variables, which win over the
+file.`,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return applyConfig(cmd)
+	},
 	Run: func(cmd *cobra.Command, args []string) {
 		if showVersion {
 			fmt.Println(version.Version)
 			os.Exit(0)
 		}
-
-		if languageKeyFile == "" {
-			fmt.Println("Required parameter --language-key not supplied")
-			os.Exit(1)
-		}
-		if webhookSecretFile == "" {
-			fmt.Println("Required parameter --webhook-secretfile not supplied")
-			os.Exit(1)
-		}
-		if languageEndpoint == "" {
-			fmt.Println("Required parameter --language-endpoint not supplied")
-			os.Exit(1)
-		}
-		if appKeyFile == "" {
-			fmt.Println("Required parameter --app-keyfile not supplied")
-			os.Exit(1)
-		}
-
-		languageKeyFilePath, err := filepath.Abs(languageKeyFile)
-		if err != nil {
-			fmt.Printf("Error getting file path for language key: %v\n", err)
-			os.Exit(1)
-		}
-		languageKeyBytes, err := ioutil.ReadFile(languageKeyFilePath)
-		if err != nil {
-			fmt.Printf("Error reading language key file: %v\n", err)
-			os.Exit(1)
-		}
-		languageKey = string(languageKeyBytes)
-
-		webhookSecretFilePath, err := filepath.Abs(webhookSecretFile)
-		if err != nil {
-			fmt.Printf("Error getting file path for webhook secret: %v\n", err)
-			os.Exit(1)
-		}
-		webhookSecret, err = ioutil.ReadFile(webhookSecretFilePath)
-		if err != nil {
-			fmt.Printf("Error reading webhook secret file: %v\n", err)
-			os.Exit(1)
-		}
-
-		if appID <= 0 {
-			fmt.Println("Required parameter --app-id not supplied or incorrect value")
-			os.Exit(1)
-		}
-
-		appKey, err = ioutil.ReadFile(appKeyFile)
-		if err != nil {
-			fmt.Printf("Error reading app key file: %v\n", err)
-			os.Exit(1)
-		}
-
-		startServer(port)
+		// The server used to run without a subcommand, so fail rather than
+		// exit 0 for deployments that were not updated to run serve.
+		fmt.Fprintln(os.Stderr, "No command given, the webhook server is run with 'comment-sentiment serve'")
+		cmd.SetOut(os.Stderr)
+		// nolint: errcheck
+		cmd.Help()
+		os.Exit(1)
 	},
 }
 
@@ -112,26 +112,63 @@ to quickly create a Cobra application.`,
 func Execute() {
 	err := rootCmd.Execute()
 	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 }
 
 func init() {
-	rootCmd.Flags().IntVarP(&port, "port", "p", 8080, "port that the server should be listening on")
-	rootCmd.Flags().StringVarP(&languageKeyFile, "language-keyfile", "l", "", "cognitive services language key file path")
-	rootCmd.Flags().StringVarP(&languageEndpoint, "language-endpoint", "e", "", "cognitive services language endpoint")
-	rootCmd.Flags().StringVarP(&webhookSecretFile, "webhook-secretfile", "w", "", "file storing the webhook secret")
-	rootCmd.Flags().IntVar(&appID, "app-id", 0, "GitHub App ID")
-	rootCmd.Flags().StringVarP(&appKeyFile, "app-keyfile", "a", "", "GitHub App key file path")
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", os.Getenv(configEnv), "YAML, JSON or TOML config file, with flag names as keys")
 	rootCmd.Flags().BoolVarP(&showVersion, "version", "v", false, "list the version")
 }
 
-func isRequestValid(signature string, body []byte, secretKey []byte) (bool, string) {
-	hash := hmac.New(sha256.New, secretKey)
-	hash.Write(body)
-	calculatedHashBytes := hash.Sum(nil)
-	calculatedHash := fmt.Sprintf("sha256=%x", string(calculatedHashBytes))
-	return calculatedHash == signature, calculatedHash
+// addProviderFlags adds the flags that configure the sentiment provider, so
+// that every command that analyzes comments is configured the same way.
+func addProviderFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&languageKeyFile, "language-keyfile", "l", "", "cognitive services language key file path")
+	cmd.Flags().StringVarP(&languageEndpoint, "language-endpoint", "e", "", "cognitive services language endpoint")
+	cmd.Flags().DurationVar(&languageTimeout, "language-timeout", 30*time.Second, "timeout for each call to the language service")
+	cmd.Flags().IntVar(&languageRetries, "language-retries", 3, "number of retries for throttled or failed language service calls")
+	cmd.Flags().StringVar(&languageAuth, "language-auth", languageAuthKey, "language service authentication: key, client-secret, client-certificate or workload-identity")
+	cmd.Flags().StringVar(&aadAuthorityHost, "azure-authority-host", envOrDefault("AZURE_AUTHORITY_HOST", azure.DefaultAuthorityHost), "Azure Active Directory authority host")
+	cmd.Flags().StringVar(&aadTenantID, "azure-tenant-id", os.Getenv("AZURE_TENANT_ID"), "Azure Active Directory tenant ID")
+	cmd.Flags().StringVar(&aadClientID, "azure-client-id", os.Getenv("AZURE_CLIENT_ID"), "Azure Active Directory application client ID")
+	cmd.Flags().StringVar(&aadSecretFile, "azure-client-secretfile", "", "file storing the Azure Active Directory client secret")
+	cmd.Flags().StringVar(&aadCertFile, "azure-client-certfile", "", "PEM file storing the Azure Active Directory client certificate and key")
+	cmd.Flags().StringVar(&aadTokenFile, "azure-federated-tokenfile", os.Getenv("AZURE_FEDERATED_TOKEN_FILE"), "workload identity federated token file")
+	cmd.Flags().StringVar(&providerName, "provider", provider.Azure, fmt.Sprintf("sentiment provider (%s)", strings.Join(provider.Names(), ", ")))
+	cmd.Flags().StringVar(&openAIEndpoint, "openai-endpoint", "", "OpenAI-compatible API base URL, such as http://localhost:8000/v1")
+	cmd.Flags().StringVar(&openAIModel, "openai-model", "", "model for the OpenAI-compatible provider")
+	cmd.Flags().StringVar(&openAIKeyFile, "openai-keyfile", "", "file storing the API key for the OpenAI-compatible provider, if it needs one")
+	cmd.Flags().BoolVar(&openAIRewrites, "openai-rewrites", false, "ask the OpenAI-compatible provider to suggest rewrites of negative sentences")
+	cmd.Flags().StringVar(&awsRegion, "aws-region", os.Getenv("AWS_REGION"), "AWS region for Comprehend, credentials are read from the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables")
+	cmd.Flags().StringVar(&awsEndpoint, "aws-endpoint", "", "override the Comprehend endpoint")
+	cmd.Flags().StringVar(&googleKeyFile, "google-keyfile", "", "file storing the Google Cloud Natural Language API key")
+	cmd.Flags().StringVar(&googleTokenFile, "google-tokenfile", "", "file storing a Google Cloud access token, used instead of an API key and read again every minute so that it can be refreshed")
+	cmd.Flags().StringVar(&googleEndpoint, "google-endpoint", "", "override the Google Cloud Natural Language endpoint")
+	cmd.Flags().StringSliceVar(&ensembleProviders, "ensemble-providers", nil, "providers combined by the ensemble provider")
+	cmd.Flags().StringSliceVar(&ensembleWeights, "ensemble-weights", nil, "ensemble provider weights, such as azure=2,openai=1")
+	cmd.Flags().StringVar(&ensembleStrategy, "ensemble-strategy", string(ensemble.MajorityVote), "how the ensemble combines results: majority or weighted")
+	cmd.Flags().DurationVar(&ensembleTimeout, "ensemble-timeout", 30*time.Second, "how long each ensemble member has to respond")
+	cmd.Flags().IntVar(&ensembleQuorum, "ensemble-quorum", 1, "minimum number of ensemble members that have to succeed")
+	cmd.Flags().StringVar(&bayesModelFile, "bayes-model", "", "model file created by the train command, for the bayes provider")
+	cmd.Flags().IntVar(&cacheSize, "cache-size", 1000, "number of analyses cached in memory, 0 disables the memory cache")
+	cmd.Flags().StringVar(&cacheDir, "cache-dir", "", "directory to also cache analyses on disk, which holds the text of the analyzed sentences")
+	cmd.Flags().IntVar(&cacheMaxEntries, "cache-max-entries", 100000, "number of analyses cached on disk, the ones that expire first are deleted beyond it")
+	cmd.Flags().DurationVar(&cacheTTL, "cache-ttl", cache.DefaultTTL, "how long analyses are cached")
+	cmd.Flags().StringSliceVar(&budgetGlobal, "budget-global", nil, "quotas for all installations together, such as '100000 records/month'")
+	cmd.Flags().StringSliceVar(&budgetInstallation, "budget-installation", nil, "quotas for each installation, such as '500000 characters/day'")
+	cmd.Flags().StringVar(&budgetActionName, "budget-action", string(budget.Skip), "what to do with comments over budget: skip, fallback to the offline provider, or queue until the quota resets (queued comments are lost on restart)")
+	cmd.Flags().StringVar(&budgetUsageFile, "budget-usage-file", "", "file to keep budget usage in across restarts, instead of the database")
+	cmd.Flags().StringVar(&offlineProvider, "offline-provider", provider.Bayes, "provider used when the configured provider cannot be, such as when over budget")
+	cmd.Flags().BoolVar(&localToxicity, "local-toxicity", true, "score incivility with the local keyword classifier when the provider does not")
+}
+
+// installationGitHubClient creates the client that handles the deliveries of
+// a repo owner. The replay command replaces it with a fake GitHub API.
+var installationGitHubClient = func(repoOwner gh.RepositoryOwner) (*ghapi.Client, error) {
+	appID, appKey := currentAppCredentials()
+	return gh.NewInstallationGitHubClient(appID, appKey, repoOwner)
 }
 
 func handleSentimentRequest(resp http.ResponseWriter, req *http.Request) {
@@ -145,8 +182,7 @@ func handleSentimentRequest(resp http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	body := req.Body
-	if body == nil {
+	if req.Body == nil {
 		resp.WriteHeader(http.StatusBadRequest)
 		// nolint: errcheck
 		resp.Write([]byte("Missing request body"))
@@ -155,8 +191,20 @@ func handleSentimentRequest(resp http.ResponseWriter, req *http.Request) {
 	}
 	defer req.Body.Close()
 
+	reloadMu.RLock()
+	maxBodyBytes := webhookMaxBodyBytes
+	reloadMu.RUnlock()
+
 	log.Debug().Msg("Reading body of sentiment analysis request")
-	payloadRaw, err := ioutil.ReadAll(body)
+	payloadRaw, err := readBody(req, maxBodyBytes)
+	if errors.Is(err, errBodyTooLarge) {
+		metrics.WebhookLimitHits.WithLabelValues("payload_size", "reject").Inc()
+		resp.WriteHeader(http.StatusRequestEntityTooLarge)
+		// nolint: errcheck
+		resp.Write([]byte(fmt.Sprintf("Request body is larger than %d bytes", maxBodyBytes)))
+		log.Warn().Msgf("Request body is larger than %d bytes", maxBodyBytes)
+		return
+	}
 	if err != nil {
 		resp.WriteHeader(http.StatusInternalServerError)
 		// nolint: errcheck
@@ -165,17 +213,10 @@ func handleSentimentRequest(resp http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	githubSignature := req.Header.Get("X-Hub-Signature-256")
-	requestIsValid, computedHash := isRequestValid(githubSignature, payloadRaw, webhookSecret)
-	if !requestIsValid {
+	if verifyWebhookSignature(req.Header, payloadRaw) == -1 {
 		resp.WriteHeader(http.StatusUnauthorized)
 		// nolint: errcheck
 		resp.Write([]byte("Unauthorized access denied"))
-		log.Warn().Msgf(
-			"Mismatched signature from request (%s) to computed (%s)",
-			githubSignature,
-			computedHash,
-		)
 		return
 	}
 
@@ -202,49 +243,26 @@ func handleSentimentRequest(resp http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	log.Debug().Msgf("Creating new GitHub client for repo owner %s", commentPayload.Repository.Owner.Login)
-	client, err := gh.NewInstallationGitHubClient(appID, appKey, commentPayload.Repository.Owner)
-	if err != nil {
-		resp.WriteHeader(http.StatusInternalServerError)
-		// nolint: errcheck
-		resp.Write([]byte("Error creating GitHub client"))
-		log.Error().Err(err).Msg("Error creating github client")
+	ctx, limited := limitComment(req.Context(), resp, commentPayload)
+	if limited {
 		return
 	}
 
-	log.Debug().Msg("Creating new sentiment service and analyzing")
-	sentimentSvc := azure.NewSentimentService(languageEndpoint, languageKey)
-	bodyTrimmed, err := gh.TrimCommentSentimentAnalysis(commentPayload.Comment.Body)
-	if err != nil {
-		resp.WriteHeader(http.StatusInternalServerError)
-		// nolint: errcheck
-		resp.Write([]byte("Error formatting body"))
-		log.Error().Err(err).Msg("Error trimming comment body")
-	}
-	analysis, err := sentimentSvc.AnalyzeSentiment(bodyTrimmed)
-	log.Debug().Msgf("Analysis result: %s", analysis.Sentiment.String())
+	log.Debug().Msgf("Creating new GitHub client for repo owner %s", commentPayload.Repository.Owner.Login)
+	client, err := installationGitHubClient(commentPayload.Repository.Owner)
 	if err != nil {
 		resp.WriteHeader(http.StatusInternalServerError)
 		// nolint: errcheck
-		resp.Write([]byte("Error getting sentiment"))
-		log.Error().Err(err).Msg("Error getting sentiment analysis")
+		resp.Write([]byte("Error creating GitHub client"))
+		log.Error().Err(err).Msg("Error creating github client")
 		return
 	}
 
-	log.Debug().Msg("Updating comment")
-	updatedComment, err := gh.UpdateCommentWithSentiment(commentPayload.Comment.Body, *analysis)
-	if err != nil {
-		resp.WriteHeader(http.StatusInternalServerError)
-		// nolint: errcheck
-		resp.Write([]byte(fmt.Sprintf("%v", err)))
-		log.Error().Err(err).Msg("Error updating comment text with sentiment")
-		return
-	}
-	if err := commentPayload.UpdateComment(client, updatedComment); err != nil {
+	if err := processComment(ctx, client, commentPayload); err != nil {
 		resp.WriteHeader(http.StatusInternalServerError)
 		// nolint: errcheck
 		resp.Write([]byte(fmt.Sprintf("%v", err)))
-		log.Error().Err(err).Msg("Error updating comment on github")
+		log.Error().Err(err).Msg("Error processing comment")
 		return
 	}
 
@@ -253,58 +271,17 @@ func handleSentimentRequest(resp http.ResponseWriter, req *http.Request) {
 	resp.Write([]byte("success"))
 }
 
-func handleManualSentimentRequest(resp http.ResponseWriter, req *http.Request) {
-	fmt.Println("Received manual request to handle sentiment")
-
-	body := req.Body
-	if body == nil {
-		resp.WriteHeader(http.StatusBadRequest)
-		// nolint: errcheck
-		resp.Write([]byte("Missing request body"))
-		return
-	}
-	defer req.Body.Close()
-
-	commentDataRaw, err := ioutil.ReadAll(body)
-	if err != nil {
-		resp.WriteHeader(http.StatusInternalServerError)
-		// nolint: errcheck
-		resp.Write([]byte("Error reading body of request"))
-		return
-	}
-	commentData := string(commentDataRaw)
-
-	sentimentSvc := azure.NewSentimentService(languageEndpoint, languageKey)
-	analysis, err := sentimentSvc.AnalyzeSentiment(commentData)
-
-	if err != nil {
-		resp.WriteHeader(http.StatusInternalServerError)
-		// nolint: errcheck
-		resp.Write([]byte("Error getting sentiment"))
-		return
-	}
-
-	if analysis == nil {
-		resp.WriteHeader(http.StatusInternalServerError)
-		// nolint: errcheck
-		resp.Write([]byte("Unexpectedly no analysis returned"))
-		return
-	}
-
-	// nolint: errcheck
-	resp.Write([]byte(fmt.Sprintf(
-		"Analysis: %s - Confidence: %.2f",
-		analysis.Sentiment,
-		analysis.Confidence,
-	)))
-}
-
-func startServer(port int) {
+func startServer(port int) error {
 	log.Info().Msgf("Starting server on port %d", port)
 
-	http.HandleFunc("/", handleSentimentRequest)
+	http.HandleFunc("/", instrumentWebhook(handleSentimentRequest))
 	http.HandleFunc("/manual", handleManualSentimentRequest)
+	registerMetricsHandler()
+	http.HandleFunc("/admin/budget", handleBudgetRequest)
+	registerAnalyticsHandlers()
+	registerDashboardHandler()
 	if err := http.ListenAndServe(fmt.Sprintf(":%d", port), nil); err != nil {
-		log.Fatal().Msgf("Error creating server: %v", err)
+		return fmt.Errorf("error creating server: %w", err)
 	}
+	return nil
 }
@@ -0,0 +1,324 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"github.com/trstringer/comment-sentiment/pkg/budget"
+	"github.com/trstringer/comment-sentiment/pkg/config"
+	"github.com/trstringer/comment-sentiment/pkg/digest"
+	"github.com/trstringer/comment-sentiment/pkg/metrics"
+	"github.com/trstringer/comment-sentiment/pkg/ratelimit"
+	"github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer/ensemble"
+	"github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer/provider"
+	"github.com/trstringer/comment-sentiment/pkg/store"
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Run the GitHub App webhook server",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := validateServeConfig(); err != nil {
+			return err
+		}
+
+		var err error
+		webhookSecrets, err = readWebhookSecrets()
+		if err != nil {
+			return err
+		}
+
+		appKey, err = ioutil.ReadFile(appKeyFile)
+		if err != nil {
+			return fmt.Errorf("error reading app key file: %w", err)
+		}
+
+		if adminTokenFile != "" {
+			adminTokenRaw, err := ioutil.ReadFile(adminTokenFile)
+			if err != nil {
+				return fmt.Errorf("error reading admin token file: %w", err)
+			}
+			adminToken = []byte(strings.TrimSpace(string(adminTokenRaw)))
+		}
+
+		if analyticsTokenFile != "" {
+			analyticsTokenRaw, err := ioutil.ReadFile(analyticsTokenFile)
+			if err != nil {
+				return fmt.Errorf("error reading analytics token file: %w", err)
+			}
+			analyticsToken = []byte(strings.TrimSpace(string(analyticsTokenRaw)))
+		}
+
+		manualKeys, err = readSecretFile(manualKeysFile, false)
+		if err != nil {
+			return fmt.Errorf("error reading manual API keys file: %w", err)
+		}
+		manualLimiter, err = newManualLimiter()
+		if err != nil {
+			return fmt.Errorf("error parsing manual rate limit: %w", err)
+		}
+		if !manualDisabled && len(manualKeys) == 0 && adminTokenFile == "" {
+			log.Warn().Msg("No API keys or admin token configured, the /manual endpoint rejects every request")
+		}
+
+		if err := readAnonymizeKey(); err != nil {
+			return err
+		}
+
+		if databaseFile != "" {
+			database, err = store.OpenBolt(databaseFile)
+			if err != nil {
+				return fmt.Errorf("error opening database: %w", err)
+			}
+			defer database.Close()
+			analysisStore = database
+			if retention > 0 {
+				go schedulePruning()
+			}
+		}
+
+		if digestScheduleExpression != "" {
+			digestSchedule, err := digest.ParseSchedule(digestScheduleExpression)
+			if err != nil {
+				return fmt.Errorf("error parsing digest schedule: %w", err)
+			}
+			digestTemplate, err := loadDigestTemplate()
+			if err != nil {
+				return fmt.Errorf("error loading digest template: %w", err)
+			}
+			go scheduleDigests(digestSchedule, digestTemplate)
+		}
+
+		communityHealthDashboard, err = newDashboard()
+		if err != nil {
+			return fmt.Errorf("error setting up dashboard: %w", err)
+		}
+
+		sentimentSvc, err = newSentimentAnalyzer(providerName)
+		if err != nil {
+			return fmt.Errorf("error setting up sentiment provider: %w", err)
+		}
+
+		repoLabels = metrics.NewLabelLimit(metricsMaxRepos)
+
+		if err := setupRateLimits(); err != nil {
+			return fmt.Errorf("error setting up rate limits: %w", err)
+		}
+
+		go sweepDiskCache()
+		go watchReload()
+		return startServer(port)
+	},
+}
+
+func init() {
+	addServeFlags(serveCmd)
+	rootCmd.AddCommand(serveCmd)
+}
+
+// addServeFlags adds the flags of the server, which config validate checks
+// without starting it.
+func addServeFlags(cmd *cobra.Command) {
+	cmd.Flags().IntVarP(&port, "port", "p", 8080, "port that the server should be listening on")
+	cmd.Flags().StringSliceVarP(&webhookSecretFiles, "webhook-secretfile", "w", nil, "files storing the active webhook secrets, a delivery signed with any of them is accepted so that the secret can be rotated")
+	cmd.Flags().BoolVar(&webhookLegacySignatures, "webhook-legacy-signatures", false, "accept deliveries signed only with the legacy SHA-1 X-Hub-Signature header")
+	cmd.Flags().IntVar(&appID, "app-id", 0, "GitHub App ID")
+	cmd.Flags().StringVarP(&appKeyFile, "app-keyfile", "a", "", "GitHub App key file path")
+	cmd.Flags().StringVar(&databaseFile, "database", "", "database file to record every analysis and the budget usage in")
+	cmd.Flags().DurationVar(&retention, "retention", 0, "how long analyses are kept in the database, such as 2160h for 90 days, 0 keeps them until they are deleted by hand")
+	cmd.Flags().StringVar(&adminTokenFile, "admin-tokenfile", "", "file storing the bearer token for the admin endpoints, which also grants access to the analytics endpoints")
+	cmd.Flags().StringVar(&analyticsTokenFile, "analytics-tokenfile", "", "file storing the bearer token for the read-only analytics endpoints")
+	cmd.Flags().StringVar(&oauthClientID, "github-oauth-client-id", "", "client ID of the GitHub OAuth app that users log in to the dashboard with, enables the dashboard")
+	cmd.Flags().StringVar(&oauthClientSecretFile, "github-oauth-client-secretfile", "", "file storing the client secret of the GitHub OAuth app")
+	cmd.Flags().StringVar(&dashboardURL, "dashboard-url", "", "external URL of the dashboard, such as https://example.com/dashboard, where /callback is the OAuth callback")
+	cmd.Flags().StringVar(&dashboardSessionKeyFile, "dashboard-session-keyfile", "", "file storing the key that signs dashboard sessions, a random key is used if not supplied")
+	cmd.Flags().StringVar(&digestScheduleExpression, "digest-schedule", "", "cron expression in UTC to post the weekly digests on, such as '0 9 * * 1', run by only one replica")
+	cmd.Flags().StringVar(&digestTemplateFile, "digest-template", "", "Go template file that defines the \"title\" and \"body\" of the digest")
+	cmd.Flags().StringVar(&anonymizeKeyFile, "anonymize-keyfile", "", "file storing the key that logins in anonymized exports are hashed with")
+	cmd.Flags().DurationVar(&reloadInterval, "reload-interval", 30*time.Second, "how often to check the config and secret files for changes, 0 only reloads on SIGHUP")
+	addLimitFlags(cmd)
+	addMetricsFlags(cmd)
+	addManualFlags(cmd)
+	addProviderFlags(cmd)
+	addShadowFlags(cmd)
+}
+
+// validateServeConfig checks the server flags without side effects, and
+// returns every problem found.
+func validateServeConfig() error {
+	errs := config.Errors{}
+
+	if len(webhookSecretFiles) == 0 {
+		errs.Add("required parameter --webhook-secretfile not supplied")
+	}
+	if appKeyFile == "" {
+		errs.Add("required parameter --app-keyfile not supplied")
+	}
+	if appID <= 0 {
+		errs.Add("required parameter --app-id not supplied or incorrect value")
+	}
+	if port <= 0 || port > 65535 {
+		errs.Add("invalid --port %d", port)
+	}
+
+	knownProvider := false
+	for _, name := range provider.Names() {
+		knownProvider = knownProvider || name == providerName
+	}
+	if !knownProvider {
+		errs.Add("unknown --provider %s, expected one of %s", providerName, strings.Join(provider.Names(), ", "))
+	}
+	// The providers are only created once their flags are valid, so that a
+	// problem is not reported twice.
+	providerFlagsValid := knownProvider
+	if len(ensembleProviders) > 0 {
+		if _, err := ensemble.ParseStrategy(ensembleStrategy); err != nil {
+			errs.Add("invalid --ensemble-strategy: %v", err)
+			providerFlagsValid = false
+		}
+		if _, err := parseWeights(ensembleWeights); err != nil {
+			errs.Add("invalid --ensemble-weights: %v", err)
+			providerFlagsValid = false
+		}
+	}
+
+	if _, err := budget.ParseAction(budgetActionName); err != nil {
+		errs.Add("invalid --budget-action: %v", err)
+	}
+	if _, err := parseQuotas(budgetGlobal); err != nil {
+		errs.Add("invalid --budget-global: %v", err)
+	}
+	if _, err := parseQuotas(budgetInstallation); err != nil {
+		errs.Add("invalid --budget-installation: %v", err)
+	}
+
+	if retention < 0 {
+		errs.Add("invalid --retention %s", retention)
+	}
+	if cacheMaxEntries < 0 {
+		errs.Add("invalid --cache-max-entries %d", cacheMaxEntries)
+	}
+	if metricsPort < 0 || metricsPort > 65535 || (metricsPort != 0 && metricsPort == port) {
+		errs.Add("invalid --metrics-port %d, expected 0 or a port other than --port", metricsPort)
+	}
+	if metricsMaxRepos < 0 {
+		errs.Add("invalid --metrics-max-repos %d", metricsMaxRepos)
+	}
+	if webhookMaxBodyBytes <= 0 {
+		errs.Add("invalid --webhook-max-body-bytes %d", webhookMaxBodyBytes)
+	}
+	if _, _, err := newRateLimiters(); err != nil {
+		errs.Add("%v", err)
+	}
+	if _, err := parseOverflowAction(rateLimitActionName); err != nil {
+		errs.Add("invalid --rate-limit-action: %v", err)
+	}
+
+	if _, err := ratelimit.ParseRate(manualRateLimit); err != nil {
+		errs.Add("invalid --manual-rate-limit: %v", err)
+	}
+	if manualMaxBodyBytes <= 0 {
+		errs.Add("invalid --manual-max-body-bytes %d", manualMaxBodyBytes)
+	}
+	if manualKeysFile != "" {
+		if data, err := ioutil.ReadFile(manualKeysFile); err == nil {
+			if _, err := parseAPIKeys(data); err != nil {
+				errs.Add("invalid --manual-keysfile: %v", err)
+			}
+		}
+	}
+
+	if digestScheduleExpression != "" {
+		if databaseFile == "" {
+			errs.Add("parameter --digest-schedule requires --database")
+		}
+		if _, err := digest.ParseSchedule(digestScheduleExpression); err != nil {
+			errs.Add("invalid --digest-schedule: %v", err)
+		}
+	}
+
+	if oauthClientID != "" {
+		if databaseFile == "" {
+			errs.Add("parameter --github-oauth-client-id requires --database")
+		}
+		if oauthClientSecretFile == "" {
+			errs.Add("parameter --github-oauth-client-id requires --github-oauth-client-secretfile")
+		}
+		if dashboardURL == "" {
+			errs.Add("parameter --github-oauth-client-id requires --dashboard-url")
+		}
+	}
+
+	type inputFile struct {
+		flag string
+		path string
+	}
+	inputFiles := []inputFile{
+		{"app-keyfile", appKeyFile},
+		{"language-keyfile", languageKeyFile},
+		{"azure-client-secretfile", aadSecretFile},
+		{"azure-client-certfile", aadCertFile},
+		{"openai-keyfile", openAIKeyFile},
+		{"google-keyfile", googleKeyFile},
+		{"google-tokenfile", googleTokenFile},
+		{"bayes-model", bayesModelFile},
+		{"admin-tokenfile", adminTokenFile},
+		{"analytics-tokenfile", analyticsTokenFile},
+		{"github-oauth-client-secretfile", oauthClientSecretFile},
+		{"dashboard-session-keyfile", dashboardSessionKeyFile},
+		{"anonymize-keyfile", anonymizeKeyFile},
+		{"manual-keysfile", manualKeysFile},
+	}
+	for _, path := range webhookSecretFiles {
+		inputFiles = append(inputFiles, inputFile{"webhook-secretfile", path})
+	}
+	for _, inputFile := range inputFiles {
+		if inputFile.path == "" {
+			continue
+		}
+		if _, err := os.Stat(inputFile.path); err != nil {
+			errs.Add("cannot read --%s: %v", inputFile.flag, err)
+			if _, ok := providerFiles()[inputFile.flag]; ok {
+				providerFlagsValid = false
+			}
+		}
+	}
+	if providerFlagsValid {
+		validateProviders(&errs)
+	}
+	if digestTemplateFile != "" {
+		if _, err := loadDigestTemplate(); err != nil {
+			errs.Add("invalid --digest-template: %v", err)
+		}
+	}
+
+	return errs.Err()
+}
+
+// validateProviders checks that the sentiment provider, and the offline
+// provider when it is used, can be created from their flags and credentials.
+func validateProviders(errs *config.Errors) {
+	providerConfig, err := providerConfigFromFlags()
+	if err != nil {
+		errs.Add("%v", err)
+		return
+	}
+	if _, err := provider.New(providerName, providerConfig); err != nil {
+		errs.Add("invalid --provider %s: %v", providerName, err)
+	}
+
+	action, _ := budget.ParseAction(budgetActionName)
+	budgetFallback := action == budget.Fallback && (len(budgetGlobal) > 0 || len(budgetInstallation) > 0)
+	overflow, _ := parseOverflowAction(rateLimitActionName)
+	if (budgetFallback || overflow == overflowOffline) && offlineProvider != providerName {
+		if _, err := provider.New(offlineProvider, providerConfig); err != nil {
+			errs.Add("invalid --offline-provider %s: %v", offlineProvider, err)
+		}
+	}
+}
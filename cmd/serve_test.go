@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/trstringer/comment-sentiment/pkg/config"
+)
+
+func TestValidateProviders(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "language-key")
+	if err := ioutil.WriteFile(keyFile, []byte("key"), 0600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	testCases := []struct {
+		name             string
+		endpoint         string
+		keyFile          string
+		rateLimitAction  string
+		expectedProblems []string
+	}{
+		{
+			name:     "valid",
+			endpoint: "https://example.com",
+			keyFile:  keyFile,
+		},
+		{
+			name:             "missing_endpoint",
+			keyFile:          keyFile,
+			expectedProblems: []string{"invalid --provider azure: error creating azure provider: language endpoint is required"},
+		},
+		{
+			name:             "missing_keyfile",
+			endpoint:         "https://example.com",
+			expectedProblems: []string{"error setting up language service authentication: required parameter --language-keyfile not supplied"},
+		},
+		{
+			name:             "offline_provider",
+			endpoint:         "https://example.com",
+			keyFile:          keyFile,
+			rateLimitAction:  string(overflowOffline),
+			expectedProblems: []string{"invalid --offline-provider bayes: error creating bayes provider: model file is required"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			previousEndpoint, previousKeyFile, previousAction := languageEndpoint, languageKeyFile, rateLimitActionName
+			t.Cleanup(func() {
+				languageEndpoint, languageKeyFile, rateLimitActionName = previousEndpoint, previousKeyFile, previousAction
+			})
+			languageEndpoint, languageKeyFile, rateLimitActionName = testCase.endpoint, testCase.keyFile, testCase.rateLimitAction
+
+			errs := config.Errors{}
+			validateProviders(&errs)
+
+			problems := []string{}
+			for _, err := range errs {
+				problems = append(problems, err.Error())
+			}
+			if strings.Join(problems, "\n") != strings.Join(testCase.expectedProblems, "\n") {
+				t.Fatalf("Unexpected problems %q, expected %q", problems, testCase.expectedProblems)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"strings"
+
+	ghapi "github.com/google/go-github/v44/github"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	gh "github.com/trstringer/comment-sentiment/pkg/github"
+)
+
+var (
+	shadowAll   bool
+	shadowRepos []string
+)
+
+// addShadowFlags adds the flags that turn on shadow mode, in which comments
+// are analyzed but nothing is written to GitHub.
+func addShadowFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&shadowAll, "shadow", false, "analyze and record what would be written to GitHub, without editing comments or posting digests")
+	cmd.Flags().StringSliceVar(&shadowRepos, "shadow-repos", nil, "repos, such as octo/repo, or owners, such as octo, to run in shadow mode")
+}
+
+// inShadowMode indicates if nothing should be written to the repo, because of
+// --shadow, --shadow-repos or the shadow setting of the repo configuration.
+func inShadowMode(repo gh.Repository, repoConfig gh.RepoConfig) bool {
+	reloadMu.RLock()
+	defer reloadMu.RUnlock()
+	if shadowAll || repoConfig.Shadow {
+		return true
+	}
+	for _, name := range shadowRepos {
+		if strings.EqualFold(name, repo.FullName) || strings.EqualFold(name, repo.Owner.Login) {
+			return true
+		}
+	}
+	return false
+}
+
+// editComment edits the comment on GitHub, or only logs the edit in shadow
+// mode.
+func editComment(client *ghapi.Client, commentPayload gh.CommentPayload, newComment string, shadow bool) error {
+	if shadow {
+		log.Info().Msgf("Shadow mode, not editing comment %s to: %q", commentPayload.Comment.HTMLURL, newComment)
+		return nil
+	}
+	return commentPayload.UpdateComment(client, newComment)
+}
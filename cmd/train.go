@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer/bayes"
+)
+
+var (
+	trainCorpusFile string
+	trainOutputFile string
+	trainAlpha      float64
+)
+
+var trainCmd = &cobra.Command{
+	Use:   "train",
+	Short: "Train a model for the bayes provider",
+	Long: `Train a Naive Bayes model from a labeled corpus for the bayes provider.
+
+The corpus is either JSONL with one {"text": "...", "label": "..."} object per
+line, or a .csv file with a header that has text and label columns. Labels are
+positive, negative or neutral.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if trainCorpusFile == "" {
+			return fmt.Errorf("required parameter --corpus not supplied")
+		}
+
+		examples, err := bayes.LoadCorpus(trainCorpusFile)
+		if err != nil {
+			return fmt.Errorf("error loading corpus: %w", err)
+		}
+		model, err := bayes.Train(examples, trainAlpha)
+		if err != nil {
+			return fmt.Errorf("error training model: %w", err)
+		}
+		if err := model.SaveFile(trainOutputFile); err != nil {
+			return fmt.Errorf("error saving model: %w", err)
+		}
+
+		fmt.Printf(
+			"Trained on %d examples with a vocabulary of %d words, model saved to %s\n",
+			len(examples),
+			model.Vocabulary,
+			trainOutputFile,
+		)
+		return nil
+	},
+}
+
+func init() {
+	trainCmd.Flags().StringVar(&trainCorpusFile, "corpus", "", "labeled corpus file (.jsonl or .csv)")
+	trainCmd.Flags().StringVarP(&trainOutputFile, "output", "o", "model.json", "file to write the model to")
+	trainCmd.Flags().Float64Var(&trainAlpha, "alpha", bayes.DefaultAlpha, "additive smoothing")
+	rootCmd.AddCommand(trainCmd)
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/rs/zerolog/log"
+
+	gh "github.com/trstringer/comment-sentiment/pkg/github"
+	"github.com/trstringer/comment-sentiment/pkg/metrics"
+)
+
+var (
+	webhookSecretFiles      []string
+	webhookSecrets          [][]byte
+	webhookLegacySignatures bool
+)
+
+// readWebhookSecrets reads every active webhook secret.
+func readWebhookSecrets() ([][]byte, error) {
+	secrets := [][]byte{}
+	for _, path := range webhookSecretFiles {
+		secret, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading webhook secret file: %w", err)
+		}
+		secrets = append(secrets, secret)
+	}
+	return secrets, nil
+}
+
+// sameSecrets indicates if both lists hold the same secrets in the same
+// order.
+func sameSecrets(a [][]byte, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// verifyWebhookSignature checks the signature of a delivery against every
+// active webhook secret, so that deliveries signed with the previous or the
+// next secret are accepted while it is rotated. The SHA-1 signature is only
+// checked with --webhook-legacy-signatures, when there is no SHA-256 one. It
+// returns the position of the secret that matched, or -1 if none did.
+func verifyWebhookSignature(header http.Header, body []byte) int {
+	reloadMu.RLock()
+	secrets, files, legacy := webhookSecrets, webhookSecretFiles, webhookLegacySignatures
+	reloadMu.RUnlock()
+
+	algorithm, signature, sign := "sha256", header.Get(gh.SignatureHeader), gh.SignPayload
+	if signature == "" && legacy {
+		algorithm, signature, sign = "sha1", header.Get(gh.LegacySignatureHeader), gh.SignPayloadSHA1
+	}
+	if signature == "" {
+		metrics.WebhookSignatures.WithLabelValues("missing", algorithm, "").Inc()
+		log.Warn().Msg("Request has no webhook signature")
+		return -1
+	}
+
+	matched := gh.MatchSignature(signature, body, secrets, sign)
+	if matched == -1 {
+		metrics.WebhookSignatures.WithLabelValues("invalid", algorithm, "").Inc()
+		log.Warn().Msgf("Request %s signature matches none of the %d webhook secrets", algorithm, len(secrets))
+		return -1
+	}
+
+	metrics.WebhookSignatures.WithLabelValues("valid", algorithm, strconv.Itoa(matched)).Inc()
+	secretName := strconv.Itoa(matched)
+	if matched < len(files) {
+		secretName = files[matched]
+	}
+	log.Info().Msgf("Request %s signature matches webhook secret %s", algorithm, secretName)
+	return matched
+}
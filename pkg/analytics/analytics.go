@@ -0,0 +1,288 @@
+// Package analytics aggregates the stored analyses into the reports served by
+// the analytics API and dashboard.
+package analytics
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	gh "github.com/trstringer/comment-sentiment/pkg/github"
+	sa "github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer"
+	"github.com/trstringer/comment-sentiment/pkg/store"
+)
+
+// Interval is the size of the time buckets of SentimentOverTime.
+type Interval string
+
+const (
+	// Day buckets start at midnight UTC.
+	Day Interval = "day"
+	// Week buckets start on Monday.
+	Week Interval = "week"
+	// Month buckets start on the first of the month.
+	Month Interval = "month"
+)
+
+// ParseInterval validates an interval name.
+func ParseInterval(name string) (Interval, error) {
+	switch Interval(name) {
+	case Day, Week, Month:
+		return Interval(name), nil
+	default:
+		return "", fmt.Errorf("unknown interval %s", name)
+	}
+}
+
+func (i Interval) start(t time.Time) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch i {
+	case Week:
+		// Go weeks start on Sunday, these start on Monday.
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case Month:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return day
+	}
+}
+
+// Counts are the number of comments with each sentiment.
+type Counts struct {
+	Positive int `json:"positive"`
+	Negative int `json:"negative"`
+	Neutral  int `json:"neutral"`
+	Total    int `json:"total"`
+}
+
+// Add counts a comment with the sentiment.
+func (c *Counts) Add(sentiment string) {
+	switch sentiment {
+	case sa.Positive.String():
+		c.Positive++
+	case sa.Negative.String():
+		c.Negative++
+	default:
+		c.Neutral++
+	}
+	c.Total++
+}
+
+// NegativeRatio is the share of negative comments.
+func (c Counts) NegativeRatio() float64 {
+	if c.Total == 0 {
+		return 0
+	}
+	return float64(c.Negative) / float64(c.Total)
+}
+
+// LatestVersions keeps only the most recent analysis of each comment, so that
+// edited comments are counted once. The order of the records is kept.
+func LatestVersions(records []store.AnalysisRecord) []store.AnalysisRecord {
+	latest := map[string]int{}
+	for i, record := range records {
+		latest[record.CommentKey()] = i
+	}
+
+	kept := []store.AnalysisRecord{}
+	for i, record := range records {
+		if latest[record.CommentKey()] == i {
+			kept = append(kept, record)
+		}
+	}
+	return kept
+}
+
+// TimeBucket is the sentiment of the comments in one interval.
+type TimeBucket struct {
+	Start time.Time `json:"start"`
+	Counts
+	NegativeRatio float64 `json:"negative_ratio"`
+}
+
+// SentimentOverTime counts the sentiment of the comments by the interval they
+// were analyzed in, oldest first. Intervals without comments are left out.
+func SentimentOverTime(records []store.AnalysisRecord, interval Interval) []TimeBucket {
+	buckets := map[time.Time]*TimeBucket{}
+	for _, record := range LatestVersions(records) {
+		start := interval.start(record.AnalyzedAt)
+		bucket, ok := buckets[start]
+		if !ok {
+			bucket = &TimeBucket{Start: start}
+			buckets[start] = bucket
+		}
+		bucket.Add(record.Sentiment)
+	}
+
+	timeBuckets := []TimeBucket{}
+	for _, bucket := range buckets {
+		bucket.NegativeRatio = bucket.Counts.NegativeRatio()
+		timeBuckets = append(timeBuckets, *bucket)
+	}
+	sort.Slice(timeBuckets, func(i, j int) bool {
+		return timeBuckets[i].Start.Before(timeBuckets[j].Start)
+	})
+	return timeBuckets
+}
+
+// AuthorStats is the sentiment of an author's comments.
+type AuthorStats struct {
+	Author string `json:"author"`
+	Counts
+	NegativeRatio     float64 `json:"negative_ratio"`
+	AverageConfidence float64 `json:"average_confidence"`
+}
+
+// Authors aggregates the comments by author, most active first.
+func Authors(records []store.AnalysisRecord) []AuthorStats {
+	authors := map[string]*AuthorStats{}
+	confidences := map[string]float64{}
+	for _, record := range LatestVersions(records) {
+		author, ok := authors[record.Author]
+		if !ok {
+			author = &AuthorStats{Author: record.Author}
+			authors[record.Author] = author
+		}
+		author.Add(record.Sentiment)
+		confidences[record.Author] += float64(record.Confidence)
+	}
+
+	authorStats := []AuthorStats{}
+	for _, author := range authors {
+		author.NegativeRatio = author.Counts.NegativeRatio()
+		author.AverageConfidence = confidences[author.Author] / float64(author.Total)
+		authorStats = append(authorStats, *author)
+	}
+	sort.Slice(authorStats, func(i, j int) bool {
+		if authorStats[i].Total != authorStats[j].Total {
+			return authorStats[i].Total > authorStats[j].Total
+		}
+		return authorStats[i].Author < authorStats[j].Author
+	})
+	return authorStats
+}
+
+// ThreadStats is the sentiment of the comments on an issue, pull request or
+// discussion.
+type ThreadStats struct {
+	Repo   string `json:"repo"`
+	Number int    `json:"number"`
+	// Discussion is set for discussions, which are numbered apart from issues
+	// and pull requests.
+	Discussion bool   `json:"discussion,omitempty"`
+	Title      string `json:"title"`
+	URL        string `json:"url"`
+	Counts
+	NegativeRatio float64 `json:"negative_ratio"`
+}
+
+// NegativeThreads aggregates the comments by thread, most negative comments
+// first. Threads without negative comments are left out.
+func NegativeThreads(records []store.AnalysisRecord) []ThreadStats {
+	threads := map[string]*ThreadStats{}
+	for _, record := range LatestVersions(records) {
+		discussion := record.CommentType == gh.CommentTypeDiscussionComment.String()
+		key := fmt.Sprintf("%s#%d:%t", record.Repo, record.ThreadNumber, discussion)
+		thread, ok := threads[key]
+		if !ok {
+			thread = &ThreadStats{Repo: record.Repo, Number: record.ThreadNumber, Discussion: discussion}
+			threads[key] = thread
+		}
+		// Titles can change, so the latest one is kept.
+		if record.ThreadTitle != "" {
+			thread.Title = record.ThreadTitle
+		}
+		if record.ThreadURL != "" {
+			thread.URL = record.ThreadURL
+		}
+		thread.Add(record.Sentiment)
+	}
+
+	threadStats := []ThreadStats{}
+	for _, thread := range threads {
+		if thread.Negative == 0 {
+			continue
+		}
+		thread.NegativeRatio = thread.Counts.NegativeRatio()
+		threadStats = append(threadStats, *thread)
+	}
+	sort.Slice(threadStats, func(i, j int) bool {
+		if threadStats[i].Negative != threadStats[j].Negative {
+			return threadStats[i].Negative > threadStats[j].Negative
+		}
+		if threadStats[i].NegativeRatio != threadStats[j].NegativeRatio {
+			return threadStats[i].NegativeRatio > threadStats[j].NegativeRatio
+		}
+		if threadStats[i].Repo != threadStats[j].Repo {
+			return threadStats[i].Repo < threadStats[j].Repo
+		}
+		if threadStats[i].Number != threadStats[j].Number {
+			return threadStats[i].Number < threadStats[j].Number
+		}
+		return !threadStats[i].Discussion && threadStats[j].Discussion
+	})
+	return threadStats
+}
+
+// CommentTypeStats is the sentiment of the comments of a comment type.
+type CommentTypeStats struct {
+	CommentType string `json:"comment_type"`
+	Counts
+	NegativeRatio float64 `json:"negative_ratio"`
+}
+
+// CommentTypes aggregates the comments by comment type.
+func CommentTypes(records []store.AnalysisRecord) []CommentTypeStats {
+	commentTypes := map[string]*CommentTypeStats{}
+	for _, record := range LatestVersions(records) {
+		commentType, ok := commentTypes[record.CommentType]
+		if !ok {
+			commentType = &CommentTypeStats{CommentType: record.CommentType}
+			commentTypes[record.CommentType] = commentType
+		}
+		commentType.Add(record.Sentiment)
+	}
+
+	commentTypeStats := []CommentTypeStats{}
+	for _, commentType := range commentTypes {
+		commentType.NegativeRatio = commentType.Counts.NegativeRatio()
+		commentTypeStats = append(commentTypeStats, *commentType)
+	}
+	sort.Slice(commentTypeStats, func(i, j int) bool {
+		return commentTypeStats[i].CommentType < commentTypeStats[j].CommentType
+	})
+	return commentTypeStats
+}
+
+// EditStats is how many negative comments were later edited to be positive.
+type EditStats struct {
+	Negative       int     `json:"negative"`
+	EditedPositive int     `json:"edited_positive"`
+	Ratio          float64 `json:"ratio"`
+}
+
+// EditedToPositive counts the comments that were analyzed as negative, and of
+// those the ones that a later edit turned positive. The records have to be
+// oldest first.
+func EditedToPositive(records []store.AnalysisRecord) EditStats {
+	negative := map[string]bool{}
+	edited := map[string]bool{}
+	for _, record := range records {
+		key := record.CommentKey()
+		switch record.Sentiment {
+		case sa.Negative.String():
+			negative[key] = true
+		case sa.Positive.String():
+			if negative[key] {
+				edited[key] = true
+			}
+		}
+	}
+
+	stats := EditStats{Negative: len(negative), EditedPositive: len(edited)}
+	if stats.Negative > 0 {
+		stats.Ratio = float64(stats.EditedPositive) / float64(stats.Negative)
+	}
+	return stats
+}
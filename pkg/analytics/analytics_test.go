@@ -0,0 +1,153 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/trstringer/comment-sentiment/pkg/store"
+)
+
+var start = time.Date(2022, 5, 2, 12, 0, 0, 0, time.UTC)
+
+var records = []store.AnalysisRecord{
+	{Repo: "octo/a", ThreadNumber: 1, ThreadTitle: "Crash", CommentID: 1, CommentType: "issue_comment", Author: "alice", Sentiment: "Negative", Confidence: 0.9, AnalyzedAt: start},
+	// An edit of the first comment replaces it.
+	{Repo: "octo/a", ThreadNumber: 1, ThreadTitle: "Crash on start", CommentID: 1, CommentType: "issue_comment", Author: "alice", Sentiment: "Neutral", Confidence: 0.7, AnalyzedAt: start.Add(time.Hour)},
+	{Repo: "octo/a", ThreadNumber: 1, CommentID: 2, CommentType: "issue_comment", Author: "bob", Sentiment: "Negative", Confidence: 0.8, AnalyzedAt: start.AddDate(0, 0, 1)},
+	{Repo: "octo/a", ThreadNumber: 2, CommentID: 3, CommentType: "pull_request_review_comment", Author: "bob", Sentiment: "Negative", Confidence: 0.6, AnalyzedAt: start.AddDate(0, 0, 7)},
+	{Repo: "octo/a", ThreadNumber: 2, CommentID: 4, CommentType: "pull_request_review_comment", Author: "carol", Sentiment: "Positive", Confidence: 1, AnalyzedAt: start.AddDate(0, 0, 8)},
+	{Repo: "octo/a", ThreadNumber: 3, CommentID: 5, CommentType: "issue_comment", Author: "carol", Sentiment: "Positive", Confidence: 1, AnalyzedAt: start.AddDate(0, 1, 0)},
+}
+
+func TestLatestVersions(t *testing.T) {
+	latest := LatestVersions(records)
+	if len(latest) != 5 || latest[0].Sentiment != "Neutral" {
+		t.Fatalf("Expected the edit to replace the original, got %+v", latest)
+	}
+}
+
+func TestSentimentOverTime(t *testing.T) {
+	testCases := []struct {
+		name           string
+		interval       Interval
+		expectedStarts []time.Time
+		expectedTotals []int
+	}{
+		{
+			name:     "day",
+			interval: Day,
+			expectedStarts: []time.Time{
+				time.Date(2022, 5, 2, 0, 0, 0, 0, time.UTC),
+				time.Date(2022, 5, 3, 0, 0, 0, 0, time.UTC),
+				time.Date(2022, 5, 9, 0, 0, 0, 0, time.UTC),
+				time.Date(2022, 5, 10, 0, 0, 0, 0, time.UTC),
+				time.Date(2022, 6, 2, 0, 0, 0, 0, time.UTC),
+			},
+			expectedTotals: []int{1, 1, 1, 1, 1},
+		},
+		{
+			name:     "week",
+			interval: Week,
+			expectedStarts: []time.Time{
+				time.Date(2022, 5, 2, 0, 0, 0, 0, time.UTC),
+				time.Date(2022, 5, 9, 0, 0, 0, 0, time.UTC),
+				time.Date(2022, 5, 30, 0, 0, 0, 0, time.UTC),
+			},
+			expectedTotals: []int{2, 2, 1},
+		},
+		{
+			name:     "month",
+			interval: Month,
+			expectedStarts: []time.Time{
+				time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC),
+				time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC),
+			},
+			expectedTotals: []int{4, 1},
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			buckets := SentimentOverTime(records, testCase.interval)
+			if len(buckets) != len(testCase.expectedStarts) {
+				t.Fatalf("Expected %d buckets, got %+v", len(testCase.expectedStarts), buckets)
+			}
+			for i, bucket := range buckets {
+				if !bucket.Start.Equal(testCase.expectedStarts[i]) || bucket.Total != testCase.expectedTotals[i] {
+					t.Fatalf("Unexpected bucket %d: %+v", i, bucket)
+				}
+			}
+		})
+	}
+}
+
+func TestAuthors(t *testing.T) {
+	authors := Authors(records)
+	if len(authors) != 3 {
+		t.Fatalf("Expected 3 authors, got %+v", authors)
+	}
+	bob := authors[0]
+	if bob.Author != "bob" || bob.Total != 2 || bob.Negative != 2 || bob.NegativeRatio != 1 {
+		t.Fatalf("Unexpected first author %+v", bob)
+	}
+	if diff := bob.AverageConfidence - 0.7; diff > 0.0001 || diff < -0.0001 {
+		t.Fatalf("Unexpected average confidence %f", bob.AverageConfidence)
+	}
+	if authors[1].Author != "carol" || authors[2].Author != "alice" {
+		t.Fatalf("Unexpected author order %+v", authors)
+	}
+}
+
+func TestNegativeThreads(t *testing.T) {
+	threads := NegativeThreads(records)
+	if len(threads) != 2 {
+		t.Fatalf("Expected 2 threads with negative comments, got %+v", threads)
+	}
+	if threads[0].Number != 1 || threads[0].Title != "Crash on start" || threads[0].Negative != 1 || threads[0].NegativeRatio != 0.5 {
+		t.Fatalf("Unexpected first thread %+v", threads[0])
+	}
+	if threads[1].Number != 2 {
+		t.Fatalf("Unexpected second thread %+v", threads[1])
+	}
+}
+
+func TestNegativeThreadsSeparatesDiscussions(t *testing.T) {
+	discussion := store.AnalysisRecord{Repo: "octo/a", ThreadNumber: 1, ThreadTitle: "Roadmap", CommentID: 6, CommentType: "discussion_comment", Author: "dave", Sentiment: "Negative", AnalyzedAt: start}
+	threads := NegativeThreads(append(append([]store.AnalysisRecord{}, records...), discussion))
+	if len(threads) != 3 {
+		t.Fatalf("Expected 3 threads with negative comments, got %+v", threads)
+	}
+	// The discussion is first, as all of its comments are negative.
+	if threads[0].Number != 1 || !threads[0].Discussion || threads[0].Title != "Roadmap" || threads[0].Total != 1 {
+		t.Fatalf("Unexpected discussion thread %+v", threads[0])
+	}
+	if threads[1].Number != 1 || threads[1].Discussion || threads[1].Title != "Crash on start" || threads[1].Total != 2 {
+		t.Fatalf("Unexpected issue thread %+v", threads[1])
+	}
+}
+
+func TestCommentTypes(t *testing.T) {
+	commentTypes := CommentTypes(records)
+	if len(commentTypes) != 2 {
+		t.Fatalf("Expected 2 comment types, got %+v", commentTypes)
+	}
+	issues := commentTypes[0]
+	if issues.CommentType != "issue_comment" || issues.Total != 3 || issues.Negative != 1 || issues.Positive != 1 {
+		t.Fatalf("Unexpected issue comment stats %+v", issues)
+	}
+}
+
+func TestEditedToPositive(t *testing.T) {
+	edits := append([]store.AnalysisRecord{}, records...)
+	edits = append(edits, store.AnalysisRecord{Repo: "octo/a", ThreadNumber: 1, CommentID: 2, CommentType: "issue_comment", Author: "bob", Sentiment: "Positive", AnalyzedAt: start.AddDate(0, 0, 2)})
+
+	stats := EditedToPositive(edits)
+	// Comment 1 was only edited to neutral, comment 3 was never edited.
+	if stats.Negative != 3 || stats.EditedPositive != 1 {
+		t.Fatalf("Unexpected edit stats %+v", stats)
+	}
+	if diff := stats.Ratio - 1.0/3; diff > 0.0001 || diff < -0.0001 {
+		t.Fatalf("Unexpected ratio %f", stats.Ratio)
+	}
+}
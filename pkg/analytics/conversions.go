@@ -0,0 +1,153 @@
+package analytics
+
+import (
+	"sort"
+	"time"
+
+	sa "github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer"
+	"github.com/trstringer/comment-sentiment/pkg/store"
+)
+
+// Outcome is what the latest analysis of a comment did to its sentiment.
+type Outcome struct {
+	// BecameNegative is set when the comment was not negative before.
+	BecameNegative bool
+	// Converted is set when an edit turned a negative comment neutral or
+	// positive.
+	Converted bool
+	Sentiment string
+	// Duration is how long the comment was negative before it converted.
+	Duration time.Duration
+}
+
+// LatestOutcome compares the latest analysis of a comment's history, oldest
+// first, with the analyses before it.
+func LatestOutcome(history []store.AnalysisRecord) Outcome {
+	if len(history) == 0 {
+		return Outcome{}
+	}
+	latest := history[len(history)-1]
+	outcome := Outcome{Sentiment: latest.Sentiment}
+
+	negativeSince, negative := negativeStreak(history[:len(history)-1])
+	switch {
+	case latest.Sentiment == sa.Negative.String():
+		outcome.BecameNegative = !negative
+	case negative:
+		outcome.Converted = true
+		outcome.Duration = latest.AnalyzedAt.Sub(negativeSince)
+	}
+	return outcome
+}
+
+// negativeStreak returns when the comment was first analyzed as negative in
+// the run of negative analyses that ends the history, if there is one.
+func negativeStreak(history []store.AnalysisRecord) (time.Time, bool) {
+	since := time.Time{}
+	negative := false
+	for _, record := range history {
+		if record.Sentiment != sa.Negative.String() {
+			negative = false
+			continue
+		}
+		if !negative {
+			since = record.AnalyzedAt
+			negative = true
+		}
+	}
+	return since, negative
+}
+
+// ConversionStats is how many negative comments of a repo were edited to be
+// neutral or positive, and how long it took.
+type ConversionStats struct {
+	Repo string `json:"repo"`
+	// Negative is the number of comments that were analyzed as negative.
+	Negative int `json:"negative"`
+	// Converted is the number of negative comments that were edited to be
+	// neutral or positive. Each comment counts once.
+	Converted     int     `json:"converted"`
+	ToNeutral     int     `json:"to_neutral"`
+	ToPositive    int     `json:"to_positive"`
+	ConvertedRate float64 `json:"converted_rate"`
+	// MedianSeconds and AverageSeconds are the time from the first negative
+	// analysis of a comment to its conversion.
+	MedianSeconds  float64 `json:"median_seconds"`
+	AverageSeconds float64 `json:"average_seconds"`
+}
+
+// Conversions follows the history of every comment, oldest first, and counts
+// the negative comments that edits converted, by repo.
+func Conversions(records []store.AnalysisRecord) []ConversionStats {
+	histories := map[string][]store.AnalysisRecord{}
+	keys := []string{}
+	for _, record := range records {
+		key := record.CommentKey()
+		if _, ok := histories[key]; !ok {
+			keys = append(keys, key)
+		}
+		histories[key] = append(histories[key], record)
+	}
+
+	repos := map[string]*ConversionStats{}
+	durations := map[string][]time.Duration{}
+	for _, key := range keys {
+		history := histories[key]
+		repo := history[0].Repo
+		stats, ok := repos[repo]
+		if !ok {
+			stats = &ConversionStats{Repo: repo}
+			repos[repo] = stats
+		}
+
+		wasNegative := false
+		for i := range history {
+			outcome := LatestOutcome(history[:i+1])
+			if outcome.BecameNegative && !wasNegative {
+				stats.Negative++
+				wasNegative = true
+			}
+			if outcome.Converted {
+				stats.Converted++
+				if outcome.Sentiment == sa.Positive.String() {
+					stats.ToPositive++
+				} else {
+					stats.ToNeutral++
+				}
+				durations[repo] = append(durations[repo], outcome.Duration)
+				break
+			}
+		}
+	}
+
+	conversionStats := []ConversionStats{}
+	for repo, stats := range repos {
+		if stats.Negative == 0 {
+			continue
+		}
+		stats.ConvertedRate = float64(stats.Converted) / float64(stats.Negative)
+		stats.MedianSeconds, stats.AverageSeconds = durationStats(durations[repo])
+		conversionStats = append(conversionStats, *stats)
+	}
+	sort.Slice(conversionStats, func(i, j int) bool {
+		return conversionStats[i].Repo < conversionStats[j].Repo
+	})
+	return conversionStats
+}
+
+func durationStats(durations []time.Duration) (float64, float64) {
+	if len(durations) == 0 {
+		return 0, 0
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+
+	var total time.Duration
+	for _, duration := range durations {
+		total += duration
+	}
+	median := durations[len(durations)/2]
+	if len(durations)%2 == 0 {
+		median = (durations[len(durations)/2-1] + median) / 2
+	}
+	return median.Seconds(), total.Seconds() / float64(len(durations))
+}
@@ -0,0 +1,78 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/trstringer/comment-sentiment/pkg/store"
+)
+
+func TestLatestOutcome(t *testing.T) {
+	version := func(sentiment string, minutes int) store.AnalysisRecord {
+		return store.AnalysisRecord{Sentiment: sentiment, AnalyzedAt: start.Add(time.Duration(minutes) * time.Minute)}
+	}
+
+	testCases := []struct {
+		name     string
+		history  []store.AnalysisRecord
+		expected Outcome
+	}{
+		{
+			name:     "new_negative",
+			history:  []store.AnalysisRecord{version("Negative", 0)},
+			expected: Outcome{BecameNegative: true, Sentiment: "Negative"},
+		},
+		{
+			name:     "still_negative",
+			history:  []store.AnalysisRecord{version("Negative", 0), version("Negative", 5)},
+			expected: Outcome{Sentiment: "Negative"},
+		},
+		{
+			name:     "converted_since_first_negative",
+			history:  []store.AnalysisRecord{version("Neutral", 0), version("Negative", 5), version("Negative", 10), version("Positive", 20)},
+			expected: Outcome{Converted: true, Sentiment: "Positive", Duration: 15 * time.Minute},
+		},
+		{
+			name:     "never_negative",
+			history:  []store.AnalysisRecord{version("Neutral", 0), version("Positive", 5)},
+			expected: Outcome{Sentiment: "Positive"},
+		},
+		{
+			name:     "empty",
+			history:  nil,
+			expected: Outcome{},
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			if actual := LatestOutcome(testCase.history); actual != testCase.expected {
+				t.Fatalf("Expected %+v, got %+v", testCase.expected, actual)
+			}
+		})
+	}
+}
+
+func TestConversions(t *testing.T) {
+	history := append([]store.AnalysisRecord{}, records...)
+	history = append(history,
+		store.AnalysisRecord{Repo: "octo/a", CommentID: 2, CommentType: "issue_comment", Sentiment: "Positive", AnalyzedAt: start.AddDate(0, 0, 3)},
+		store.AnalysisRecord{Repo: "octo/b", CommentID: 9, CommentType: "issue_comment", Sentiment: "Positive", AnalyzedAt: start},
+	)
+
+	conversions := Conversions(history)
+	if len(conversions) != 1 {
+		t.Fatalf("Expected only the repo with negative comments, got %+v", conversions)
+	}
+	stats := conversions[0]
+	// Comment 1 converted to neutral after an hour, comment 2 to positive
+	// after two days and comment 3 never did.
+	if stats.Repo != "octo/a" || stats.Negative != 3 || stats.Converted != 2 || stats.ToNeutral != 1 || stats.ToPositive != 1 {
+		t.Fatalf("Unexpected conversions %+v", stats)
+	}
+	expectedMedian := (time.Hour + 48*time.Hour).Seconds() / 2
+	if stats.MedianSeconds != expectedMedian || stats.AverageSeconds != expectedMedian {
+		t.Fatalf("Unexpected durations %+v", stats)
+	}
+}
@@ -0,0 +1,47 @@
+package analytics
+
+import (
+	"sort"
+	"time"
+
+	"github.com/trstringer/comment-sentiment/pkg/store"
+)
+
+// ShadowEdit is an edit of a comment that shadow mode held back.
+type ShadowEdit struct {
+	Repo       string `json:"repo"`
+	ThreadURL  string `json:"thread_url"`
+	CommentURL string `json:"comment_url"`
+	Author     string `json:"author"`
+	Sentiment  string `json:"sentiment"`
+	// Annotated is whether the edit adds the analysis, rather than removing
+	// the analysis of a previous version of the comment.
+	Annotated  bool      `json:"annotated"`
+	Comment    string    `json:"comment"`
+	AnalyzedAt time.Time `json:"analyzed_at"`
+}
+
+// ShadowEdits lists the edits that shadow mode held back, newest first.
+// Shadow records of comments that would not have been edited are left out.
+func ShadowEdits(records []store.AnalysisRecord) []ShadowEdit {
+	edits := []ShadowEdit{}
+	for _, record := range records {
+		if !record.Shadow || record.ShadowComment == "" {
+			continue
+		}
+		edits = append(edits, ShadowEdit{
+			Repo:       record.Repo,
+			ThreadURL:  record.ThreadURL,
+			CommentURL: record.CommentURL,
+			Author:     record.Author,
+			Sentiment:  record.Sentiment,
+			Annotated:  record.Annotated,
+			Comment:    record.ShadowComment,
+			AnalyzedAt: record.AnalyzedAt,
+		})
+	}
+	sort.SliceStable(edits, func(i, j int) bool {
+		return edits[i].AnalyzedAt.After(edits[j].AnalyzedAt)
+	})
+	return edits
+}
@@ -0,0 +1,24 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/trstringer/comment-sentiment/pkg/store"
+)
+
+func TestShadowEdits(t *testing.T) {
+	start := time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC)
+	records := []store.AnalysisRecord{
+		{CommentID: 1, Shadow: true, Annotated: true, ShadowComment: "First", AnalyzedAt: start},
+		{CommentID: 2, Shadow: true, AnalyzedAt: start.Add(time.Hour)},
+		{CommentID: 3, Annotated: true, AnalyzedAt: start.Add(2 * time.Hour)},
+		{CommentID: 4, Shadow: true, ShadowComment: "Removed", AnalyzedAt: start.Add(3 * time.Hour)},
+	}
+
+	edits := ShadowEdits(records)
+	if len(edits) != 2 || edits[0].Comment != "Removed" || edits[0].Annotated ||
+		edits[1].Comment != "First" || !edits[1].Annotated {
+		t.Fatalf("Unexpected edits %+v", edits)
+	}
+}
@@ -0,0 +1,131 @@
+// Package backfill walks the comment history of repos page by page, keeping
+// a checkpoint so that it can be resumed, and backing off when GitHub rate
+// limits it.
+package backfill
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	gh "github.com/trstringer/comment-sentiment/pkg/github"
+)
+
+// DefaultMinRemaining is the rate limit left at which the backfill waits for
+// the limit to reset, so that webhook deliveries still have calls to use.
+const DefaultMinRemaining int = 500
+
+// maxRateLimitRetries is how often a page is retried after a rate limit.
+const maxRateLimitRetries int = 5
+
+// Lister lists a page of the comments of a kind in a repo.
+type Lister func(ctx context.Context, repo gh.Repository, kind gh.CommentKind, cursor string) (gh.CommentPage, error)
+
+// Processor analyzes a batch of comments. An error stops the backfill before
+// the batch is checkpointed, so that the batch is processed again when the
+// backfill is resumed.
+type Processor func(ctx context.Context, comments []gh.CommentPayload) error
+
+// Backfill walks the comments of repos.
+type Backfill struct {
+	List       Lister
+	Process    Processor
+	Checkpoint *Checkpoint
+	// Kinds are the kinds of comments to walk, gh.CommentKinds if empty.
+	Kinds []gh.CommentKind
+	// MinRemaining is the rate limit left at which to wait for the reset.
+	MinRemaining int
+	// Sleep waits for the duration, time.Sleep unless the context ends if
+	// nil.
+	Sleep func(ctx context.Context, d time.Duration) error
+}
+
+// Run backfills the repos one after the other, skipping what the checkpoint
+// has as done.
+func (b *Backfill) Run(ctx context.Context, repos []gh.Repository) error {
+	kinds := b.Kinds
+	if len(kinds) == 0 {
+		kinds = gh.CommentKinds
+	}
+	for _, repo := range repos {
+		for _, kind := range kinds {
+			if err := b.runKind(ctx, repo, kind); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (b *Backfill) runKind(ctx context.Context, repo gh.Repository, kind gh.CommentKind) error {
+	progress := b.Checkpoint.Progress(repo.FullName, kind)
+	if progress.Done {
+		log.Debug().Msgf("Already backfilled %s of %s, skipping", kind, repo.FullName)
+		return nil
+	}
+	log.Info().Msgf("Backfilling %s of %s", kind, repo.FullName)
+
+	for !progress.Done {
+		page, err := b.listPage(ctx, repo, kind, progress.Cursor)
+		if err != nil {
+			return err
+		}
+		if err := b.Process(ctx, page.Comments); err != nil {
+			return fmt.Errorf("error processing %s of %s: %w", kind, repo.FullName, err)
+		}
+
+		progress.Comments += len(page.Comments)
+		progress.Cursor = page.Next
+		progress.Done = page.Next == ""
+		if err := b.Checkpoint.SetProgress(repo.FullName, kind, progress); err != nil {
+			return err
+		}
+		log.Info().Msgf("Backfilled %d %s of %s", progress.Comments, kind, repo.FullName)
+
+		if page.Rate.Limit > 0 && page.Rate.Remaining < b.MinRemaining && !progress.Done {
+			wait := time.Until(page.Rate.Reset.Time)
+			log.Info().Msgf("%d GitHub API calls left, waiting %s for the rate limit to reset", page.Rate.Remaining, wait)
+			if err := b.sleep(ctx, wait); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// listPage lists the page, waiting out rate limits.
+func (b *Backfill) listPage(ctx context.Context, repo gh.Repository, kind gh.CommentKind, cursor string) (gh.CommentPage, error) {
+	for retry := 0; ; retry++ {
+		page, err := b.List(ctx, repo, kind, cursor)
+		if err == nil {
+			return page, nil
+		}
+		wait, rateLimited := gh.RateLimitWait(err)
+		if !rateLimited || retry >= maxRateLimitRetries {
+			return gh.CommentPage{}, err
+		}
+		log.Warn().Err(err).Msgf("Rate limited by GitHub, waiting %s", wait)
+		if err := b.sleep(ctx, wait); err != nil {
+			return gh.CommentPage{}, err
+		}
+	}
+}
+
+func (b *Backfill) sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	if b.Sleep != nil {
+		return b.Sleep(ctx, d)
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,139 @@
+package backfill
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	ghapi "github.com/google/go-github/v44/github"
+
+	gh "github.com/trstringer/comment-sentiment/pkg/github"
+)
+
+var testRepo = gh.Repository{FullName: "octo/a", Name: "a", Owner: gh.RepositoryOwner{Login: "octo"}}
+
+// pagedLister lists pages of two comments with numeric cursors.
+func pagedLister(pages int, listed *[]string) Lister {
+	return func(ctx context.Context, repo gh.Repository, kind gh.CommentKind, cursor string) (gh.CommentPage, error) {
+		*listed = append(*listed, string(kind)+":"+cursor)
+		page := 1
+		if cursor != "" {
+			page, _ = strconv.Atoi(cursor)
+		}
+		commentPage := gh.CommentPage{Comments: []gh.CommentPayload{{}, {}}}
+		if page < pages {
+			commentPage.Next = strconv.Itoa(page + 1)
+		}
+		return commentPage, nil
+	}
+}
+
+func TestBackfillResumes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	checkpoint, err := LoadCheckpoint(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	listed := []string{}
+	processed := 0
+	errStop := errors.New("stop")
+	backfill := &Backfill{
+		List:       pagedLister(3, &listed),
+		Checkpoint: checkpoint,
+		Kinds:      []gh.CommentKind{gh.IssueComments},
+		Process: func(ctx context.Context, comments []gh.CommentPayload) error {
+			if processed == 4 {
+				return errStop
+			}
+			processed += len(comments)
+			return nil
+		},
+	}
+	if err := backfill.Run(context.Background(), []gh.Repository{testRepo}); !errors.Is(err, errStop) {
+		t.Fatalf("Expected stop error, got %v", err)
+	}
+
+	checkpoint, err = LoadCheckpoint(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	progress := checkpoint.Progress(testRepo.FullName, gh.IssueComments)
+	if progress.Cursor != "3" || progress.Done || progress.Comments != 4 {
+		t.Fatalf("Unexpected progress %+v", progress)
+	}
+
+	listed = []string{}
+	backfill.Checkpoint = checkpoint
+	backfill.Process = func(ctx context.Context, comments []gh.CommentPayload) error { return nil }
+	if err := backfill.Run(context.Background(), []gh.Repository{testRepo}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(listed) != 1 || listed[0] != "issue_comments:3" {
+		t.Fatalf("Unexpected pages listed %v", listed)
+	}
+	progress = checkpoint.Progress(testRepo.FullName, gh.IssueComments)
+	if !progress.Done || progress.Comments != 6 {
+		t.Fatalf("Unexpected progress %+v", progress)
+	}
+
+	listed = []string{}
+	if err := backfill.Run(context.Background(), []gh.Repository{testRepo}); err != nil || len(listed) != 0 {
+		t.Fatalf("Expected nothing to backfill, listed %v: %v", listed, err)
+	}
+}
+
+func TestBackfillRateLimits(t *testing.T) {
+	checkpoint, _ := LoadCheckpoint("")
+	reset := time.Now().Add(time.Hour)
+	calls := 0
+	slept := []time.Duration{}
+	backfill := &Backfill{
+		Checkpoint:   checkpoint,
+		Kinds:        []gh.CommentKind{gh.ReviewComments},
+		MinRemaining: 10,
+		List: func(ctx context.Context, repo gh.Repository, kind gh.CommentKind, cursor string) (gh.CommentPage, error) {
+			calls++
+			switch calls {
+			case 1:
+				req := httptest.NewRequest(http.MethodGet, "/repos/octo/a/pulls/comments", nil)
+				return gh.CommentPage{}, &ghapi.AbuseRateLimitError{Response: &http.Response{Request: req}}
+			case 2:
+				return gh.CommentPage{Next: "2", Rate: ghapi.Rate{Limit: 5000, Remaining: 5, Reset: ghapi.Timestamp{Time: reset}}}, nil
+			default:
+				return gh.CommentPage{}, nil
+			}
+		},
+		Process: func(ctx context.Context, comments []gh.CommentPayload) error { return nil },
+		Sleep: func(ctx context.Context, d time.Duration) error {
+			slept = append(slept, d)
+			return nil
+		},
+	}
+	if err := backfill.Run(context.Background(), []gh.Repository{testRepo}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if calls != 3 || len(slept) != 2 || slept[0] != time.Minute || slept[1] < 59*time.Minute {
+		t.Fatalf("Unexpected %d calls and sleeps %v", calls, slept)
+	}
+}
+
+func TestBackfillStopsOnOtherErrors(t *testing.T) {
+	checkpoint, _ := LoadCheckpoint("")
+	errList := errors.New("not found")
+	backfill := &Backfill{
+		Checkpoint: checkpoint,
+		List: func(ctx context.Context, repo gh.Repository, kind gh.CommentKind, cursor string) (gh.CommentPage, error) {
+			return gh.CommentPage{}, errList
+		},
+		Process: func(ctx context.Context, comments []gh.CommentPayload) error { return nil },
+	}
+	if err := backfill.Run(context.Background(), []gh.Repository{testRepo}); !errors.Is(err, errList) {
+		t.Fatalf("Expected list error, got %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+package backfill
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	gh "github.com/trstringer/comment-sentiment/pkg/github"
+)
+
+// Progress is how far the comments of a kind in a repo are backfilled.
+type Progress struct {
+	// Cursor is the page to continue from.
+	Cursor string `json:"cursor,omitempty"`
+	// Done is set once every page is backfilled.
+	Done bool `json:"done,omitempty"`
+	// Comments counts the comments backfilled so far.
+	Comments int `json:"comments"`
+}
+
+// Checkpoint keeps the progress of a backfill in a JSON file, so that an
+// interrupted backfill continues where it stopped.
+type Checkpoint struct {
+	path  string
+	mu    sync.Mutex
+	repos map[string]map[gh.CommentKind]Progress
+}
+
+// LoadCheckpoint reads the checkpoint file, which does not need to exist yet.
+// A checkpoint without a path is kept in memory only.
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	checkpoint := &Checkpoint{path: path, repos: map[string]map[gh.CommentKind]Progress{}}
+	if path == "" {
+		return checkpoint, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return checkpoint, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading checkpoint file: %w", err)
+	}
+	if err := json.Unmarshal(data, &checkpoint.repos); err != nil {
+		return nil, fmt.Errorf("error unmarshalling checkpoint file: %w", err)
+	}
+	return checkpoint, nil
+}
+
+// Progress returns the progress of the comments of the kind in the repo.
+func (c *Checkpoint) Progress(repo string, kind gh.CommentKind) Progress {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.repos[repo][kind]
+}
+
+// SetProgress updates the progress of the comments of the kind in the repo
+// and saves the file.
+func (c *Checkpoint) SetProgress(repo string, kind gh.CommentKind, progress Progress) error {
+	c.mu.Lock()
+	if c.repos[repo] == nil {
+		c.repos[repo] = map[gh.CommentKind]Progress{}
+	}
+	c.repos[repo][kind] = progress
+	data, err := json.MarshalIndent(c.repos, "", "  ")
+	c.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("error marshalling checkpoint: %w", err)
+	}
+	if c.path == "" {
+		return nil
+	}
+
+	tmpPath := filepath.Join(filepath.Dir(c.path), fmt.Sprintf(".%s.tmp", filepath.Base(c.path)))
+	if err := ioutil.WriteFile(tmpPath, data, 0o600); err != nil {
+		return fmt.Errorf("error writing checkpoint file: %w", err)
+	}
+	if err := os.Rename(tmpPath, c.path); err != nil {
+		return fmt.Errorf("error saving checkpoint file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package budget
+
+import (
+	"context"
+	"errors"
+
+	"github.com/rs/zerolog/log"
+
+	sa "github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer"
+)
+
+type installationKey struct{}
+
+// WithInstallation sets the installation that the analyzed comment belongs
+// to, so that its quotas apply.
+func WithInstallation(ctx context.Context, installation string) context.Context {
+	return context.WithValue(ctx, installationKey{}, installation)
+}
+
+// InstallationFromContext returns the installation set with WithInstallation.
+func InstallationFromContext(ctx context.Context) string {
+	installation, _ := ctx.Value(installationKey{}).(string)
+	return installation
+}
+
+// Analyzer enforces the budget before calling a paid analyzer.
+type Analyzer struct {
+	analyzer sa.Analyzer
+	budget   *Budget
+	fallback sa.Analyzer
+}
+
+// NewAnalyzer creates an analyzer that reserves budget before each call to
+// analyzer. When a quota is exceeded, the fallback analyzer is used if there
+// is one, otherwise the *ExceededError is returned so that the caller can
+// skip or queue the comment.
+func NewAnalyzer(analyzer sa.Analyzer, budget *Budget, fallback sa.Analyzer) *Analyzer {
+	return &Analyzer{
+		analyzer: analyzer,
+		budget:   budget,
+		fallback: fallback,
+	}
+}
+
+// AnalyzeSentiment analyzes the text if the budget allows it.
+func (a Analyzer) AnalyzeSentiment(ctx context.Context, text string) (*sa.Analysis, error) {
+	err := a.budget.Reserve(InstallationFromContext(ctx), text)
+	if err == nil {
+		return a.analyzer.AnalyzeSentiment(ctx, text)
+	}
+
+	var exceeded *ExceededError
+	if !errors.As(err, &exceeded) || a.fallback == nil {
+		return nil, err
+	}
+
+	log.Warn().Err(err).Msg("Budget exceeded, using the offline provider")
+	analysis, err := a.fallback.AnalyzeSentiment(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+	if analysis != nil {
+		analysis.Degraded = true
+	}
+	return analysis, nil
+}
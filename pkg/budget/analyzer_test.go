@@ -0,0 +1,64 @@
+package budget
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	sa "github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer"
+)
+
+type fakeAnalyzer struct {
+	sentiment sa.Sentiment
+	calls     int
+}
+
+func (f *fakeAnalyzer) AnalyzeSentiment(ctx context.Context, text string) (*sa.Analysis, error) {
+	f.calls++
+	return &sa.Analysis{Sentiment: f.sentiment}, nil
+}
+
+func TestAnalyzeSentiment(t *testing.T) {
+	testCases := []struct {
+		name             string
+		withFallback     bool
+		expectedDegraded bool
+		expectExceeded   bool
+	}{
+		{name: "skip", withFallback: false, expectExceeded: true},
+		{name: "fallback", withFallback: true, expectedDegraded: true},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			paid := &fakeAnalyzer{sentiment: sa.Positive}
+			fallback := &fakeAnalyzer{sentiment: sa.Neutral}
+			budget := NewBudget(NewMemoryStore(), nil, []Quota{{Limit: 1, Unit: Records, Period: Day}})
+
+			var fallbackAnalyzer sa.Analyzer
+			if testCase.withFallback {
+				fallbackAnalyzer = fallback
+			}
+			analyzer := NewAnalyzer(paid, budget, fallbackAnalyzer)
+			ctx := WithInstallation(context.Background(), "1")
+
+			analysis, err := analyzer.AnalyzeSentiment(ctx, "first")
+			if err != nil || analysis.Degraded {
+				t.Fatalf("Expected the first call to be within budget, got %+v, %v", analysis, err)
+			}
+
+			analysis, err = analyzer.AnalyzeSentiment(ctx, "second")
+			var exceeded *ExceededError
+			if errors.As(err, &exceeded) != testCase.expectExceeded {
+				t.Fatalf("Unexpected error result: %v", err)
+			}
+			if !testCase.expectExceeded && analysis.Degraded != testCase.expectedDegraded {
+				t.Fatalf("Expected degraded %t, got %+v", testCase.expectedDegraded, analysis)
+			}
+			if paid.calls != 1 {
+				t.Fatalf("Expected the paid analyzer to be called once, got %d", paid.calls)
+			}
+		})
+	}
+}
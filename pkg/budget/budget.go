@@ -0,0 +1,325 @@
+// Package budget enforces quotas on calls to paid sentiment providers, both
+// globally and per GitHub App installation.
+package budget
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RecordSize is the number of characters in a billable text record.
+const RecordSize int64 = 1000
+
+// Unit is what a quota counts.
+type Unit string
+
+const (
+	// Characters counts the characters of the analyzed text.
+	Characters Unit = "characters"
+	// Records counts text records of up to RecordSize characters, which is
+	// how Azure bills.
+	Records Unit = "records"
+)
+
+// Period is how often a quota resets. Periods are in UTC.
+type Period string
+
+const (
+	// Day resets at midnight.
+	Day Period = "day"
+	// Month resets at midnight on the first of the month.
+	Month Period = "month"
+)
+
+// Action is what happens to a comment when a quota is exceeded.
+type Action string
+
+const (
+	// Skip leaves the comment alone.
+	Skip Action = "skip"
+	// Fallback analyzes the comment with the offline provider.
+	Fallback Action = "fallback"
+	// Queue analyzes the comment once the quota resets.
+	Queue Action = "queue"
+)
+
+// ParseAction validates an action name.
+func ParseAction(name string) (Action, error) {
+	switch Action(name) {
+	case Skip, Fallback, Queue:
+		return Action(name), nil
+	default:
+		return "", fmt.Errorf("unknown budget action %s", name)
+	}
+}
+
+// Quota limits the usage in each period.
+type Quota struct {
+	Limit  int64
+	Unit   Unit
+	Period Period
+}
+
+// ParseQuota parses a quota such as "100000 characters/month" or
+// "500 records/day".
+func ParseQuota(rawQuota string) (Quota, error) {
+	fields := strings.Fields(rawQuota)
+	if len(fields) != 2 {
+		return Quota{}, fmt.Errorf("invalid quota '%s', expected a limit and unit/period such as '500 records/day'", rawQuota)
+	}
+
+	limit, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil || limit < 0 {
+		return Quota{}, fmt.Errorf("invalid quota limit '%s'", fields[0])
+	}
+
+	parts := strings.SplitN(fields[1], "/", 2)
+	if len(parts) != 2 {
+		return Quota{}, fmt.Errorf("invalid quota '%s', expected unit/period", fields[1])
+	}
+	quota := Quota{Limit: limit}
+	switch parts[0] {
+	case "characters", "chars":
+		quota.Unit = Characters
+	case "records":
+		quota.Unit = Records
+	default:
+		return Quota{}, fmt.Errorf("unknown quota unit '%s'", parts[0])
+	}
+	switch parts[1] {
+	case "day":
+		quota.Period = Day
+	case "month":
+		quota.Period = Month
+	default:
+		return Quota{}, fmt.Errorf("unknown quota period '%s'", parts[1])
+	}
+
+	return quota, nil
+}
+
+// String formats the quota the way ParseQuota reads it.
+func (q Quota) String() string {
+	return fmt.Sprintf("%d %s/%s", q.Limit, q.Unit, q.Period)
+}
+
+// start returns the start of the period that t is in.
+func (q Quota) start(t time.Time) time.Time {
+	t = t.UTC()
+	if q.Period == Month {
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// reset returns when the period that t is in ends.
+func (q Quota) reset(t time.Time) time.Time {
+	if q.Period == Month {
+		return q.start(t).AddDate(0, 1, 0)
+	}
+	return q.start(t).AddDate(0, 0, 1)
+}
+
+// key identifies the usage counter of the scope for the period that t is in.
+func (q Quota) key(scope string, t time.Time) string {
+	layout := "2006-01-02"
+	if q.Period == Month {
+		layout = "2006-01"
+	}
+	return fmt.Sprintf("%s/%s/%s", scope, q.Period, q.start(t).Format(layout))
+}
+
+// Usage is an amount of analyzed text.
+type Usage struct {
+	Characters int64 `json:"characters"`
+	Records    int64 `json:"records"`
+}
+
+// UsageFor returns the usage of analyzing the text.
+func UsageFor(text string) Usage {
+	characters := int64(len([]rune(text)))
+	return Usage{
+		Characters: characters,
+		Records:    (characters + RecordSize - 1) / RecordSize,
+	}
+}
+
+func (u Usage) amount(unit Unit) int64 {
+	if unit == Records {
+		return u.Records
+	}
+	return u.Characters
+}
+
+// ExceededError is returned when analyzing a comment would exceed a quota.
+type ExceededError struct {
+	Scope   string
+	Quota   Quota
+	ResetAt time.Time
+}
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf(
+		"%s quota of %s exceeded until %s",
+		e.Scope,
+		e.Quota,
+		e.ResetAt.Format(time.RFC3339),
+	)
+}
+
+// GlobalScope is the scope of the quotas that apply to all installations.
+const GlobalScope string = "global"
+
+// Budget tracks usage against global and per-installation quotas.
+type Budget struct {
+	store        UsageStore
+	global       []Quota
+	installation []Quota
+	mu           sync.Mutex
+	now          func() time.Time
+}
+
+// NewBudget creates a budget that keeps usage in the store.
+func NewBudget(store UsageStore, global, installation []Quota) *Budget {
+	return &Budget{
+		store:        store,
+		global:       global,
+		installation: installation,
+		now:          time.Now,
+	}
+}
+
+func installationScope(installation string) string {
+	return fmt.Sprintf("installation/%s", installation)
+}
+
+type scopedQuota struct {
+	scope string
+	quota Quota
+}
+
+func (b *Budget) quotas(installation string) []scopedQuota {
+	quotas := []scopedQuota{}
+	for _, quota := range b.global {
+		quotas = append(quotas, scopedQuota{scope: GlobalScope, quota: quota})
+	}
+	if installation != "" {
+		for _, quota := range b.installation {
+			quotas = append(quotas, scopedQuota{scope: installationScope(installation), quota: quota})
+		}
+	}
+	return quotas
+}
+
+// Reserve records the usage of analyzing the text for the installation, or
+// returns an *ExceededError without recording anything if that would exceed a
+// quota. Only global quotas apply when installation is empty.
+func (b *Budget) Reserve(installation, text string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	usage := UsageFor(text)
+	quotas := b.quotas(installation)
+
+	var exceeded *ExceededError
+	for _, scoped := range quotas {
+		used, err := b.store.Usage(scoped.quota.key(scoped.scope, now))
+		if err != nil {
+			return fmt.Errorf("error getting usage: %w", err)
+		}
+		if used.amount(scoped.quota.Unit)+usage.amount(scoped.quota.Unit) <= scoped.quota.Limit {
+			continue
+		}
+		// Report the quota that resets last, as that is when the comment can
+		// be analyzed.
+		resetAt := scoped.quota.reset(now)
+		if exceeded == nil || resetAt.After(exceeded.ResetAt) {
+			exceeded = &ExceededError{Scope: scoped.scope, Quota: scoped.quota, ResetAt: resetAt}
+		}
+	}
+	if exceeded != nil {
+		return exceeded
+	}
+
+	// Quotas with the same scope and period share a counter.
+	keys := map[string]bool{}
+	for _, scoped := range quotas {
+		keys[scoped.quota.key(scoped.scope, now)] = true
+	}
+	for key := range keys {
+		if err := b.store.AddUsage(key, usage); err != nil {
+			return fmt.Errorf("error recording usage: %w", err)
+		}
+	}
+	return nil
+}
+
+// QuotaStatus is the usage of a quota in the current period.
+type QuotaStatus struct {
+	Quota     string    `json:"quota"`
+	Used      int64     `json:"used"`
+	Remaining int64     `json:"remaining"`
+	ResetAt   time.Time `json:"reset_at"`
+}
+
+// Status returns the usage of every quota in the current period, keyed by
+// scope. Installations without usage in the current period are left out.
+func (b *Budget) Status() (map[string][]QuotaStatus, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	installations := map[string]bool{}
+	if len(b.installation) > 0 {
+		prefix := installationScope("")
+		usages, err := b.store.ListUsage(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("error listing usage: %w", err)
+		}
+		for key := range usages {
+			installation := strings.SplitN(strings.TrimPrefix(key, prefix), "/", 2)[0]
+			for _, quota := range b.installation {
+				if quota.key(installationScope(installation), now) == key {
+					installations[installation] = true
+				}
+			}
+		}
+	}
+
+	status := map[string][]QuotaStatus{}
+	appendStatus := func(scoped scopedQuota) error {
+		used, err := b.store.Usage(scoped.quota.key(scoped.scope, now))
+		if err != nil {
+			return fmt.Errorf("error getting usage: %w", err)
+		}
+		remaining := scoped.quota.Limit - used.amount(scoped.quota.Unit)
+		if remaining < 0 {
+			remaining = 0
+		}
+		status[scoped.scope] = append(status[scoped.scope], QuotaStatus{
+			Quota:     scoped.quota.String(),
+			Used:      used.amount(scoped.quota.Unit),
+			Remaining: remaining,
+			ResetAt:   scoped.quota.reset(now),
+		})
+		return nil
+	}
+
+	for _, scoped := range b.quotas("") {
+		if err := appendStatus(scoped); err != nil {
+			return nil, err
+		}
+	}
+	for installation := range installations {
+		for _, quota := range b.installation {
+			if err := appendStatus(scopedQuota{scope: installationScope(installation), quota: quota}); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return status, nil
+}
@@ -0,0 +1,141 @@
+package budget
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseQuota(t *testing.T) {
+	testCases := []struct {
+		name      string
+		rawQuota  string
+		expected  Quota
+		expectErr bool
+	}{
+		{name: "records_per_day", rawQuota: "500 records/day", expected: Quota{Limit: 500, Unit: Records, Period: Day}},
+		{name: "chars_per_month", rawQuota: " 100000  chars/month", expected: Quota{Limit: 100000, Unit: Characters, Period: Month}},
+		{name: "missing_period", rawQuota: "500 records", expectErr: true},
+		{name: "unknown_unit", rawQuota: "500 words/day", expectErr: true},
+		{name: "unknown_period", rawQuota: "500 records/week", expectErr: true},
+		{name: "negative_limit", rawQuota: "-1 records/day", expectErr: true},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			actual, err := ParseQuota(testCase.rawQuota)
+			if (err != nil) != testCase.expectErr {
+				t.Fatalf("Unexpected error result: %v", err)
+			}
+			if actual != testCase.expected {
+				t.Fatalf("Expected %+v, got %+v", testCase.expected, actual)
+			}
+		})
+	}
+}
+
+func TestUsageFor(t *testing.T) {
+	usage := UsageFor(strings.Repeat("é", 1001))
+	if usage.Characters != 1001 || usage.Records != 2 {
+		t.Fatalf("Unexpected usage %+v", usage)
+	}
+}
+
+func TestReserve(t *testing.T) {
+	now := time.Date(2022, 5, 31, 23, 0, 0, 0, time.UTC)
+	budget := NewBudget(
+		NewMemoryStore(),
+		[]Quota{{Limit: 3, Unit: Records, Period: Month}},
+		[]Quota{{Limit: 10, Unit: Characters, Period: Day}},
+	)
+	budget.now = func() time.Time { return now }
+
+	if err := budget.Reserve("1", "123456"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var exceeded *ExceededError
+	err := budget.Reserve("1", "12345")
+	if !errors.As(err, &exceeded) {
+		t.Fatalf("Expected installation quota to be exceeded, got %v", err)
+	}
+	if exceeded.Scope != "installation/1" || !exceeded.ResetAt.Equal(time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("Unexpected exceeded error: %+v", exceeded)
+	}
+
+	// Another installation has its own daily quota but shares the global one.
+	if err := budget.Reserve("2", "12345"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := budget.Reserve("", "1"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = budget.Reserve("", "1")
+	if !errors.As(err, &exceeded) || exceeded.Scope != GlobalScope {
+		t.Fatalf("Expected global quota to be exceeded, got %v", err)
+	}
+
+	// A new month resets both quotas.
+	now = now.Add(2 * time.Hour)
+	if err := budget.Reserve("1", "12345"); err != nil {
+		t.Fatalf("Unexpected error after reset: %v", err)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	now := time.Date(2022, 5, 10, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	budget := NewBudget(
+		store,
+		[]Quota{{Limit: 100, Unit: Characters, Period: Month}},
+		[]Quota{{Limit: 10, Unit: Characters, Period: Day}},
+	)
+	budget.now = func() time.Time { return now.AddDate(0, 0, -1) }
+	if err := budget.Reserve("old", "12345"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	budget.now = func() time.Time { return now }
+	if err := budget.Reserve("1", "1234"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	status, err := budget.Status()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(status) != 2 {
+		t.Fatalf("Expected global and one installation, got %+v", status)
+	}
+	if global := status[GlobalScope][0]; global.Used != 9 || global.Remaining != 91 {
+		t.Fatalf("Unexpected global status %+v", global)
+	}
+	if installation := status["installation/1"][0]; installation.Used != 4 || installation.Remaining != 6 {
+		t.Fatalf("Unexpected installation status %+v", installation)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.json")
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := store.AddUsage("global/day/2022-05-10", Usage{Characters: 5, Records: 1}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	reopened, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	usage, err := reopened.Usage("global/day/2022-05-10")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if usage != (Usage{Characters: 5, Records: 1}) {
+		t.Fatalf("Unexpected usage after reopening %+v", usage)
+	}
+}
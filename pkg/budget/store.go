@@ -0,0 +1,111 @@
+package budget
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// UsageStore keeps usage counters by key.
+type UsageStore interface {
+	// Usage returns the usage of the key, which is zero for unknown keys.
+	Usage(key string) (Usage, error)
+	// AddUsage adds to the usage of the key.
+	AddUsage(key string, usage Usage) error
+	// ListUsage returns the usage of every key with the prefix.
+	ListUsage(prefix string) (map[string]Usage, error)
+}
+
+// MemoryStore keeps usage in memory, so it is lost on restart.
+type MemoryStore struct {
+	mu     sync.Mutex
+	usages map[string]Usage
+}
+
+// NewMemoryStore creates an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{usages: map[string]Usage{}}
+}
+
+// Usage returns the usage of the key.
+func (m *MemoryStore) Usage(key string) (Usage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.usages[key], nil
+}
+
+// AddUsage adds to the usage of the key.
+func (m *MemoryStore) AddUsage(key string, usage Usage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.usages[key] = Usage{
+		Characters: m.usages[key].Characters + usage.Characters,
+		Records:    m.usages[key].Records + usage.Records,
+	}
+	return nil
+}
+
+// ListUsage returns the usage of every key with the prefix.
+func (m *MemoryStore) ListUsage(prefix string) (map[string]Usage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	usages := map[string]Usage{}
+	for key, usage := range m.usages {
+		if strings.HasPrefix(key, prefix) {
+			usages[key] = usage
+		}
+	}
+	return usages, nil
+}
+
+// FileStore keeps usage in memory and writes it to a JSON file on every
+// change, so that usage survives restarts.
+type FileStore struct {
+	*MemoryStore
+	path string
+}
+
+// NewFileStore creates a store backed by the file at path, loading any usage
+// already in it.
+func NewFileStore(path string) (*FileStore, error) {
+	store := &FileStore{MemoryStore: NewMemoryStore(), path: path}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading usage file: %w", err)
+	}
+	if err := json.Unmarshal(data, &store.usages); err != nil {
+		return nil, fmt.Errorf("error unmarshalling usage file: %w", err)
+	}
+	return store, nil
+}
+
+// AddUsage adds to the usage of the key and saves the file.
+func (f *FileStore) AddUsage(key string, usage Usage) error {
+	if err := f.MemoryStore.AddUsage(key, usage); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	data, err := json.Marshal(f.usages)
+	f.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("error marshalling usage: %w", err)
+	}
+
+	tmpPath := filepath.Join(filepath.Dir(f.path), fmt.Sprintf(".%s.tmp", filepath.Base(f.path)))
+	if err := ioutil.WriteFile(tmpPath, data, 0o600); err != nil {
+		return fmt.Errorf("error writing usage file: %w", err)
+	}
+	if err := os.Rename(tmpPath, f.path); err != nil {
+		return fmt.Errorf("error saving usage file: %w", err)
+	}
+	return nil
+}
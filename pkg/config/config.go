@@ -0,0 +1,262 @@
+// Package config layers the values of command line flags from a config file
+// and environment variables. A flag set on the command line wins over its
+// environment variable, which wins over the config file, which wins over the
+// flag's default.
+package config
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix prefixes the environment variable of every flag.
+const EnvPrefix string = "COMMENT_SENTIMENT_"
+
+// EnvName returns the environment variable of a flag, such as
+// COMMENT_SENTIMENT_APP_ID for --app-id.
+func EnvName(flag string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(flag, "-", "_"))
+}
+
+// Errors are every problem found with a configuration, so that they can be
+// fixed at once.
+type Errors []error
+
+// Add adds a problem.
+func (e *Errors) Add(format string, args ...interface{}) {
+	*e = append(*e, fmt.Errorf(format, args...))
+}
+
+// Err returns the errors, or nil if there are none.
+func (e Errors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e Errors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	lines := []string{fmt.Sprintf("%d configuration errors:", len(e))}
+	for _, err := range e {
+		lines = append(lines, "  - "+err.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Values are flag values by flag name.
+type Values map[string]string
+
+// LoadFile reads a YAML, JSON or TOML config file, by its extension. Keys are flag
+// names, and nested keys are joined with "-", so that keyfile under language
+// sets --language-keyfile. Lists set flags that take several values.
+func LoadFile(path string) (Values, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %w", err)
+	}
+
+	var raw map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	case ".yaml", ".yml", ".json":
+		err = yaml.Unmarshal(data, &raw)
+	default:
+		return nil, fmt.Errorf("unknown config file type %s, expected .yaml, .yml, .json or .toml", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+
+	values := Values{}
+	if err := flatten(values, "", raw); err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+	return values, nil
+}
+
+func flatten(values Values, prefix string, raw map[string]interface{}) error {
+	for key, value := range raw {
+		name := key
+		if prefix != "" {
+			name = prefix + "-" + key
+		}
+		switch typed := value.(type) {
+		case nil:
+		case map[string]interface{}:
+			if err := flatten(values, name, typed); err != nil {
+				return err
+			}
+		case []map[string]interface{}:
+			return fmt.Errorf("%s can only list plain values", name)
+		case []interface{}:
+			items := []string{}
+			for _, item := range typed {
+				switch item.(type) {
+				case map[string]interface{}, []interface{}:
+					return fmt.Errorf("%s can only list plain values", name)
+				}
+				items = append(items, fmt.Sprint(item))
+			}
+			values[name] = joinList(items)
+		default:
+			values[name] = fmt.Sprint(typed)
+		}
+	}
+	return nil
+}
+
+// joinList joins the items the way list flags split them, quoting items with
+// commas.
+func joinList(items []string) string {
+	buffer := bytes.Buffer{}
+	writer := csv.NewWriter(&buffer)
+	// Writing to a buffer does not fail.
+	// nolint: errcheck
+	writer.Write(items)
+	writer.Flush()
+	return strings.TrimSuffix(buffer.String(), "\n")
+}
+
+// Loader applies the environment variables and a config file to flags, and
+// can apply them again when the file changes. Flags set on the command line
+// are never changed.
+type Loader struct {
+	flags       *pflag.FlagSet
+	path        string
+	known       func(name string) bool
+	commandLine map[string]bool
+}
+
+// NewLoader creates a loader of the config file at path, which is optional.
+// Keys of the file that are not flags of flags have to be accepted by known,
+// so that one file can configure several commands. It has to be created
+// after the command line is parsed.
+func NewLoader(flags *pflag.FlagSet, path string, known func(name string) bool) *Loader {
+	commandLine := map[string]bool{}
+	flags.Visit(func(flag *pflag.Flag) {
+		commandLine[flag.Name] = true
+	})
+	return &Loader{flags: flags, path: path, known: known, commandLine: commandLine}
+}
+
+// Flags returns the flags that the loader sets.
+func (l *Loader) Flags() *pflag.FlagSet {
+	return l.flags
+}
+
+// Load sets every flag that was not set on the command line from its
+// environment variable, or else from the config file, or else back to its
+// default. If validate is not nil and fails, or a value is invalid, the flags
+// are set back to their previous values. It returns the names of the flags
+// whose value changed.
+func (l *Loader) Load(validate func() error) ([]string, error) {
+	values := Values{}
+	if l.path != "" {
+		var err error
+		values, err = LoadFile(l.path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	errs := Errors{}
+	names := []string{}
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if l.flags.Lookup(name) == nil && !l.known(name) {
+			errs.Add("unknown config key %s", name)
+		}
+	}
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+
+	previous := map[string]string{}
+	changed := []string{}
+	l.flags.VisitAll(func(flag *pflag.Flag) {
+		if l.commandLine[flag.Name] {
+			return
+		}
+		value, source := defaultValue(flag), ""
+		if envValue, ok := os.LookupEnv(EnvName(flag.Name)); ok {
+			value, source = envValue, EnvName(flag.Name)
+		} else if fileValue, ok := values[flag.Name]; ok {
+			value, source = fileValue, "config key "+flag.Name
+		}
+
+		current := flagValue(flag)
+		if err := setFlag(flag, value); err != nil {
+			errs.Add("invalid %s: %v", source, err)
+			return
+		}
+		if flagValue(flag) != current {
+			previous[flag.Name] = current
+			changed = append(changed, flag.Name)
+		}
+	})
+
+	err := errs.Err()
+	if err == nil && validate != nil {
+		err = validate()
+	}
+	if err != nil {
+		for name, value := range previous {
+			// The previous value was valid.
+			// nolint: errcheck
+			setFlag(l.flags.Lookup(name), value)
+		}
+		return nil, err
+	}
+	return changed, nil
+}
+
+// flagValue returns the value of the flag in the form that setFlag accepts.
+func flagValue(flag *pflag.Flag) string {
+	if slice, ok := flag.Value.(pflag.SliceValue); ok {
+		return joinList(slice.GetSlice())
+	}
+	return flag.Value.String()
+}
+
+// defaultValue returns the default of the flag in the form that setFlag
+// accepts.
+func defaultValue(flag *pflag.Flag) string {
+	if _, ok := flag.Value.(pflag.SliceValue); ok {
+		return strings.TrimSuffix(strings.TrimPrefix(flag.DefValue, "["), "]")
+	}
+	return flag.DefValue
+}
+
+// setFlag sets the value of the flag. Lists replace the current items rather
+// than add to them.
+func setFlag(flag *pflag.Flag, value string) error {
+	slice, ok := flag.Value.(pflag.SliceValue)
+	if !ok {
+		return flag.Value.Set(value)
+	}
+	if value == "" {
+		return slice.Replace([]string{})
+	}
+	items, err := csv.NewReader(strings.NewReader(value)).Read()
+	if err != nil {
+		return err
+	}
+	return slice.Replace(items)
+}
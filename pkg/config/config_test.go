@@ -0,0 +1,280 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+func TestEnvName(t *testing.T) {
+	if name := EnvName("language-keyfile"); name != "COMMENT_SENTIMENT_LANGUAGE_KEYFILE" {
+		t.Fatalf("Unexpected env name %s", name)
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	expected := Values{
+		"port":               "9090",
+		"app-id":             "12",
+		"language-keyfile":   "/etc/key",
+		"language-timeout":   "10s",
+		"ensemble-providers": "azure,bayes",
+		"budget-global":      `"100 records/day, per repo",5000 characters/month`,
+		"shadow":             "true",
+	}
+
+	testCases := []struct {
+		name   string
+		file   string
+		data   string
+		hasErr bool
+	}{
+		{
+			name: "yaml",
+			file: "config.yaml",
+			data: `port: 9090
+app-id: 12
+language:
+  keyfile: /etc/key
+  timeout: 10s
+ensemble-providers: [azure, bayes]
+budget-global:
+  - 100 records/day, per repo
+  - 5000 characters/month
+shadow: true
+`,
+		},
+		{
+			name: "toml",
+			file: "config.toml",
+			data: `# Server
+port = 9_090
+app-id = 12
+ensemble-providers = [
+  "azure",
+  'bayes', # trailing comma
+]
+budget-global = ["100 records/day, per repo", "5000 characters/month"]
+shadow = true
+
+[language]
+keyfile = '/etc/key'
+"timeout" = "10s"
+`,
+		},
+		{
+			name: "toml dotted keys",
+			file: "config.toml",
+			data: `port = 9090
+app-id = 12
+language.keyfile = "/etc/key"
+language.timeout = "10s"
+ensemble-providers = ["azure", "bayes"]
+budget-global = ["100 records/day, per repo", "5000 characters/month"]
+shadow = true
+`,
+		},
+		{
+			name:   "toml unquoted string",
+			file:   "config.toml",
+			data:   "provider = bayes\n",
+			hasErr: true,
+		},
+		{
+			name:   "toml duplicate key",
+			file:   "config.toml",
+			data:   "port = 1\nport = 2\n",
+			hasErr: true,
+		},
+		{
+			name:   "toml unterminated string",
+			file:   "config.toml",
+			data:   "provider = \"bayes\n",
+			hasErr: true,
+		},
+		{
+			name: "json",
+			file: "config.json",
+			data: `{
+  "port": 9090,
+  "app-id": 12,
+  "language": {"keyfile": "/etc/key", "timeout": "10s"},
+  "ensemble-providers": ["azure", "bayes"],
+  "budget-global": ["100 records/day, per repo", "5000 characters/month"],
+  "shadow": true
+}
+`,
+		},
+		{
+			name:   "toml leading zero",
+			file:   "config.toml",
+			data:   "port = 010\n",
+			hasErr: true,
+		},
+		{
+			name:   "toml array of tables",
+			file:   "config.toml",
+			data:   "[[language]]\nkeyfile = \"/etc/key\"\n",
+			hasErr: true,
+		},
+		{
+			name:   "nested list",
+			file:   "config.yaml",
+			data:   "budget-global: [[1]]\n",
+			hasErr: true,
+		},
+		{
+			name:   "unknown extension",
+			file:   "config.ini",
+			data:   "port=1\n",
+			hasErr: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), testCase.file)
+			if err := ioutil.WriteFile(path, []byte(testCase.data), 0600); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			values, err := LoadFile(path)
+			if testCase.hasErr {
+				if err == nil {
+					t.Fatalf("Expected error, got %v", values)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(values, expected) {
+				t.Fatalf("Unexpected values %v", values)
+			}
+		})
+	}
+}
+
+func TestLoader(t *testing.T) {
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	port := flags.Int("port", 8080, "")
+	appID := flags.Int("app-id", 0, "")
+	provider := flags.String("provider", "azure", "")
+	timeout := flags.Duration("language-timeout", time.Second, "")
+	budget := flags.StringSlice("budget-global", nil, "")
+	if err := flags.Parse([]string{"--port", "1"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Setenv(EnvName("port"), "2")
+	t.Setenv(EnvName("app-id"), "3")
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig := func(data string) {
+		if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	writeConfig(`port: 4
+app-id: 5
+provider: bayes
+budget-global: ["1 records/day, x", 2 records/month]
+days: 7
+`)
+	known := func(name string) bool { return name == "days" }
+	loader := NewLoader(flags, path, known)
+	changed, err := loader.Load(nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if *port != 1 || *appID != 3 || *provider != "bayes" || *timeout != time.Second ||
+		!reflect.DeepEqual(*budget, []string{"1 records/day, x", "2 records/month"}) {
+		t.Fatalf("Unexpected flags %d %d %s %s %v", *port, *appID, *provider, *timeout, *budget)
+	}
+	if !reflect.DeepEqual(changed, []string{"app-id", "budget-global", "provider"}) {
+		t.Fatalf("Unexpected changed flags %v", changed)
+	}
+
+	writeConfig("budget-global: [3 records/day]\nlanguage-timeout: 2s\n")
+	changed, err = loader.Load(nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if *provider != "azure" || *timeout != 2*time.Second || !reflect.DeepEqual(*budget, []string{"3 records/day"}) ||
+		!reflect.DeepEqual(changed, []string{"budget-global", "language-timeout", "provider"}) {
+		t.Fatalf("Unexpected reload %s %s %v %v", *provider, *timeout, *budget, changed)
+	}
+
+	writeConfig("language-timeout: 3s\nprovider: openai\n")
+	_, err = loader.Load(func() error { return fmt.Errorf("invalid provider") })
+	if err == nil || *timeout != 2*time.Second || *provider != "azure" || !reflect.DeepEqual(*budget, []string{"3 records/day"}) {
+		t.Fatalf("Expected rollback, got %s %s %v: %v", *timeout, *provider, *budget, err)
+	}
+
+	writeConfig("prot: 1\nshadw: true\n")
+	_, err = loader.Load(nil)
+	errs, ok := err.(Errors)
+	if !ok || len(errs) != 2 || !strings.Contains(err.Error(), "unknown config key prot") {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	t.Setenv(EnvName("language-timeout"), "soon")
+	writeConfig("provider: bayes\ncache-size: high\n")
+	flags.Int("cache-size", 0, "")
+	_, err = loader.Load(nil)
+	if errs, ok := err.(Errors); !ok || len(errs) != 2 || *provider != "azure" {
+		t.Fatalf("Expected invalid env and config errors, got %v", err)
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "secret")
+	missing := filepath.Join(dir, "missing")
+	if err := ioutil.WriteFile(secret, []byte("a"), 0600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	watcher := NewWatcher([]string{secret, missing, ""})
+	if changed := watcher.Changed(); len(changed) != 0 {
+		t.Fatalf("Unexpected changes %v", changed)
+	}
+
+	// Rotate the secret the way mounted secrets are, by swapping a symlink.
+	rotated := filepath.Join(dir, "rotated")
+	if err := ioutil.WriteFile(rotated, []byte("b"), 0600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := os.Remove(secret); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if changed := watcher.Changed(); len(changed) != 0 {
+		t.Fatalf("Expected no change while the secret is missing, got %v", changed)
+	}
+	if err := os.Symlink(rotated, secret); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := ioutil.WriteFile(missing, []byte("c"), 0600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if changed := watcher.Changed(); !reflect.DeepEqual(changed, []string{missing, secret}) {
+		t.Fatalf("Unexpected changes %v", changed)
+	}
+	if changed := watcher.Changed(); len(changed) != 0 {
+		t.Fatalf("Unexpected changes %v", changed)
+	}
+
+	watcher.Watch([]string{rotated})
+	if err := ioutil.WriteFile(rotated, []byte("d"), 0600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if changed := watcher.Changed(); !reflect.DeepEqual(changed, []string{rotated}) {
+		t.Fatalf("Unexpected changes %v", changed)
+	}
+}
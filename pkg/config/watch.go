@@ -0,0 +1,64 @@
+package config
+
+import (
+	"crypto/sha256"
+	"io/ioutil"
+	"sort"
+)
+
+// Watcher finds the files whose content changed since they were last read.
+// Mounted secrets are rotated by swapping a symlink, so the content is
+// compared rather than the modification time. A Watcher is not safe for
+// concurrent use.
+type Watcher struct {
+	digests map[string][sha256.Size]byte
+}
+
+// NewWatcher creates a watcher of the files at paths.
+func NewWatcher(paths []string) *Watcher {
+	w := &Watcher{digests: map[string][sha256.Size]byte{}}
+	w.Watch(paths)
+	return w
+}
+
+// Watch replaces the watched files with the files at paths. Files that were
+// already watched keep their last content, so their changes are not lost.
+func (w *Watcher) Watch(paths []string) {
+	digests := map[string][sha256.Size]byte{}
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		if digest, ok := w.digests[path]; ok {
+			digests[path] = digest
+			continue
+		}
+		digests[path], _ = fileDigest(path)
+	}
+	w.digests = digests
+}
+
+// Changed returns the files whose content changed since the last call. Files
+// that cannot be read, such as while they are being replaced, are not
+// reported until they can be.
+func (w *Watcher) Changed() []string {
+	changed := []string{}
+	for path, previous := range w.digests {
+		digest, ok := fileDigest(path)
+		if !ok || digest == previous {
+			continue
+		}
+		w.digests[path] = digest
+		changed = append(changed, path)
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+func fileDigest(path string) ([sha256.Size]byte, bool) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return [sha256.Size]byte{}, false
+	}
+	return sha256.Sum256(data), true
+}
@@ -0,0 +1,337 @@
+// Package dashboard serves the community health dashboard. It is rendered on
+// the server from embedded templates and assets, and users log in with
+// GitHub to see the data of their own account and organizations.
+package dashboard
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/oauth2"
+
+	"github.com/trstringer/comment-sentiment/pkg/analytics"
+	"github.com/trstringer/comment-sentiment/pkg/store"
+)
+
+const (
+	// DefaultPath is where the dashboard is served when no path is
+	// configured.
+	DefaultPath string = "/dashboard"
+	// Scope lets the dashboard list the organizations of the user.
+	Scope string = "read:org"
+
+	defaultWeeks int = 12
+	maxThreads   int = 10
+)
+
+//go:embed templates/*.html
+var templateFiles embed.FS
+
+//go:embed static
+var staticFiles embed.FS
+
+// Config configures the dashboard.
+type Config struct {
+	Store store.AnalysisRepository
+	// OAuth is the configuration of the GitHub OAuth app. Its redirect URL
+	// has to be the callback path of the dashboard.
+	OAuth *oauth2.Config
+	// SessionKey signs the session cookies.
+	SessionKey []byte
+	// Path is where the dashboard is served, DefaultPath if empty.
+	Path string
+	// Identify looks up users when they log in, GitHubIdentity if nil.
+	Identify IdentifyFunc
+}
+
+// Dashboard serves the dashboard pages.
+type Dashboard struct {
+	config    Config
+	templates *template.Template
+	static    http.Handler
+}
+
+// New creates the dashboard.
+func New(config Config) (*Dashboard, error) {
+	if config.Store == nil {
+		return nil, fmt.Errorf("dashboard requires a store")
+	}
+	if config.OAuth == nil {
+		return nil, fmt.Errorf("dashboard requires an OAuth configuration")
+	}
+	if len(config.SessionKey) == 0 {
+		return nil, fmt.Errorf("dashboard requires a session key")
+	}
+	if config.Path == "" {
+		config.Path = DefaultPath
+	}
+	config.Path = strings.TrimSuffix(config.Path, "/")
+	if config.Identify == nil {
+		config.Identify = GitHubIdentity
+	}
+
+	templates, err := template.New("").Funcs(template.FuncMap{
+		"percent": percent,
+		"date":    func(t time.Time) string { return t.Format("2006-01-02") },
+	}).ParseFS(templateFiles, "templates/*.html")
+	if err != nil {
+		return nil, fmt.Errorf("error parsing dashboard templates: %w", err)
+	}
+
+	static, err := fs.Sub(staticFiles, "static")
+	if err != nil {
+		return nil, fmt.Errorf("error loading dashboard assets: %w", err)
+	}
+
+	return &Dashboard{
+		config:    config,
+		templates: templates,
+		static:    http.StripPrefix(config.Path+"/static/", http.FileServer(http.FS(static))),
+	}, nil
+}
+
+// Path is where the dashboard is served.
+func (d *Dashboard) Path() string {
+	return d.config.Path
+}
+
+// ServeHTTP routes the dashboard requests, which are every request under the
+// dashboard path.
+func (d *Dashboard) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	route := strings.TrimPrefix(req.URL.Path, d.config.Path)
+	if route == "" {
+		http.Redirect(resp, req, d.config.Path+"/", http.StatusFound)
+		return
+	}
+	route = strings.TrimPrefix(route, "/")
+
+	switch {
+	case strings.HasPrefix(route, "static/"):
+		d.static.ServeHTTP(resp, req)
+	case route == "login":
+		d.handleLogin(resp, req)
+	case route == "callback":
+		d.handleCallback(resp, req)
+	case route == "logout":
+		d.handleLogout(resp, req)
+	case route == "":
+		d.handleIndex(resp, req)
+	case !strings.Contains(route, "/"):
+		d.handleOwner(resp, req, route)
+	default:
+		http.NotFound(resp, req)
+	}
+}
+
+func (d *Dashboard) handleLogin(resp http.ResponseWriter, req *http.Request) {
+	state, err := newState()
+	if err != nil {
+		http.Error(resp, "Error starting login", http.StatusInternalServerError)
+		log.Error().Err(err).Msg("Error starting dashboard login")
+		return
+	}
+	d.setCookie(resp, stateCookie, state, stateTTL)
+	http.Redirect(resp, req, d.config.OAuth.AuthCodeURL(state), http.StatusFound)
+}
+
+func (d *Dashboard) handleCallback(resp http.ResponseWriter, req *http.Request) {
+	stateCookieValue, err := req.Cookie(stateCookie)
+	if err != nil || stateCookieValue.Value == "" || req.URL.Query().Get("state") != stateCookieValue.Value {
+		http.Error(resp, "Invalid login state, please log in again", http.StatusBadRequest)
+		return
+	}
+	d.clearCookie(resp, stateCookie)
+
+	token, err := d.config.OAuth.Exchange(req.Context(), req.URL.Query().Get("code"))
+	if err != nil {
+		http.Error(resp, "Error logging in with GitHub", http.StatusUnauthorized)
+		log.Warn().Err(err).Msg("Error exchanging dashboard OAuth code")
+		return
+	}
+	identity, err := d.config.Identify(req.Context(), token)
+	if err != nil {
+		http.Error(resp, "Error getting GitHub user", http.StatusInternalServerError)
+		log.Error().Err(err).Msg("Error identifying dashboard user")
+		return
+	}
+
+	value, err := d.newSession(identity, token, time.Now())
+	if err != nil {
+		http.Error(resp, "Error logging in", http.StatusInternalServerError)
+		log.Error().Err(err).Msg("Error creating dashboard session")
+		return
+	}
+	d.setCookie(resp, sessionCookie, value, sessionTTL)
+	log.Info().Msgf("User %s logged in to the dashboard", identity.Login)
+	http.Redirect(resp, req, d.config.Path+"/", http.StatusFound)
+}
+
+func (d *Dashboard) handleLogout(resp http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(resp, "Only POST supported", http.StatusMethodNotAllowed)
+		return
+	}
+	d.clearCookie(resp, sessionCookie)
+	http.Redirect(resp, req, d.config.Path+"/", http.StatusSeeOther)
+}
+
+type indexPage struct {
+	Title  string
+	Path   string
+	Login  string
+	Owners []string
+}
+
+func (d *Dashboard) handleIndex(resp http.ResponseWriter, req *http.Request) {
+	s, ok := d.currentSession(resp, req)
+	if !ok {
+		d.render(resp, "login.html", indexPage{Title: "Log in", Path: d.config.Path})
+		return
+	}
+	d.render(resp, "index.html", indexPage{
+		Title:  "Community health",
+		Path:   d.config.Path,
+		Login:  s.Identity.Login,
+		Owners: s.Identity.Owners,
+	})
+}
+
+type repoTrend struct {
+	Repo    string
+	Counts  analytics.Counts
+	Edits   analytics.EditStats
+	Buckets []analytics.TimeBucket
+}
+
+type ownerPage struct {
+	Title        string
+	Path         string
+	Login        string
+	Owner        string
+	Interval     analytics.Interval
+	Since        time.Time
+	Counts       analytics.Counts
+	Edits        analytics.EditStats
+	Repos        []repoTrend
+	Threads      []analytics.ThreadStats
+	CommentTypes []analytics.CommentTypeStats
+}
+
+func (d *Dashboard) handleOwner(resp http.ResponseWriter, req *http.Request, owner string) {
+	s, ok := d.currentSession(resp, req)
+	if !ok {
+		http.Redirect(resp, req, d.config.Path+"/login", http.StatusFound)
+		return
+	}
+	// Owners that the user cannot see are reported as missing, so that the
+	// dashboard does not tell which owners have data.
+	if !s.Identity.CanSee(owner) {
+		http.NotFound(resp, req)
+		return
+	}
+
+	page := ownerPage{
+		Title:    owner,
+		Path:     d.config.Path,
+		Login:    s.Identity.Login,
+		Owner:    owner,
+		Interval: analytics.Week,
+		Since:    time.Now().UTC().AddDate(0, 0, -7*defaultWeeks),
+	}
+	query := req.URL.Query()
+	if rawInterval := query.Get("interval"); rawInterval != "" {
+		interval, err := analytics.ParseInterval(rawInterval)
+		if err != nil {
+			http.Error(resp, err.Error(), http.StatusBadRequest)
+			return
+		}
+		page.Interval = interval
+	}
+	if rawSince := query.Get("since"); rawSince != "" {
+		since, err := time.Parse("2006-01-02", rawSince)
+		if err != nil {
+			http.Error(resp, fmt.Sprintf("invalid since %s", rawSince), http.StatusBadRequest)
+			return
+		}
+		page.Since = since
+	}
+
+	records, err := d.config.Store.ListAnalyses(req.Context(), store.Filter{Owner: owner, Since: page.Since})
+	if err != nil {
+		http.Error(resp, "Error reading analyses", http.StatusInternalServerError)
+		log.Error().Err(err).Msg("Error reading analyses for the dashboard")
+		return
+	}
+
+	latest := analytics.LatestVersions(records)
+	for _, record := range latest {
+		page.Counts.Add(record.Sentiment)
+	}
+	page.Edits = analytics.EditedToPositive(records)
+	page.Repos = repoTrends(records, page.Interval)
+	page.Threads = analytics.NegativeThreads(records)
+	if len(page.Threads) > maxThreads {
+		page.Threads = page.Threads[:maxThreads]
+	}
+	page.CommentTypes = analytics.CommentTypes(records)
+
+	d.render(resp, "owner.html", page)
+}
+
+// repoTrends splits the records by repo, most active repo first.
+func repoTrends(records []store.AnalysisRecord, interval analytics.Interval) []repoTrend {
+	byRepo := map[string][]store.AnalysisRecord{}
+	for _, record := range records {
+		byRepo[record.Repo] = append(byRepo[record.Repo], record)
+	}
+
+	trends := []repoTrend{}
+	for repo, repoRecords := range byRepo {
+		trend := repoTrend{
+			Repo:    repo,
+			Edits:   analytics.EditedToPositive(repoRecords),
+			Buckets: analytics.SentimentOverTime(repoRecords, interval),
+		}
+		for _, record := range analytics.LatestVersions(repoRecords) {
+			trend.Counts.Add(record.Sentiment)
+		}
+		trends = append(trends, trend)
+	}
+	sort.Slice(trends, func(i, j int) bool {
+		if trends[i].Counts.Total != trends[j].Counts.Total {
+			return trends[i].Counts.Total > trends[j].Counts.Total
+		}
+		return trends[i].Repo < trends[j].Repo
+	})
+	return trends
+}
+
+// render executes the template into a buffer first, so that a failing
+// template does not send half a page.
+func (d *Dashboard) render(resp http.ResponseWriter, name string, data interface{}) {
+	buffer := bytes.Buffer{}
+	if err := d.templates.ExecuteTemplate(&buffer, name, data); err != nil {
+		http.Error(resp, "Error rendering page", http.StatusInternalServerError)
+		log.Error().Err(err).Msgf("Error rendering dashboard template %s", name)
+		return
+	}
+	resp.Header().Set("Content-Type", "text/html; charset=utf-8")
+	// nolint: errcheck
+	buffer.WriteTo(resp)
+}
+
+// percent is the share of part in total, for bar widths.
+func percent(part, total int) string {
+	if total == 0 {
+		return "0"
+	}
+	return fmt.Sprintf("%.1f", 100*float64(part)/float64(total))
+}
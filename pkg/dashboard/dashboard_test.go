@@ -0,0 +1,297 @@
+package dashboard
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/trstringer/comment-sentiment/pkg/store"
+)
+
+type memoryStore struct {
+	records []store.AnalysisRecord
+}
+
+func (m *memoryStore) SaveAnalysis(ctx context.Context, record *store.AnalysisRecord) error {
+	m.records = append(m.records, *record)
+	return nil
+}
+
+func (m *memoryStore) ListAnalyses(ctx context.Context, filter store.Filter) ([]store.AnalysisRecord, error) {
+	records := []store.AnalysisRecord{}
+	for _, record := range m.records {
+		if filter.Matches(record) {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+func (m *memoryStore) EachAnalysis(ctx context.Context, filter store.Filter, fn func(store.AnalysisRecord) error) error {
+	for _, record := range m.records {
+		if !filter.Matches(record) {
+			continue
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) CommentHistory(ctx context.Context, commentKey string) ([]store.AnalysisRecord, error) {
+	records := []store.AnalysisRecord{}
+	for _, record := range m.records {
+		if record.CommentKey() == commentKey {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+func (m *memoryStore) Close() error {
+	return nil
+}
+
+func newTestDashboard(t *testing.T, tokenURL string) *Dashboard {
+	now := time.Now().UTC()
+	analyses := &memoryStore{records: []store.AnalysisRecord{
+		{Repo: "octo/a", ThreadNumber: 1, ThreadTitle: "Crash", CommentID: 1, CommentType: "issue_comment", Sentiment: "Negative", AnalyzedAt: now.Add(-time.Hour)},
+		{Repo: "octo/a", ThreadNumber: 1, CommentID: 1, CommentType: "issue_comment", Sentiment: "Positive", AnalyzedAt: now},
+		{Repo: "octo/b", ThreadNumber: 2, ThreadTitle: "Slow build <script>", CommentID: 2, CommentType: "issue_comment", Sentiment: "Negative", AnalyzedAt: now},
+		{Repo: "other/a", ThreadNumber: 3, ThreadTitle: "Secret thread", CommentID: 3, CommentType: "issue_comment", Sentiment: "Negative", AnalyzedAt: now},
+	}}
+
+	dashboard, err := New(Config{
+		Store: analyses,
+		OAuth: &oauth2.Config{
+			ClientID:     "client",
+			ClientSecret: "secret",
+			Endpoint:     oauth2.Endpoint{AuthURL: "https://github.com/login/oauth/authorize", TokenURL: tokenURL},
+			RedirectURL:  "https://example.com/dashboard/callback",
+			Scopes:       []string{Scope},
+		},
+		SessionKey: []byte("test-session-key"),
+		Identify: func(ctx context.Context, token *oauth2.Token) (Identity, error) {
+			return Identity{Login: "alice", Owners: []string{"alice", "octo"}}, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error creating dashboard: %v", err)
+	}
+	return dashboard
+}
+
+func serve(dashboard *Dashboard, req *http.Request) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	dashboard.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestSession(t *testing.T) {
+	dashboard := newTestDashboard(t, "")
+	now := time.Now()
+	value, err := dashboard.encodeSession(session{Identity: Identity{Login: "alice"}, Expires: now.Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("Unexpected error encoding session: %v", err)
+	}
+
+	if s, err := dashboard.decodeSession(value, now); err != nil || s.Identity.Login != "alice" {
+		t.Fatalf("Unexpected session %+v: %v", s, err)
+	}
+	if _, err := dashboard.decodeSession(value, now.Add(2*time.Hour)); err == nil {
+		t.Fatalf("Expected an error for an expired session")
+	}
+	// The data of another session with the signature of this one.
+	other, _ := dashboard.encodeSession(session{Identity: Identity{Login: "mallory"}, Expires: now.Add(time.Hour)})
+	otherData, _, _ := strings.Cut(other, ".")
+	_, signature, _ := strings.Cut(value, ".")
+	if _, err := dashboard.decodeSession(otherData+"."+signature, now); err == nil {
+		t.Fatalf("Expected an error for a tampered session")
+	}
+
+	otherKey := newTestDashboard(t, "")
+	otherKey.config.SessionKey = []byte("other-key")
+	if _, err := otherKey.decodeSession(value, now); err == nil {
+		t.Fatalf("Expected an error for a session signed with another key")
+	}
+}
+
+func TestSessionRefresh(t *testing.T) {
+	testCases := []struct {
+		name           string
+		identified     time.Duration
+		identity       Identity
+		identifyErr    error
+		expectedStatus int
+		expectedCookie bool
+	}{
+		{
+			name:           "recent",
+			identified:     -time.Minute,
+			identity:       Identity{Login: "alice", Owners: []string{"alice"}},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "still_member",
+			identified:     -identityTTL,
+			identity:       Identity{Login: "alice", Owners: []string{"alice", "octo"}},
+			expectedStatus: http.StatusOK,
+			expectedCookie: true,
+		},
+		{
+			name:           "removed_from_organization",
+			identified:     -identityTTL,
+			identity:       Identity{Login: "alice", Owners: []string{"alice"}},
+			expectedStatus: http.StatusNotFound,
+			expectedCookie: true,
+		},
+		{
+			name:           "token_revoked",
+			identified:     -identityTTL,
+			identifyErr:    errors.New("bad credentials"),
+			expectedStatus: http.StatusFound,
+			expectedCookie: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			dashboard := newTestDashboard(t, "")
+			dashboard.config.Identify = func(ctx context.Context, token *oauth2.Token) (Identity, error) {
+				if token.AccessToken != "token" {
+					t.Fatalf("Unexpected token %s", token.AccessToken)
+				}
+				return testCase.identity, testCase.identifyErr
+			}
+			now := time.Now()
+			encryptedToken, err := dashboard.encryptToken("token")
+			if err != nil {
+				t.Fatalf("Unexpected error encrypting token: %v", err)
+			}
+			value, err := dashboard.encodeSession(session{
+				Identity:   Identity{Login: "alice", Owners: []string{"alice", "octo"}},
+				Token:      encryptedToken,
+				Identified: now.Add(testCase.identified),
+				Expires:    now.Add(time.Hour),
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error encoding session: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/dashboard/octo", nil)
+			req.AddCookie(&http.Cookie{Name: sessionCookie, Value: value})
+			resp := serve(dashboard, req)
+			if resp.Code != testCase.expectedStatus {
+				t.Fatalf("Unexpected status %d, expected %d", resp.Code, testCase.expectedStatus)
+			}
+			if cookies := resp.Result().Cookies(); (len(cookies) > 0) != testCase.expectedCookie {
+				t.Fatalf("Unexpected cookies %+v", cookies)
+			}
+		})
+	}
+}
+
+func TestLogin(t *testing.T) {
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if err := req.ParseForm(); err != nil || req.Form.Get("code") != "good-code" {
+			resp.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		resp.Header().Set("Content-Type", "application/json")
+		// nolint: errcheck
+		resp.Write([]byte(`{"access_token": "token", "token_type": "bearer"}`))
+	}))
+	defer tokenServer.Close()
+	dashboard := newTestDashboard(t, tokenServer.URL)
+
+	login := serve(dashboard, httptest.NewRequest(http.MethodGet, "/dashboard/login", nil))
+	if login.Code != http.StatusFound || !strings.Contains(login.Header().Get("Location"), "scope=read%3Aorg") {
+		t.Fatalf("Expected a redirect to GitHub, got %d %s", login.Code, login.Header().Get("Location"))
+	}
+	stateCookieValue := login.Result().Cookies()[0]
+
+	wrongState := httptest.NewRequest(http.MethodGet, "/dashboard/callback?code=good-code&state=wrong", nil)
+	wrongState.AddCookie(stateCookieValue)
+	if resp := serve(dashboard, wrongState); resp.Code != http.StatusBadRequest {
+		t.Fatalf("Expected a mismatched state to be rejected, got %d", resp.Code)
+	}
+
+	callback := httptest.NewRequest(http.MethodGet, "/dashboard/callback?code=good-code&state="+stateCookieValue.Value, nil)
+	callback.AddCookie(stateCookieValue)
+	resp := serve(dashboard, callback)
+	if resp.Code != http.StatusFound {
+		t.Fatalf("Expected a redirect after login, got %d: %s", resp.Code, resp.Body.String())
+	}
+	var sessionCookieValue *http.Cookie
+	for _, cookie := range resp.Result().Cookies() {
+		if cookie.Name == sessionCookie {
+			sessionCookieValue = cookie
+		}
+	}
+	if sessionCookieValue == nil || !sessionCookieValue.Secure || !sessionCookieValue.HttpOnly {
+		t.Fatalf("Expected a secure session cookie, got %+v", sessionCookieValue)
+	}
+
+	index := httptest.NewRequest(http.MethodGet, "/dashboard/", nil)
+	index.AddCookie(sessionCookieValue)
+	if resp := serve(dashboard, index); !strings.Contains(resp.Body.String(), `href="/dashboard/octo"`) {
+		t.Fatalf("Expected the index to link to the organization, got %s", resp.Body.String())
+	}
+}
+
+func TestOwnerPage(t *testing.T) {
+	dashboard := newTestDashboard(t, "")
+	value, err := dashboard.encodeSession(session{
+		Identity:   Identity{Login: "alice", Owners: []string{"alice", "octo"}},
+		Identified: time.Now(),
+		Expires:    time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error encoding session: %v", err)
+	}
+	withSession := func(target string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.AddCookie(&http.Cookie{Name: sessionCookie, Value: value})
+		return req
+	}
+
+	if resp := serve(dashboard, httptest.NewRequest(http.MethodGet, "/dashboard/octo", nil)); resp.Code != http.StatusFound {
+		t.Fatalf("Expected a redirect to log in, got %d", resp.Code)
+	}
+	if resp := serve(dashboard, withSession("/dashboard/other")); resp.Code != http.StatusNotFound {
+		t.Fatalf("Expected another organization to be hidden, got %d", resp.Code)
+	}
+	if resp := serve(dashboard, withSession("/dashboard/octo?interval=year")); resp.Code != http.StatusBadRequest {
+		t.Fatalf("Expected an unknown interval to be rejected, got %d", resp.Code)
+	}
+
+	resp := serve(dashboard, withSession("/dashboard/octo?interval=day"))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected the page, got %d: %s", resp.Code, resp.Body.String())
+	}
+	body := resp.Body.String()
+	for _, expected := range []string{"octo/a", "octo/b", "Slow build &lt;script&gt;", "50.0%"} {
+		if !strings.Contains(body, expected) {
+			t.Fatalf("Expected the page to contain %q, got %s", expected, body)
+		}
+	}
+	if strings.Contains(body, "Secret thread") {
+		t.Fatalf("Expected the page to only show the organization's data")
+	}
+}
+
+func TestStatic(t *testing.T) {
+	dashboard := newTestDashboard(t, "")
+	resp := serve(dashboard, httptest.NewRequest(http.MethodGet, "/dashboard/static/style.css", nil))
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Header().Get("Content-Type"), "text/css") {
+		t.Fatalf("Expected the stylesheet, got %d %s", resp.Code, resp.Header().Get("Content-Type"))
+	}
+}
@@ -0,0 +1,60 @@
+package dashboard
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	ghapi "github.com/google/go-github/v44/github"
+	"golang.org/x/oauth2"
+)
+
+// Identity is a GitHub user that logged in to the dashboard.
+type Identity struct {
+	Login string `json:"login"`
+	// Owners are the user and the organizations they are a member of, which
+	// are the owners whose data they can see.
+	Owners []string `json:"owners"`
+}
+
+// CanSee indicates if the user can see the data of the repo owner.
+func (i Identity) CanSee(owner string) bool {
+	for _, allowed := range i.Owners {
+		if strings.EqualFold(allowed, owner) {
+			return true
+		}
+	}
+	return false
+}
+
+// IdentifyFunc looks up the identity of the user of an OAuth token.
+type IdentifyFunc func(ctx context.Context, token *oauth2.Token) (Identity, error)
+
+// GitHubIdentity looks up the user of the token and their organizations with
+// the GitHub API. Memberships of private organizations are only listed with
+// the read:org scope.
+func GitHubIdentity(ctx context.Context, token *oauth2.Token) (Identity, error) {
+	client := ghapi.NewClient(oauth2.NewClient(ctx, oauth2.StaticTokenSource(token)))
+
+	user, _, err := client.Users.Get(ctx, "")
+	if err != nil {
+		return Identity{}, fmt.Errorf("error getting GitHub user: %w", err)
+	}
+	identity := Identity{Login: user.GetLogin(), Owners: []string{user.GetLogin()}}
+
+	options := &ghapi.ListOptions{PerPage: 100}
+	for {
+		orgs, resp, err := client.Organizations.List(ctx, "", options)
+		if err != nil {
+			return Identity{}, fmt.Errorf("error listing organizations of %s: %w", identity.Login, err)
+		}
+		for _, org := range orgs {
+			identity.Owners = append(identity.Owners, org.GetLogin())
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		options.Page = resp.NextPage
+	}
+	return identity, nil
+}
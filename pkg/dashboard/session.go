@@ -0,0 +1,223 @@
+package dashboard
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/oauth2"
+)
+
+const (
+	sessionCookie string        = "comment_sentiment_session"
+	stateCookie   string        = "comment_sentiment_oauth_state"
+	sessionTTL    time.Duration = 8 * time.Hour
+	stateTTL      time.Duration = 10 * time.Minute
+	// identityTTL is how long the organizations of a session are trusted
+	// before they are looked up again, so that users removed from an
+	// organization lose access to its data.
+	identityTTL time.Duration = 15 * time.Minute
+)
+
+// session is stored in a cookie signed with the session key, so that the
+// server keeps no state and replicas can share sessions.
+type session struct {
+	Identity Identity `json:"identity"`
+	// Token is the OAuth token of the user, encrypted with the session key,
+	// to look up the identity again.
+	Token      string    `json:"token,omitempty"`
+	Identified time.Time `json:"identified"`
+	Expires    time.Time `json:"expires"`
+}
+
+// NewSessionKey generates a random key to sign sessions with.
+func NewSessionKey() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("error generating session key: %w", err)
+	}
+	return key, nil
+}
+
+func (d *Dashboard) sign(data []byte) []byte {
+	mac := hmac.New(sha256.New, d.config.SessionKey)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func (d *Dashboard) encodeSession(s session) (string, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return "", fmt.Errorf("error marshalling session: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data) + "." +
+		base64.RawURLEncoding.EncodeToString(d.sign(data)), nil
+}
+
+func (d *Dashboard) decodeSession(value string, now time.Time) (session, error) {
+	s := session{}
+	encodedData, encodedSignature, found := strings.Cut(value, ".")
+	if !found {
+		return s, fmt.Errorf("malformed session")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(encodedData)
+	if err != nil {
+		return s, fmt.Errorf("malformed session: %w", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return s, fmt.Errorf("malformed session: %w", err)
+	}
+	if !hmac.Equal(signature, d.sign(data)) {
+		return s, fmt.Errorf("invalid session signature")
+	}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return s, fmt.Errorf("error unmarshalling session: %w", err)
+	}
+	if !now.Before(s.Expires) {
+		return s, fmt.Errorf("session expired")
+	}
+	return s, nil
+}
+
+// tokenCipher encrypts the OAuth tokens of sessions with a key derived from
+// the session key.
+func (d *Dashboard) tokenCipher() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(d.sign([]byte("session token")))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (d *Dashboard) encryptToken(token string) (string, error) {
+	aead, err := d.tokenCipher()
+	if err != nil {
+		return "", fmt.Errorf("error encrypting session token: %w", err)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("error encrypting session token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(aead.Seal(nonce, nonce, []byte(token), nil)), nil
+}
+
+func (d *Dashboard) decryptToken(encrypted string) (string, error) {
+	aead, err := d.tokenCipher()
+	if err != nil {
+		return "", fmt.Errorf("error decrypting session token: %w", err)
+	}
+	data, err := base64.RawURLEncoding.DecodeString(encrypted)
+	if err != nil || len(data) < aead.NonceSize() {
+		return "", fmt.Errorf("malformed session token")
+	}
+	token, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("error decrypting session token: %w", err)
+	}
+	return string(token), nil
+}
+
+// newSession creates the session of a user who logged in with token.
+func (d *Dashboard) newSession(identity Identity, token *oauth2.Token, now time.Time) (string, error) {
+	encryptedToken, err := d.encryptToken(token.AccessToken)
+	if err != nil {
+		return "", err
+	}
+	return d.encodeSession(session{
+		Identity:   identity,
+		Token:      encryptedToken,
+		Identified: now,
+		Expires:    now.Add(sessionTTL),
+	})
+}
+
+// refreshIdentity looks up the identity of the session again with its token
+// once identityTTL passed.
+func (d *Dashboard) refreshIdentity(ctx context.Context, s session, now time.Time) (session, bool, error) {
+	if now.Sub(s.Identified) < identityTTL {
+		return s, false, nil
+	}
+	token, err := d.decryptToken(s.Token)
+	if err != nil {
+		return s, false, err
+	}
+	identity, err := d.config.Identify(ctx, &oauth2.Token{AccessToken: token})
+	if err != nil {
+		return s, false, err
+	}
+	s.Identity, s.Identified = identity, now
+	return s, true, nil
+}
+
+// currentSession returns the session of the request, if there is a valid
+// one. The identity of the session is looked up again once identityTTL
+// passed, and the session ends if that fails, such as when the user revoked
+// the token.
+func (d *Dashboard) currentSession(resp http.ResponseWriter, req *http.Request) (session, bool) {
+	cookie, err := req.Cookie(sessionCookie)
+	if err != nil {
+		return session{}, false
+	}
+	now := time.Now()
+	s, err := d.decodeSession(cookie.Value, now)
+	if err != nil {
+		return session{}, false
+	}
+	s, refreshed, err := d.refreshIdentity(req.Context(), s, now)
+	if err != nil {
+		log.Warn().Err(err).Msgf("Error refreshing dashboard identity of %s, ending the session", s.Identity.Login)
+		d.clearCookie(resp, sessionCookie)
+		return session{}, false
+	}
+	if refreshed {
+		value, err := d.encodeSession(s)
+		if err != nil {
+			log.Error().Err(err).Msg("Error updating dashboard session")
+			return session{}, false
+		}
+		d.setCookie(resp, sessionCookie, value, s.Expires.Sub(now))
+	}
+	return s, true
+}
+
+func (d *Dashboard) setCookie(resp http.ResponseWriter, name, value string, ttl time.Duration) {
+	http.SetCookie(resp, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     d.config.Path,
+		MaxAge:   int(ttl.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(d.config.OAuth.RedirectURL, "https://"),
+		// Lax, so that the cookies are sent on the redirect back from GitHub.
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (d *Dashboard) clearCookie(resp http.ResponseWriter, name string) {
+	http.SetCookie(resp, &http.Cookie{
+		Name:     name,
+		Path:     d.config.Path,
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+}
+
+func newState() (string, error) {
+	state := make([]byte, 16)
+	if _, err := rand.Read(state); err != nil {
+		return "", fmt.Errorf("error generating OAuth state: %w", err)
+	}
+	return hex.EncodeToString(state), nil
+}
@@ -0,0 +1,138 @@
+// Package digest compiles and renders the weekly community health digest of
+// a repo, and schedules it.
+package digest
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/trstringer/comment-sentiment/pkg/analytics"
+	gh "github.com/trstringer/comment-sentiment/pkg/github"
+	"github.com/trstringer/comment-sentiment/pkg/store"
+)
+
+// Period is the time a digest covers.
+const Period time.Duration = 7 * 24 * time.Hour
+
+const (
+	maxContributors int = 5
+	maxThreads      int = 5
+)
+
+//go:embed digest.md.tmpl
+var defaultTemplate string
+
+// Digest is the community health of a repo over a week.
+type Digest struct {
+	Repo  string
+	Start time.Time
+	End   time.Time
+	// Counts are the comments of the week, and PreviousCounts the comments
+	// of the week before.
+	Counts         analytics.Counts
+	PreviousCounts analytics.Counts
+	// Contributors wrote the most positive comments of the week.
+	Contributors []analytics.AuthorStats
+	// Threads had the most negative comments of the week.
+	Threads []analytics.ThreadStats
+}
+
+// Compile creates the digest of the repo for the week that ends at end. The
+// records need to cover the week before too, for the trend.
+func Compile(repo string, records []store.AnalysisRecord, end time.Time) Digest {
+	digest := Digest{Repo: repo, Start: end.Add(-Period), End: end}
+
+	week := []store.AnalysisRecord{}
+	for _, record := range analytics.LatestVersions(records) {
+		switch {
+		case record.Repo != repo || !record.AnalyzedAt.Before(end):
+			continue
+		case !record.AnalyzedAt.Before(digest.Start):
+			week = append(week, record)
+			digest.Counts.Add(record.Sentiment)
+		case !record.AnalyzedAt.Before(digest.Start.Add(-Period)):
+			digest.PreviousCounts.Add(record.Sentiment)
+		}
+	}
+
+	for _, author := range analytics.Authors(week) {
+		if author.Positive > 0 {
+			digest.Contributors = append(digest.Contributors, author)
+		}
+	}
+	sort.SliceStable(digest.Contributors, func(i, j int) bool {
+		return digest.Contributors[i].Positive > digest.Contributors[j].Positive
+	})
+	if len(digest.Contributors) > maxContributors {
+		digest.Contributors = digest.Contributors[:maxContributors]
+	}
+
+	digest.Threads = analytics.NegativeThreads(week)
+	if len(digest.Threads) > maxThreads {
+		digest.Threads = digest.Threads[:maxThreads]
+	}
+	return digest
+}
+
+// NegativeTrend is the change of the share of negative comments since the
+// previous week, in percentage points.
+func (d Digest) NegativeTrend() float64 {
+	return 100 * (d.Counts.NegativeRatio() - d.PreviousCounts.NegativeRatio())
+}
+
+// Template renders digests. It defines a "title" and a "body" template.
+type Template struct {
+	template *template.Template
+}
+
+// DefaultTemplate is the template used when no other is configured.
+func DefaultTemplate() *Template {
+	t, err := ParseTemplate(defaultTemplate)
+	if err != nil {
+		panic(fmt.Sprintf("invalid default digest template: %v", err))
+	}
+	return t
+}
+
+// ParseTemplate parses a Go text/template that defines a "title" and a
+// "body" template, with a Digest as data. Text from GitHub, such as thread
+// titles, is escaped with the markdown function.
+func ParseTemplate(text string) (*Template, error) {
+	t, err := template.New("digest").Funcs(template.FuncMap{
+		"date": func(t time.Time) string { return t.Format("2006-01-02") },
+		"percent": func(ratio float64) string {
+			return fmt.Sprintf("%.1f%%", 100*ratio)
+		},
+		"signed": func(value float64) string {
+			return fmt.Sprintf("%+.1f", value)
+		},
+		"markdown": gh.EscapeMarkdown,
+	}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing digest template: %w", err)
+	}
+	for _, name := range []string{"title", "body"} {
+		if t.Lookup(name) == nil {
+			return nil, fmt.Errorf("digest template does not define %q", name)
+		}
+	}
+	return &Template{template: t}, nil
+}
+
+// Render renders the title and body of the digest.
+func (t *Template) Render(digest Digest) (string, string, error) {
+	title := bytes.Buffer{}
+	if err := t.template.ExecuteTemplate(&title, "title", digest); err != nil {
+		return "", "", fmt.Errorf("error rendering digest title: %w", err)
+	}
+	body := bytes.Buffer{}
+	if err := t.template.ExecuteTemplate(&body, "body", digest); err != nil {
+		return "", "", fmt.Errorf("error rendering digest body: %w", err)
+	}
+	return strings.TrimSpace(title.String()), strings.TrimSpace(body.String()) + "\n", nil
+}
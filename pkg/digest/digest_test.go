@@ -0,0 +1,76 @@
+package digest
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/trstringer/comment-sentiment/pkg/store"
+)
+
+var end = time.Date(2022, 5, 16, 9, 0, 0, 0, time.UTC)
+
+var records = []store.AnalysisRecord{
+	// The week before.
+	{Repo: "octo/a", CommentID: 1, CommentType: "issue_comment", Author: "alice", Sentiment: "Positive", AnalyzedAt: end.AddDate(0, 0, -10)},
+	{Repo: "octo/a", CommentID: 2, CommentType: "issue_comment", Author: "bob", Sentiment: "Positive", AnalyzedAt: end.AddDate(0, 0, -9)},
+	// The week.
+	{Repo: "octo/a", ThreadNumber: 4, ThreadTitle: "Flaky *test* @bob", ThreadURL: "https://github.com/octo/a/issues/4", CommentID: 3, CommentType: "issue_comment", Author: "bob", Sentiment: "Negative", AnalyzedAt: end.AddDate(0, 0, -3)},
+	{Repo: "octo/a", ThreadNumber: 4, CommentID: 4, CommentType: "issue_comment", Author: "carol", Sentiment: "Positive", AnalyzedAt: end.AddDate(0, 0, -2)},
+	{Repo: "octo/a", ThreadNumber: 5, CommentID: 5, CommentType: "issue_comment", Author: "carol", Sentiment: "Positive", AnalyzedAt: end.AddDate(0, 0, -1)},
+	{Repo: "octo/a", ThreadNumber: 5, CommentID: 6, CommentType: "issue_comment", Author: "alice", Sentiment: "Positive", AnalyzedAt: end.Add(-time.Hour)},
+	// Another repo and after the week.
+	{Repo: "octo/b", CommentID: 7, CommentType: "issue_comment", Author: "mallory", Sentiment: "Positive", AnalyzedAt: end.AddDate(0, 0, -1)},
+	{Repo: "octo/a", CommentID: 8, CommentType: "issue_comment", Author: "mallory", Sentiment: "Positive", AnalyzedAt: end},
+}
+
+func TestCompile(t *testing.T) {
+	digest := Compile("octo/a", records, end)
+	if digest.Counts.Total != 4 || digest.Counts.Negative != 1 || digest.PreviousCounts.Total != 2 {
+		t.Fatalf("Unexpected counts %+v and %+v", digest.Counts, digest.PreviousCounts)
+	}
+	if digest.NegativeTrend() != 25 {
+		t.Fatalf("Expected a trend of 25 points, got %f", digest.NegativeTrend())
+	}
+	if len(digest.Contributors) != 2 || digest.Contributors[0].Author != "carol" || digest.Contributors[1].Author != "alice" {
+		t.Fatalf("Unexpected contributors %+v", digest.Contributors)
+	}
+	if len(digest.Threads) != 1 || digest.Threads[0].Number != 4 {
+		t.Fatalf("Unexpected threads %+v", digest.Threads)
+	}
+}
+
+func TestRender(t *testing.T) {
+	title, body, err := DefaultTemplate().Render(Compile("octo/a", records, end))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if title != "Community health digest for octo/a, week of 2022-05-09" {
+		t.Fatalf("Unexpected title %q", title)
+	}
+	for _, expected := range []string{
+		"| Negative | 1 | 0 |",
+		"25.0% of the comments were negative, +25.0 percentage points",
+		"- `carol` for 2 positive comments",
+		"- `alice` for 1 positive comment\n",
+		"- [octo/a#4](https://github.com/octo/a/issues/4) Flaky \\*test\\* \\@bob: 1 of 2 comments negative",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Fatalf("Expected the body to contain %q, got:\n%s", expected, body)
+		}
+	}
+}
+
+func TestParseTemplate(t *testing.T) {
+	if _, err := ParseTemplate(`{{define "title"}}Digest{{end}}`); err == nil {
+		t.Fatalf("Expected an error for a template without a body")
+	}
+	custom, err := ParseTemplate(`{{define "title"}}{{.Repo}}{{end}}{{define "body"}}{{.Counts.Total}} comments{{end}}`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	title, body, err := custom.Render(Compile("octo/a", records, end))
+	if err != nil || title != "octo/a" || body != "4 comments\n" {
+		t.Fatalf("Unexpected render %q %q: %v", title, body, err)
+	}
+}
@@ -0,0 +1,152 @@
+package digest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a cron expression with the five standard fields: minute, hour,
+// day of month, month and day of week. Times are in UTC.
+type Schedule struct {
+	minutes     map[int]bool
+	hours       map[int]bool
+	daysOfMonth map[int]bool
+	months      map[int]bool
+	daysOfWeek  map[int]bool
+	// Like cron, when both days are restricted a time matches either.
+	anyDayOfMonth bool
+	anyDayOfWeek  bool
+}
+
+type field struct {
+	name string
+	min  int
+	max  int
+}
+
+var fields = []field{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12},
+	{name: "day of week", min: 0, max: 7},
+}
+
+// ParseSchedule parses a cron expression such as "0 9 * * 1" for Mondays at
+// 09:00 UTC. Fields can be *, numbers, ranges such as 1-5, lists such as 1,3
+// and steps such as */15. Sunday is 0 or 7.
+func ParseSchedule(expression string) (Schedule, error) {
+	parts := strings.Fields(expression)
+	if len(parts) != len(fields) {
+		return Schedule{}, fmt.Errorf("schedule %q must have %d fields", expression, len(fields))
+	}
+
+	values := make([]map[int]bool, len(fields))
+	for i, part := range parts {
+		parsed, err := parseField(part, fields[i])
+		if err != nil {
+			return Schedule{}, fmt.Errorf("invalid schedule %q: %w", expression, err)
+		}
+		values[i] = parsed
+	}
+	if values[4][7] {
+		values[4][0] = true
+	}
+
+	return Schedule{
+		minutes:       values[0],
+		hours:         values[1],
+		daysOfMonth:   values[2],
+		months:        values[3],
+		daysOfWeek:    values[4],
+		anyDayOfMonth: parts[2] == "*",
+		anyDayOfWeek:  parts[4] == "*",
+	}, nil
+}
+
+func parseField(value string, f field) (map[int]bool, error) {
+	values := map[int]bool{}
+	for _, item := range strings.Split(value, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepPart)
+			if err != nil || step < 1 {
+				return nil, fmt.Errorf("invalid step %s in %s", stepPart, f.name)
+			}
+		}
+
+		start, end := f.min, f.max
+		if rangePart != "*" {
+			startPart, endPart, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if start, err = parseValue(startPart, f); err != nil {
+				return nil, err
+			}
+			end = start
+			if isRange {
+				if end, err = parseValue(endPart, f); err != nil {
+					return nil, err
+				}
+			} else if hasStep {
+				end = f.max
+			}
+			if end < start {
+				return nil, fmt.Errorf("invalid range %s in %s", rangePart, f.name)
+			}
+		}
+
+		for v := start; v <= end; v += step {
+			values[v] = true
+		}
+	}
+	return values, nil
+}
+
+func parseValue(value string, f field) (int, error) {
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < f.min || parsed > f.max {
+		return 0, fmt.Errorf("invalid %s %s, must be %d-%d", f.name, value, f.min, f.max)
+	}
+	return parsed, nil
+}
+
+// Next returns the first time after t that matches the schedule.
+func (s Schedule) Next(t time.Time) time.Time {
+	next := t.UTC().Truncate(time.Minute).Add(time.Minute)
+	// Every schedule matches within a few years, such as on February 29.
+	limit := next.AddDate(5, 0, 0)
+	for next.Before(limit) {
+		switch {
+		case !s.months[int(next.Month())]:
+			next = time.Date(next.Year(), next.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !s.matchesDay(next):
+			next = time.Date(next.Year(), next.Month(), next.Day()+1, 0, 0, 0, 0, time.UTC)
+		case !s.hours[next.Hour()]:
+			next = next.Truncate(time.Hour).Add(time.Hour)
+		case !s.minutes[next.Minute()]:
+			next = next.Add(time.Minute)
+		default:
+			return next
+		}
+	}
+	return time.Time{}
+}
+
+func (s Schedule) matchesDay(t time.Time) bool {
+	dayOfMonth := s.daysOfMonth[t.Day()]
+	dayOfWeek := s.daysOfWeek[int(t.Weekday())]
+	switch {
+	case s.anyDayOfMonth && s.anyDayOfWeek:
+		return true
+	case s.anyDayOfMonth:
+		return dayOfWeek
+	case s.anyDayOfWeek:
+		return dayOfMonth
+	default:
+		return dayOfMonth || dayOfWeek
+	}
+}
@@ -0,0 +1,46 @@
+package digest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedule(t *testing.T) {
+	// A Wednesday.
+	now := time.Date(2022, 5, 11, 10, 30, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name       string
+		expression string
+		expected   time.Time
+		expectErr  bool
+	}{
+		{name: "weekly", expression: "0 9 * * 1", expected: time.Date(2022, 5, 16, 9, 0, 0, 0, time.UTC)},
+		{name: "sunday_as_7", expression: "0 9 * * 7", expected: time.Date(2022, 5, 15, 9, 0, 0, 0, time.UTC)},
+		{name: "step", expression: "*/15 * * * *", expected: time.Date(2022, 5, 11, 10, 45, 0, 0, time.UTC)},
+		{name: "range_and_list", expression: "0 8,12 * * 1-5", expected: time.Date(2022, 5, 11, 12, 0, 0, 0, time.UTC)},
+		{name: "monthly", expression: "0 0 1 * *", expected: time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "day_of_month_or_week", expression: "0 0 20 * 5", expected: time.Date(2022, 5, 13, 0, 0, 0, 0, time.UTC)},
+		{name: "leap_day", expression: "0 0 29 2 *", expected: time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{name: "too_few_fields", expression: "0 9 * *", expectErr: true},
+		{name: "out_of_range", expression: "60 9 * * *", expectErr: true},
+		{name: "bad_step", expression: "*/0 * * * *", expectErr: true},
+		{name: "reversed_range", expression: "0 9 * * 5-1", expectErr: true},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			schedule, err := ParseSchedule(testCase.expression)
+			if (err != nil) != testCase.expectErr {
+				t.Fatalf("Unexpected error result: %v", err)
+			}
+			if testCase.expectErr {
+				return
+			}
+			if next := schedule.Next(now); !next.Equal(testCase.expected) {
+				t.Fatalf("Expected %s, got %s", testCase.expected, next)
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+// Package export writes stored analyses as CSV or JSONL, optionally
+// anonymized, so they can be joined with other data.
+package export
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/trstringer/comment-sentiment/pkg/store"
+)
+
+// Format is the file format of an export.
+type Format string
+
+const (
+	// CSV writes a header and a row per analysis. Sentences are left out.
+	CSV Format = "csv"
+	// JSONL writes a JSON object per line for each analysis.
+	JSONL Format = "jsonl"
+)
+
+// ParseFormat validates a format name.
+func ParseFormat(name string) (Format, error) {
+	switch Format(name) {
+	case CSV, JSONL:
+		return Format(name), nil
+	default:
+		return "", fmt.Errorf("unknown export format %s", name)
+	}
+}
+
+// ContentType is the media type of the format.
+func (f Format) ContentType() string {
+	if f == CSV {
+		return "text/csv; charset=utf-8"
+	}
+	return "application/x-ndjson"
+}
+
+// Anonymizer hashes logins and strips the comment text from records.
+type Anonymizer struct {
+	key []byte
+}
+
+// NewAnonymizer creates an anonymizer that hashes logins with HMAC-SHA256
+// and the key. Hashes stay the same across exports with the same key, so
+// exports can be joined. Without a key logins are hashed with SHA-256, which
+// can be reversed by hashing known logins.
+func NewAnonymizer(key []byte) *Anonymizer {
+	return &Anonymizer{key: key}
+}
+
+// HashLogin returns the hex hash of the login.
+func (a *Anonymizer) HashLogin(login string) string {
+	if login == "" {
+		return ""
+	}
+	if len(a.key) == 0 {
+		sum := sha256.Sum256([]byte(login))
+		return hex.EncodeToString(sum[:])
+	}
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(login))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Anonymize returns a copy of the record with a hashed author and without
+// the text of its sentences or the comment it would have been edited to in
+// shadow mode. The ID and URL of the comment are left out too, as the
+// comment shows its author, and so is any link to the comment in the thread
+// URL.
+func (a *Anonymizer) Anonymize(record store.AnalysisRecord) store.AnalysisRecord {
+	record.Author = a.HashLogin(record.Author)
+	record.CommentID = 0
+	record.CommentURL = ""
+	record.ThreadURL, _, _ = strings.Cut(record.ThreadURL, "#")
+	sentences := make([]store.SentenceRecord, len(record.Sentences))
+	for i, sentence := range record.Sentences {
+		sentence.Text = ""
+		sentences[i] = sentence
+	}
+	record.Sentences = sentences
+	record.ShadowComment = ""
+	return record
+}
+
+// Writer writes records in a format.
+type Writer struct {
+	format     Format
+	anonymizer *Anonymizer
+	csv        *csv.Writer
+	json       *json.Encoder
+	wroteCSV   bool
+}
+
+// NewWriter creates a writer of the format to w. Records are anonymized if
+// the anonymizer is not nil.
+func NewWriter(w io.Writer, format Format, anonymizer *Anonymizer) *Writer {
+	writer := &Writer{format: format, anonymizer: anonymizer}
+	if format == CSV {
+		writer.csv = csv.NewWriter(w)
+	} else {
+		writer.json = json.NewEncoder(w)
+	}
+	return writer
+}
+
+var csvHeader = []string{
+	"id",
+	"installation",
+	"repo",
+	"thread_number",
+	"thread_title",
+	"thread_url",
+	"comment_id",
+	"comment_url",
+	"comment_type",
+	"action",
+	"author",
+	"provider",
+	"sentiment",
+	"confidence",
+	"annotated",
+	"toxicity",
+	"comment_created_at",
+	"comment_updated_at",
+	"analyzed_at",
+}
+
+// Write writes the record.
+func (w *Writer) Write(record store.AnalysisRecord) error {
+	if w.anonymizer != nil {
+		record = w.anonymizer.Anonymize(record)
+	}
+	if w.format != CSV {
+		return w.json.Encode(record)
+	}
+
+	if !w.wroteCSV {
+		if err := w.csv.Write(csvHeader); err != nil {
+			return err
+		}
+		w.wroteCSV = true
+	}
+	toxicity := ""
+	if len(record.Toxicity) > 0 {
+		data, err := json.Marshal(record.Toxicity)
+		if err != nil {
+			return fmt.Errorf("error marshalling toxicity: %w", err)
+		}
+		toxicity = string(data)
+	}
+	return w.csv.Write([]string{
+		strconv.FormatUint(record.ID, 10),
+		record.Installation,
+		record.Repo,
+		strconv.Itoa(record.ThreadNumber),
+		record.ThreadTitle,
+		record.ThreadURL,
+		strconv.FormatInt(record.CommentID, 10),
+		record.CommentURL,
+		record.CommentType,
+		record.Action,
+		record.Author,
+		record.Provider,
+		record.Sentiment,
+		strconv.FormatFloat(float64(record.Confidence), 'f', -1, 32),
+		strconv.FormatBool(record.Annotated),
+		toxicity,
+		formatTime(record.CommentCreatedAt),
+		formatTime(record.CommentUpdatedAt),
+		formatTime(record.AnalyzedAt),
+	})
+}
+
+// Flush writes buffered data. A CSV export without records still gets its
+// header.
+func (w *Writer) Flush() error {
+	if w.format != CSV {
+		return nil
+	}
+	if !w.wroteCSV {
+		if err := w.csv.Write(csvHeader); err != nil {
+			return err
+		}
+		w.wroteCSV = true
+	}
+	w.csv.Flush()
+	return w.csv.Error()
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
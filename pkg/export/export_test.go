@@ -0,0 +1,119 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/trstringer/comment-sentiment/pkg/store"
+)
+
+var record = store.AnalysisRecord{
+	ID:          7,
+	Repo:        "octo/a",
+	ThreadTitle: "Crash, on start",
+	CommentID:   42,
+	CommentType: "issue_comment",
+	Author:      "alice",
+	Sentiment:   "Negative",
+	Confidence:  0.75,
+	Sentences:   []store.SentenceRecord{{Text: "This is broken.", Sentiment: "Negative", Confidence: 0.75}},
+	Toxicity:    map[string]float32{"Insult": 0.5},
+	AnalyzedAt:  time.Date(2022, 5, 2, 12, 0, 0, 0, time.UTC),
+}
+
+var shadowRecord = func() store.AnalysisRecord {
+	shadowed := record
+	shadowed.Shadow = true
+	shadowed.ShadowComment = "This is broken.\n\n<!-- ANALYSIS START -->"
+	shadowed.ThreadURL = "https://github.com/octo/a/pull/1#discussion_r42"
+	shadowed.CommentURL = "https://github.com/octo/a/pull/1#discussion_r42"
+	return shadowed
+}()
+
+func TestCSV(t *testing.T) {
+	buffer := bytes.Buffer{}
+	writer := NewWriter(&buffer, CSV, nil)
+	if err := writer.Write(record); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := writer.Flush(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	rows, err := csv.NewReader(&buffer).ReadAll()
+	if err != nil || len(rows) != 2 {
+		t.Fatalf("Unexpected rows %v: %v", rows, err)
+	}
+	row := map[string]string{}
+	for i, column := range rows[0] {
+		row[column] = rows[1][i]
+	}
+	if row["thread_title"] != "Crash, on start" || row["author"] != "alice" || row["confidence"] != "0.75" ||
+		row["toxicity"] != `{"Insult":0.5}` || row["analyzed_at"] != "2022-05-02T12:00:00Z" || row["comment_created_at"] != "" {
+		t.Fatalf("Unexpected row %v", row)
+	}
+}
+
+func TestCSVHeaderOnly(t *testing.T) {
+	buffer := bytes.Buffer{}
+	if err := NewWriter(&buffer, CSV, nil).Flush(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(buffer.String(), "id,installation,repo,") || strings.Count(buffer.String(), "\n") != 1 {
+		t.Fatalf("Expected only the header, got %q", buffer.String())
+	}
+}
+
+func TestJSONLAnonymized(t *testing.T) {
+	buffer := bytes.Buffer{}
+	anonymizer := NewAnonymizer([]byte("key"))
+	writer := NewWriter(&buffer, JSONL, anonymizer)
+	for i := 0; i < 2; i++ {
+		if err := writer.Write(shadowRecord); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %q", buffer.String())
+	}
+	actual := store.AnalysisRecord{}
+	if err := json.Unmarshal([]byte(lines[0]), &actual); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if actual.Author == "alice" || actual.Author != anonymizer.HashLogin("alice") || len(actual.Author) != 64 {
+		t.Fatalf("Expected a hashed author, got %s", actual.Author)
+	}
+	if len(actual.Sentences) != 1 || actual.Sentences[0].Text != "" || actual.Sentences[0].Sentiment != "Negative" {
+		t.Fatalf("Expected the sentence text to be stripped, got %+v", actual.Sentences)
+	}
+	if actual.ShadowComment != "" || strings.Contains(lines[0], "shadow_comment") || !actual.Shadow {
+		t.Fatalf("Expected the shadow comment to be stripped, got %q", lines[0])
+	}
+	if actual.CommentID != 0 || actual.CommentURL != "" || actual.ThreadURL != "https://github.com/octo/a/pull/1" || strings.Contains(lines[0], "42") {
+		t.Fatalf("Expected the comment ID and URLs to be stripped, got %q", lines[0])
+	}
+	if record.Sentences[0].Text == "" || shadowRecord.ShadowComment == "" {
+		t.Fatalf("Expected the original record to be left alone")
+	}
+}
+
+func TestHashLogin(t *testing.T) {
+	keyed := NewAnonymizer([]byte("key"))
+	otherKey := NewAnonymizer([]byte("other"))
+	unkeyed := NewAnonymizer(nil)
+	if keyed.HashLogin("alice") != keyed.HashLogin("alice") {
+		t.Fatalf("Expected hashes to be stable")
+	}
+	if keyed.HashLogin("alice") == otherKey.HashLogin("alice") || keyed.HashLogin("alice") == unkeyed.HashLogin("alice") {
+		t.Fatalf("Expected hashes to depend on the key")
+	}
+	if unkeyed.HashLogin("") != "" {
+		t.Fatalf("Expected an empty login to stay empty")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
+	"net/http"
 	"time"
 
 	"github.com/golang-jwt/jwt"
@@ -48,21 +49,31 @@ func newGitHubClient(token string) *ghapi.Client {
 	tokenSource := oauth2.StaticTokenSource(
 		&oauth2.Token{AccessToken: token},
 	)
-	oauthClient := oauth2.NewClient(context.Background(), tokenSource)
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, &http.Client{
+		Transport: metricsTransport{base: http.DefaultTransport},
+	})
+	oauthClient := oauth2.NewClient(ctx, tokenSource)
 	return ghapi.NewClient(oauthClient)
 }
 
 // NewInstallationGitHubClient creates a new client for the installation.
 func NewInstallationGitHubClient(appID int, privateKey []byte, repoOwner RepositoryOwner) (*ghapi.Client, error) {
+	client, _, err := NewInstallationGitHubClientWithID(appID, privateKey, repoOwner)
+	return client, err
+}
+
+// NewInstallationGitHubClientWithID creates a new client for the installation
+// and also returns the installation ID.
+func NewInstallationGitHubClientWithID(appID int, privateKey []byte, repoOwner RepositoryOwner) (*ghapi.Client, int64, error) {
 	jwt, err := generateJWT(appID, privateKey)
 	if err != nil {
-		return nil, fmt.Errorf("error generating JWT: %w", err)
+		return nil, 0, fmt.Errorf("error generating JWT: %w", err)
 	}
 
 	client := newGitHubClient(jwt)
 	installations, _, err := client.Apps.ListInstallations(context.Background(), nil)
 	if err != nil {
-		return nil, fmt.Errorf("error getting app installations: %w", err)
+		return nil, 0, fmt.Errorf("error getting app installations: %w", err)
 	}
 
 	var installationID int64 = -1
@@ -73,7 +84,7 @@ func NewInstallationGitHubClient(appID int, privateKey []byte, repoOwner Reposit
 	}
 
 	if installationID < 0 {
-		return nil, fmt.Errorf("unable to find app installation")
+		return nil, 0, fmt.Errorf("unable to find app installation")
 	}
 
 	installationToken, _, err := client.Apps.CreateInstallationToken(
@@ -82,8 +93,8 @@ func NewInstallationGitHubClient(appID int, privateKey []byte, repoOwner Reposit
 		nil,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("error creating installation token")
+		return nil, 0, fmt.Errorf("error creating installation token")
 	}
 
-	return newGitHubClient(installationToken.GetToken()), nil
+	return newGitHubClient(installationToken.GetToken()), installationID, nil
 }
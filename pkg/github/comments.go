@@ -14,6 +14,8 @@ func (c CommentPayload) CommentType() (CommentType, error) {
 		return CommentTypeIssueComment, nil
 	} else if c.PullRequest != nil {
 		return CommentTypePullRequestReviewComment, nil
+	} else if c.Discussion != nil {
+		return CommentTypeDiscussionComment, nil
 	}
 
 	return CommentTypeUnknown, fmt.Errorf("unable to determine comment type")
@@ -33,6 +35,9 @@ func (c CommentPayload) UpdateComment(client *ghapi.Client, newComment string) e
 	case CommentTypePullRequestReviewComment:
 		log.Debug().Msg("Updating comment with type pull request review")
 		return c.updatePullRequestReviewComment(client, newComment)
+	case CommentTypeDiscussionComment:
+		log.Debug().Msg("Updating comment with type discussion")
+		return c.updateDiscussionComment(client, newComment)
 	default:
 		log.Error().Msg("Unknown comment type")
 		return fmt.Errorf("unable to update comment due to unknown type")
@@ -68,3 +73,101 @@ func (c CommentPayload) updatePullRequestReviewComment(client *ghapi.Client, new
 
 	return nil
 }
+
+const updateDiscussionCommentMutation string = `mutation($commentId: ID!, $body: String!) {
+  updateDiscussionComment(input: {commentId: $commentId, body: $body}) {
+    comment { id }
+  }
+}`
+
+func (c CommentPayload) updateDiscussionComment(client *ghapi.Client, newComment string) error {
+	_, err := graphQL(context.Background(), client, updateDiscussionCommentMutation, map[string]interface{}{
+		"commentId": c.Comment.NodeID,
+		"body":      newComment,
+	}, &struct{}{})
+	if err != nil {
+		return fmt.Errorf("error updating discussion comment: %w", err)
+	}
+
+	return nil
+}
+
+const discussionCommentQuery string = `query($id: ID!) {
+  node(id: $id) {
+    ... on DiscussionComment { body }
+  }
+}`
+
+// CurrentBody fetches the current text of the comment, which may have been
+// edited since the payload was delivered.
+func (c CommentPayload) CurrentBody(ctx context.Context, client *ghapi.Client) (string, error) {
+	commentType, err := c.CommentType()
+	if err != nil {
+		return "", fmt.Errorf("error trying to get comment: %w", err)
+	}
+
+	switch commentType {
+	case CommentTypeIssueComment:
+		comment, _, err := client.Issues.GetComment(ctx, c.Repository.Owner.Login, c.Repository.Name, c.Comment.ID)
+		if err != nil {
+			return "", fmt.Errorf("error getting issue comment: %w", err)
+		}
+		return comment.GetBody(), nil
+	case CommentTypePullRequestReviewComment:
+		comment, _, err := client.PullRequests.GetComment(ctx, c.Repository.Owner.Login, c.Repository.Name, c.Comment.ID)
+		if err != nil {
+			return "", fmt.Errorf("error getting pull request review comment: %w", err)
+		}
+		return comment.GetBody(), nil
+	case CommentTypeDiscussionComment:
+		data := struct {
+			Node struct {
+				Body string `json:"body"`
+			} `json:"node"`
+		}{}
+		if _, err := graphQL(ctx, client, discussionCommentQuery, map[string]interface{}{"id": c.Comment.NodeID}, &data); err != nil {
+			return "", fmt.Errorf("error getting discussion comment: %w", err)
+		}
+		return data.Node.Body, nil
+	default:
+		return "", fmt.Errorf("unable to get comment due to unknown type")
+	}
+}
+
+// InstallationKey identifies the installation the comment belongs to. It is
+// the installation ID when the payload has one, otherwise the repo owner.
+func (c CommentPayload) InstallationKey() string {
+	if c.Installation != nil {
+		return fmt.Sprintf("%d", c.Installation.ID)
+	}
+	return c.Repository.Owner.Login
+}
+
+// Thread returns the number, title and URL of the issue, pull request or
+// discussion that the comment is on.
+func (c CommentPayload) Thread() (int, string, string) {
+	if c.Issue != nil {
+		return c.Issue.Number, c.Issue.Title, c.Issue.HTMLURL
+	}
+	if c.PullRequest != nil {
+		return c.PullRequest.Number, c.PullRequest.Title, c.PullRequest.HTMLURL
+	}
+	if c.Discussion != nil {
+		return c.Discussion.Number, c.Discussion.Title, c.Discussion.HTMLURL
+	}
+	return 0, "", ""
+}
+
+// String is the name of the comment type as used in webhook events.
+func (c CommentType) String() string {
+	switch c {
+	case CommentTypeIssueComment:
+		return "issue_comment"
+	case CommentTypePullRequestReviewComment:
+		return "pull_request_review_comment"
+	case CommentTypeDiscussionComment:
+		return "discussion_comment"
+	default:
+		return "unknown"
+	}
+}
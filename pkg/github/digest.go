@@ -0,0 +1,98 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	ghapi "github.com/google/go-github/v44/github"
+)
+
+// PostDigest posts the digest of the repo where its configuration asks for
+// it, and returns the URL of the issue or discussion.
+func PostDigest(ctx context.Context, client *ghapi.Client, repo Repository, config DigestConfig, title, body string) (string, error) {
+	switch config.Post {
+	case DigestIssue:
+		return createIssue(ctx, client, repo, config.Labels, title, body)
+	case DigestDiscussion:
+		return createDiscussion(ctx, client, repo, config.Category, title, body)
+	default:
+		return "", fmt.Errorf("digest is not enabled for repo %s", repo.FullName)
+	}
+}
+
+func createIssue(ctx context.Context, client *ghapi.Client, repo Repository, labels []string, title, body string) (string, error) {
+	request := &ghapi.IssueRequest{Title: &title, Body: &body}
+	if len(labels) > 0 {
+		request.Labels = &labels
+	}
+	issue, _, err := client.Issues.Create(ctx, repo.Owner.Login, repo.Name, request)
+	if err != nil {
+		return "", fmt.Errorf("error creating issue: %w", err)
+	}
+	return issue.GetHTMLURL(), nil
+}
+
+const discussionCategoriesQuery string = `query($owner: String!, $name: String!) {
+  repository(owner: $owner, name: $name) {
+    id
+    discussionCategories(first: 100) {
+      nodes { id name }
+    }
+  }
+}`
+
+const createDiscussionMutation string = `mutation($repositoryId: ID!, $categoryId: ID!, $title: String!, $body: String!) {
+  createDiscussion(input: {repositoryId: $repositoryId, categoryId: $categoryId, title: $title, body: $body}) {
+    discussion { url }
+  }
+}`
+
+func createDiscussion(ctx context.Context, client *ghapi.Client, repo Repository, category, title, body string) (string, error) {
+	repoData := struct {
+		Repository struct {
+			ID                   string `json:"id"`
+			DiscussionCategories struct {
+				Nodes []struct {
+					ID   string `json:"id"`
+					Name string `json:"name"`
+				} `json:"nodes"`
+			} `json:"discussionCategories"`
+		} `json:"repository"`
+	}{}
+	_, err := graphQL(ctx, client, discussionCategoriesQuery, map[string]interface{}{
+		"owner": repo.Owner.Login,
+		"name":  repo.Name,
+	}, &repoData)
+	if err != nil {
+		return "", fmt.Errorf("error getting discussion categories: %w", err)
+	}
+
+	categoryID := ""
+	for _, node := range repoData.Repository.DiscussionCategories.Nodes {
+		if strings.EqualFold(node.Name, category) {
+			categoryID = node.ID
+		}
+	}
+	if categoryID == "" {
+		return "", fmt.Errorf("discussion category %s not found in repo %s", category, repo.FullName)
+	}
+
+	discussionData := struct {
+		CreateDiscussion struct {
+			Discussion struct {
+				URL string `json:"url"`
+			} `json:"discussion"`
+		} `json:"createDiscussion"`
+	}{}
+	_, err = graphQL(ctx, client, createDiscussionMutation, map[string]interface{}{
+		"repositoryId": repoData.Repository.ID,
+		"categoryId":   categoryID,
+		"title":        title,
+		"body":         body,
+	}, &discussionData)
+	if err != nil {
+		return "", fmt.Errorf("error creating discussion: %w", err)
+	}
+	return discussionData.CreateDiscussion.Discussion.URL, nil
+}
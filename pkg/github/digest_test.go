@@ -0,0 +1,79 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	ghapi "github.com/google/go-github/v44/github"
+)
+
+func newTestClient(t *testing.T, handler http.Handler) *ghapi.Client {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	client := ghapi.NewClient(nil)
+	baseURL, err := url.Parse(server.URL + "/")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	client.BaseURL = baseURL
+	return client
+}
+
+var digestRepo = Repository{FullName: "octo/a", Name: "a", Owner: RepositoryOwner{Login: "octo"}}
+
+func TestPostDigestIssue(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		issue := ghapi.IssueRequest{}
+		if req.URL.Path != "/repos/octo/a/issues" || json.NewDecoder(req.Body).Decode(&issue) != nil ||
+			issue.GetTitle() != "Digest" || len(issue.GetLabels()) != 1 {
+			resp.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		// nolint: errcheck
+		resp.Write([]byte(`{"html_url": "https://github.com/octo/a/issues/1"}`))
+	}))
+
+	config := DigestConfig{Post: DigestIssue, Labels: []string{"community"}}
+	issueURL, err := PostDigest(context.Background(), client, digestRepo, config, "Digest", "Body")
+	if err != nil || issueURL != "https://github.com/octo/a/issues/1" {
+		t.Fatalf("Unexpected result %s: %v", issueURL, err)
+	}
+}
+
+func TestPostDigestDiscussion(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		request := graphQLRequest{}
+		if req.URL.Path != "/graphql" || json.NewDecoder(req.Body).Decode(&request) != nil {
+			resp.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch {
+		case strings.HasPrefix(request.Query, "query"):
+			// nolint: errcheck
+			resp.Write([]byte(`{"data": {"repository": {"id": "R1", "discussionCategories": {"nodes": [
+				{"id": "C1", "name": "Announcements"}, {"id": "C2", "name": "General"}]}}}}`))
+		case request.Variables["categoryId"] == "C2" && request.Variables["repositoryId"] == "R1":
+			// nolint: errcheck
+			resp.Write([]byte(`{"data": {"createDiscussion": {"discussion": {"url": "https://github.com/octo/a/discussions/2"}}}}`))
+		default:
+			// nolint: errcheck
+			resp.Write([]byte(`{"errors": [{"message": "unexpected mutation"}]}`))
+		}
+	}))
+
+	config := DigestConfig{Post: DigestDiscussion, Category: "general"}
+	discussionURL, err := PostDigest(context.Background(), client, digestRepo, config, "Digest", "Body")
+	if err != nil || discussionURL != "https://github.com/octo/a/discussions/2" {
+		t.Fatalf("Unexpected result %s: %v", discussionURL, err)
+	}
+
+	config.Category = "Missing"
+	if _, err := PostDigest(context.Background(), client, digestRepo, config, "Digest", "Body"); err == nil {
+		t.Fatalf("Expected an error for a missing category")
+	}
+}
@@ -10,6 +10,7 @@ import (
 
 const (
 	negativeCommentSuggestion string = "*... consider editing for a more positive response!*"
+	uncivilCommentSuggestion  string = "*... please keep the conversation respectful.*"
 	indicatorCommentStart     string = "<!-- ANALYSIS START -->"
 	indicatorCommentEnd       string = "<!-- ANALYSIS END -->"
 )
@@ -28,11 +29,50 @@ func sentimentResponse(analysis sa.Analysis) string {
 		response = fmt.Sprintf("%s %s", response, negativeCommentSuggestion)
 	}
 
+	uncivilCategories := analysis.UncivilCategories(sa.DefaultToxicityThreshold)
+	if len(uncivilCategories) > 0 {
+		categories := []string{}
+		for _, toxicityScore := range uncivilCategories {
+			categories = append(categories, fmt.Sprintf(
+				"%s (%.2f)",
+				toxicityLabel(toxicityScore.Category),
+				toxicityScore.Score,
+			))
+		}
+		response = fmt.Sprintf(
+			"%s\n\n**Incivility detected**: %s %s",
+			response,
+			strings.Join(categories, ", "),
+			uncivilCommentSuggestion,
+		)
+	}
+
+	// A negative comment already asks for an edit, so only list the negative
+	// sentences when there is a suggested rewrite to go with them.
 	negativeSentences := analysis.NegativeSentences()
-	if len(negativeSentences) > 0 && analysis.Sentiment != sa.Negative {
+	rewrites := make([]string, len(negativeSentences))
+	hasRewrites := false
+	texts := make([]string, len(negativeSentences))
+	listed, hasRewrites := 0, false
+	for i, negativeSentence := range negativeSentences {
+		texts[i] = renderFooterText(negativeSentence.Text)
+		if texts[i] == "" {
+			continue
+		}
+		listed++
+		rewrites[i] = renderFooterText(negativeSentence.SuggestedRewrite)
+		hasRewrites = hasRewrites || rewrites[i] != ""
+	}
+	if listed > 0 && (analysis.Sentiment != sa.Negative || hasRewrites) {
 		response = fmt.Sprintf("%s\n\nNegative sentences that could be improved:", response)
-		for _, negativeSentence := range negativeSentences {
-			response = fmt.Sprintf("%s\n* %s", response, negativeSentence.Text)
+		for i := range negativeSentences {
+			if texts[i] == "" {
+				continue
+			}
+			response = fmt.Sprintf("%s\n* %s", response, texts[i])
+			if rewrites[i] != "" {
+				response = fmt.Sprintf("%s\n  * *Suggested rewrite*: %s", response, rewrites[i])
+			}
 		}
 	}
 
@@ -45,6 +85,43 @@ func sentimentResponse(analysis sa.Analysis) string {
 	return response
 }
 
+// markdownEscaper escapes the characters that format inline markdown, and
+// @ so that the footer does not mention anyone.
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	"`", "\\`",
+	"*", `\*`,
+	"_", `\_`,
+	"[", `\[`,
+	"]", `\]`,
+	"(", `\(`,
+	")", `\)`,
+	"<", `\<`,
+	">", `\>`,
+	"!", `\!`,
+	"#", `\#`,
+	"|", `\|`,
+	"~", `\~`,
+	"@", `\@`,
+)
+
+// renderFooterText renders a sentence or a suggested rewrite as plain text
+// on one line. Both come from the comment or a model, so they are not trusted
+// to keep to the footer. Text with the footer markers, which would break
+// removing the footer, is left out by returning empty.
+func renderFooterText(text string) string {
+	if strings.Contains(text, indicatorCommentStart) || strings.Contains(text, indicatorCommentEnd) {
+		return ""
+	}
+	return EscapeMarkdown(text)
+}
+
+// EscapeMarkdown renders text that is not trusted as plain markdown on one
+// line, such as a title in a digest.
+func EscapeMarkdown(text string) string {
+	return markdownEscaper.Replace(strings.Join(strings.Fields(text), " "))
+}
+
 // emojiFromSentiment converts the sentiment to a GitHub emoji string.
 func emojiFromSentiment(source sa.Sentiment) string {
 	var emoji string
@@ -61,6 +138,16 @@ func emojiFromSentiment(source sa.Sentiment) string {
 	return emoji
 }
 
+// toxicityLabel converts the toxicity category to readable text.
+func toxicityLabel(category sa.ToxicityCategory) string {
+	switch category {
+	case sa.IdentityAttack:
+		return "identity attack"
+	default:
+		return strings.ToLower(category.String())
+	}
+}
+
 // UpdateCommentWithSentiment changes the comment text to include the analyzed
 // sentiment.
 func UpdateCommentWithSentiment(comment string, analysis sa.Analysis) (string, error) {
@@ -72,6 +159,13 @@ func UpdateCommentWithSentiment(comment string, analysis sa.Analysis) (string, e
 	return fmt.Sprintf("%s\n\n%s", comment, sentimentResponse(analysis)), nil
 }
 
+// HasCommentSentimentAnalysis indicates if the comment has a sentiment
+// analysis footer.
+func HasCommentSentimentAnalysis(comment string) bool {
+	start := strings.Index(comment, indicatorCommentStart)
+	return start >= 0 && strings.Contains(comment[start:], indicatorCommentEnd)
+}
+
 // TrimCommentSentimentAnalysis removes any sentiment analysis from a comment.
 func TrimCommentSentimentAnalysis(comment string) (string, error) {
 	reg, err := regexp.Compile(fmt.Sprintf(
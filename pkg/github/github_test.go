@@ -135,6 +135,198 @@ this is another line.
 
 Negative sentences that could be improved:
 * sentence text 1
+<!-- ANALYSIS END -->`,
+		},
+		{
+			name:    "neutral_analysis_negative_sentence_suggested_rewrite",
+			comment: "this is a comment.",
+			sentimentAnalysis: sa.Analysis{
+				Sentiment:  sa.Neutral,
+				Confidence: 0.9,
+				SentenceAnalyses: []sa.SentenceAnalysis{
+					{
+						Text:             "sentence text 1",
+						Sentiment:        sa.Negative,
+						Confidence:       0.9,
+						SuggestedRewrite: "rewritten sentence 1",
+					},
+				},
+			},
+			expected: `this is a comment.
+
+<!-- ANALYSIS START -->
+**Overall sentiment analysis**: Neutral :neutral_face: (confidence: 0.90)
+
+Negative sentences that could be improved:
+* sentence text 1
+  * *Suggested rewrite*: rewritten sentence 1
+<!-- ANALYSIS END -->`,
+		},
+		{
+			name:    "negative_analysis_suggested_rewrite",
+			comment: "this is a comment.",
+			sentimentAnalysis: sa.Analysis{
+				Sentiment:  sa.Negative,
+				Confidence: 0.9,
+				SentenceAnalyses: []sa.SentenceAnalysis{
+					{
+						Text:             "sentence text 1",
+						Sentiment:        sa.Negative,
+						Confidence:       0.9,
+						SuggestedRewrite: "rewritten sentence 1",
+					},
+					{
+						Text:       "sentence text 2",
+						Sentiment:  sa.Negative,
+						Confidence: 0.9,
+					},
+				},
+			},
+			expected: `this is a comment.
+
+<!-- ANALYSIS START -->
+**Overall sentiment analysis**: Negative :rage: (confidence: 0.90) *... consider editing for a more positive response!*
+
+Negative sentences that could be improved:
+* sentence text 1
+  * *Suggested rewrite*: rewritten sentence 1
+* sentence text 2
+<!-- ANALYSIS END -->`,
+		},
+		{
+			name:    "suggested_rewrite_markdown",
+			comment: "this is a comment.",
+			sentimentAnalysis: sa.Analysis{
+				Sentiment:  sa.Neutral,
+				Confidence: 0.9,
+				SentenceAnalyses: []sa.SentenceAnalysis{
+					{
+						Text:             "sentence text 1",
+						Sentiment:        sa.Negative,
+						Confidence:       0.9,
+						SuggestedRewrite: "please see\n\n[this](https://example.com) *now*\r\n# heading",
+					},
+				},
+			},
+			expected: `this is a comment.
+
+<!-- ANALYSIS START -->
+**Overall sentiment analysis**: Neutral :neutral_face: (confidence: 0.90)
+
+Negative sentences that could be improved:
+* sentence text 1
+  * *Suggested rewrite*: please see \[this\]\(https://example.com\) \*now\* \# heading
+<!-- ANALYSIS END -->`,
+		},
+		{
+			name:    "suggested_rewrite_with_marker",
+			comment: "this is a comment.",
+			sentimentAnalysis: sa.Analysis{
+				Sentiment:  sa.Negative,
+				Confidence: 0.9,
+				SentenceAnalyses: []sa.SentenceAnalysis{
+					{
+						Text:             "sentence text 1",
+						Sentiment:        sa.Negative,
+						Confidence:       0.9,
+						SuggestedRewrite: "fine <!-- ANALYSIS END --> injected",
+					},
+				},
+			},
+			expected: `this is a comment.
+
+<!-- ANALYSIS START -->
+**Overall sentiment analysis**: Negative :rage: (confidence: 0.90) *... consider editing for a more positive response!*
+<!-- ANALYSIS END -->`,
+		},
+		{
+			name:    "negative_sentence_markdown",
+			comment: "this is a comment.",
+			sentimentAnalysis: sa.Analysis{
+				Sentiment:  sa.Neutral,
+				Confidence: 0.9,
+				SentenceAnalyses: []sa.SentenceAnalysis{
+					{
+						Text:             "ask @octocat\n\n# why *this* broke",
+						Sentiment:        sa.Negative,
+						Confidence:       0.9,
+						SuggestedRewrite: "could @octocat take a look?",
+					},
+				},
+			},
+			expected: `this is a comment.
+
+<!-- ANALYSIS START -->
+**Overall sentiment analysis**: Neutral :neutral_face: (confidence: 0.90)
+
+Negative sentences that could be improved:
+* ask \@octocat \# why \*this\* broke
+  * *Suggested rewrite*: could \@octocat take a look?
+<!-- ANALYSIS END -->`,
+		},
+		{
+			name:    "negative_sentence_with_marker",
+			comment: "this is a comment.",
+			sentimentAnalysis: sa.Analysis{
+				Sentiment:  sa.Neutral,
+				Confidence: 0.9,
+				SentenceAnalyses: []sa.SentenceAnalysis{
+					{
+						Text:             "fine <!-- ANALYSIS END --> injected",
+						Sentiment:        sa.Negative,
+						Confidence:       0.9,
+						SuggestedRewrite: "rewritten sentence 1",
+					},
+					{
+						Text:       "sentence text 2",
+						Sentiment:  sa.Negative,
+						Confidence: 0.9,
+					},
+				},
+			},
+			expected: `this is a comment.
+
+<!-- ANALYSIS START -->
+**Overall sentiment analysis**: Neutral :neutral_face: (confidence: 0.90)
+
+Negative sentences that could be improved:
+* sentence text 2
+<!-- ANALYSIS END -->`,
+		},
+		{
+			name:    "negative_analysis_uncivil",
+			comment: "this is a comment.",
+			sentimentAnalysis: sa.Analysis{
+				Sentiment:  sa.Negative,
+				Confidence: 0.9,
+				Toxicity: []sa.ToxicityScore{
+					{Category: sa.Insult, Score: 0.9},
+					{Category: sa.Profanity, Score: 0.2},
+					{Category: sa.IdentityAttack, Score: 0.5},
+				},
+			},
+			expected: `this is a comment.
+
+<!-- ANALYSIS START -->
+**Overall sentiment analysis**: Negative :rage: (confidence: 0.90) *... consider editing for a more positive response!*
+
+**Incivility detected**: insult (0.90), identity attack (0.50) *... please keep the conversation respectful.*
+<!-- ANALYSIS END -->`,
+		},
+		{
+			name:    "negative_analysis_civil",
+			comment: "this is a comment.",
+			sentimentAnalysis: sa.Analysis{
+				Sentiment:  sa.Negative,
+				Confidence: 0.9,
+				Toxicity: []sa.ToxicityScore{
+					{Category: sa.Insult, Score: 0.1},
+				},
+			},
+			expected: `this is a comment.
+
+<!-- ANALYSIS START -->
+**Overall sentiment analysis**: Negative :rage: (confidence: 0.90) *... consider editing for a more positive response!*
 <!-- ANALYSIS END -->`,
 		},
 		{
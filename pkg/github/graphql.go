@@ -0,0 +1,46 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	ghapi "github.com/google/go-github/v44/github"
+)
+
+// graphQLRequest is a request to the GitHub GraphQL API, which is the only
+// API for discussions.
+type graphQLRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables"`
+}
+
+type graphQLError struct {
+	Message string `json:"message"`
+}
+
+// graphQL runs the query and decodes its data into data.
+func graphQL(ctx context.Context, client *ghapi.Client, query string, variables map[string]interface{}, data interface{}) (*ghapi.Response, error) {
+	req, err := client.NewRequest(http.MethodPost, "graphql", graphQLRequest{Query: query, Variables: variables})
+	if err != nil {
+		return nil, fmt.Errorf("error creating GraphQL request: %w", err)
+	}
+
+	resp := struct {
+		Data   interface{}    `json:"data"`
+		Errors []graphQLError `json:"errors"`
+	}{Data: data}
+	httpResp, err := client.Do(ctx, req, &resp)
+	if err != nil {
+		return httpResp, fmt.Errorf("error calling GraphQL API: %w", err)
+	}
+	if len(resp.Errors) > 0 {
+		messages := []string{}
+		for _, graphQLErr := range resp.Errors {
+			messages = append(messages, graphQLErr.Message)
+		}
+		return httpResp, fmt.Errorf("GraphQL API error: %s", strings.Join(messages, ", "))
+	}
+	return httpResp, nil
+}
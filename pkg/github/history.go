@@ -0,0 +1,357 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	ghapi "github.com/google/go-github/v44/github"
+)
+
+// ActionBackfill is the action of payloads listed from the history of a repo
+// instead of delivered by a webhook.
+const ActionBackfill string = "backfill"
+
+// CommentKind is a kind of comment that can be listed from the history of a
+// repo.
+type CommentKind string
+
+const (
+	// IssueComments are the comments on issues and pull requests.
+	IssueComments CommentKind = "issue_comments"
+	// ReviewComments are the review comments on pull request diffs.
+	ReviewComments CommentKind = "review_comments"
+	// DiscussionComments are the comments on discussions and their replies.
+	DiscussionComments CommentKind = "discussion_comments"
+)
+
+// CommentKinds are every kind of comment, in the order they are backfilled.
+var CommentKinds = []CommentKind{IssueComments, ReviewComments, DiscussionComments}
+
+// commentsPerPage is the most comments the REST API returns in a page.
+const commentsPerPage int = 100
+
+// CommentPage is a page of the comments of a repo.
+type CommentPage struct {
+	Comments []CommentPayload
+	// Next is the cursor of the next page, and is empty after the last page.
+	Next string
+	// Rate is the rate limit of the client after listing the page.
+	Rate ghapi.Rate
+}
+
+// ListInstallationRepos lists the repos the client's installation can
+// access.
+func ListInstallationRepos(ctx context.Context, client *ghapi.Client) ([]Repository, error) {
+	repos := []Repository{}
+	options := &ghapi.ListOptions{PerPage: commentsPerPage}
+	for {
+		list, resp, err := client.Apps.ListRepos(ctx, options)
+		if err != nil {
+			return nil, fmt.Errorf("error listing installation repos: %w", err)
+		}
+		for _, repo := range list.Repositories {
+			repos = append(repos, Repository{
+				FullName: repo.GetFullName(),
+				Name:     repo.GetName(),
+				Owner:    RepositoryOwner{Login: repo.GetOwner().GetLogin()},
+			})
+		}
+		if resp.NextPage == 0 {
+			return repos, nil
+		}
+		options.Page = resp.NextPage
+	}
+}
+
+// ListCommentPage lists a page of the comments of the kind in the repo,
+// oldest first. The cursor is empty for the first page and the Next of the
+// previous page after that.
+func ListCommentPage(ctx context.Context, client *ghapi.Client, repo Repository, kind CommentKind, cursor string) (CommentPage, error) {
+	switch kind {
+	case IssueComments:
+		return listIssueComments(ctx, client, repo, cursor)
+	case ReviewComments:
+		return listReviewComments(ctx, client, repo, cursor)
+	case DiscussionComments:
+		return listDiscussionComments(ctx, client, repo, cursor)
+	default:
+		return CommentPage{}, fmt.Errorf("unknown comment kind %s", kind)
+	}
+}
+
+func parsePageCursor(cursor string) (int, error) {
+	if cursor == "" {
+		return 1, nil
+	}
+	page, err := strconv.Atoi(cursor)
+	if err != nil || page < 1 {
+		return 0, fmt.Errorf("invalid page cursor %s", cursor)
+	}
+	return page, nil
+}
+
+func nextPageCursor(resp *ghapi.Response) string {
+	if resp.NextPage == 0 {
+		return ""
+	}
+	return strconv.Itoa(resp.NextPage)
+}
+
+func listIssueComments(ctx context.Context, client *ghapi.Client, repo Repository, cursor string) (CommentPage, error) {
+	page, err := parsePageCursor(cursor)
+	if err != nil {
+		return CommentPage{}, err
+	}
+	sort, direction := "created", "asc"
+	comments, resp, err := client.Issues.ListComments(ctx, repo.Owner.Login, repo.Name, 0, &ghapi.IssueListCommentsOptions{
+		Sort:        &sort,
+		Direction:   &direction,
+		ListOptions: ghapi.ListOptions{Page: page, PerPage: commentsPerPage},
+	})
+	if err != nil {
+		return CommentPage{}, fmt.Errorf("error listing issue comments of %s: %w", repo.FullName, err)
+	}
+
+	commentPage := CommentPage{Next: nextPageCursor(resp), Rate: resp.Rate}
+	for _, comment := range comments {
+		commentPage.Comments = append(commentPage.Comments, CommentPayload{
+			Action: ActionBackfill,
+			Comment: Comment{
+				Body:        comment.GetBody(),
+				ID:          comment.GetID(),
+				NodeID:      comment.GetNodeID(),
+				CommentUser: CommentUser{Login: comment.GetUser().GetLogin()},
+				HTMLURL:     comment.GetHTMLURL(),
+				CreatedAt:   comment.GetCreatedAt(),
+				UpdatedAt:   comment.GetUpdatedAt(),
+			},
+			Issue: &Issue{
+				URL:     comment.GetIssueURL(),
+				Number:  threadNumber(comment.GetIssueURL()),
+				HTMLURL: threadURL(comment.GetHTMLURL()),
+			},
+			Repository: repo,
+		})
+	}
+	return commentPage, nil
+}
+
+func listReviewComments(ctx context.Context, client *ghapi.Client, repo Repository, cursor string) (CommentPage, error) {
+	page, err := parsePageCursor(cursor)
+	if err != nil {
+		return CommentPage{}, err
+	}
+	comments, resp, err := client.PullRequests.ListComments(ctx, repo.Owner.Login, repo.Name, 0, &ghapi.PullRequestListCommentsOptions{
+		Sort:        "created",
+		Direction:   "asc",
+		ListOptions: ghapi.ListOptions{Page: page, PerPage: commentsPerPage},
+	})
+	if err != nil {
+		return CommentPage{}, fmt.Errorf("error listing review comments of %s: %w", repo.FullName, err)
+	}
+
+	commentPage := CommentPage{Next: nextPageCursor(resp), Rate: resp.Rate}
+	for _, comment := range comments {
+		reviewID := comment.GetPullRequestReviewID()
+		commentPage.Comments = append(commentPage.Comments, CommentPayload{
+			Action: ActionBackfill,
+			Comment: Comment{
+				Body:                comment.GetBody(),
+				ID:                  comment.GetID(),
+				NodeID:              comment.GetNodeID(),
+				PullRequestReviewID: &reviewID,
+				CommentUser:         CommentUser{Login: comment.GetUser().GetLogin()},
+				HTMLURL:             comment.GetHTMLURL(),
+				CreatedAt:           comment.GetCreatedAt(),
+				UpdatedAt:           comment.GetUpdatedAt(),
+			},
+			PullRequest: &PullRequest{
+				URL:     comment.GetPullRequestURL(),
+				Number:  threadNumber(comment.GetPullRequestURL()),
+				HTMLURL: threadURL(comment.GetHTMLURL()),
+			},
+			Repository: repo,
+		})
+	}
+	return commentPage, nil
+}
+
+// threadNumber returns the number at the end of an issue or pull request API
+// URL.
+func threadNumber(apiURL string) int {
+	number, _ := strconv.Atoi(apiURL[strings.LastIndex(apiURL, "/")+1:])
+	return number
+}
+
+// threadURL returns the URL of the thread of a comment URL.
+func threadURL(commentURL string) string {
+	url, _, _ := strings.Cut(commentURL, "#")
+	return url
+}
+
+const discussionCommentFields string = `id databaseId body url createdAt updatedAt author { login }`
+
+// discussionCommentsQuery lists fewer discussions than comments per page, as
+// every discussion comes with up to 100 comments.
+const discussionCommentsQuery string = `query($owner: String!, $name: String!, $cursor: String) {
+  repository(owner: $owner, name: $name) {
+    discussions(first: 10, after: $cursor, orderBy: {field: CREATED_AT, direction: ASC}) {
+      pageInfo { hasNextPage endCursor }
+      nodes {
+        number title url
+        comments(first: 100) {
+          pageInfo { hasNextPage endCursor }
+          nodes { ` + discussionCommentFields + ` replies(first: 100) { nodes { ` + discussionCommentFields + ` } } }
+        }
+      }
+    }
+  }
+}`
+
+const moreDiscussionCommentsQuery string = `query($owner: String!, $name: String!, $number: Int!, $cursor: String) {
+  repository(owner: $owner, name: $name) {
+    discussion(number: $number) {
+      comments(first: 100, after: $cursor) {
+        pageInfo { hasNextPage endCursor }
+        nodes { ` + discussionCommentFields + ` replies(first: 100) { nodes { ` + discussionCommentFields + ` } } }
+      }
+    }
+  }
+}`
+
+type pageInfo struct {
+	HasNextPage bool   `json:"hasNextPage"`
+	EndCursor   string `json:"endCursor"`
+}
+
+type discussionCommentNode struct {
+	ID         string    `json:"id"`
+	DatabaseID int64     `json:"databaseId"`
+	Body       string    `json:"body"`
+	URL        string    `json:"url"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+	Author     struct {
+		Login string `json:"login"`
+	} `json:"author"`
+	Replies struct {
+		Nodes []discussionCommentNode `json:"nodes"`
+	} `json:"replies"`
+}
+
+type discussionComments struct {
+	PageInfo pageInfo                `json:"pageInfo"`
+	Nodes    []discussionCommentNode `json:"nodes"`
+}
+
+// listDiscussionComments lists the comments of a page of discussions. Only
+// the first 100 replies of a comment are listed.
+func listDiscussionComments(ctx context.Context, client *ghapi.Client, repo Repository, cursor string) (CommentPage, error) {
+	data := struct {
+		Repository struct {
+			Discussions struct {
+				PageInfo pageInfo `json:"pageInfo"`
+				Nodes    []struct {
+					Number   int                `json:"number"`
+					Title    string             `json:"title"`
+					URL      string             `json:"url"`
+					Comments discussionComments `json:"comments"`
+				} `json:"nodes"`
+			} `json:"discussions"`
+		} `json:"repository"`
+	}{}
+	variables := map[string]interface{}{"owner": repo.Owner.Login, "name": repo.Name}
+	if cursor != "" {
+		variables["cursor"] = cursor
+	}
+	resp, err := graphQL(ctx, client, discussionCommentsQuery, variables, &data)
+	if err != nil {
+		return CommentPage{}, fmt.Errorf("error listing discussion comments of %s: %w", repo.FullName, err)
+	}
+
+	commentPage := CommentPage{Rate: resp.Rate}
+	if data.Repository.Discussions.PageInfo.HasNextPage {
+		commentPage.Next = data.Repository.Discussions.PageInfo.EndCursor
+	}
+	for _, discussion := range data.Repository.Discussions.Nodes {
+		thread := &Discussion{Number: discussion.Number, Title: discussion.Title, HTMLURL: discussion.URL}
+		comments := discussion.Comments
+		for {
+			for _, comment := range comments.Nodes {
+				commentPage.Comments = append(commentPage.Comments, discussionCommentPayload(repo, thread, comment))
+				for _, reply := range comment.Replies.Nodes {
+					commentPage.Comments = append(commentPage.Comments, discussionCommentPayload(repo, thread, reply))
+				}
+			}
+			if !comments.PageInfo.HasNextPage {
+				break
+			}
+
+			more := struct {
+				Repository struct {
+					Discussion struct {
+						Comments discussionComments `json:"comments"`
+					} `json:"discussion"`
+				} `json:"repository"`
+			}{}
+			resp, err := graphQL(ctx, client, moreDiscussionCommentsQuery, map[string]interface{}{
+				"owner":  repo.Owner.Login,
+				"name":   repo.Name,
+				"number": discussion.Number,
+				"cursor": comments.PageInfo.EndCursor,
+			}, &more)
+			if err != nil {
+				return CommentPage{}, fmt.Errorf("error listing comments of discussion %d of %s: %w", discussion.Number, repo.FullName, err)
+			}
+			commentPage.Rate = resp.Rate
+			comments = more.Repository.Discussion.Comments
+		}
+	}
+	return commentPage, nil
+}
+
+func discussionCommentPayload(repo Repository, discussion *Discussion, comment discussionCommentNode) CommentPayload {
+	return CommentPayload{
+		Action: ActionBackfill,
+		Comment: Comment{
+			Body:        comment.Body,
+			ID:          comment.DatabaseID,
+			NodeID:      comment.ID,
+			CommentUser: CommentUser{Login: comment.Author.Login},
+			HTMLURL:     comment.URL,
+			CreatedAt:   comment.CreatedAt,
+			UpdatedAt:   comment.UpdatedAt,
+		},
+		Discussion: discussion,
+		Repository: repo,
+	}
+}
+
+// minRateLimitWait is how long to wait for a secondary rate limit that does
+// not say when to retry.
+const minRateLimitWait time.Duration = time.Minute
+
+// RateLimitWait returns how long to wait before retrying a call that failed
+// with err, and whether err is a GitHub rate limit at all.
+func RateLimitWait(err error) (time.Duration, bool) {
+	rateLimitErr := &ghapi.RateLimitError{}
+	if errors.As(err, &rateLimitErr) {
+		wait := time.Until(rateLimitErr.Rate.Reset.Time)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	abuseErr := &ghapi.AbuseRateLimitError{}
+	if errors.As(err, &abuseErr) {
+		if abuseErr.RetryAfter != nil && *abuseErr.RetryAfter > 0 {
+			return *abuseErr.RetryAfter, true
+		}
+		return minRateLimitWait, true
+	}
+	return 0, false
+}
@@ -0,0 +1,146 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	ghapi "github.com/google/go-github/v44/github"
+)
+
+func TestListCommentPageIssueComments(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		query := req.URL.Query()
+		if req.URL.Path != "/repos/octo/a/issues/comments" || query.Get("page") != "2" ||
+			query.Get("sort") != "created" || query.Get("direction") != "asc" {
+			resp.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		resp.Header().Set("Link", `<https://api.github.com/repos/octo/a/issues/comments?page=3>; rel="next"`)
+		// nolint: errcheck
+		resp.Write([]byte(`[{
+			"id": 7,
+			"body": "Thanks!",
+			"user": {"login": "alice"},
+			"html_url": "https://github.com/octo/a/pull/12#issuecomment-7",
+			"issue_url": "https://api.github.com/repos/octo/a/issues/12"
+		}]`))
+	}))
+
+	page, err := ListCommentPage(context.Background(), client, digestRepo, IssueComments, "2")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if page.Next != "3" || len(page.Comments) != 1 {
+		t.Fatalf("Unexpected page %+v", page)
+	}
+	comment := page.Comments[0]
+	number, _, url := comment.Thread()
+	commentType, _ := comment.CommentType()
+	if comment.Action != ActionBackfill || commentType != CommentTypeIssueComment ||
+		comment.Comment.CommentUser.Login != "alice" || number != 12 || url != "https://github.com/octo/a/pull/12" {
+		t.Fatalf("Unexpected comment %+v", comment)
+	}
+}
+
+func TestListCommentPageDiscussionComments(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		request := graphQLRequest{}
+		if req.URL.Path != "/graphql" || json.NewDecoder(req.Body).Decode(&request) != nil {
+			resp.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if request.Variables["number"] == nil {
+			// nolint: errcheck
+			resp.Write([]byte(`{"data": {"repository": {"discussions": {
+				"pageInfo": {"hasNextPage": true, "endCursor": "D1"},
+				"nodes": [{"number": 3, "title": "Ideas", "url": "https://github.com/octo/a/discussions/3",
+					"comments": {"pageInfo": {"hasNextPage": true, "endCursor": "C1"}, "nodes": [
+						{"id": "DC_1", "databaseId": 1, "body": "First", "author": {"login": "alice"},
+							"replies": {"nodes": [{"id": "DC_2", "databaseId": 2, "body": "Reply", "author": {"login": "bob"}}]}}
+					]}}]
+			}}}}`))
+			return
+		}
+		if request.Variables["cursor"] != "C1" {
+			resp.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		// nolint: errcheck
+		resp.Write([]byte(`{"data": {"repository": {"discussion": {"comments": {
+			"pageInfo": {"hasNextPage": false},
+			"nodes": [{"id": "DC_3", "databaseId": 3, "body": "Later", "author": {"login": "carol"}}]
+		}}}}}`))
+	}))
+
+	page, err := ListCommentPage(context.Background(), client, digestRepo, DiscussionComments, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if page.Next != "D1" || len(page.Comments) != 3 {
+		t.Fatalf("Unexpected page %+v", page)
+	}
+	for i, nodeID := range []string{"DC_1", "DC_2", "DC_3"} {
+		comment := page.Comments[i]
+		commentType, _ := comment.CommentType()
+		number, title, _ := comment.Thread()
+		if comment.Comment.NodeID != nodeID || commentType != CommentTypeDiscussionComment || number != 3 || title != "Ideas" {
+			t.Fatalf("Unexpected comment %d %+v", i, comment)
+		}
+	}
+}
+
+func TestRateLimitWait(t *testing.T) {
+	retryAfter := 30 * time.Second
+	testCases := []struct {
+		name      string
+		err       error
+		rateLimit bool
+		min       time.Duration
+		max       time.Duration
+	}{
+		{
+			name:      "primary",
+			err:       &ghapi.RateLimitError{Rate: ghapi.Rate{Reset: ghapi.Timestamp{Time: time.Now().Add(time.Hour)}}},
+			rateLimit: true,
+			min:       59 * time.Minute,
+			max:       time.Hour,
+		},
+		{
+			name:      "primary reset",
+			err:       &ghapi.RateLimitError{Rate: ghapi.Rate{Reset: ghapi.Timestamp{Time: time.Now().Add(-time.Hour)}}},
+			rateLimit: true,
+		},
+		{
+			name:      "secondary retry after",
+			err:       &ghapi.AbuseRateLimitError{RetryAfter: &retryAfter},
+			rateLimit: true,
+			min:       retryAfter,
+			max:       retryAfter,
+		},
+		{
+			name:      "secondary",
+			err:       &ghapi.AbuseRateLimitError{},
+			rateLimit: true,
+			min:       minRateLimitWait,
+			max:       minRateLimitWait,
+		},
+		{
+			name: "other",
+			err:  errors.New("not found"),
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			wait, rateLimit := RateLimitWait(testCase.err)
+			if rateLimit != testCase.rateLimit || wait < testCase.min || wait > testCase.max {
+				t.Fatalf("Unexpected wait %s and rate limit %t", wait, rateLimit)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package github
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/trstringer/comment-sentiment/pkg/metrics"
+)
+
+// metricsTransport records the GitHub API calls and the rate limit left.
+type metricsTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip sends the request with the base transport.
+func (t metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		metrics.GitHubRequests.WithLabelValues(req.Method, "error").Inc()
+		return resp, err
+	}
+	metrics.GitHubRequests.WithLabelValues(req.Method, fmt.Sprintf("%dxx", resp.StatusCode/100)).Inc()
+
+	if remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining")); err == nil {
+		resource := resp.Header.Get("X-RateLimit-Resource")
+		if !rateLimitResources[resource] {
+			resource = metrics.OtherLabel
+		}
+		metrics.GitHubRateLimitRemaining.WithLabelValues(resource).Set(float64(remaining))
+	}
+	return resp, nil
+}
+
+// rateLimitResources are the rate limit resources of the API that the app
+// calls.
+var rateLimitResources = map[string]bool{
+	"core":    true,
+	"graphql": true,
+	"search":  true,
+}
@@ -0,0 +1,56 @@
+package github
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/trstringer/comment-sentiment/pkg/metrics"
+)
+
+func TestMetricsTransport(t *testing.T) {
+	testCases := []struct {
+		name              string
+		status            int
+		resource          string
+		expectedStatus    string
+		expectedResource  string
+		expectedRemaining float64
+	}{
+		{name: "core", status: http.StatusOK, resource: "core", expectedStatus: "2xx", expectedResource: "core", expectedRemaining: 4999},
+		{name: "not_found", status: http.StatusNotFound, resource: "graphql", expectedStatus: "4xx", expectedResource: "graphql", expectedRemaining: 4999},
+		{name: "unknown_resource", status: http.StatusOK, resource: "code_scanning_upload", expectedStatus: "2xx", expectedResource: metrics.OtherLabel, expectedRemaining: 4999},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+				resp.Header().Set("X-RateLimit-Remaining", "4999")
+				resp.Header().Set("X-RateLimit-Resource", testCase.resource)
+				resp.WriteHeader(testCase.status)
+			}))
+			defer server.Close()
+
+			requests := metrics.GitHubRequests.WithLabelValues(http.MethodGet, testCase.expectedStatus)
+			before := testutil.ToFloat64(requests)
+
+			client := &http.Client{Transport: metricsTransport{base: http.DefaultTransport}}
+			resp, err := client.Get(server.URL)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			resp.Body.Close()
+
+			if actual := testutil.ToFloat64(requests) - before; actual != 1 {
+				t.Fatalf("Expected 1 request counted with status %s, got %f", testCase.expectedStatus, actual)
+			}
+			remaining := testutil.ToFloat64(metrics.GitHubRateLimitRemaining.WithLabelValues(testCase.expectedResource))
+			if remaining != testCase.expectedRemaining {
+				t.Fatalf("Expected %f remaining for %s, got %f", testCase.expectedRemaining, testCase.expectedResource, remaining)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	ghapi "github.com/google/go-github/v44/github"
+	"gopkg.in/yaml.v3"
+
+	sa "github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer"
+)
+
+// RepoConfigPath is the file in a repo that configures the bot for it.
+const RepoConfigPath string = ".github/comment-sentiment.yaml"
+
+// Trigger is what makes the bot add the analysis to a comment.
+type Trigger string
+
+const (
+	// TriggerAll analyzes every comment, which is the default.
+	TriggerAll Trigger = "all"
+	// TriggerNegative only acts on negative comments or comments with
+	// negative sentences.
+	TriggerNegative Trigger = "negative"
+	// TriggerIncivility only acts on uncivil comments, so plain negativity
+	// such as a bug report is left alone.
+	TriggerIncivility Trigger = "incivility"
+)
+
+// DigestTarget is where the weekly digest of a repo is posted.
+type DigestTarget string
+
+const (
+	// DigestIssue posts the digest as an issue.
+	DigestIssue DigestTarget = "issue"
+	// DigestDiscussion posts the digest as a discussion.
+	DigestDiscussion DigestTarget = "discussion"
+)
+
+// DefaultDigestCategory is the discussion category digests are posted in.
+const DefaultDigestCategory string = "General"
+
+// DigestConfig configures the weekly community health digest of a repo.
+type DigestConfig struct {
+	// Post is where the digest is posted. No digest is posted if it is empty.
+	Post DigestTarget `yaml:"post"`
+	// Category is the discussion category of digest discussions.
+	Category string `yaml:"category"`
+	// Labels are added to digest issues.
+	Labels []string `yaml:"labels"`
+}
+
+// RepoConfig is the configuration a repo can set in RepoConfigPath.
+type RepoConfig struct {
+	Trigger Trigger `yaml:"trigger"`
+	// Shadow analyzes comments without editing them or posting anything, and
+	// records what would have been written instead.
+	Shadow bool         `yaml:"shadow"`
+	Digest DigestConfig `yaml:"digest"`
+}
+
+// DefaultRepoConfig is used for repos without a configuration file.
+func DefaultRepoConfig() RepoConfig {
+	return RepoConfig{
+		Trigger: TriggerAll,
+		Digest:  DigestConfig{Category: DefaultDigestCategory},
+	}
+}
+
+// ParseRepoConfig parses and validates the YAML configuration file.
+func ParseRepoConfig(data []byte) (RepoConfig, error) {
+	config := DefaultRepoConfig()
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return DefaultRepoConfig(), fmt.Errorf("error parsing repo config: %w", err)
+	}
+
+	switch config.Trigger {
+	case TriggerAll, TriggerNegative, TriggerIncivility:
+	case "":
+		config.Trigger = TriggerAll
+	default:
+		return DefaultRepoConfig(), fmt.Errorf("unknown trigger %s in repo config", config.Trigger)
+	}
+
+	switch config.Digest.Post {
+	case "", DigestIssue, DigestDiscussion:
+	default:
+		return DefaultRepoConfig(), fmt.Errorf("unknown digest post %s in repo config", config.Digest.Post)
+	}
+	if config.Digest.Category == "" {
+		config.Digest.Category = DefaultDigestCategory
+	}
+
+	return config, nil
+}
+
+// ShouldAnnotate indicates if the analysis should be added to the comment.
+func (c RepoConfig) ShouldAnnotate(analysis sa.Analysis) bool {
+	switch c.Trigger {
+	case TriggerNegative:
+		return analysis.Sentiment == sa.Negative ||
+			len(analysis.NegativeSentences()) > 0 ||
+			analysis.IsUncivil(sa.DefaultToxicityThreshold)
+	case TriggerIncivility:
+		return analysis.IsUncivil(sa.DefaultToxicityThreshold)
+	default:
+		return true
+	}
+}
+
+// RepoConfigCache caches repo configurations so that the file is not
+// fetched for every comment.
+type RepoConfigCache struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]repoConfigEntry
+}
+
+type repoConfigEntry struct {
+	config  RepoConfig
+	expires time.Time
+}
+
+// NewRepoConfigCache creates a cache that keeps configurations for ttl.
+func NewRepoConfigCache(ttl time.Duration) *RepoConfigCache {
+	return &RepoConfigCache{
+		ttl:     ttl,
+		entries: map[string]repoConfigEntry{},
+	}
+}
+
+// Get returns the configuration of the repo, fetching it if it is not cached.
+// Repos without a configuration file get DefaultRepoConfig.
+func (r *RepoConfigCache) Get(ctx context.Context, client *ghapi.Client, repo Repository) (RepoConfig, error) {
+	r.mu.Lock()
+	entry, ok := r.entries[repo.FullName]
+	r.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.config, nil
+	}
+
+	config, err := LoadRepoConfig(ctx, client, repo)
+	if err != nil {
+		return config, err
+	}
+
+	r.mu.Lock()
+	r.entries[repo.FullName] = repoConfigEntry{config: config, expires: time.Now().Add(r.ttl)}
+	r.mu.Unlock()
+	return config, nil
+}
+
+// LoadRepoConfig fetches the configuration file of the repo.
+func LoadRepoConfig(ctx context.Context, client *ghapi.Client, repo Repository) (RepoConfig, error) {
+	file, _, _, err := client.Repositories.GetContents(
+		ctx,
+		repo.Owner.Login,
+		repo.Name,
+		RepoConfigPath,
+		nil,
+	)
+	if err != nil {
+		var errResp *ghapi.ErrorResponse
+		if errors.As(err, &errResp) && errResp.Response != nil && errResp.Response.StatusCode == http.StatusNotFound {
+			return DefaultRepoConfig(), nil
+		}
+		return DefaultRepoConfig(), fmt.Errorf("error getting repo config: %w", err)
+	}
+	if file == nil {
+		return DefaultRepoConfig(), fmt.Errorf("repo config %s is not a file", RepoConfigPath)
+	}
+
+	content, err := file.GetContent()
+	if err != nil {
+		return DefaultRepoConfig(), fmt.Errorf("error decoding repo config: %w", err)
+	}
+	return ParseRepoConfig([]byte(content))
+}
@@ -0,0 +1,93 @@
+package github
+
+import (
+	"testing"
+
+	sa "github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer"
+)
+
+func TestParseRepoConfig(t *testing.T) {
+	testCases := []struct {
+		name      string
+		data      string
+		expected  Trigger
+		expectErr bool
+	}{
+		{name: "empty", data: "", expected: TriggerAll},
+		{name: "incivility", data: "trigger: incivility\n", expected: TriggerIncivility},
+		{name: "unknown_trigger", data: "trigger: sometimes\n", expected: TriggerAll, expectErr: true},
+		{name: "invalid_yaml", data: "trigger: [", expected: TriggerAll, expectErr: true},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			config, err := ParseRepoConfig([]byte(testCase.data))
+			if (err != nil) != testCase.expectErr {
+				t.Fatalf("Unexpected error result: %v", err)
+			}
+			if config.Trigger != testCase.expected {
+				t.Fatalf("Expected trigger %s, got %s", testCase.expected, config.Trigger)
+			}
+		})
+	}
+}
+
+func TestParseRepoConfigDigest(t *testing.T) {
+	config, err := ParseRepoConfig([]byte("digest:\n  post: discussion\n"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if config.Digest.Post != DigestDiscussion || config.Digest.Category != DefaultDigestCategory {
+		t.Fatalf("Unexpected digest config %+v", config.Digest)
+	}
+
+	if _, err := ParseRepoConfig([]byte("digest:\n  post: email\n")); err == nil {
+		t.Fatalf("Expected an error for an unknown digest post")
+	}
+	if config := DefaultRepoConfig(); config.Digest.Post != "" {
+		t.Fatalf("Expected no digest by default, got %+v", config.Digest)
+	}
+}
+
+func TestParseRepoConfigShadow(t *testing.T) {
+	config, err := ParseRepoConfig([]byte("shadow: true\n"))
+	if err != nil || !config.Shadow {
+		t.Fatalf("Expected shadow config, got %+v: %v", config, err)
+	}
+	if DefaultRepoConfig().Shadow {
+		t.Fatalf("Expected no shadow mode by default")
+	}
+}
+
+func TestShouldAnnotate(t *testing.T) {
+	negative := sa.Analysis{Sentiment: sa.Negative}
+	uncivil := sa.Analysis{
+		Sentiment: sa.Neutral,
+		Toxicity:  []sa.ToxicityScore{{Category: sa.Insult, Score: 0.9}},
+	}
+	positive := sa.Analysis{Sentiment: sa.Positive}
+
+	testCases := []struct {
+		name     string
+		trigger  Trigger
+		analysis sa.Analysis
+		expected bool
+	}{
+		{name: "all_positive", trigger: TriggerAll, analysis: positive, expected: true},
+		{name: "negative_positive", trigger: TriggerNegative, analysis: positive, expected: false},
+		{name: "negative_negative", trigger: TriggerNegative, analysis: negative, expected: true},
+		{name: "incivility_negative", trigger: TriggerIncivility, analysis: negative, expected: false},
+		{name: "incivility_uncivil", trigger: TriggerIncivility, analysis: uncivil, expected: true},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			actual := RepoConfig{Trigger: testCase.trigger}.ShouldAnnotate(testCase.analysis)
+			if actual != testCase.expected {
+				t.Fatalf("Expected %t, got %t", testCase.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package github
+
+import (
+	"crypto/hmac"
+	"crypto/sha1" // nolint: gosec
+	"crypto/sha256"
+	"fmt"
+)
+
+const (
+	// SignatureHeader is the header GitHub signs webhook deliveries in.
+	SignatureHeader string = "X-Hub-Signature-256"
+	// LegacySignatureHeader is the header GitHub also signs webhook
+	// deliveries in with SHA-1, for compatibility.
+	LegacySignatureHeader string = "X-Hub-Signature"
+	// EventHeader is the header that names the event of a webhook delivery.
+	EventHeader string = "X-GitHub-Event"
+)
+
+// SignPayload computes the X-Hub-Signature-256 header of the delivery body,
+// signed with the webhook secret.
+func SignPayload(body []byte, secret []byte) string {
+	hash := hmac.New(sha256.New, secret)
+	hash.Write(body)
+	return fmt.Sprintf("sha256=%x", hash.Sum(nil))
+}
+
+// SignPayloadSHA1 computes the legacy X-Hub-Signature header of the delivery
+// body, signed with the webhook secret.
+func SignPayloadSHA1(body []byte, secret []byte) string {
+	hash := hmac.New(sha1.New, secret)
+	hash.Write(body)
+	return fmt.Sprintf("sha1=%x", hash.Sum(nil))
+}
+
+// MatchSignature returns the position of the secret that the signature of
+// the body was made with by sign, or -1 if none was. The signature is
+// compared with every secret in constant time, so that the time taken does
+// not tell how close it is to a valid one.
+func MatchSignature(signature string, body []byte, secrets [][]byte, sign func(body []byte, secret []byte) string) int {
+	matched := -1
+	for i, secret := range secrets {
+		if len(secret) == 0 {
+			continue
+		}
+		if hmac.Equal([]byte(sign(body, secret)), []byte(signature)) && matched == -1 {
+			matched = i
+		}
+	}
+	return matched
+}
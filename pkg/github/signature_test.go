@@ -0,0 +1,83 @@
+package github
+
+import "testing"
+
+func TestSignPayload(t *testing.T) {
+	// Example from the GitHub documentation on validating webhook deliveries.
+	signature := SignPayload([]byte("Hello, World!"), []byte("It's a Secret to Everybody"))
+	expected := "sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17"
+	if signature != expected {
+		t.Fatalf("Expected %s, got %s", expected, signature)
+	}
+
+	signature = SignPayloadSHA1([]byte("Hello, World!"), []byte("It's a Secret to Everybody"))
+	expected = "sha1=01dc10d0c83e72ed246219cdd91669667fe2ca59"
+	if signature != expected {
+		t.Fatalf("Expected %s, got %s", expected, signature)
+	}
+}
+
+func TestMatchSignature(t *testing.T) {
+	body := []byte(`{"action": "created"}`)
+	secrets := [][]byte{[]byte("old"), nil, []byte("new")}
+
+	testCases := []struct {
+		name      string
+		signature string
+		sign      func(body []byte, secret []byte) string
+		expected  int
+	}{
+		{
+			name:      "first secret",
+			signature: SignPayload(body, []byte("old")),
+			sign:      SignPayload,
+			expected:  0,
+		},
+		{
+			name:      "rotated secret",
+			signature: SignPayload(body, []byte("new")),
+			sign:      SignPayload,
+			expected:  2,
+		},
+		{
+			name:      "unknown secret",
+			signature: SignPayload(body, []byte("other")),
+			sign:      SignPayload,
+			expected:  -1,
+		},
+		{
+			name:      "empty secret",
+			signature: SignPayload(body, nil),
+			sign:      SignPayload,
+			expected:  -1,
+		},
+		{
+			name:      "missing signature",
+			signature: "",
+			sign:      SignPayload,
+			expected:  -1,
+		},
+		{
+			name:      "legacy",
+			signature: SignPayloadSHA1(body, []byte("new")),
+			sign:      SignPayloadSHA1,
+			expected:  2,
+		},
+		{
+			name:      "wrong algorithm",
+			signature: SignPayloadSHA1(body, []byte("new")),
+			sign:      SignPayload,
+			expected:  -1,
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			matched := MatchSignature(testCase.signature, body, secrets, testCase.sign)
+			if matched != testCase.expected {
+				t.Fatalf("Expected secret %d, got %d", testCase.expected, matched)
+			}
+		})
+	}
+}
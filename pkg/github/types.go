@@ -1,5 +1,7 @@
 package github
 
+import "time"
+
 // CommentType allows the ability to distinguish different comment types.
 type CommentType int
 
@@ -9,6 +11,8 @@ const (
 	// CommentTypePullRequestReviewComment represents a GitHub pull request
 	// review comment.
 	CommentTypePullRequestReviewComment
+	// CommentTypeDiscussionComment represents a GitHub discussion comment.
+	CommentTypeDiscussionComment
 	// CommentTypeUnknown is the indication that the comment type is unknown
 	// and the output should likely not be trusted.
 	CommentTypeUnknown
@@ -24,8 +28,16 @@ type CommentPayload struct {
 	Comment     Comment      `json:"comment"`
 	Issue       *Issue       `json:"issue,omitempty"`
 	PullRequest *PullRequest `json:"pull_request,omitempty"`
+	Discussion  *Discussion  `json:"discussion,omitempty"`
 	Repository  Repository   `json:"repository"`
 	Sender      Sender       `json:"sender"`
+	// Installation is set for deliveries to a GitHub App.
+	Installation *Installation `json:"installation,omitempty"`
+}
+
+// Installation represents the GitHub App installation of the delivery.
+type Installation struct {
+	ID int64 `json:"id"`
 }
 
 // Sender represents the sender of the action from the GitHub API.
@@ -54,17 +66,34 @@ type CommentUser struct {
 type Comment struct {
 	Body                string      `json:"body"`
 	ID                  int64       `json:"id"`
+	NodeID              string      `json:"node_id"`
 	PullRequestReviewID *int64      `json:"pull_request_review_id,omitempty"`
 	CommentUser         CommentUser `json:"user"`
+	HTMLURL             string      `json:"html_url"`
+	CreatedAt           time.Time   `json:"created_at"`
+	UpdatedAt           time.Time   `json:"updated_at"`
 }
 
 // Issue represents a GitHub issue.
 type Issue struct {
-	ID  int64  `json:"id"`
-	URL string `json:"url"`
+	ID      int64  `json:"id"`
+	URL     string `json:"url"`
+	Number  int    `json:"number"`
+	Title   string `json:"title"`
+	HTMLURL string `json:"html_url"`
 }
 
 // PullRequest represents a GitHub pull request.
 type PullRequest struct {
-	URL string `json:"url"`
+	URL     string `json:"url"`
+	Number  int    `json:"number"`
+	Title   string `json:"title"`
+	HTMLURL string `json:"html_url"`
+}
+
+// Discussion represents a GitHub discussion.
+type Discussion struct {
+	Number  int    `json:"number"`
+	Title   string `json:"title"`
+	HTMLURL string `json:"html_url"`
 }
@@ -0,0 +1,213 @@
+// Package metrics defines the Prometheus metrics exposed by the app. Label
+// values are kept to small, known sets so that the number of series stays
+// bounded.
+package metrics
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace string = "comment_sentiment"
+
+// CacheLookups counts analysis cache lookups by provider and result, which is
+// either hit or miss.
+var CacheLookups = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_lookups_total",
+		Help:      "Sentiment analysis cache lookups by provider and result.",
+	},
+	[]string{"provider", "result"},
+)
+
+// NegativeComments counts comments that were analyzed as negative, once for
+// each time a comment becomes negative.
+var NegativeComments = promauto.NewCounter(
+	prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "negative_comments_total",
+		Help:      "Comments that became negative.",
+	},
+)
+
+// NegativeCommentConversions counts negative comments that were edited to be
+// neutral or positive, by the new sentiment.
+var NegativeCommentConversions = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "negative_comment_conversions_total",
+		Help:      "Negative comments that were edited to be neutral or positive, by the new sentiment.",
+	},
+	[]string{"sentiment"},
+)
+
+// NegativeCommentConversionSeconds is how long comments were negative before
+// an edit converted them.
+var NegativeCommentConversionSeconds = promauto.NewHistogram(
+	prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "negative_comment_conversion_seconds",
+		Help:      "Time from a comment becoming negative to an edit converting it.",
+		// From a minute to a week.
+		Buckets: []float64{60, 300, 900, 3600, 6 * 3600, 24 * 3600, 7 * 24 * 3600},
+	},
+)
+
+// WebhookSignatures counts the signature checks of webhook deliveries by
+// result, which is valid, invalid or missing, by the algorithm of the
+// signature, and by the position of the webhook secret that matched, which
+// is empty when none did.
+var WebhookSignatures = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_signatures_total",
+		Help:      "Webhook delivery signature checks by result, algorithm and matching secret.",
+	},
+	[]string{"result", "algorithm", "secret"},
+)
+
+// WebhookLimitHits counts webhook deliveries over a limit, by the limit,
+// which is payload_size, installation or repo, and by what was done with
+// them, which is reject, drop, queue or offline.
+var WebhookLimitHits = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_limit_hits_total",
+		Help:      "Webhook deliveries over a size or rate limit, by limit and action.",
+	},
+	[]string{"limit", "action"},
+)
+
+// WebhookDeliveries counts webhook deliveries by event and by outcome, which
+// is processed, queued, rejected, too_large, rate_limited, invalid or error.
+var WebhookDeliveries = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_deliveries_total",
+		Help:      "Webhook deliveries by event and outcome.",
+	},
+	[]string{"event", "outcome"},
+)
+
+// WebhookDeliverySeconds is how long webhook deliveries take to handle, by
+// event.
+var WebhookDeliverySeconds = promauto.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "webhook_delivery_seconds",
+		Help:      "Time to handle webhook deliveries, by event.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 12),
+	},
+	[]string{"event"},
+)
+
+// AnalyzerRequests counts the calls to sentiment providers by provider and
+// result, which is success or error. Cached analyses do not call the
+// provider.
+var AnalyzerRequests = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "analyzer_requests_total",
+		Help:      "Sentiment provider calls by provider and result.",
+	},
+	[]string{"provider", "result"},
+)
+
+// AnalyzerSeconds is how long sentiment providers take to analyze a comment,
+// by provider.
+var AnalyzerSeconds = promauto.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "analyzer_seconds",
+		Help:      "Time for sentiment providers to analyze a comment, by provider.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 12),
+	},
+	[]string{"provider"},
+)
+
+// GitHubRequests counts GitHub API calls by method and status, which is the
+// class of the status code, such as 2xx, or error when there is no response.
+var GitHubRequests = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "github_requests_total",
+		Help:      "GitHub API calls by method and status class.",
+	},
+	[]string{"method", "status"},
+)
+
+// GitHubRateLimitRemaining is the number of GitHub API calls left in the rate
+// limit window, by rate limit resource, as of the last response. Each
+// installation has its own rate limit, so it is the last installation's.
+var GitHubRateLimitRemaining = promauto.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "github_rate_limit_remaining",
+		Help:      "GitHub API calls left in the rate limit window as of the last response, by resource.",
+	},
+	[]string{"resource"},
+)
+
+// QueuedComments is the number of comments waiting in a queue, by queue,
+// which is budget or rate_limit.
+var QueuedComments = promauto.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "queued_comments",
+		Help:      "Comments waiting in a queue, by queue.",
+	},
+	[]string{"queue"},
+)
+
+// CommentSentiments counts the analyzed comments by repo and sentiment. The
+// repo label is bounded with a LabelLimit.
+var CommentSentiments = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "comment_sentiments_total",
+		Help:      "Analyzed comments by repo and sentiment.",
+	},
+	[]string{"repo", "sentiment"},
+)
+
+// OtherLabel replaces the label values over a LabelLimit.
+const OtherLabel string = "other"
+
+// LabelLimit bounds the values of a label, such as repos, to the first ones
+// seen, so that the number of series stays bounded. It is safe for concurrent
+// use.
+type LabelLimit struct {
+	max    int
+	mu     sync.Mutex
+	values map[string]bool
+}
+
+// NewLabelLimit creates a limit of max values.
+func NewLabelLimit(max int) *LabelLimit {
+	return &LabelLimit{max: max, values: map[string]bool{}}
+}
+
+// Value returns value if it was already seen or there is room for it, or
+// else OtherLabel.
+func (l *LabelLimit) Value(value string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.values[value] {
+		return value
+	}
+	if len(l.values) >= l.max {
+		return OtherLabel
+	}
+	l.values[value] = true
+	return value
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"testing"
+)
+
+func TestLabelLimit(t *testing.T) {
+	testCases := []struct {
+		name     string
+		max      int
+		values   []string
+		expected []string
+	}{
+		{
+			name:     "under_limit",
+			max:      3,
+			values:   []string{"a", "b", "a"},
+			expected: []string{"a", "b", "a"},
+		},
+		{
+			name:     "over_limit",
+			max:      2,
+			values:   []string{"a", "b", "c", "a", "d", "b"},
+			expected: []string{"a", "b", OtherLabel, "a", OtherLabel, "b"},
+		},
+		{
+			name:     "no_values",
+			max:      0,
+			values:   []string{"a"},
+			expected: []string{OtherLabel},
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			limit := NewLabelLimit(testCase.max)
+			for i, value := range testCase.values {
+				if actual := limit.Value(value); actual != testCase.expected[i] {
+					t.Fatalf("Unexpected label for value %d %s: expected %s, got %s", i, value, testCase.expected[i], actual)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+// Package ratelimit limits how often something happens for each key, such as
+// an API key or an installation, with token buckets.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxBuckets bounds the keys that are tracked. Full buckets are forgotten
+// when there are more, as they are the same as new ones.
+const maxBuckets int = 10000
+
+// Rate is how many events are allowed in a period. The zero Rate allows
+// everything.
+type Rate struct {
+	Limit  int
+	Period time.Duration
+}
+
+var periods = map[string]time.Duration{
+	"second": time.Second,
+	"minute": time.Minute,
+	"hour":   time.Hour,
+	"day":    24 * time.Hour,
+}
+
+// ParseRate parses a rate such as "60/minute". The period is second, minute,
+// hour or day. An empty rate or a limit of 0 allows everything.
+func ParseRate(rawRate string) (Rate, error) {
+	if strings.TrimSpace(rawRate) == "" {
+		return Rate{}, nil
+	}
+	parts := strings.SplitN(strings.TrimSpace(rawRate), "/", 2)
+	if len(parts) != 2 {
+		return Rate{}, fmt.Errorf("invalid rate '%s', expected a limit and period such as '60/minute'", rawRate)
+	}
+	limit, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil || limit < 0 {
+		return Rate{}, fmt.Errorf("invalid rate limit '%s'", parts[0])
+	}
+	period, ok := periods[strings.TrimSpace(parts[1])]
+	if !ok {
+		return Rate{}, fmt.Errorf("unknown rate period '%s'", parts[1])
+	}
+	if limit == 0 {
+		return Rate{}, nil
+	}
+	return Rate{Limit: limit, Period: period}, nil
+}
+
+// Unlimited indicates if the rate allows everything.
+func (r Rate) Unlimited() bool {
+	return r.Limit <= 0 || r.Period <= 0
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// Limiter keeps a token bucket for each key. A bucket holds up to the limit
+// of the rate, so that a burst of that many events is allowed, and refills
+// evenly over the period.
+type Limiter struct {
+	rate    Rate
+	now     func() time.Time
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+// NewLimiter creates a limiter of each key to rate.
+func NewLimiter(rate Rate) *Limiter {
+	return &Limiter{rate: rate, now: time.Now, buckets: map[string]*bucket{}}
+}
+
+// Allow takes a token from the bucket of key. When the bucket is empty, it
+// returns false and how long until the next token.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	return l.take(key, false)
+}
+
+// Reserve takes a token from the bucket of key even when it is empty, and
+// returns how long until that token is available, so that the events that
+// wait for their tokens are spread out at the rate.
+func (l *Limiter) Reserve(key string) time.Duration {
+	_, wait := l.take(key, true)
+	return wait
+}
+
+// Cancel gives back a token taken from the bucket of key, for an event that
+// was not handled after all, such as a reserved event that was dropped.
+func (l *Limiter) Cancel(key string) {
+	if l.rate.Unlimited() {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		return
+	}
+	l.refill(b, l.now())
+	b.tokens = math.Min(float64(l.rate.Limit), b.tokens+1)
+}
+
+func (l *Limiter) take(key string, reserve bool) (bool, time.Duration) {
+	if l.rate.Unlimited() {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxBuckets {
+			l.forgetFull(now)
+		}
+		b = &bucket{tokens: float64(l.rate.Limit), updated: now}
+		l.buckets[key] = b
+	}
+	l.refill(b, now)
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	perToken := float64(l.rate.Period) / float64(l.rate.Limit)
+	wait := time.Duration((1 - b.tokens) * perToken).Round(time.Millisecond)
+	if wait < time.Millisecond {
+		wait = time.Millisecond
+	}
+	if reserve {
+		b.tokens--
+	}
+	return false, wait
+}
+
+func (l *Limiter) refill(b *bucket, now time.Time) {
+	elapsed := now.Sub(b.updated)
+	if elapsed <= 0 {
+		return
+	}
+	b.tokens = math.Min(
+		float64(l.rate.Limit),
+		b.tokens+float64(l.rate.Limit)*float64(elapsed)/float64(l.rate.Period),
+	)
+	b.updated = now
+}
+
+func (l *Limiter) forgetFull(now time.Time) {
+	for key, b := range l.buckets {
+		l.refill(b, now)
+		if b.tokens >= float64(l.rate.Limit) {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	testCases := []struct {
+		name     string
+		rawRate  string
+		expected Rate
+		hasErr   bool
+	}{
+		{name: "per minute", rawRate: "60/minute", expected: Rate{Limit: 60, Period: time.Minute}},
+		{name: "spaces", rawRate: " 5 / day ", expected: Rate{Limit: 5, Period: 24 * time.Hour}},
+		{name: "empty", rawRate: "", expected: Rate{}},
+		{name: "zero", rawRate: "0/second", expected: Rate{}},
+		{name: "no period", rawRate: "60", hasErr: true},
+		{name: "unknown period", rawRate: "60/week", hasErr: true},
+		{name: "negative", rawRate: "-1/hour", hasErr: true},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			rate, err := ParseRate(testCase.rawRate)
+			if testCase.hasErr {
+				if err == nil {
+					t.Fatalf("Expected error, got %+v", rate)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if rate != testCase.expected {
+				t.Fatalf("Expected %+v, got %+v", testCase.expected, rate)
+			}
+		})
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	now := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	limiter := NewLimiter(Rate{Limit: 2, Period: time.Minute})
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := limiter.Allow("a"); !ok {
+			t.Fatalf("Expected burst call %d to be allowed", i)
+		}
+	}
+	ok, wait := limiter.Allow("a")
+	if ok || wait != 30*time.Second {
+		t.Fatalf("Expected to wait 30s, got %t %s", ok, wait)
+	}
+	if ok, _ := limiter.Allow("b"); !ok {
+		t.Fatalf("Expected other key to be allowed")
+	}
+
+	now = now.Add(20 * time.Second)
+	if ok, wait := limiter.Allow("a"); ok || wait != 10*time.Second {
+		t.Fatalf("Expected to wait 10s, got %t %s", ok, wait)
+	}
+	now = now.Add(10 * time.Second)
+	if ok, _ := limiter.Allow("a"); !ok {
+		t.Fatalf("Expected refilled token to be allowed")
+	}
+
+	unlimited := NewLimiter(Rate{})
+	for i := 0; i < 100; i++ {
+		if ok, _ := unlimited.Allow("a"); !ok {
+			t.Fatalf("Expected unlimited rate to allow everything")
+		}
+	}
+}
+
+func TestLimiterReserve(t *testing.T) {
+	now := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	limiter := NewLimiter(Rate{Limit: 1, Period: time.Minute})
+	limiter.now = func() time.Time { return now }
+
+	for i, expected := range []time.Duration{0, time.Minute, 2 * time.Minute} {
+		if wait := limiter.Reserve("a"); wait != expected {
+			t.Fatalf("Expected reservation %d to wait %s, got %s", i, expected, wait)
+		}
+	}
+	if ok, wait := limiter.Allow("a"); ok || wait != 3*time.Minute {
+		t.Fatalf("Expected to wait for the reservations, got %t %s", ok, wait)
+	}
+
+	now = now.Add(3 * time.Minute)
+	if ok, _ := limiter.Allow("a"); !ok {
+		t.Fatalf("Expected token after the reservations")
+	}
+}
+
+func TestLimiterCancel(t *testing.T) {
+	now := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	limiter := NewLimiter(Rate{Limit: 1, Period: time.Minute})
+	limiter.now = func() time.Time { return now }
+
+	limiter.Reserve("a")
+	for i := 0; i < 10; i++ {
+		limiter.Reserve("a")
+		limiter.Cancel("a")
+	}
+	if wait := limiter.Reserve("a"); wait != time.Minute {
+		t.Fatalf("Expected the canceled reservations to be given back, got a wait of %s", wait)
+	}
+
+	limiter.Cancel("a")
+	limiter.Cancel("a")
+	limiter.Cancel("a")
+	if ok, _ := limiter.Allow("a"); !ok {
+		t.Fatalf("Expected a token after canceling")
+	}
+	if ok, _ := limiter.Allow("a"); ok {
+		t.Fatalf("Expected canceling not to fill the bucket over its limit")
+	}
+}
+
+func TestLimiterForgetsFullBuckets(t *testing.T) {
+	now := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	limiter := NewLimiter(Rate{Limit: 1, Period: time.Second})
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < maxBuckets; i++ {
+		limiter.Allow(string(rune(i)))
+	}
+	now = now.Add(time.Second)
+	limiter.Allow("new")
+	if len(limiter.buckets) != 1 {
+		t.Fatalf("Expected full buckets to be forgotten, got %d", len(limiter.buckets))
+	}
+}
@@ -0,0 +1,106 @@
+// Package replay reads saved webhook deliveries so they can be sent to the
+// server again, and fakes the GitHub API to see what a delivery would do.
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/textproto"
+	"strings"
+
+	gh "github.com/trstringer/comment-sentiment/pkg/github"
+)
+
+// Delivery is a saved webhook delivery.
+type Delivery struct {
+	Header http.Header
+	Body   []byte
+}
+
+// savedDelivery is a delivery as the GitHub API returns it from
+// /app/hook/deliveries/{id}.
+type savedDelivery struct {
+	Request *struct {
+		Headers map[string]string `json:"headers"`
+		Payload json.RawMessage   `json:"payload"`
+	} `json:"request"`
+}
+
+// ParseDelivery reads a saved delivery. It is either the JSON of a delivery
+// from the GitHub API, a JSON payload without headers, or headers as
+// "Name: value" lines followed by a blank line and the payload, as shown on
+// the advanced tab of the GitHub App settings.
+func ParseDelivery(data []byte) (Delivery, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return Delivery{}, fmt.Errorf("delivery is empty")
+	}
+
+	if trimmed[0] == '{' {
+		saved := savedDelivery{}
+		if err := json.Unmarshal(trimmed, &saved); err != nil {
+			return Delivery{}, fmt.Errorf("error parsing delivery: %w", err)
+		}
+		if saved.Request == nil {
+			return Delivery{Header: http.Header{}, Body: trimmed}, nil
+		}
+		header := http.Header{}
+		for name, value := range saved.Request.Headers {
+			header.Set(name, value)
+		}
+		return Delivery{Header: header, Body: saved.Request.Payload}, nil
+	}
+
+	reader := textproto.NewReader(bufio.NewReader(bytes.NewReader(trimmed)))
+	mimeHeader, err := reader.ReadMIMEHeader()
+	if err != nil && err != io.EOF {
+		return Delivery{}, fmt.Errorf("error parsing delivery headers: %w", err)
+	}
+	for name := range mimeHeader {
+		// Lines such as "Request method: POST" describe the delivery and are
+		// not headers.
+		if strings.Contains(name, " ") {
+			delete(mimeHeader, name)
+		}
+	}
+	body, err := ioutil.ReadAll(reader.R)
+	if err != nil {
+		return Delivery{}, fmt.Errorf("error reading delivery body: %w", err)
+	}
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return Delivery{}, fmt.Errorf("delivery has no payload after its headers")
+	}
+	return Delivery{Header: http.Header(mimeHeader), Body: body}, nil
+}
+
+// hopHeaders are headers of the saved request that do not apply to a new
+// request.
+var hopHeaders = []string{"Content-Length", "Host", "Connection", "Accept-Encoding"}
+
+// NewRequest creates a POST of the delivery to url. The delivery is signed
+// with the secret if there is one, and keeps its saved signature otherwise.
+func (d Delivery) NewRequest(url string, secret []byte) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(d.Body))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	for name, values := range d.Header {
+		req.Header[name] = append([]string{}, values...)
+	}
+	for _, name := range hopHeaders {
+		req.Header.Del(name)
+	}
+	if req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if len(secret) > 0 {
+		req.Header.Set(gh.SignatureHeader, gh.SignPayload(d.Body, secret))
+	}
+	return req, nil
+}
@@ -0,0 +1,122 @@
+package replay
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+
+	ghapi "github.com/google/go-github/v44/github"
+
+	gh "github.com/trstringer/comment-sentiment/pkg/github"
+)
+
+// Edit is a write call made to the fake GitHub API.
+type Edit struct {
+	Method string
+	Path   string
+	// Body is the new text of an edited comment, or the request body of
+	// other writes.
+	Body string
+}
+
+// FakeGitHub is a GitHub API that serves a repo configuration and records
+// writes instead of making them.
+type FakeGitHub struct {
+	server     *httptest.Server
+	repoConfig string
+	mu         sync.Mutex
+	edits      []Edit
+}
+
+// NewFakeGitHub starts a fake GitHub API. Every repo has the repoConfig
+// configuration file, or none if it is empty.
+func NewFakeGitHub(repoConfig string) *FakeGitHub {
+	fake := &FakeGitHub{repoConfig: repoConfig}
+	fake.server = httptest.NewServer(http.HandlerFunc(fake.serveHTTP))
+	return fake
+}
+
+// Client creates a client of the fake API.
+func (f *FakeGitHub) Client() *ghapi.Client {
+	client := ghapi.NewClient(f.server.Client())
+	// The server URL is always valid.
+	client.BaseURL, _ = url.Parse(f.server.URL + "/")
+	return client
+}
+
+// Edits returns the writes made so far.
+func (f *FakeGitHub) Edits() []Edit {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Edit{}, f.edits...)
+}
+
+// Close stops the fake API.
+func (f *FakeGitHub) Close() {
+	f.server.Close()
+}
+
+func (f *FakeGitHub) serveHTTP(resp http.ResponseWriter, req *http.Request) {
+	if req.Method == http.MethodGet {
+		if strings.HasSuffix(req.URL.Path, "/contents/"+gh.RepoConfigPath) && f.repoConfig != "" {
+			writeJSON(resp, map[string]string{
+				"type":     "file",
+				"encoding": "base64",
+				"content":  base64.StdEncoding.EncodeToString([]byte(f.repoConfig)),
+			})
+			return
+		}
+		resp.WriteHeader(http.StatusNotFound)
+		writeJSON(resp, map[string]string{"message": "Not Found"})
+		return
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		resp.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	edit := Edit{Method: req.Method, Path: req.URL.Path, Body: string(body)}
+	if newBody, ok := commentBody(req.URL.Path, body); ok {
+		edit.Body = newBody
+	}
+	f.mu.Lock()
+	f.edits = append(f.edits, edit)
+	f.mu.Unlock()
+
+	writeJSON(resp, map[string]interface{}{"data": map[string]interface{}{}})
+}
+
+// commentBody returns the new text of a comment edit, from a REST edit or a
+// GraphQL updateDiscussionComment mutation.
+func commentBody(path string, body []byte) (string, bool) {
+	request := struct {
+		Body      *string `json:"body"`
+		Query     string  `json:"query"`
+		Variables struct {
+			Body *string `json:"body"`
+		} `json:"variables"`
+	}{}
+	if json.Unmarshal(body, &request) != nil {
+		return "", false
+	}
+	switch {
+	case strings.HasSuffix(path, "/graphql") && strings.Contains(request.Query, "updateDiscussionComment") && request.Variables.Body != nil:
+		return *request.Variables.Body, true
+	case strings.Contains(path, "/comments/") && request.Body != nil:
+		return *request.Body, true
+	default:
+		return "", false
+	}
+}
+
+func writeJSON(resp http.ResponseWriter, value interface{}) {
+	resp.Header().Set("Content-Type", "application/json")
+	// nolint: errcheck
+	json.NewEncoder(resp).Encode(value)
+}
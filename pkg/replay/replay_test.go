@@ -0,0 +1,128 @@
+package replay
+
+import (
+	"context"
+	"testing"
+
+	ghapi "github.com/google/go-github/v44/github"
+
+	gh "github.com/trstringer/comment-sentiment/pkg/github"
+)
+
+const testPayload string = `{"action": "created", "comment": {"id": 1, "body": "Hi"}}`
+
+func TestParseDelivery(t *testing.T) {
+	testCases := []struct {
+		name   string
+		data   string
+		event  string
+		body   string
+		hasErr bool
+	}{
+		{
+			name:  "headers",
+			data:  "Request method: POST\nX-GitHub-Event: issue_comment\ncontent-type: application/json\n\n" + testPayload + "\n",
+			event: "issue_comment",
+			body:  testPayload,
+		},
+		{
+			name:  "api",
+			data:  `{"id": 9, "request": {"headers": {"X-GitHub-Event": "discussion_comment"}, "payload": ` + testPayload + `}}`,
+			event: "discussion_comment",
+			body:  testPayload,
+		},
+		{
+			name: "payload",
+			data: "\n" + testPayload,
+			body: testPayload,
+		},
+		{
+			name:   "headers only",
+			data:   "X-GitHub-Event: issue_comment\n",
+			hasErr: true,
+		},
+		{
+			name:   "empty",
+			data:   " \n",
+			hasErr: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			delivery, err := ParseDelivery([]byte(testCase.data))
+			if testCase.hasErr {
+				if err == nil {
+					t.Fatalf("Expected error, got %+v", delivery)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if delivery.Header.Get("X-GitHub-Event") != testCase.event || delivery.Header.Get("Request Method") != "" ||
+				string(delivery.Body) != testCase.body {
+				t.Fatalf("Unexpected delivery %v %s", delivery.Header, delivery.Body)
+			}
+		})
+	}
+}
+
+func TestDeliveryNewRequest(t *testing.T) {
+	delivery, err := ParseDelivery([]byte("X-Hub-Signature-256: sha256=old\nContent-Length: 3\n\n" + testPayload))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	req, err := delivery.NewRequest("http://localhost:8080/", []byte("secret"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if req.Header.Get(gh.SignatureHeader) != gh.SignPayload([]byte(testPayload), []byte("secret")) ||
+		req.Header.Get("Content-Length") != "" || req.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("Unexpected headers %v", req.Header)
+	}
+
+	req, err = delivery.NewRequest("http://localhost:8080/", nil)
+	if err != nil || req.Header.Get(gh.SignatureHeader) != "sha256=old" {
+		t.Fatalf("Expected saved signature, got %v: %v", req.Header, err)
+	}
+}
+
+func TestFakeGitHub(t *testing.T) {
+	fake := NewFakeGitHub("trigger: negative\n")
+	defer fake.Close()
+	client := fake.Client()
+	repo := gh.Repository{FullName: "octo/a", Name: "a", Owner: gh.RepositoryOwner{Login: "octo"}}
+
+	config, err := gh.LoadRepoConfig(context.Background(), client, repo)
+	if err != nil || config.Trigger != gh.TriggerNegative {
+		t.Fatalf("Unexpected config %+v: %v", config, err)
+	}
+
+	issueComment := gh.CommentPayload{Comment: gh.Comment{ID: 5}, Issue: &gh.Issue{Number: 1}, Repository: repo}
+	if err := issueComment.UpdateComment(client, "Edited"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	discussionComment := gh.CommentPayload{Comment: gh.Comment{NodeID: "DC_1"}, Discussion: &gh.Discussion{Number: 2}, Repository: repo}
+	if err := discussionComment.UpdateComment(client, "Discussed"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, _, err := client.Issues.Create(context.Background(), "octo", "a", &ghapi.IssueRequest{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	edits := fake.Edits()
+	if len(edits) != 3 || edits[0].Path != "/repos/octo/a/issues/comments/5" || edits[0].Body != "Edited" ||
+		edits[1].Path != "/graphql" || edits[1].Body != "Discussed" || edits[2].Path != "/repos/octo/a/issues" {
+		t.Fatalf("Unexpected edits %+v", edits)
+	}
+
+	empty := NewFakeGitHub("")
+	defer empty.Close()
+	config, err = gh.LoadRepoConfig(context.Background(), empty.Client(), repo)
+	if err != nil || config.Trigger != gh.TriggerAll {
+		t.Fatalf("Expected default config, got %+v: %v", config, err)
+	}
+}
@@ -0,0 +1,302 @@
+// Package aws is a sentiment provider for Amazon Comprehend.
+package aws
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	sa "github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer"
+)
+
+const (
+	defaultTimeout time.Duration = 30 * time.Second
+	serviceName    string        = "comprehend"
+	targetPrefix   string        = "Comprehend_20171127"
+	// maxTextBytes is the Comprehend limit on the size of a single document.
+	maxTextBytes int = 5000
+	// maxBatchSize is the Comprehend limit on documents in a batch call.
+	maxBatchSize int = 25
+)
+
+// SentimentService is the Amazon Comprehend service in a region.
+type SentimentService struct {
+	endpoint     string
+	region       string
+	languageCode string
+	credentials  Credentials
+	httpClient   *http.Client
+}
+
+// Option configures optional settings of the SentimentService.
+type Option func(*SentimentService)
+
+// WithEndpoint overrides the regional Comprehend endpoint.
+func WithEndpoint(endpoint string) Option {
+	return func(s *SentimentService) {
+		s.endpoint = strings.TrimRight(endpoint, "/")
+	}
+}
+
+// WithHTTPClient sets the HTTP client used for all calls to Comprehend.
+func WithHTTPClient(client *http.Client) Option {
+	return func(s *SentimentService) {
+		s.httpClient = client
+	}
+}
+
+// WithTimeout sets the timeout of the default HTTP client.
+func WithTimeout(timeout time.Duration) Option {
+	return func(s *SentimentService) {
+		s.httpClient = &http.Client{Timeout: timeout}
+	}
+}
+
+// WithLanguageCode sets the language of the analyzed text, which defaults to
+// English.
+func WithLanguageCode(languageCode string) Option {
+	return func(s *SentimentService) {
+		s.languageCode = languageCode
+	}
+}
+
+type sentimentScore struct {
+	Positive float32 `json:"Positive"`
+	Negative float32 `json:"Negative"`
+	Neutral  float32 `json:"Neutral"`
+	Mixed    float32 `json:"Mixed"`
+}
+
+type detectSentimentRequest struct {
+	Text         string `json:"Text"`
+	LanguageCode string `json:"LanguageCode"`
+}
+
+type detectSentimentResponse struct {
+	Sentiment      string         `json:"Sentiment"`
+	SentimentScore sentimentScore `json:"SentimentScore"`
+}
+
+type batchDetectSentimentRequest struct {
+	TextList     []string `json:"TextList"`
+	LanguageCode string   `json:"LanguageCode"`
+}
+
+type batchResult struct {
+	Index          int            `json:"Index"`
+	Sentiment      string         `json:"Sentiment"`
+	SentimentScore sentimentScore `json:"SentimentScore"`
+}
+
+type batchError struct {
+	Index        int    `json:"Index"`
+	ErrorCode    string `json:"ErrorCode"`
+	ErrorMessage string `json:"ErrorMessage"`
+}
+
+type batchDetectSentimentResponse struct {
+	ResultList []batchResult `json:"ResultList"`
+	ErrorList  []batchError  `json:"ErrorList"`
+}
+
+type errorResponse struct {
+	Type         string `json:"__type"`
+	Message      string `json:"message"`
+	MessageUpper string `json:"Message"`
+}
+
+// NewSentimentService creates a Comprehend provider for the region.
+func NewSentimentService(region string, credentials Credentials, opts ...Option) *SentimentService {
+	svc := &SentimentService{
+		endpoint:     fmt.Sprintf("https://comprehend.%s.amazonaws.com", region),
+		region:       region,
+		languageCode: "en",
+		credentials:  credentials,
+		httpClient:   &http.Client{Timeout: defaultTimeout},
+	}
+	for _, opt := range opts {
+		opt(svc)
+	}
+	return svc
+}
+
+// AnalyzeSentiment analyzes the document with DetectSentiment and each of
+// its sentences with BatchDetectSentiment.
+func (s SentimentService) AnalyzeSentiment(ctx context.Context, text string) (*sa.Analysis, error) {
+	document := detectSentimentResponse{}
+	err := s.call(ctx, "DetectSentiment", detectSentimentRequest{
+		Text:         truncate(text, maxTextBytes),
+		LanguageCode: s.languageCode,
+	}, &document)
+	if err != nil {
+		return nil, err
+	}
+
+	resultSentiment := sentimentFromString(document.Sentiment)
+	analysis := &sa.Analysis{
+		Sentiment:        resultSentiment,
+		Confidence:       document.SentimentScore.confidence(document.Sentiment),
+		SentenceAnalyses: []sa.SentenceAnalysis{},
+	}
+
+	sentences := sa.SplitSentences(text)
+	if len(sentences) <= 1 {
+		for _, sentence := range sentences {
+			analysis.SentenceAnalyses = append(analysis.SentenceAnalyses, sa.SentenceAnalysis{
+				Text:       sentence,
+				Sentiment:  analysis.Sentiment,
+				Confidence: analysis.Confidence,
+			})
+		}
+		return analysis, nil
+	}
+
+	for batchStart := 0; batchStart < len(sentences); batchStart += maxBatchSize {
+		batchEnd := batchStart + maxBatchSize
+		if batchEnd > len(sentences) {
+			batchEnd = len(sentences)
+		}
+		batch := sentences[batchStart:batchEnd]
+
+		textList := []string{}
+		for _, sentence := range batch {
+			textList = append(textList, truncate(sentence, maxTextBytes))
+		}
+		batchResponse := batchDetectSentimentResponse{}
+		err := s.call(ctx, "BatchDetectSentiment", batchDetectSentimentRequest{
+			TextList:     textList,
+			LanguageCode: s.languageCode,
+		}, &batchResponse)
+		if err != nil {
+			return nil, err
+		}
+		if len(batchResponse.ErrorList) > 0 {
+			batchErr := batchResponse.ErrorList[0]
+			return nil, fmt.Errorf(
+				"error analyzing sentence %d: %s: %s",
+				batchStart+batchErr.Index,
+				batchErr.ErrorCode,
+				batchErr.ErrorMessage,
+			)
+		}
+
+		sentenceResults := make([]*batchResult, len(batch))
+		for i := range batchResponse.ResultList {
+			result := &batchResponse.ResultList[i]
+			if result.Index >= 0 && result.Index < len(batch) {
+				sentenceResults[result.Index] = result
+			}
+		}
+		for i, result := range sentenceResults {
+			if result == nil {
+				return nil, fmt.Errorf("unexpectedly no analysis returned for sentence %d", batchStart+i)
+			}
+			analysis.SentenceAnalyses = append(analysis.SentenceAnalyses, sa.SentenceAnalysis{
+				Text:       batch[i],
+				Sentiment:  sentimentFromString(result.Sentiment),
+				Confidence: result.SentimentScore.confidence(result.Sentiment),
+			})
+		}
+	}
+
+	return analysis, nil
+}
+
+// call sends a signed JSON RPC request for the Comprehend operation.
+func (s SentimentService) call(ctx context.Context, operation string, input, output interface{}) error {
+	payload, err := json.Marshal(input)
+	if err != nil {
+		return fmt.Errorf("error marshalling %s request: %w", operation, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint+"/", bytes.NewBuffer(payload))
+	if err != nil {
+		return fmt.Errorf("error creating new request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", fmt.Sprintf("%s.%s", targetPrefix, operation))
+	if err := signRequest(req, s.credentials, s.region, serviceName, time.Now()); err != nil {
+		return err
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error calling Comprehend: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading Comprehend response: %w", err)
+	}
+	if resp.StatusCode >= 400 {
+		errResp := errorResponse{}
+		if err := json.Unmarshal(body, &errResp); err == nil && errResp.Type != "" {
+			message := errResp.Message
+			if message == "" {
+				message = errResp.MessageUpper
+			}
+			errType := errResp.Type
+			if index := strings.LastIndex(errType, "#"); index >= 0 {
+				errType = errType[index+1:]
+			}
+			return fmt.Errorf(
+				"unexpected status from Comprehend %s: HTTP %d: %s: %s",
+				operation,
+				resp.StatusCode,
+				errType,
+				message,
+			)
+		}
+		return fmt.Errorf("unexpected status from Comprehend %s: HTTP %d", operation, resp.StatusCode)
+	}
+
+	if err := json.Unmarshal(body, output); err != nil {
+		return fmt.Errorf("error unmarshalling %s response: %w", operation, err)
+	}
+	return nil
+}
+
+// sentimentFromString maps the Comprehend sentiment. Mixed has no equivalent
+// so it is treated as neutral.
+func sentimentFromString(rawSentiment string) sa.Sentiment {
+	switch rawSentiment {
+	case "POSITIVE":
+		return sa.Positive
+	case "NEGATIVE":
+		return sa.Negative
+	default:
+		return sa.Neutral
+	}
+}
+
+func (s sentimentScore) confidence(rawSentiment string) float32 {
+	switch rawSentiment {
+	case "POSITIVE":
+		return s.Positive
+	case "NEGATIVE":
+		return s.Negative
+	case "MIXED":
+		return s.Mixed
+	default:
+		return s.Neutral
+	}
+}
+
+// truncate shortens text to at most maxBytes without splitting a character.
+func truncate(text string, maxBytes int) string {
+	if len(text) <= maxBytes {
+		return text
+	}
+	text = text[:maxBytes]
+	for !utf8.ValidString(text) {
+		text = text[:len(text)-1]
+	}
+	return text
+}
@@ -0,0 +1,126 @@
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	sa "github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer"
+)
+
+// newRecordedServer serves the recorded response for each Comprehend
+// operation, keyed by the X-Amz-Target header.
+func newRecordedServer(t *testing.T, status int, responses map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), signingAlgorithm+" Credential=AKID/") {
+			t.Errorf("Request is not signed: '%s'", r.Header.Get("Authorization"))
+		}
+		if r.Header.Get("Content-Type") != "application/x-amz-json-1.1" {
+			t.Errorf("Unexpected content type '%s'", r.Header.Get("Content-Type"))
+		}
+
+		target := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), targetPrefix+".")
+		responseFile, ok := responses[target]
+		if !ok {
+			t.Errorf("Unexpected operation %s", target)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if target == "BatchDetectSentiment" {
+			batchReq := batchDetectSentimentRequest{}
+			if err := json.NewDecoder(r.Body).Decode(&batchReq); err != nil || len(batchReq.TextList) != 2 {
+				t.Errorf("Unexpected batch request: %+v (%v)", batchReq, err)
+			}
+		}
+
+		response, err := ioutil.ReadFile(filepath.Join("testdata", responseFile))
+		if err != nil {
+			t.Fatalf("Unexpected error reading recorded response: %v", err)
+		}
+		w.WriteHeader(status)
+		// nolint: errcheck
+		w.Write(response)
+	}))
+}
+
+func newTestService(url string) *SentimentService {
+	return NewSentimentService(
+		"us-east-1",
+		Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"},
+		WithEndpoint(url),
+	)
+}
+
+func TestAnalyzeSentiment(t *testing.T) {
+	server := newRecordedServer(t, http.StatusOK, map[string]string{
+		"DetectSentiment":      "detect_sentiment.json",
+		"BatchDetectSentiment": "batch_detect_sentiment.json",
+	})
+	defer server.Close()
+
+	analysis, err := newTestService(server.URL).AnalyzeSentiment(
+		context.Background(),
+		"Thanks for the quick fix! The docs are still useless.",
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if analysis.Sentiment != sa.Neutral {
+		t.Fatalf("Expected mixed to map to Neutral, got %s", analysis.Sentiment)
+	}
+	if analysis.Confidence < 0.41 || analysis.Confidence > 0.42 {
+		t.Fatalf("Expected mixed confidence, got %f", analysis.Confidence)
+	}
+	expectedSentences := []sa.Sentiment{sa.Positive, sa.Negative}
+	if len(analysis.SentenceAnalyses) != len(expectedSentences) {
+		t.Fatalf("Expected %d sentences, got %d", len(expectedSentences), len(analysis.SentenceAnalyses))
+	}
+	for i, sentence := range analysis.SentenceAnalyses {
+		if sentence.Sentiment != expectedSentences[i] {
+			t.Fatalf("Expected sentence %d to be %s, got %s", i, expectedSentences[i], sentence.Sentiment)
+		}
+	}
+	if analysis.SentenceAnalyses[1].Text != "The docs are still useless." {
+		t.Fatalf("Unexpected sentence text '%s'", analysis.SentenceAnalyses[1].Text)
+	}
+}
+
+func TestAnalyzeSentimentSingleSentence(t *testing.T) {
+	server := newRecordedServer(t, http.StatusOK, map[string]string{
+		"DetectSentiment": "detect_sentiment.json",
+	})
+	defer server.Close()
+
+	analysis, err := newTestService(server.URL).AnalyzeSentiment(context.Background(), "Not sure about this.")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(analysis.SentenceAnalyses) != 1 || analysis.SentenceAnalyses[0].Sentiment != analysis.Sentiment {
+		t.Fatalf("Unexpected sentence analyses: %+v", analysis.SentenceAnalyses)
+	}
+}
+
+func TestAnalyzeSentimentError(t *testing.T) {
+	server := newRecordedServer(t, http.StatusBadRequest, map[string]string{
+		"DetectSentiment": "text_size_limit_exceeded.json",
+	})
+	defer server.Close()
+
+	_, err := newTestService(server.URL).AnalyzeSentiment(context.Background(), "text")
+	if err == nil || !strings.Contains(err.Error(), "TextSizeLimitExceededException") {
+		t.Fatalf("Expected error with exception type, got %v", err)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	actual := truncate("héllo", 2)
+	if actual != "h" {
+		t.Fatalf("Expected truncation at character boundary, got '%s'", actual)
+	}
+}
@@ -0,0 +1,157 @@
+package aws
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	signingAlgorithm string = "AWS4-HMAC-SHA256"
+	amzDateFormat    string = "20060102T150405Z"
+	scopeDateFormat  string = "20060102"
+)
+
+// Credentials are the AWS access keys used to sign requests.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// signRequest signs the request in place with AWS Signature Version 4.
+func signRequest(req *http.Request, credentials Credentials, region, service string, signingTime time.Time) error {
+	payload := []byte{}
+	if req.Body != nil {
+		var err error
+		payload, err = ioutil.ReadAll(req.Body)
+		if err != nil {
+			return fmt.Errorf("error reading request body for signing: %w", err)
+		}
+		req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(payload))
+	}
+
+	signingTime = signingTime.UTC()
+	amzDate := signingTime.Format(amzDateFormat)
+	req.Header.Set("X-Amz-Date", amzDate)
+	if credentials.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", credentials.SessionToken)
+	}
+	if req.Host == "" {
+		req.Host = req.URL.Host
+	}
+
+	canonicalHeaders, signedHeaders := canonicalizeHeaders(req)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI(req.URL),
+		canonicalQuery(req.URL),
+		canonicalHeaders,
+		signedHeaders,
+		hashHex(payload),
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", signingTime.Format(scopeDateFormat), region, service)
+	stringToSign := strings.Join([]string{
+		signingAlgorithm,
+		amzDate,
+		scope,
+		hashHex([]byte(canonicalRequest)),
+	}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+credentials.SecretAccessKey), signingTime.Format(scopeDateFormat))
+	signingKey = hmacSHA256(signingKey, region)
+	signingKey = hmacSHA256(signingKey, service)
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		signingAlgorithm,
+		credentials.AccessKeyID,
+		scope,
+		signedHeaders,
+		signature,
+	))
+	return nil
+}
+
+func canonicalizeHeaders(req *http.Request) (string, string) {
+	headers := map[string]string{"host": req.Host}
+	for name, values := range req.Header {
+		lowerName := strings.ToLower(name)
+		if lowerName == "authorization" || lowerName == "user-agent" {
+			continue
+		}
+		trimmedValues := []string{}
+		for _, value := range values {
+			trimmedValues = append(trimmedValues, strings.Join(strings.Fields(value), " "))
+		}
+		headers[lowerName] = strings.Join(trimmedValues, ",")
+	}
+
+	names := []string{}
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	canonical := ""
+	for _, name := range names {
+		canonical += fmt.Sprintf("%s:%s\n", name, headers[name])
+	}
+	return canonical, strings.Join(names, ";")
+}
+
+func canonicalURI(u *url.URL) string {
+	path := u.EscapedPath()
+	if path == "" {
+		return "/"
+	}
+	return path
+}
+
+func canonicalQuery(u *url.URL) string {
+	query := u.Query()
+	keys := []string{}
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := []string{}
+	for _, key := range keys {
+		values := query[key]
+		sort.Strings(values)
+		for _, value := range values {
+			pairs = append(pairs, fmt.Sprintf("%s=%s", awsEscape(key), awsEscape(value)))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// awsEscape percent-encodes everything except the unreserved characters, as
+// required by SigV4.
+func awsEscape(value string) string {
+	return strings.ReplaceAll(url.QueryEscape(value), "+", "%20")
+}
+
+func hashHex(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	hash := hmac.New(sha256.New, key)
+	hash.Write([]byte(data))
+	return hash.Sum(nil)
+}
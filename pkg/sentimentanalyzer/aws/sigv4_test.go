@@ -0,0 +1,56 @@
+package aws
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSignRequest uses the example request from the AWS Signature Version 4
+// documentation.
+func TestSignRequest(t *testing.T) {
+	req, err := http.NewRequest(
+		http.MethodGet,
+		"https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08",
+		nil,
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+
+	credentials := Credentials{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}
+	signingTime := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	if err := signRequest(req, credentials, "us-east-1", "iam", signingTime); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, " +
+		"SignedHeaders=content-type;host;x-amz-date, " +
+		"Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7"
+	if actual := req.Header.Get("Authorization"); actual != expected {
+		t.Fatalf("Expected '%s', got '%s'", expected, actual)
+	}
+}
+
+func TestSignRequestSessionToken(t *testing.T) {
+	req, err := http.NewRequest(http.MethodPost, "https://comprehend.us-east-1.amazonaws.com/", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	credentials := Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret", SessionToken: "session"}
+	if err := signRequest(req, credentials, "us-east-1", "comprehend", time.Now()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if req.Header.Get("X-Amz-Security-Token") != "session" {
+		t.Fatalf("Missing security token header")
+	}
+	if !strings.Contains(req.Header.Get("Authorization"), "x-amz-security-token") {
+		t.Fatalf("Security token is not signed: %s", req.Header.Get("Authorization"))
+	}
+}
@@ -0,0 +1,322 @@
+package azure
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1" // nolint: gosec
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// DefaultAuthorityHost is the Azure Active Directory authority for the
+	// public cloud.
+	DefaultAuthorityHost string = "https://login.microsoftonline.com/"
+	// DefaultScope is the token scope for Cognitive Services resources.
+	DefaultScope string = "https://cognitiveservices.azure.com/.default"
+
+	clientAssertionType string        = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+	tokenRefreshMargin  time.Duration = 5 * time.Minute
+	assertionLifetime   time.Duration = 10 * time.Minute
+)
+
+// Authorizer adds credentials to requests sent to the language service.
+type Authorizer interface {
+	Authorize(req *http.Request) error
+}
+
+// KeyAuthorizer authenticates with a static Ocp-Apim-Subscription-Key.
+type KeyAuthorizer string
+
+// Authorize sets the subscription key header.
+func (k KeyAuthorizer) Authorize(req *http.Request) error {
+	req.Header.Set("Ocp-Apim-Subscription-Key", string(k))
+	return nil
+}
+
+// TokenAuthorizer authenticates with Azure Active Directory bearer tokens.
+// Tokens are cached and only refreshed shortly before they expire.
+type TokenAuthorizer struct {
+	source oauth2.TokenSource
+}
+
+// Authorize sets a bearer token, requesting a new one if needed.
+func (t TokenAuthorizer) Authorize(req *http.Request) error {
+	token, err := t.source.Token()
+	if err != nil {
+		return fmt.Errorf("error getting access token: %w", err)
+	}
+	token.SetAuthHeader(req)
+	return nil
+}
+
+// AADConfig is the application identity used to request tokens from Azure
+// Active Directory.
+type AADConfig struct {
+	// AuthorityHost defaults to DefaultAuthorityHost. Point it at a local
+	// token endpoint to test without Azure.
+	AuthorityHost string
+	TenantID      string
+	ClientID      string
+	// Scope defaults to DefaultScope.
+	Scope      string
+	HTTPClient *http.Client
+}
+
+// NewClientSecretAuthorizer authenticates through the OAuth2 client
+// credentials flow with a client secret.
+func NewClientSecretAuthorizer(config AADConfig, secret string) *TokenAuthorizer {
+	return newTokenAuthorizer(config, func(tokenURL string) (url.Values, error) {
+		return url.Values{"client_secret": {secret}}, nil
+	})
+}
+
+// NewClientCertificateAuthorizer authenticates through the OAuth2 client
+// credentials flow with a signed assertion. certPEM must hold the certificate
+// and its RSA private key.
+func NewClientCertificateAuthorizer(config AADConfig, certPEM []byte) (*TokenAuthorizer, error) {
+	cert, key, err := parseCertificate(certPEM)
+	if err != nil {
+		return nil, err
+	}
+	thumbprint := sha1.Sum(cert.Raw) // nolint: gosec
+
+	return newTokenAuthorizer(config, func(tokenURL string) (url.Values, error) {
+		assertion, err := clientAssertion(config.ClientID, tokenURL, thumbprint[:], key)
+		if err != nil {
+			return nil, err
+		}
+		return url.Values{
+			"client_assertion_type": {clientAssertionType},
+			"client_assertion":      {assertion},
+		}, nil
+	}), nil
+}
+
+// NewWorkloadIdentityAuthorizer authenticates with a federated token file,
+// as projected into the pod by Azure workload identity. The file is read on
+// every token request because the kubelet rotates it.
+func NewWorkloadIdentityAuthorizer(config AADConfig, tokenFile string) *TokenAuthorizer {
+	return newTokenAuthorizer(config, func(tokenURL string) (url.Values, error) {
+		assertion, err := ioutil.ReadFile(tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading federated token file: %w", err)
+		}
+		return url.Values{
+			"client_assertion_type": {clientAssertionType},
+			"client_assertion":      {strings.TrimSpace(string(assertion))},
+		}, nil
+	})
+}
+
+func newTokenAuthorizer(config AADConfig, credential func(tokenURL string) (url.Values, error)) *TokenAuthorizer {
+	authorityHost := config.AuthorityHost
+	if authorityHost == "" {
+		authorityHost = DefaultAuthorityHost
+	}
+	scope := config.Scope
+	if scope == "" {
+		scope = DefaultScope
+	}
+	httpClient := config.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: defaultTimeout}
+	}
+
+	source := &aadTokenSource{
+		tokenURL: fmt.Sprintf(
+			"%s/%s/oauth2/v2.0/token",
+			strings.TrimRight(authorityHost, "/"),
+			config.TenantID,
+		),
+		clientID:   config.ClientID,
+		scope:      scope,
+		httpClient: httpClient,
+		credential: credential,
+	}
+	return &TokenAuthorizer{source: oauth2.ReuseTokenSource(nil, source)}
+}
+
+type aadTokenSource struct {
+	tokenURL   string
+	clientID   string
+	scope      string
+	httpClient *http.Client
+	credential func(tokenURL string) (url.Values, error)
+}
+
+type tokenResponse struct {
+	AccessToken      string      `json:"access_token"`
+	TokenType        string      `json:"token_type"`
+	ExpiresIn        interface{} `json:"expires_in"`
+	Error            string      `json:"error"`
+	ErrorDescription string      `json:"error_description"`
+}
+
+// Token requests a new access token. Expiry is moved forward by a margin so
+// that the cached token is refreshed before Azure starts rejecting it.
+func (s *aadTokenSource) Token() (*oauth2.Token, error) {
+	form, err := s.credential(s.tokenURL)
+	if err != nil {
+		return nil, err
+	}
+	form.Set("grant_type", "client_credentials")
+	form.Set("client_id", s.clientID)
+	form.Set("scope", s.scope)
+
+	req, err := http.NewRequestWithContext(
+		context.Background(),
+		http.MethodPost,
+		s.tokenURL,
+		strings.NewReader(form.Encode()),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error creating token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error calling token endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading token response: %w", err)
+	}
+	tokenResp := tokenResponse{}
+	if err := json.Unmarshal(body, &tokenResp); err != nil {
+		return nil, fmt.Errorf("error unmarshalling token response (HTTP %d): %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode >= 400 || tokenResp.Error != "" {
+		return nil, fmt.Errorf(
+			"unexpected status from token endpoint: HTTP %d: %s: %s",
+			resp.StatusCode,
+			tokenResp.Error,
+			tokenResp.ErrorDescription,
+		)
+	}
+	if tokenResp.AccessToken == "" {
+		return nil, fmt.Errorf("token endpoint returned no access token")
+	}
+
+	lifetime := expiresIn(tokenResp.ExpiresIn)
+	if lifetime > 2*tokenRefreshMargin {
+		lifetime -= tokenRefreshMargin
+	} else {
+		lifetime /= 2
+	}
+
+	return &oauth2.Token{
+		AccessToken: tokenResp.AccessToken,
+		TokenType:   "Bearer",
+		Expiry:      time.Now().Add(lifetime),
+	}, nil
+}
+
+// expiresIn handles expires_in as either a JSON number or a string, as the
+// different Azure token endpoints do not agree.
+func expiresIn(raw interface{}) time.Duration {
+	switch value := raw.(type) {
+	case float64:
+		return time.Duration(value) * time.Second
+	case string:
+		seconds, err := strconv.Atoi(value)
+		if err == nil {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+	return 0
+}
+
+func clientAssertion(clientID, audience string, thumbprint []byte, key *rsa.PrivateKey) (string, error) {
+	now := time.Now()
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", fmt.Errorf("error generating assertion ID: %w", err)
+	}
+
+	token := jwt.NewWithClaims(
+		jwt.SigningMethodRS256,
+		jwt.StandardClaims{
+			Audience:  audience,
+			Issuer:    clientID,
+			Subject:   clientID,
+			Id:        hex.EncodeToString(jti),
+			IssuedAt:  now.Unix(),
+			NotBefore: now.Unix(),
+			ExpiresAt: now.Add(assertionLifetime).Unix(),
+		},
+	)
+	token.Header["x5t"] = base64.RawURLEncoding.EncodeToString(thumbprint)
+
+	signed, err := token.SignedString(key)
+	if err != nil {
+		return "", fmt.Errorf("error signing client assertion: %w", err)
+	}
+	return signed, nil
+}
+
+func parseCertificate(certPEM []byte) (*x509.Certificate, *rsa.PrivateKey, error) {
+	var cert *x509.Certificate
+	var key *rsa.PrivateKey
+
+	for {
+		var block *pem.Block
+		block, certPEM = pem.Decode(certPEM)
+		if block == nil {
+			break
+		}
+
+		switch block.Type {
+		case "CERTIFICATE":
+			if cert != nil {
+				continue
+			}
+			parsed, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, nil, fmt.Errorf("error parsing certificate: %w", err)
+			}
+			cert = parsed
+		case "RSA PRIVATE KEY":
+			parsed, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, nil, fmt.Errorf("error parsing private key: %w", err)
+			}
+			key = parsed
+		case "PRIVATE KEY":
+			parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, nil, fmt.Errorf("error parsing private key: %w", err)
+			}
+			rsaKey, ok := parsed.(*rsa.PrivateKey)
+			if !ok {
+				return nil, nil, fmt.Errorf("unsupported private key type %T", parsed)
+			}
+			key = rsaKey
+		}
+	}
+
+	if cert == nil {
+		return nil, nil, fmt.Errorf("no certificate found in PEM")
+	}
+	if key == nil {
+		return nil, nil, fmt.Errorf("no private key found in PEM")
+	}
+	return cert, key, nil
+}
@@ -0,0 +1,160 @@
+package azure
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+
+	"github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer/azure/azuretest"
+)
+
+func testAADConfig(tokenServer *azuretest.TokenServer) AADConfig {
+	return AADConfig{
+		AuthorityHost: tokenServer.URL,
+		TenantID:      "tenant",
+		ClientID:      "client",
+	}
+}
+
+func TestClientSecretAuthorizerCachesToken(t *testing.T) {
+	tokenServer := azuretest.NewTokenServer()
+	defer tokenServer.Close()
+
+	authorizedHeaders := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorizedHeaders = append(authorizedHeaders, r.Header.Get("Authorization"))
+		if r.Header.Get("Ocp-Apim-Subscription-Key") != "" {
+			t.Errorf("Unexpected subscription key header with token auth")
+		}
+		// nolint: errcheck
+		w.Write([]byte(successResponse))
+	}))
+	defer server.Close()
+
+	svc := NewSentimentService(
+		server.URL,
+		"",
+		WithAuthorizer(NewClientSecretAuthorizer(testAADConfig(tokenServer), "secret")),
+	)
+	for i := 0; i < 2; i++ {
+		if _, err := svc.AnalyzeSentiment(context.Background(), "text"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	requests := tokenServer.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("Expected 1 token request, got %d", len(requests))
+	}
+	if requests[0].Get("client_secret") != "secret" || requests[0].Get("scope") != DefaultScope {
+		t.Fatalf("Unexpected token request: %v", requests[0])
+	}
+	for _, header := range authorizedHeaders {
+		if header != "Bearer "+azuretest.AccessToken(1) {
+			t.Fatalf("Unexpected authorization header '%s'", header)
+		}
+	}
+}
+
+func TestTokenAuthorizerRefreshesExpiredToken(t *testing.T) {
+	tokenServer := azuretest.NewTokenServer()
+	tokenServer.ExpiresIn = 0
+	defer tokenServer.Close()
+
+	authorizer := NewClientSecretAuthorizer(testAADConfig(tokenServer), "secret")
+	for i := 1; i <= 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		if err := authorizer.Authorize(req); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if req.Header.Get("Authorization") != "Bearer "+azuretest.AccessToken(i) {
+			t.Fatalf("Expected token %d, got '%s'", i, req.Header.Get("Authorization"))
+		}
+	}
+}
+
+func TestWorkloadIdentityAuthorizer(t *testing.T) {
+	tokenServer := azuretest.NewTokenServer()
+	defer tokenServer.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "azure-identity-token")
+	if err := ioutil.WriteFile(tokenFile, []byte("federated-token\n"), 0600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	authorizer := NewWorkloadIdentityAuthorizer(testAADConfig(tokenServer), tokenFile)
+	if err := authorizer.Authorize(httptest.NewRequest(http.MethodPost, "/", nil)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	request := tokenServer.Requests()[0]
+	if request.Get("client_assertion") != "federated-token" {
+		t.Fatalf("Expected federated token assertion, got '%s'", request.Get("client_assertion"))
+	}
+	if request.Get("client_assertion_type") != clientAssertionType {
+		t.Fatalf("Unexpected assertion type '%s'", request.Get("client_assertion_type"))
+	}
+}
+
+func TestClientCertificateAuthorizer(t *testing.T) {
+	tokenServer := azuretest.NewTokenServer()
+	defer tokenServer.Close()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "comment-sentiment"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
+	certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	})...)
+
+	authorizer, err := NewClientCertificateAuthorizer(testAADConfig(tokenServer), certPEM)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := authorizer.Authorize(httptest.NewRequest(http.MethodPost, "/", nil)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertion := tokenServer.Requests()[0].Get("client_assertion")
+	claims := &jwt.StandardClaims{}
+	token, err := jwt.ParseWithClaims(assertion, claims, func(token *jwt.Token) (interface{}, error) {
+		return &key.PublicKey, nil
+	})
+	if err != nil || !token.Valid {
+		t.Fatalf("Invalid client assertion: %v", err)
+	}
+	if claims.Issuer != "client" || claims.Subject != "client" {
+		t.Fatalf("Unexpected assertion claims: %+v", claims)
+	}
+	if claims.Audience != tokenServer.URL+"/tenant/oauth2/v2.0/token" {
+		t.Fatalf("Unexpected assertion audience '%s'", claims.Audience)
+	}
+	if token.Header["x5t"] == nil {
+		t.Fatalf("Missing x5t header in client assertion")
+	}
+}
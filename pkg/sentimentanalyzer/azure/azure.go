@@ -2,18 +2,74 @@ package azure
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"math/rand"
 	"net/http"
+	"time"
 
 	sa "github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer"
 )
 
+const (
+	defaultTimeout    time.Duration = 30 * time.Second
+	defaultMaxRetries int           = 3
+	defaultBaseDelay  time.Duration = 500 * time.Millisecond
+	defaultMaxDelay   time.Duration = 10 * time.Second
+)
+
 // SentimentService represents the cognitive services language resource.
 type SentimentService struct {
-	endpoint string
-	key      string
+	endpoint   string
+	authorizer Authorizer
+	httpClient *http.Client
+	maxRetries int
+	baseDelay  time.Duration
+	maxDelay   time.Duration
+}
+
+// Option configures optional settings of the SentimentService.
+type Option func(*SentimentService)
+
+// WithHTTPClient sets the HTTP client used for all calls to the language
+// service. The client is shared across calls so that connections are reused.
+func WithHTTPClient(client *http.Client) Option {
+	return func(s *SentimentService) {
+		s.httpClient = client
+	}
+}
+
+// WithAuthorizer replaces subscription key authentication, such as with
+// Azure Active Directory tokens.
+func WithAuthorizer(authorizer Authorizer) Option {
+	return func(s *SentimentService) {
+		s.authorizer = authorizer
+	}
+}
+
+// WithTimeout sets the timeout of the default HTTP client.
+func WithTimeout(timeout time.Duration) Option {
+	return func(s *SentimentService) {
+		s.httpClient = &http.Client{Timeout: timeout}
+	}
+}
+
+// WithMaxRetries sets how many times a throttled or failed call is retried.
+func WithMaxRetries(maxRetries int) Option {
+	return func(s *SentimentService) {
+		s.maxRetries = maxRetries
+	}
+}
+
+// WithBackoff sets the initial and maximum delay between retries.
+func WithBackoff(baseDelay, maxDelay time.Duration) Option {
+	return func(s *SentimentService) {
+		s.baseDelay = baseDelay
+		s.maxDelay = maxDelay
+	}
 }
 
 type confidenceScores struct {
@@ -35,59 +91,80 @@ type sentence struct {
 	Text             string           `json:"text"`
 }
 
+type documentError struct {
+	ID    string       `json:"id"`
+	Error errorDetails `json:"error"`
+}
+
 type textAnalyticsResponse struct {
 	Documents []textAnalyticsResponseDocument `json:"documents"`
+	Errors    []documentError                 `json:"errors"`
 }
 
-// NewSentimentService generates a new Azure sentiment service.
-func NewSentimentService(endpoint, key string) *SentimentService {
-	return &SentimentService{
-		endpoint: endpoint,
-		key:      key,
+// NewSentimentService generates a new Azure sentiment service. The key is
+// used as the subscription key unless WithAuthorizer is passed.
+func NewSentimentService(endpoint, key string, opts ...Option) *SentimentService {
+	svc := &SentimentService{
+		endpoint:   endpoint,
+		authorizer: KeyAuthorizer(key),
+		httpClient: &http.Client{Timeout: defaultTimeout},
+		maxRetries: defaultMaxRetries,
+		baseDelay:  defaultBaseDelay,
+		maxDelay:   defaultMaxDelay,
+	}
+	for _, opt := range opts {
+		opt(svc)
 	}
+	return svc
 }
 
 // AnalyzeSentiment makes a call to cognitive services to analyze the
-// sentiment.
-func (a SentimentService) AnalyzeSentiment(text string) (*sa.Analysis, error) {
+// sentiment. Throttled (HTTP 429) and server error responses, and calls that
+// did not get a response, are retried with exponential backoff, honoring any
+// Retry-After header from the service up to the maximum delay.
+func (a SentimentService) AnalyzeSentiment(ctx context.Context, text string) (*sa.Analysis, error) {
 	textMarshalled, err := formatDocument(text)
 	if err != nil {
 		return nil, fmt.Errorf("error creating format document: %w", err)
 	}
 
-	textAnalyticsURL := fmt.Sprintf("%s/text/analytics/v3.2-preview.1/sentiment", a.endpoint)
+	var body []byte
+	for attempt := 0; ; attempt++ {
+		body, err = a.post(ctx, textMarshalled)
+		if err == nil {
+			break
+		}
 
-	req, err := http.NewRequest(
-		http.MethodPost,
-		textAnalyticsURL,
-		bytes.NewBuffer(textMarshalled),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("error creating new request: %w", err)
-	}
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Ocp-Apim-Subscription-Key", a.key)
+		retryAfter, retryable := retryableError(ctx, err)
+		if !retryable || attempt >= a.maxRetries {
+			return nil, err
+		}
+		delay, ok := a.retryDelay(attempt, retryAfter)
+		if !ok {
+			return nil, err
+		}
 
-	client := http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("unexpected status from language service: HTTP %d", resp.StatusCode)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
 	}
 
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
 	sentimentAnalysis := &textAnalyticsResponse{}
 	if err := json.Unmarshal(body, sentimentAnalysis); err != nil {
-		return nil, fmt.Errorf("error unmarshalling text analysis")
+		return nil, fmt.Errorf("error unmarshalling text analysis: %w", err)
 	}
 
 	if len(sentimentAnalysis.Documents) == 0 {
+		if len(sentimentAnalysis.Errors) > 0 {
+			docErr := sentimentAnalysis.Errors[0].Error
+			return nil, &APIError{
+				StatusCode: http.StatusOK,
+				Code:       docErr.code(),
+				Message:    docErr.message(),
+			}
+		}
 		return nil, fmt.Errorf("unexpectedly no analysis returned")
 	}
 	resultSentiment := sentimentFromString(sentimentAnalysis.Documents[0].Sentiment)
@@ -114,6 +191,78 @@ func (a SentimentService) AnalyzeSentiment(text string) (*sa.Analysis, error) {
 	return &resultAnalysis, nil
 }
 
+// post sends a single request to the language service and returns the raw
+// response body. Error statuses are returned as an *APIError.
+func (a SentimentService) post(ctx context.Context, payload []byte) ([]byte, error) {
+	textAnalyticsURL := fmt.Sprintf("%s/text/analytics/v3.2-preview.1/sentiment", a.endpoint)
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		textAnalyticsURL,
+		bytes.NewBuffer(payload),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error creating new request: %w", err)
+	}
+	req.Header.Add("Content-Type", "application/json")
+	if err := a.authorizer.Authorize(req); err != nil {
+		return nil, err
+	}
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return nil, &transportError{fmt.Errorf("error calling language service: %w", err)}
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &transportError{fmt.Errorf("error reading language service response: %w", err)}
+	}
+
+	if resp.StatusCode >= 400 {
+		return nil, newAPIError(resp, body)
+	}
+
+	return body, nil
+}
+
+// retryableError returns the delay requested by the service and if the call
+// that failed with err could succeed if it was tried again.
+func retryableError(ctx context.Context, err error) (time.Duration, bool) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.RetryAfter, apiErr.Retryable()
+	}
+	var transportErr *transportError
+	return 0, errors.As(err, &transportErr) && ctx.Err() == nil
+}
+
+// retryDelay calculates how long to wait before the next attempt. The delay
+// grows exponentially from the base delay with some jitter, but the service's
+// requested delay wins when it is longer. It indicates false when the service
+// requested a delay longer than the maximum delay, so that the call fails
+// rather than wait that long.
+func (a SentimentService) retryDelay(attempt int, retryAfter time.Duration) (time.Duration, bool) {
+	if retryAfter > a.maxDelay {
+		return 0, false
+	}
+	delay := a.baseDelay << uint(attempt)
+	if delay <= 0 || delay > a.maxDelay {
+		delay = a.maxDelay
+	}
+	if delay > 1 {
+		// nolint: gosec
+		delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+	}
+
+	if retryAfter > delay {
+		return retryAfter, true
+	}
+	return delay, true
+}
+
 func formatDocument(text string) ([]byte, error) {
 	documentStructure := map[string][]map[string]string{
 		"documents": {
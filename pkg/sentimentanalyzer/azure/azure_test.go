@@ -0,0 +1,312 @@
+package azure
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	sa "github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer"
+)
+
+const successResponse string = `{
+  "documents": [
+    {
+      "id": "1",
+      "sentiment": "negative",
+      "confidenceScores": {"positive": 0.01, "neutral": 0.09, "negative": 0.9},
+      "sentences": [
+        {
+          "sentiment": "negative",
+          "confidenceScores": {"positive": 0.01, "neutral": 0.09, "negative": 0.9},
+          "text": "This is terrible."
+        }
+      ]
+    }
+  ],
+  "errors": []
+}`
+
+func newTestService(url string) *SentimentService {
+	return NewSentimentService(
+		url,
+		"testkey",
+		WithBackoff(time.Millisecond, 5*time.Millisecond),
+	)
+}
+
+func TestAnalyzeSentiment(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Ocp-Apim-Subscription-Key") != "testkey" {
+			t.Errorf("Expected subscription key header, got '%s'", r.Header.Get("Ocp-Apim-Subscription-Key"))
+		}
+		if r.URL.Path != "/text/analytics/v3.2-preview.1/sentiment" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		// nolint: errcheck
+		w.Write([]byte(successResponse))
+	}))
+	defer server.Close()
+
+	analysis, err := newTestService(server.URL).AnalyzeSentiment(context.Background(), "This is terrible.")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if analysis.Sentiment != sa.Negative {
+		t.Fatalf("Expected Negative sentiment, got %s", analysis.Sentiment)
+	}
+	if analysis.Confidence != 0.9 {
+		t.Fatalf("Expected confidence 0.9, got %f", analysis.Confidence)
+	}
+	if len(analysis.SentenceAnalyses) != 1 || analysis.SentenceAnalyses[0].Text != "This is terrible." {
+		t.Fatalf("Unexpected sentence analyses: %+v", analysis.SentenceAnalyses)
+	}
+}
+
+func TestAnalyzeSentimentRetries(t *testing.T) {
+	testCases := []struct {
+		name           string
+		failures       int
+		failureStatus  int
+		retryAfter     string
+		expectedCalls  int32
+		expectedStatus int
+	}{
+		{
+			name:          "throttled_then_success",
+			failures:      2,
+			failureStatus: http.StatusTooManyRequests,
+			expectedCalls: 3,
+		},
+		{
+			name:          "server_error_then_success",
+			failures:      1,
+			failureStatus: http.StatusServiceUnavailable,
+			expectedCalls: 2,
+		},
+		{
+			name:           "throttled_retries_exhausted",
+			failures:       10,
+			failureStatus:  http.StatusTooManyRequests,
+			expectedCalls:  4,
+			expectedStatus: http.StatusTooManyRequests,
+		},
+		{
+			name:           "retry_after_over_max_delay_not_retried",
+			failures:       10,
+			failureStatus:  http.StatusTooManyRequests,
+			retryAfter:     "30",
+			expectedCalls:  1,
+			expectedStatus: http.StatusTooManyRequests,
+		},
+		{
+			name:           "bad_request_not_retried",
+			failures:       10,
+			failureStatus:  http.StatusBadRequest,
+			expectedCalls:  1,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			var calls int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				call := atomic.AddInt32(&calls, 1)
+				if int(call) <= testCase.failures {
+					retryAfter := testCase.retryAfter
+					if retryAfter == "" {
+						retryAfter = "0"
+					}
+					w.Header().Set("Retry-After", retryAfter)
+					w.WriteHeader(testCase.failureStatus)
+					// nolint: errcheck
+					w.Write([]byte(`{"error": {"code": "TooManyRequests", "message": "slow down"}}`))
+					return
+				}
+				// nolint: errcheck
+				w.Write([]byte(successResponse))
+			}))
+			defer server.Close()
+
+			_, err := newTestService(server.URL).AnalyzeSentiment(context.Background(), "text")
+			if actualCalls := atomic.LoadInt32(&calls); actualCalls != testCase.expectedCalls {
+				t.Fatalf("Expected %d calls, got %d", testCase.expectedCalls, actualCalls)
+			}
+
+			if testCase.expectedStatus == 0 {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				return
+			}
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("Expected APIError, got %v", err)
+			}
+			if apiErr.StatusCode != testCase.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", testCase.expectedStatus, apiErr.StatusCode)
+			}
+		})
+	}
+}
+
+func TestAnalyzeSentimentTransportRetries(t *testing.T) {
+	testCases := []struct {
+		name          string
+		failures      int
+		expectedCalls int32
+		expectErr     bool
+	}{
+		{
+			name:          "connection_reset_then_success",
+			failures:      2,
+			expectedCalls: 3,
+		},
+		{
+			name:          "retries_exhausted",
+			failures:      10,
+			expectedCalls: 4,
+			expectErr:     true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			var calls int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				call := atomic.AddInt32(&calls, 1)
+				if int(call) <= testCase.failures {
+					// Close the connection without a response.
+					conn, _, err := w.(http.Hijacker).Hijack()
+					if err != nil {
+						t.Errorf("Unexpected error hijacking connection: %v", err)
+						return
+					}
+					conn.Close()
+					return
+				}
+				// nolint: errcheck
+				w.Write([]byte(successResponse))
+			}))
+			defer server.Close()
+
+			_, err := newTestService(server.URL).AnalyzeSentiment(context.Background(), "text")
+			if actualCalls := atomic.LoadInt32(&calls); actualCalls != testCase.expectedCalls {
+				t.Fatalf("Expected %d calls, got %d", testCase.expectedCalls, actualCalls)
+			}
+			if (err != nil) != testCase.expectErr {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestAnalyzeSentimentErrorDetails(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		// nolint: errcheck
+		w.Write([]byte(`{
+  "error": {
+    "code": "InvalidRequest",
+    "message": "Invalid Request.",
+    "innererror": {"code": "InvalidDocument", "message": "Document text is empty."}
+  }
+}`))
+	}))
+	defer server.Close()
+
+	_, err := newTestService(server.URL).AnalyzeSentiment(context.Background(), "")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("Expected APIError, got %v", err)
+	}
+	if apiErr.Code != "InvalidDocument" || apiErr.Message != "Document text is empty." {
+		t.Fatalf("Unexpected error details: %+v", apiErr)
+	}
+}
+
+func TestAnalyzeSentimentDocumentError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// nolint: errcheck
+		w.Write([]byte(`{
+  "documents": [],
+  "errors": [{"id": "1", "error": {"code": "InvalidArgument", "message": "Invalid document in request."}}]
+}`))
+	}))
+	defer server.Close()
+
+	_, err := newTestService(server.URL).AnalyzeSentiment(context.Background(), "text")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("Expected APIError, got %v", err)
+	}
+	if apiErr.Code != "InvalidArgument" {
+		t.Fatalf("Expected code InvalidArgument, got %s", apiErr.Code)
+	}
+}
+
+func TestAnalyzeSentimentContextCanceled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	service := NewSentimentService(server.URL, "testkey", WithBackoff(time.Millisecond, time.Minute))
+	start := time.Now()
+	_, err := service.AnalyzeSentiment(ctx, "text")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected deadline exceeded, got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatalf("Retry-After was not interrupted by the context")
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	testCases := []struct {
+		name     string
+		header   http.Header
+		expected time.Duration
+	}{
+		{
+			name:     "missing",
+			header:   http.Header{},
+			expected: 0,
+		},
+		{
+			name:     "seconds",
+			header:   http.Header{"Retry-After": []string{"7"}},
+			expected: 7 * time.Second,
+		},
+		{
+			name:     "milliseconds",
+			header:   http.Header{"Retry-After-Ms": []string{"250"}, "Retry-After": []string{"1"}},
+			expected: 250 * time.Millisecond,
+		},
+		{
+			name:     "invalid",
+			header:   http.Header{"Retry-After": []string{"soon"}},
+			expected: 0,
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			actual := retryAfter(testCase.header)
+			if actual != testCase.expected {
+				t.Fatalf("Expected %s, got %s", testCase.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+// Package azuretest provides a local Azure Active Directory token endpoint
+// for testing token authentication without Azure.
+package azuretest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+)
+
+// TokenServer is a stub of the Azure Active Directory v2.0 token endpoint.
+// Point azure.AADConfig.AuthorityHost at URL to use it.
+type TokenServer struct {
+	*httptest.Server
+
+	// ExpiresIn is the token lifetime in seconds returned to clients.
+	ExpiresIn int
+
+	mu       sync.Mutex
+	requests []url.Values
+}
+
+// NewTokenServer starts a new token endpoint. The caller must call Close.
+func NewTokenServer() *TokenServer {
+	tokenServer := &TokenServer{ExpiresIn: 3600}
+	tokenServer.Server = httptest.NewServer(http.HandlerFunc(tokenServer.handleToken))
+	return tokenServer
+}
+
+// Requests returns the form values of every token request received.
+func (s *TokenServer) Requests() []url.Values {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]url.Values{}, s.requests...)
+}
+
+// AccessToken returns the access token issued for the nth request, starting
+// at 1.
+func AccessToken(n int) string {
+	return fmt.Sprintf("access-token-%d", n)
+}
+
+func (s *TokenServer) handleToken(resp http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		resp.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if err := req.ParseForm(); err != nil {
+		resp.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, req.PostForm)
+	tokenNumber := len(s.requests)
+	expiresIn := s.ExpiresIn
+	s.mu.Unlock()
+
+	resp.Header().Set("Content-Type", "application/json")
+	if req.PostForm.Get("grant_type") != "client_credentials" || req.PostForm.Get("client_id") == "" {
+		resp.WriteHeader(http.StatusBadRequest)
+		// nolint: errcheck
+		json.NewEncoder(resp).Encode(map[string]string{
+			"error":             "invalid_request",
+			"error_description": "AADSTS900144: missing client credentials",
+		})
+		return
+	}
+
+	// nolint: errcheck
+	json.NewEncoder(resp).Encode(map[string]interface{}{
+		"token_type":   "Bearer",
+		"expires_in":   expiresIn,
+		"access_token": AccessToken(tokenNumber),
+	})
+}
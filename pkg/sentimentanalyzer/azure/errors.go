@@ -0,0 +1,119 @@
+package azure
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// APIError is an error response from the language service. Code and Message
+// are taken from the error body that Azure returns, when there is one.
+type APIError struct {
+	StatusCode int
+	Code       string
+	Message    string
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	if e.Code == "" && e.Message == "" {
+		return fmt.Sprintf("unexpected status from language service: HTTP %d", e.StatusCode)
+	}
+	return fmt.Sprintf(
+		"unexpected status from language service: HTTP %d: %s: %s",
+		e.StatusCode,
+		e.Code,
+		e.Message,
+	)
+}
+
+// Retryable indicates if the call that caused the error could succeed if it
+// was tried again.
+func (e *APIError) Retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// transportError is returned when the language service could not be called
+// or its response could not be read, such as when the connection is reset.
+type transportError struct {
+	err error
+}
+
+func (e *transportError) Error() string {
+	return e.err.Error()
+}
+
+func (e *transportError) Unwrap() error {
+	return e.err
+}
+
+type errorDetails struct {
+	Code       string        `json:"code"`
+	Message    string        `json:"message"`
+	InnerError *errorDetails `json:"innererror,omitempty"`
+}
+
+type errorResponse struct {
+	Error errorDetails `json:"error"`
+}
+
+// code returns the most specific error code available, as the outer code is
+// usually a generic one such as InvalidRequest.
+func (e errorDetails) code() string {
+	if e.InnerError != nil && e.InnerError.Code != "" {
+		return e.InnerError.Code
+	}
+	return e.Code
+}
+
+func (e errorDetails) message() string {
+	if e.InnerError != nil && e.InnerError.Message != "" {
+		return e.InnerError.Message
+	}
+	return e.Message
+}
+
+func newAPIError(resp *http.Response, body []byte) *APIError {
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		RetryAfter: retryAfter(resp.Header),
+	}
+
+	errResp := errorResponse{}
+	if err := json.Unmarshal(body, &errResp); err == nil {
+		apiErr.Code = errResp.Error.code()
+		apiErr.Message = errResp.Error.message()
+	}
+
+	return apiErr
+}
+
+// retryAfter parses the delay requested by the service. Retry-After can be
+// either a number of seconds or an HTTP date, and some Azure services also
+// send a more precise retry-after-ms header.
+func retryAfter(header http.Header) time.Duration {
+	if ms := header.Get("retry-after-ms"); ms != "" {
+		if delay, err := strconv.Atoi(ms); err == nil && delay > 0 {
+			return time.Duration(delay) * time.Millisecond
+		}
+	}
+
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay
+		}
+	}
+	return 0
+}
@@ -0,0 +1,250 @@
+// Package bayes is a local multinomial Naive Bayes sentiment provider that is
+// trained on a labeled corpus, so that it can learn a community's jargon and
+// run without any external service.
+package bayes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"unicode"
+
+	sa "github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer"
+)
+
+// modelVersion is increased whenever the model file format changes.
+const modelVersion int = 1
+
+// DefaultAlpha is the default additive (Laplace) smoothing.
+const DefaultAlpha float64 = 1
+
+var sentiments = []sa.Sentiment{sa.Positive, sa.Negative, sa.Neutral}
+
+// Model holds the token counts learned from a corpus.
+type Model struct {
+	Version int     `json:"version"`
+	Alpha   float64 `json:"alpha"`
+	// Classes is keyed by the lower case sentiment name.
+	Classes    map[string]*ClassCounts `json:"classes"`
+	Vocabulary int                     `json:"vocabulary"`
+}
+
+// ClassCounts are the counts for one sentiment.
+type ClassCounts struct {
+	Documents int            `json:"documents"`
+	Tokens    int            `json:"tokens"`
+	Counts    map[string]int `json:"counts"`
+}
+
+// Train builds a model from the examples with the given smoothing.
+func Train(examples []Example, alpha float64) (*Model, error) {
+	if len(examples) == 0 {
+		return nil, fmt.Errorf("no training examples")
+	}
+	if alpha <= 0 {
+		return nil, fmt.Errorf("smoothing must be greater than 0, got %f", alpha)
+	}
+
+	model := &Model{
+		Version: modelVersion,
+		Alpha:   alpha,
+		Classes: map[string]*ClassCounts{},
+	}
+	for _, sentiment := range sentiments {
+		model.Classes[className(sentiment)] = &ClassCounts{Counts: map[string]int{}}
+	}
+
+	vocabulary := map[string]bool{}
+	for _, example := range examples {
+		class := model.Classes[className(example.Label)]
+		class.Documents++
+		for _, token := range Tokenize(example.Text) {
+			class.Counts[token]++
+			class.Tokens++
+			vocabulary[token] = true
+		}
+	}
+	model.Vocabulary = len(vocabulary)
+
+	return model, nil
+}
+
+// Predict returns the most likely sentiment of the text and its probability.
+func (m Model) Predict(text string) (sa.Sentiment, float32) {
+	tokens := Tokenize(text)
+
+	totalDocuments := 0
+	for _, class := range m.Classes {
+		totalDocuments += class.Documents
+	}
+
+	logProbabilities := map[sa.Sentiment]float64{}
+	for _, sentiment := range sentiments {
+		class, ok := m.Classes[className(sentiment)]
+		if !ok || class.Documents == 0 {
+			continue
+		}
+		logProbability := math.Log(float64(class.Documents) / float64(totalDocuments))
+		denominator := float64(class.Tokens) + m.Alpha*float64(m.Vocabulary+1)
+		for _, token := range tokens {
+			logProbability += math.Log((float64(class.Counts[token]) + m.Alpha) / denominator)
+		}
+		logProbabilities[sentiment] = logProbability
+	}
+	if len(logProbabilities) == 0 {
+		return sa.Neutral, 0
+	}
+
+	// Ties go to Neutral, as a wrong Neutral is the cheapest mistake to make.
+	winner := sa.Neutral
+	found := false
+	for _, sentiment := range []sa.Sentiment{sa.Neutral, sa.Negative, sa.Positive} {
+		logProbability, ok := logProbabilities[sentiment]
+		if ok && (!found || logProbability > logProbabilities[winner]) {
+			winner = sentiment
+			found = true
+		}
+	}
+
+	// The probability is normalized over the classes with the log-sum-exp
+	// trick, as the raw likelihoods underflow for long comments.
+	sum := 0.0
+	for _, logProbability := range logProbabilities {
+		sum += math.Exp(logProbability - logProbabilities[winner])
+	}
+	return winner, float32(1 / sum)
+}
+
+// Save writes the model as JSON.
+func (m Model) Save(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(m); err != nil {
+		return fmt.Errorf("error encoding model: %w", err)
+	}
+	return nil
+}
+
+// SaveFile writes the model to a file.
+func (m Model) SaveFile(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating model file: %w", err)
+	}
+	if err := m.Save(file); err != nil {
+		// nolint: errcheck
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Load reads a model saved with Save.
+func Load(r io.Reader) (*Model, error) {
+	model := &Model{}
+	if err := json.NewDecoder(r).Decode(model); err != nil {
+		return nil, fmt.Errorf("error decoding model: %w", err)
+	}
+	if model.Version != modelVersion {
+		return nil, fmt.Errorf("unsupported model version %d, expected %d", model.Version, modelVersion)
+	}
+	if len(model.Classes) == 0 || model.Alpha <= 0 {
+		return nil, fmt.Errorf("model is missing classes or smoothing")
+	}
+	return model, nil
+}
+
+// LoadFile reads a model from a file.
+func LoadFile(path string) (*Model, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening model file: %w", err)
+	}
+	defer file.Close()
+	return Load(file)
+}
+
+// Tokenize splits the text into lower case words. Words after a negation such
+// as "not" or "don't" are prefixed with "not_" until the next punctuation, so
+// that "not good" does not count as "good".
+func Tokenize(text string) []string {
+	tokens := []string{}
+	negated := false
+	word := strings.Builder{}
+
+	flush := func() {
+		if word.Len() == 0 {
+			return
+		}
+		token := word.String()
+		word.Reset()
+		if negated {
+			tokens = append(tokens, "not_"+token)
+		} else {
+			tokens = append(tokens, token)
+		}
+		if isNegation(token) {
+			negated = true
+		}
+	}
+
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '\'' || r == '_':
+			word.WriteRune(r)
+		case unicode.IsSpace(r):
+			flush()
+		default:
+			flush()
+			negated = false
+		}
+	}
+	flush()
+
+	return tokens
+}
+
+func isNegation(token string) bool {
+	switch token {
+	case "not", "no", "never", "nothing", "nobody", "cannot":
+		return true
+	default:
+		return strings.HasSuffix(token, "n't")
+	}
+}
+
+func className(sentiment sa.Sentiment) string {
+	return strings.ToLower(sentiment.String())
+}
+
+// SentimentService analyzes comments with a trained model.
+type SentimentService struct {
+	model *Model
+}
+
+// NewSentimentService creates a provider from a trained model.
+func NewSentimentService(model *Model) *SentimentService {
+	return &SentimentService{model: model}
+}
+
+// AnalyzeSentiment classifies the whole text and each of its sentences.
+func (s SentimentService) AnalyzeSentiment(ctx context.Context, text string) (*sa.Analysis, error) {
+	sentiment, confidence := s.model.Predict(text)
+	analysis := &sa.Analysis{
+		Sentiment:        sentiment,
+		Confidence:       confidence,
+		SentenceAnalyses: []sa.SentenceAnalysis{},
+	}
+	for _, sentence := range sa.SplitSentences(text) {
+		sentenceSentiment, sentenceConfidence := s.model.Predict(sentence)
+		analysis.SentenceAnalyses = append(analysis.SentenceAnalyses, sa.SentenceAnalysis{
+			Text:       sentence,
+			Sentiment:  sentenceSentiment,
+			Confidence: sentenceConfidence,
+		})
+	}
+	return analysis, nil
+}
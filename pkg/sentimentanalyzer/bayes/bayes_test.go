@@ -0,0 +1,146 @@
+package bayes
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+
+	sa "github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer"
+)
+
+var trainingExamples = []Example{
+	{Text: "Thanks, this looks great!", Label: sa.Positive},
+	{Text: "Great work, love it", Label: sa.Positive},
+	{Text: "Awesome, thanks for the fix", Label: sa.Positive},
+	{Text: "This is garbage and a waste of time", Label: sa.Negative},
+	{Text: "Terrible idea, this is not great", Label: sa.Negative},
+	{Text: "Stop wasting my time with garbage", Label: sa.Negative},
+	{Text: "Kill the process and rerun the build", Label: sa.Neutral},
+	{Text: "The build runs on the main branch", Label: sa.Neutral},
+	{Text: "Rerun the tests on the branch", Label: sa.Neutral},
+}
+
+func TestTokenize(t *testing.T) {
+	testCases := []struct {
+		name     string
+		text     string
+		expected []string
+	}{
+		{name: "simple", text: "Hello, World!", expected: []string{"hello", "world"}},
+		{name: "negation", text: "This is not good. Fine", expected: []string{"this", "is", "not", "not_good", "fine"}},
+		{name: "contraction_negation", text: "I don't like it", expected: []string{"i", "don't", "not_like", "not_it"}},
+		{name: "empty", text: "  ", expected: []string{}},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			actual := Tokenize(testCase.text)
+			if !reflect.DeepEqual(actual, testCase.expected) {
+				t.Fatalf("Expected %v, got %v", testCase.expected, actual)
+			}
+		})
+	}
+}
+
+func TestPredict(t *testing.T) {
+	model, err := Train(trainingExamples, DefaultAlpha)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	testCases := []struct {
+		name     string
+		text     string
+		expected sa.Sentiment
+	}{
+		{name: "positive", text: "thanks, great fix", expected: sa.Positive},
+		{name: "negative", text: "what garbage, a waste of my time", expected: sa.Negative},
+		{name: "jargon_is_neutral", text: "kill the build", expected: sa.Neutral},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			sentiment, confidence := model.Predict(testCase.text)
+			if sentiment != testCase.expected {
+				t.Fatalf("Expected %s, got %s", testCase.expected, sentiment)
+			}
+			if confidence <= 0.33 || confidence > 1 {
+				t.Fatalf("Unexpected confidence %f", confidence)
+			}
+		})
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	model, err := Train(trainingExamples, 0.5)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	buf := bytes.Buffer{}
+	if err := model.Save(&buf); err != nil {
+		t.Fatalf("Unexpected error saving: %v", err)
+	}
+	loaded, err := Load(&buf)
+	if err != nil {
+		t.Fatalf("Unexpected error loading: %v", err)
+	}
+	if !reflect.DeepEqual(model, loaded) {
+		t.Fatalf("Loaded model differs from the saved model")
+	}
+
+	if _, err := Load(bytes.NewBufferString(`{"version": 99}`)); err == nil {
+		t.Fatalf("Expected error for unsupported version")
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	model, err := Train(trainingExamples, DefaultAlpha)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	evaluation := model.Evaluate([]Example{
+		{Text: "great, thanks", Label: sa.Positive},
+		{Text: "garbage", Label: sa.Negative},
+		{Text: "rerun the build", Label: sa.Neutral},
+		{Text: "thanks for the garbage fix", Label: sa.Negative},
+	})
+	if evaluation.Examples != 4 || evaluation.Accuracy != 0.75 {
+		t.Fatalf("Unexpected evaluation: %+v", evaluation)
+	}
+	negative := evaluation.Classes[sa.Negative]
+	if negative.Precision != 1 || negative.Recall != 0.5 || negative.Support != 2 {
+		t.Fatalf("Unexpected negative metrics: %+v", negative)
+	}
+	if diff := negative.F1 - 2.0/3.0; diff > 0.0001 || diff < -0.0001 {
+		t.Fatalf("Unexpected negative F1 %f", negative.F1)
+	}
+	if positive := evaluation.Classes[sa.Positive]; positive.Precision != 0.5 || positive.Recall != 1 {
+		t.Fatalf("Unexpected positive metrics: %+v", positive)
+	}
+}
+
+func TestAnalyzeSentiment(t *testing.T) {
+	model, err := Train(trainingExamples, DefaultAlpha)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	analysis, err := NewSentimentService(model).AnalyzeSentiment(
+		context.Background(),
+		"Rerun the build. This is garbage.",
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(analysis.SentenceAnalyses) != 2 {
+		t.Fatalf("Expected 2 sentences, got %+v", analysis.SentenceAnalyses)
+	}
+	if analysis.SentenceAnalyses[1].Sentiment != sa.Negative {
+		t.Fatalf("Expected the second sentence to be negative, got %s", analysis.SentenceAnalyses[1].Sentiment)
+	}
+}
@@ -0,0 +1,115 @@
+package bayes
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	sa "github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer"
+)
+
+// Example is a labeled piece of text from a corpus.
+type Example struct {
+	Text  string
+	Label sa.Sentiment
+}
+
+type jsonExample struct {
+	Text  string `json:"text"`
+	Label string `json:"label"`
+}
+
+// LoadCorpus reads the examples in a corpus file. Files ending in .csv are
+// read as CSV with a header that has text and label columns, any other file
+// is read as JSONL with one {"text": ..., "label": ...} object per line.
+func LoadCorpus(path string) ([]Example, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening corpus: %w", err)
+	}
+	defer file.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return ReadCSV(file)
+	}
+	return ReadJSONL(file)
+}
+
+// ReadJSONL reads examples from JSON lines. Blank lines are skipped.
+func ReadJSONL(r io.Reader) ([]Example, error) {
+	examples := []Example{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		rawExample := jsonExample{}
+		if err := json.Unmarshal([]byte(line), &rawExample); err != nil {
+			return nil, fmt.Errorf("error parsing corpus line %d: %w", lineNumber, err)
+		}
+		label, err := sa.ParseSentiment(rawExample.Label)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing corpus line %d: %w", lineNumber, err)
+		}
+		examples = append(examples, Example{Text: rawExample.Text, Label: label})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading corpus: %w", err)
+	}
+	return examples, nil
+}
+
+// ReadCSV reads examples from CSV with a header row that names the text and
+// label columns. Other columns are ignored.
+func ReadCSV(r io.Reader) ([]Example, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error reading corpus header: %w", err)
+	}
+	textColumn, labelColumn := -1, -1
+	for i, column := range header {
+		switch strings.ToLower(strings.TrimSpace(column)) {
+		case "text":
+			textColumn = i
+		case "label":
+			labelColumn = i
+		}
+	}
+	if textColumn < 0 || labelColumn < 0 {
+		return nil, fmt.Errorf("corpus header must have text and label columns")
+	}
+
+	examples := []Example{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading corpus: %w", err)
+		}
+		line, _ := reader.FieldPos(0)
+		if textColumn >= len(record) || labelColumn >= len(record) {
+			return nil, fmt.Errorf("corpus line %d is missing columns", line)
+		}
+		label, err := sa.ParseSentiment(record[labelColumn])
+		if err != nil {
+			return nil, fmt.Errorf("error parsing corpus line %d: %w", line, err)
+		}
+		examples = append(examples, Example{Text: record[textColumn], Label: label})
+	}
+	return examples, nil
+}
@@ -0,0 +1,71 @@
+package bayes
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	sa "github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer"
+)
+
+func TestReadCorpus(t *testing.T) {
+	expected := []Example{
+		{Text: "looks great, thanks", Label: sa.Positive},
+		{Text: "this is garbage", Label: sa.Negative},
+	}
+
+	testCases := []struct {
+		name      string
+		read      func(string) ([]Example, error)
+		data      string
+		expectErr bool
+	}{
+		{
+			name: "jsonl",
+			read: func(data string) ([]Example, error) { return ReadJSONL(strings.NewReader(data)) },
+			data: `{"text": "looks great, thanks", "label": "positive"}
+
+{"text": "this is garbage", "label": "NEGATIVE"}
+`,
+		},
+		{
+			name: "csv",
+			read: func(data string) ([]Example, error) { return ReadCSV(strings.NewReader(data)) },
+			data: `id,label,text
+1,positive,"looks great, thanks"
+2,negative,this is garbage
+`,
+		},
+		{
+			name:      "jsonl_unknown_label",
+			read:      func(data string) ([]Example, error) { return ReadJSONL(strings.NewReader(data)) },
+			data:      `{"text": "meh", "label": "mixed"}`,
+			expectErr: true,
+		},
+		{
+			name:      "csv_missing_label_column",
+			read:      func(data string) ([]Example, error) { return ReadCSV(strings.NewReader(data)) },
+			data:      "text\nhello\n",
+			expectErr: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			actual, err := testCase.read(testCase.data)
+			if testCase.expectErr {
+				if err == nil {
+					t.Fatalf("Expected error, got %+v", actual)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(actual, expected) {
+				t.Fatalf("Expected %+v, got %+v", expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package bayes
+
+import (
+	sa "github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer"
+)
+
+// ClassMetrics are the evaluation results for one sentiment.
+type ClassMetrics struct {
+	Precision float64
+	Recall    float64
+	F1        float64
+	// Support is the number of examples labeled with the sentiment.
+	Support int
+}
+
+// Evaluation is the result of evaluating a model against labeled examples.
+type Evaluation struct {
+	Examples int
+	Accuracy float64
+	Classes  map[sa.Sentiment]ClassMetrics
+	// MacroF1 is the unweighted mean of the F1 of every sentiment.
+	MacroF1 float64
+}
+
+// Evaluate predicts every example and compares it to its label.
+func (m Model) Evaluate(examples []Example) Evaluation {
+	truePositives := map[sa.Sentiment]int{}
+	predicted := map[sa.Sentiment]int{}
+	actual := map[sa.Sentiment]int{}
+	correct := 0
+	for _, example := range examples {
+		prediction, _ := m.Predict(example.Text)
+		predicted[prediction]++
+		actual[example.Label]++
+		if prediction == example.Label {
+			truePositives[prediction]++
+			correct++
+		}
+	}
+
+	evaluation := Evaluation{
+		Examples: len(examples),
+		Classes:  map[sa.Sentiment]ClassMetrics{},
+	}
+	if len(examples) > 0 {
+		evaluation.Accuracy = float64(correct) / float64(len(examples))
+	}
+	for _, sentiment := range sentiments {
+		metrics := ClassMetrics{Support: actual[sentiment]}
+		if predicted[sentiment] > 0 {
+			metrics.Precision = float64(truePositives[sentiment]) / float64(predicted[sentiment])
+		}
+		if actual[sentiment] > 0 {
+			metrics.Recall = float64(truePositives[sentiment]) / float64(actual[sentiment])
+		}
+		if metrics.Precision+metrics.Recall > 0 {
+			metrics.F1 = 2 * metrics.Precision * metrics.Recall / (metrics.Precision + metrics.Recall)
+		}
+		evaluation.Classes[sentiment] = metrics
+		evaluation.MacroF1 += metrics.F1 / float64(len(sentiments))
+	}
+	return evaluation
+}
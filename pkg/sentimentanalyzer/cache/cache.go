@@ -0,0 +1,139 @@
+// Package cache caches sentiment analyses so that repeated comments, such as
+// "LGTM" or "Thanks!", and edits that only touch code blocks do not call the
+// provider again.
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/trstringer/comment-sentiment/pkg/metrics"
+	sa "github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer"
+)
+
+// DefaultTTL is how long analyses are cached by default.
+const DefaultTTL time.Duration = 24 * time.Hour
+
+// Entry is a cached analysis.
+type Entry struct {
+	Analysis sa.Analysis `json:"analysis"`
+	Expires  time.Time   `json:"expires"`
+}
+
+// Store is a cache backend. Get returns nil when the key is not cached.
+type Store interface {
+	Get(key string) (*Entry, error)
+	Set(key string, entry Entry) error
+}
+
+// Analyzer caches the analyses of another analyzer.
+type Analyzer struct {
+	analyzer   sa.Analyzer
+	providerID string
+	stores     []Store
+	ttl        time.Duration
+	now        func() time.Time
+}
+
+// Option configures optional settings of the Analyzer.
+type Option func(*Analyzer)
+
+// WithTTL sets how long analyses are cached. Defaults to DefaultTTL.
+func WithTTL(ttl time.Duration) Option {
+	return func(a *Analyzer) {
+		a.ttl = ttl
+	}
+}
+
+// NewAnalyzer caches the analyses of analyzer in the stores, which are
+// checked in order, so a fast store such as Memory should come before a slow
+// one such as Disk. The providerID is part of the key so that analyses of
+// different providers or models are not mixed up.
+func NewAnalyzer(analyzer sa.Analyzer, providerID string, stores []Store, opts ...Option) *Analyzer {
+	a := &Analyzer{
+		analyzer:   analyzer,
+		providerID: providerID,
+		stores:     stores,
+		ttl:        DefaultTTL,
+		now:        time.Now,
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// Key is the cache key of the text for the provider.
+func Key(providerID, text string) string {
+	hash := sha256.Sum256([]byte(providerID + "\x00" + sa.NormalizeComment(text)))
+	return hex.EncodeToString(hash[:])
+}
+
+// AnalyzeSentiment returns the cached analysis of the text, or analyzes and
+// caches it. The provider is given the normalized text, so that everything
+// that shares a key gets the same analysis and footer. Store errors are
+// logged and treated as a miss.
+func (a Analyzer) AnalyzeSentiment(ctx context.Context, text string) (*sa.Analysis, error) {
+	key := Key(a.providerID, text)
+	now := a.now()
+
+	for i, store := range a.stores {
+		entry, err := store.Get(key)
+		if err != nil {
+			log.Warn().Err(err).Msg("Error reading from the analysis cache")
+			continue
+		}
+		if entry == nil || !now.Before(entry.Expires) {
+			continue
+		}
+
+		metrics.CacheLookups.WithLabelValues(a.providerID, "hit").Inc()
+		log.Debug().Msgf("Analysis cache hit for %s", key)
+		// Fill in the faster stores that missed.
+		a.set(a.stores[:i], key, *entry)
+		analysis := copyAnalysis(entry.Analysis)
+		return &analysis, nil
+	}
+
+	metrics.CacheLookups.WithLabelValues(a.providerID, "miss").Inc()
+	analysis, err := a.analyzer.AnalyzeSentiment(ctx, sa.NormalizeComment(text))
+	if err != nil {
+		return nil, err
+	}
+	if analysis == nil || analysis.Degraded {
+		return analysis, nil
+	}
+
+	a.set(a.stores, key, Entry{
+		Analysis: copyAnalysis(*analysis),
+		Expires:  now.Add(a.ttl),
+	})
+	return analysis, nil
+}
+
+func (a Analyzer) set(stores []Store, key string, entry Entry) {
+	for _, store := range stores {
+		if err := store.Set(key, entry); err != nil {
+			log.Warn().Err(err).Msg("Error writing to the analysis cache")
+		}
+	}
+}
+
+// copyAnalysis copies the slices of the analysis so that callers cannot
+// change a cached analysis.
+func copyAnalysis(analysis sa.Analysis) sa.Analysis {
+	if analysis.SentenceAnalyses != nil {
+		analysis.SentenceAnalyses = append([]sa.SentenceAnalysis{}, analysis.SentenceAnalyses...)
+	}
+	if analysis.Toxicity != nil {
+		analysis.Toxicity = append([]sa.ToxicityScore{}, analysis.Toxicity...)
+	}
+	if analysis.Providers != nil {
+		analysis.Providers = append([]string{}, analysis.Providers...)
+	}
+	return analysis
+}
@@ -0,0 +1,250 @@
+package cache
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/trstringer/comment-sentiment/pkg/metrics"
+	sa "github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer"
+)
+
+type countingAnalyzer struct {
+	calls []string
+}
+
+func (c *countingAnalyzer) AnalyzeSentiment(ctx context.Context, text string) (*sa.Analysis, error) {
+	c.calls = append(c.calls, text)
+	return &sa.Analysis{
+		Sentiment:  sa.Negative,
+		Confidence: 0.87654321,
+		SentenceAnalyses: []sa.SentenceAnalysis{
+			{Text: text, Sentiment: sa.Negative, Confidence: 0.3333333, SuggestedRewrite: "be nice"},
+		},
+		Toxicity:  []sa.ToxicityScore{{Category: sa.Insult, Score: 0.7}},
+		Providers: []string{"fake"},
+	}, nil
+}
+
+func TestAnalyzeSentiment(t *testing.T) {
+	testCases := []struct {
+		name          string
+		first         string
+		second        string
+		providerID    string
+		expectedCalls int
+	}{
+		{name: "identical", first: "LGTM", second: "LGTM", expectedCalls: 1},
+		{name: "whitespace_only", first: "Thanks!", second: "  Thanks!\n", expectedCalls: 1},
+		{name: "code_block_edit", first: "Broken:\n```\nfoo\n```", second: "Broken:\n```\nbar\n```", expectedCalls: 1},
+		{name: "different_text", first: "LGTM", second: "+1", expectedCalls: 2},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			analyzer := &countingAnalyzer{}
+			cached := NewAnalyzer(analyzer, "fake", []Store{NewMemory(10)})
+
+			first, err := cached.AnalyzeSentiment(context.Background(), testCase.first)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			second, err := cached.AnalyzeSentiment(context.Background(), testCase.second)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(analyzer.calls) != testCase.expectedCalls {
+				t.Fatalf("Expected %d calls, got %d", testCase.expectedCalls, len(analyzer.calls))
+			}
+			if testCase.expectedCalls == 1 && !reflect.DeepEqual(first, second) {
+				t.Fatalf("Expected cached analysis %+v, got %+v", *first, *second)
+			}
+		})
+	}
+}
+
+func TestAnalyzeSentimentProviderID(t *testing.T) {
+	analyzer := &countingAnalyzer{}
+	store := NewMemory(10)
+	for _, providerID := range []string{"azure", "openai"} {
+		if _, err := NewAnalyzer(analyzer, providerID, []Store{store}).AnalyzeSentiment(context.Background(), "LGTM"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if len(analyzer.calls) != 2 {
+		t.Fatalf("Expected each provider to be called, got %d calls", len(analyzer.calls))
+	}
+}
+
+func TestAnalyzeSentimentTTL(t *testing.T) {
+	analyzer := &countingAnalyzer{}
+	cached := NewAnalyzer(analyzer, "fake", []Store{NewMemory(10)}, WithTTL(time.Hour))
+	now := time.Now()
+	cached.now = func() time.Time { return now }
+
+	for _, elapsed := range []time.Duration{0, 30 * time.Minute, 61 * time.Minute} {
+		now = now.Add(elapsed)
+		if _, err := cached.AnalyzeSentiment(context.Background(), "LGTM"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if len(analyzer.calls) != 2 {
+		t.Fatalf("Expected the expired entry to be analyzed again, got %d calls", len(analyzer.calls))
+	}
+}
+
+func TestAnalyzeSentimentDisk(t *testing.T) {
+	dir := t.TempDir()
+	analyzer := &countingAnalyzer{}
+
+	disk, err := NewDisk(dir, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected, err := NewAnalyzer(analyzer, "fake", []Store{NewMemory(10), disk}).
+		AnalyzeSentiment(context.Background(), "This is bad.")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// A new memory store is like a restart, so the entry has to come from
+	// disk and is copied back into memory.
+	memory := NewMemory(10)
+	hitsBefore := testutil.ToFloat64(metrics.CacheLookups.WithLabelValues("fake", "hit"))
+	actual, err := NewAnalyzer(analyzer, "fake", []Store{memory, disk}).
+		AnalyzeSentiment(context.Background(), "This is bad.")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(analyzer.calls) != 1 {
+		t.Fatalf("Expected one call, got %d", len(analyzer.calls))
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("Expected analysis from disk %+v, got %+v", *expected, *actual)
+	}
+	if memory.Len() != 1 {
+		t.Fatalf("Expected the memory store to be filled from disk")
+	}
+	if hits := testutil.ToFloat64(metrics.CacheLookups.WithLabelValues("fake", "hit")); hits != hitsBefore+1 {
+		t.Fatalf("Expected a hit to be counted, got %f hits after %f", hits, hitsBefore)
+	}
+}
+
+func TestMemoryEviction(t *testing.T) {
+	memory := NewMemory(2)
+	for _, key := range []string{"a", "b"} {
+		if err := memory.Set(key, Entry{}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	// Using a makes b the least recently used entry.
+	if entry, _ := memory.Get("a"); entry == nil {
+		t.Fatalf("Expected a to be cached")
+	}
+	if err := memory.Set("c", Entry{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if entry, _ := memory.Get("b"); entry != nil {
+		t.Fatalf("Expected b to be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if entry, _ := memory.Get(key); entry == nil {
+			t.Fatalf("Expected %s to be cached", key)
+		}
+	}
+}
+
+func TestDiskExpiry(t *testing.T) {
+	disk, err := NewDisk(t.TempDir(), 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	now := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	disk.now = func() time.Time { return now }
+
+	if err := disk.Set("a", Entry{Expires: now.Add(time.Hour)}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if entry, err := disk.Get("a"); entry == nil || err != nil {
+		t.Fatalf("Expected a to be cached, got %v", err)
+	}
+
+	now = now.Add(time.Hour)
+	if entry, err := disk.Get("a"); entry != nil || err != nil {
+		t.Fatalf("Expected a to be expired, got %+v, %v", entry, err)
+	}
+	if _, err := os.Stat(disk.path("a")); !os.IsNotExist(err) {
+		t.Fatalf("Expected the expired entry to be deleted, got %v", err)
+	}
+}
+
+func TestDiskPrune(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	disk := &Disk{dir: dir, maxEntries: 2, now: func() time.Time { return now }}
+
+	expires := map[string]time.Duration{
+		"expired":  -time.Minute,
+		"first":    time.Minute,
+		"second":   2 * time.Minute,
+		"third":    3 * time.Minute,
+		"expired2": -time.Hour,
+	}
+	for key, ttl := range expires {
+		if err := disk.Set(key, Entry{Expires: now.Add(ttl)}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	leftover := filepath.Join(dir, "a.tmp123")
+	if err := ioutil.WriteFile(leftover, nil, 0o600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := os.Chtimes(leftover, now.Add(-2*time.Hour), now.Add(-2*time.Hour)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, err := disk.Prune(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	names := []string{}
+	for _, file := range files {
+		names = append(names, file.Name())
+	}
+	if !reflect.DeepEqual(names, []string{"second.json", "third.json"}) {
+		t.Fatalf("Expected the entries that expire last to be kept, got %v", names)
+	}
+}
+
+type degradedAnalyzer struct {
+	calls int
+}
+
+func (d *degradedAnalyzer) AnalyzeSentiment(ctx context.Context, text string) (*sa.Analysis, error) {
+	d.calls++
+	return &sa.Analysis{Sentiment: sa.Neutral, Degraded: true}, nil
+}
+
+func TestAnalyzeSentimentDegradedNotCached(t *testing.T) {
+	analyzer := &degradedAnalyzer{}
+	cached := NewAnalyzer(analyzer, "fake", []Store{NewMemory(10)})
+	for i := 0; i < 2; i++ {
+		if _, err := cached.AnalyzeSentiment(context.Background(), "LGTM"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if analyzer.calls != 2 {
+		t.Fatalf("Expected degraded analyses not to be cached, got %d calls", analyzer.calls)
+	}
+}
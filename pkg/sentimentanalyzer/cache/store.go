@@ -0,0 +1,238 @@
+package cache
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory is an in-memory store that evicts the least recently used entry
+// once it is full.
+type Memory struct {
+	size    int
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type memoryItem struct {
+	key   string
+	entry Entry
+}
+
+// NewMemory creates a store that holds up to size entries.
+func NewMemory(size int) *Memory {
+	return &Memory{
+		size:    size,
+		order:   list.New(),
+		entries: map[string]*list.Element{},
+	}
+}
+
+// Get returns the entry for the key and marks it as recently used.
+func (m *Memory) Get(key string) (*Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	element, ok := m.entries[key]
+	if !ok {
+		return nil, nil
+	}
+	m.order.MoveToFront(element)
+	entry := element.Value.(*memoryItem).entry
+	return &entry, nil
+}
+
+// Set adds or replaces the entry for the key.
+func (m *Memory) Set(key string, entry Entry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if element, ok := m.entries[key]; ok {
+		element.Value.(*memoryItem).entry = entry
+		m.order.MoveToFront(element)
+		return nil
+	}
+
+	m.entries[key] = m.order.PushFront(&memoryItem{key: key, entry: entry})
+	for m.order.Len() > m.size {
+		oldest := m.order.Back()
+		m.order.Remove(oldest)
+		delete(m.entries, oldest.Value.(*memoryItem).key)
+	}
+	return nil
+}
+
+// Len is the number of entries in the store.
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.order.Len()
+}
+
+// Disk is a store that keeps one JSON file per entry in a directory, so that
+// the cache survives restarts. The modification time of each file is set to
+// the expiry of its entry. Expired entries are deleted when they are read and
+// when the store is pruned, which also deletes the entries that expire first
+// once there are more than the maximum.
+type Disk struct {
+	dir        string
+	maxEntries int
+	now        func() time.Time
+
+	mu      sync.Mutex
+	writes  int
+	pruning bool
+}
+
+// NewDisk creates a store in dir that holds up to maxEntries entries, or any
+// number if it is 0, creating the directory if needed. The store is pruned
+// when it is created and after every tenth of maxEntries writes.
+func NewDisk(dir string, maxEntries int) (*Disk, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("error creating cache directory: %w", err)
+	}
+	d := &Disk{dir: dir, maxEntries: maxEntries, now: time.Now}
+	if _, err := d.Prune(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Get reads the entry for the key. An expired entry is deleted.
+func (d *Disk) Get(key string) (*Entry, error) {
+	data, err := ioutil.ReadFile(d.path(key))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading cache entry: %w", err)
+	}
+
+	entry := &Entry{}
+	if err := json.Unmarshal(data, entry); err != nil {
+		return nil, fmt.Errorf("error unmarshalling cache entry: %w", err)
+	}
+	if !d.now().Before(entry.Expires) {
+		if err := os.Remove(d.path(key)); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("error deleting expired cache entry: %w", err)
+		}
+		return nil, nil
+	}
+	return entry, nil
+}
+
+// Prune deletes the expired entries, the entries that expire first while
+// there are more than the maximum, and temporary files left behind by
+// interrupted writes. It returns the number of entries deleted.
+func (d *Disk) Prune() (int, error) {
+	d.mu.Lock()
+	if d.pruning {
+		d.mu.Unlock()
+		return 0, nil
+	}
+	d.pruning = true
+	d.writes = 0
+	d.mu.Unlock()
+	defer func() {
+		d.mu.Lock()
+		d.pruning = false
+		d.mu.Unlock()
+	}()
+
+	files, err := ioutil.ReadDir(d.dir)
+	if err != nil {
+		return 0, fmt.Errorf("error listing cache directory: %w", err)
+	}
+
+	now := d.now()
+	deleted := 0
+	entries := []os.FileInfo{}
+	for _, file := range files {
+		path := filepath.Join(d.dir, file.Name())
+		switch {
+		case file.IsDir():
+		case strings.Contains(file.Name(), ".tmp"):
+			// Writes take far less than an hour.
+			if now.Sub(file.ModTime()) > time.Hour {
+				// nolint: errcheck
+				os.Remove(path)
+			}
+		case filepath.Ext(file.Name()) != ".json":
+		case !now.Before(file.ModTime()):
+			if err := os.Remove(path); err == nil {
+				deleted++
+			}
+		default:
+			entries = append(entries, file)
+		}
+	}
+
+	if d.maxEntries > 0 && len(entries) > d.maxEntries {
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].ModTime().Before(entries[j].ModTime())
+		})
+		for _, file := range entries[:len(entries)-d.maxEntries] {
+			if err := os.Remove(filepath.Join(d.dir, file.Name())); err == nil {
+				deleted++
+			}
+		}
+	}
+	return deleted, nil
+}
+
+// Set writes the entry for the key. The entry is written to a temporary file
+// first so that readers never see a partial entry.
+func (d *Disk) Set(key string, entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("error marshalling cache entry: %w", err)
+	}
+
+	tmpFile, err := ioutil.TempFile(d.dir, key+".tmp")
+	if err != nil {
+		return fmt.Errorf("error creating cache entry: %w", err)
+	}
+	if _, err := tmpFile.Write(data); err != nil {
+		// nolint: errcheck
+		tmpFile.Close()
+		// nolint: errcheck
+		os.Remove(tmpFile.Name())
+		return fmt.Errorf("error writing cache entry: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		// nolint: errcheck
+		os.Remove(tmpFile.Name())
+		return fmt.Errorf("error writing cache entry: %w", err)
+	}
+	if err := os.Chtimes(tmpFile.Name(), entry.Expires, entry.Expires); err != nil {
+		// nolint: errcheck
+		os.Remove(tmpFile.Name())
+		return fmt.Errorf("error writing cache entry: %w", err)
+	}
+	if err := os.Rename(tmpFile.Name(), d.path(key)); err != nil {
+		return fmt.Errorf("error saving cache entry: %w", err)
+	}
+
+	d.mu.Lock()
+	d.writes++
+	prune := d.maxEntries > 0 && d.writes >= d.maxEntries/10+1
+	d.mu.Unlock()
+	if prune {
+		if _, err := d.Prune(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Disk) path(key string) string {
+	return filepath.Join(d.dir, key+".json")
+}
@@ -0,0 +1,320 @@
+// Package ensemble combines the results of several sentiment providers to
+// reduce the false positives of any single model.
+package ensemble
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	sa "github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer"
+)
+
+const defaultTimeout time.Duration = 30 * time.Second
+
+// Strategy is how member results are combined.
+type Strategy string
+
+const (
+	// MajorityVote picks the sentiment with the most (weighted) votes. Ties
+	// go to Neutral, as a wrong Neutral is the cheapest mistake to make.
+	MajorityVote Strategy = "majority"
+	// WeightedAverage averages the confidence of every member for each
+	// sentiment and picks the highest.
+	WeightedAverage Strategy = "weighted"
+)
+
+// ParseStrategy validates a strategy name.
+func ParseStrategy(name string) (Strategy, error) {
+	switch Strategy(name) {
+	case MajorityVote, WeightedAverage:
+		return Strategy(name), nil
+	default:
+		return "", fmt.Errorf("unknown ensemble strategy %s", name)
+	}
+}
+
+// Member is an analyzer that takes part in the ensemble.
+type Member struct {
+	Name     string
+	Analyzer sa.Analyzer
+	// Weight defaults to 1 when it is not set.
+	Weight float32
+}
+
+// SentimentService calls every member in parallel and combines their
+// analyses.
+type SentimentService struct {
+	members  []Member
+	strategy Strategy
+	timeout  time.Duration
+	quorum   int
+}
+
+// Option configures optional settings of the SentimentService.
+type Option func(*SentimentService)
+
+// WithStrategy sets how member results are combined. Defaults to
+// MajorityVote.
+func WithStrategy(strategy Strategy) Option {
+	return func(s *SentimentService) {
+		s.strategy = strategy
+	}
+}
+
+// WithTimeout sets how long each member has to respond before it is left out
+// of the result.
+func WithTimeout(timeout time.Duration) Option {
+	return func(s *SentimentService) {
+		s.timeout = timeout
+	}
+}
+
+// WithQuorum sets the minimum number of members that have to succeed.
+// Defaults to 1.
+func WithQuorum(quorum int) Option {
+	return func(s *SentimentService) {
+		s.quorum = quorum
+	}
+}
+
+// NewSentimentService creates an ensemble of the members.
+func NewSentimentService(members []Member, opts ...Option) *SentimentService {
+	svc := &SentimentService{
+		members:  members,
+		strategy: MajorityVote,
+		timeout:  defaultTimeout,
+		quorum:   1,
+	}
+	for _, opt := range opts {
+		opt(svc)
+	}
+	return svc
+}
+
+type memberResult struct {
+	member   Member
+	analysis *sa.Analysis
+	err      error
+}
+
+// AnalyzeSentiment analyzes the text with every member. Members that fail or
+// time out are logged and left out, as long as the quorum is met.
+func (s SentimentService) AnalyzeSentiment(ctx context.Context, text string) (*sa.Analysis, error) {
+	results := make([]memberResult, len(s.members))
+	wg := sync.WaitGroup{}
+	for i, member := range s.members {
+		wg.Add(1)
+		go func(i int, member Member) {
+			defer wg.Done()
+			memberCtx, cancel := context.WithTimeout(ctx, s.timeout)
+			defer cancel()
+
+			analysis, err := member.Analyzer.AnalyzeSentiment(memberCtx, text)
+			if err == nil && analysis == nil {
+				err = fmt.Errorf("unexpectedly no analysis returned")
+			}
+			results[i] = memberResult{member: member, analysis: analysis, err: err}
+		}(i, member)
+	}
+	wg.Wait()
+
+	succeeded := []memberResult{}
+	failures := []string{}
+	for _, result := range results {
+		if result.err != nil {
+			log.Warn().Err(result.err).Msgf("Ensemble member %s failed", result.member.Name)
+			failures = append(failures, fmt.Sprintf("%s: %v", result.member.Name, result.err))
+			continue
+		}
+		succeeded = append(succeeded, result)
+	}
+	if len(succeeded) == 0 || len(succeeded) < s.quorum {
+		return nil, fmt.Errorf(
+			"only %d of %d ensemble members succeeded: %s",
+			len(succeeded),
+			len(s.members),
+			strings.Join(failures, "; "),
+		)
+	}
+
+	return s.combine(succeeded), nil
+}
+
+type vote struct {
+	weight     float32
+	sentiment  sa.Sentiment
+	confidence float32
+}
+
+func (s SentimentService) combine(results []memberResult) *sa.Analysis {
+	votes := []vote{}
+	providers := []string{}
+	for _, result := range results {
+		votes = append(votes, vote{
+			weight:     weight(result.member),
+			sentiment:  result.analysis.Sentiment,
+			confidence: result.analysis.Confidence,
+		})
+		providers = append(providers, result.member.Name)
+	}
+	resultSentiment, resultConfidence := s.decide(votes)
+
+	// The first member's sentence split is used, and each of its sentences is
+	// combined with the sentences of the same text from the other members.
+	sentenceAnalyses := []sa.SentenceAnalysis{}
+	for _, sentence := range results[0].analysis.SentenceAnalyses {
+		sentenceVotes := []vote{}
+		suggestedRewrite := ""
+		for _, result := range results {
+			for _, memberSentence := range result.analysis.SentenceAnalyses {
+				if normalize(memberSentence.Text) != normalize(sentence.Text) {
+					continue
+				}
+				sentenceVotes = append(sentenceVotes, vote{
+					weight:     weight(result.member),
+					sentiment:  memberSentence.Sentiment,
+					confidence: memberSentence.Confidence,
+				})
+				if suggestedRewrite == "" {
+					suggestedRewrite = memberSentence.SuggestedRewrite
+				}
+				break
+			}
+		}
+
+		sentenceSentiment, sentenceConfidence := s.decide(sentenceVotes)
+		if sentenceSentiment != sa.Negative {
+			suggestedRewrite = ""
+		}
+		sentenceAnalyses = append(sentenceAnalyses, sa.SentenceAnalysis{
+			Text:             sentence.Text,
+			Sentiment:        sentenceSentiment,
+			Confidence:       sentenceConfidence,
+			SuggestedRewrite: suggestedRewrite,
+		})
+	}
+
+	return &sa.Analysis{
+		Sentiment:        resultSentiment,
+		Confidence:       resultConfidence,
+		SentenceAnalyses: sentenceAnalyses,
+		Toxicity:         combineToxicity(results),
+		Providers:        providers,
+	}
+}
+
+// combineToxicity averages the toxicity scores by weight across the members
+// that scored toxicity.
+func combineToxicity(results []memberResult) []sa.ToxicityScore {
+	totalWeight := float32(0)
+	scores := map[sa.ToxicityCategory]float32{}
+	for _, result := range results {
+		if len(result.analysis.Toxicity) == 0 {
+			continue
+		}
+		totalWeight += weight(result.member)
+		for _, category := range sa.ToxicityCategories {
+			scores[category] += weight(result.member) * result.analysis.ToxicityScore(category)
+		}
+	}
+	if totalWeight == 0 {
+		return nil
+	}
+
+	toxicity := []sa.ToxicityScore{}
+	for _, category := range sa.ToxicityCategories {
+		toxicity = append(toxicity, sa.ToxicityScore{
+			Category: category,
+			Score:    scores[category] / totalWeight,
+		})
+	}
+	return toxicity
+}
+
+func (s SentimentService) decide(votes []vote) (sa.Sentiment, float32) {
+	if s.strategy == WeightedAverage {
+		return weightedAverage(votes)
+	}
+	return majorityVote(votes)
+}
+
+// majorityVote returns the sentiment with the most weight, or neutral when
+// sentiments tie for the most weight. The confidence is the weighted
+// confidence of the winning voters over the total weight, so that
+// disagreement lowers it. When positive and negative tie and no voter said
+// neutral, the confidence is the weighted mean confidence of the tied voters.
+func majorityVote(votes []vote) (sa.Sentiment, float32) {
+	totalWeight := float32(0)
+	sentimentWeights := map[sa.Sentiment]float32{}
+	sentimentConfidences := map[sa.Sentiment]float32{}
+	for _, v := range votes {
+		totalWeight += v.weight
+		sentimentWeights[v.sentiment] += v.weight
+		sentimentConfidences[v.sentiment] += v.weight * v.confidence
+	}
+	if totalWeight == 0 {
+		return sa.Neutral, 0
+	}
+
+	winner, tie := sa.Neutral, false
+	for _, sentiment := range []sa.Sentiment{sa.Negative, sa.Positive} {
+		switch {
+		case sentimentWeights[sentiment] > sentimentWeights[winner]:
+			winner, tie = sentiment, false
+		case sentimentWeights[sentiment] == sentimentWeights[winner] && sentimentWeights[sentiment] > 0:
+			tie = true
+		}
+	}
+	if tie {
+		if sentimentWeights[sa.Neutral] == 0 {
+			tiedWeight := sentimentWeights[sa.Negative] + sentimentWeights[sa.Positive]
+			return sa.Neutral, (sentimentConfidences[sa.Negative] + sentimentConfidences[sa.Positive]) / tiedWeight
+		}
+		winner = sa.Neutral
+	}
+	return winner, sentimentConfidences[winner] / totalWeight
+}
+
+// weightedAverage spreads each member's remaining confidence evenly over the
+// other sentiments, averages the scores by weight and picks the highest.
+func weightedAverage(votes []vote) (sa.Sentiment, float32) {
+	totalWeight := float32(0)
+	scores := map[sa.Sentiment]float32{}
+	for _, v := range votes {
+		totalWeight += v.weight
+		for _, sentiment := range []sa.Sentiment{sa.Positive, sa.Negative, sa.Neutral} {
+			if sentiment == v.sentiment {
+				scores[sentiment] += v.weight * v.confidence
+			} else {
+				scores[sentiment] += v.weight * (1 - v.confidence) / 2
+			}
+		}
+	}
+	if totalWeight == 0 {
+		return sa.Neutral, 0
+	}
+
+	winner := sa.Neutral
+	for _, sentiment := range []sa.Sentiment{sa.Negative, sa.Positive} {
+		if scores[sentiment] > scores[winner] {
+			winner = sentiment
+		}
+	}
+	return winner, scores[winner] / totalWeight
+}
+
+func weight(member Member) float32 {
+	if member.Weight <= 0 {
+		return 1
+	}
+	return member.Weight
+}
+
+func normalize(text string) string {
+	return strings.ToLower(strings.Join(strings.Fields(text), " "))
+}
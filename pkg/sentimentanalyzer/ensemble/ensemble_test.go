@@ -0,0 +1,219 @@
+package ensemble
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	sa "github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer"
+)
+
+type fakeAnalyzer struct {
+	analysis *sa.Analysis
+	err      error
+	delay    time.Duration
+}
+
+func (f fakeAnalyzer) AnalyzeSentiment(ctx context.Context, text string) (*sa.Analysis, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(f.delay):
+	}
+	return f.analysis, f.err
+}
+
+func analyzer(sentiment sa.Sentiment, confidence float32, sentences ...sa.SentenceAnalysis) fakeAnalyzer {
+	return fakeAnalyzer{analysis: &sa.Analysis{
+		Sentiment:        sentiment,
+		Confidence:       confidence,
+		SentenceAnalyses: sentences,
+	}}
+}
+
+func TestAnalyzeSentiment(t *testing.T) {
+	testCases := []struct {
+		name               string
+		strategy           Strategy
+		members            []Member
+		expectedSentiment  sa.Sentiment
+		expectedConfidence float32
+		expectedProviders  []string
+	}{
+		{
+			name:     "majority_overrules_false_positive",
+			strategy: MajorityVote,
+			members: []Member{
+				{Name: "a", Analyzer: analyzer(sa.Negative, 0.9)},
+				{Name: "b", Analyzer: analyzer(sa.Neutral, 0.8)},
+				{Name: "c", Analyzer: analyzer(sa.Neutral, 0.6)},
+			},
+			expectedSentiment:  sa.Neutral,
+			expectedConfidence: (0.8 + 0.6) / 3,
+			expectedProviders:  []string{"a", "b", "c"},
+		},
+		{
+			name:     "majority_tie_goes_to_neutral",
+			strategy: MajorityVote,
+			members: []Member{
+				{Name: "a", Analyzer: analyzer(sa.Negative, 0.9)},
+				{Name: "b", Analyzer: analyzer(sa.Neutral, 0.8)},
+			},
+			expectedSentiment:  sa.Neutral,
+			expectedConfidence: 0.4,
+			expectedProviders:  []string{"a", "b"},
+		},
+		{
+			name:     "majority_positive_negative_tie_goes_to_neutral",
+			strategy: MajorityVote,
+			members: []Member{
+				{Name: "a", Analyzer: analyzer(sa.Negative, 0.9)},
+				{Name: "b", Analyzer: analyzer(sa.Positive, 0.8)},
+			},
+			expectedSentiment:  sa.Neutral,
+			expectedConfidence: (0.9 + 0.8) / 2,
+			expectedProviders:  []string{"a", "b"},
+		},
+		{
+			name:     "majority_weighted_positive_negative_tie",
+			strategy: MajorityVote,
+			members: []Member{
+				{Name: "a", Analyzer: analyzer(sa.Negative, 0.9), Weight: 2},
+				{Name: "b", Analyzer: analyzer(sa.Positive, 0.6)},
+				{Name: "c", Analyzer: analyzer(sa.Positive, 0.6)},
+			},
+			expectedSentiment:  sa.Neutral,
+			expectedConfidence: (2*0.9 + 0.6 + 0.6) / 4,
+			expectedProviders:  []string{"a", "b", "c"},
+		},
+		{
+			name:     "majority_tie_below_winner",
+			strategy: MajorityVote,
+			members: []Member{
+				{Name: "a", Analyzer: analyzer(sa.Negative, 0.9)},
+				{Name: "b", Analyzer: analyzer(sa.Positive, 0.8)},
+				{Name: "c", Analyzer: analyzer(sa.Neutral, 0.6), Weight: 0.5},
+				{Name: "d", Analyzer: analyzer(sa.Positive, 0.6)},
+			},
+			expectedSentiment:  sa.Positive,
+			expectedConfidence: (0.8 + 0.6) / 3.5,
+			expectedProviders:  []string{"a", "b", "c", "d"},
+		},
+		{
+			name:     "majority_weighted",
+			strategy: MajorityVote,
+			members: []Member{
+				{Name: "a", Analyzer: analyzer(sa.Negative, 1), Weight: 3},
+				{Name: "b", Analyzer: analyzer(sa.Neutral, 1)},
+			},
+			expectedSentiment:  sa.Negative,
+			expectedConfidence: 0.75,
+			expectedProviders:  []string{"a", "b"},
+		},
+		{
+			name:     "weighted_average",
+			strategy: WeightedAverage,
+			members: []Member{
+				{Name: "a", Analyzer: analyzer(sa.Negative, 0.5)},
+				{Name: "b", Analyzer: analyzer(sa.Positive, 0.9)},
+			},
+			expectedSentiment:  sa.Positive,
+			expectedConfidence: (0.25 + 0.9) / 2,
+			expectedProviders:  []string{"a", "b"},
+		},
+		{
+			name:     "failed_member_left_out",
+			strategy: MajorityVote,
+			members: []Member{
+				{Name: "a", Analyzer: fakeAnalyzer{err: fmt.Errorf("throttled")}},
+				{Name: "b", Analyzer: analyzer(sa.Positive, 0.9)},
+			},
+			expectedSentiment:  sa.Positive,
+			expectedConfidence: 0.9,
+			expectedProviders:  []string{"b"},
+		},
+		{
+			name:     "slow_member_left_out",
+			strategy: MajorityVote,
+			members: []Member{
+				{Name: "a", Analyzer: analyzer(sa.Positive, 0.9)},
+				{Name: "b", Analyzer: fakeAnalyzer{delay: time.Minute}},
+			},
+			expectedSentiment:  sa.Positive,
+			expectedConfidence: 0.9,
+			expectedProviders:  []string{"a"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			svc := NewSentimentService(
+				testCase.members,
+				WithStrategy(testCase.strategy),
+				WithTimeout(50*time.Millisecond),
+			)
+			actual, err := svc.AnalyzeSentiment(context.Background(), "text")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if actual.Sentiment != testCase.expectedSentiment {
+				t.Fatalf("Expected %s, got %s", testCase.expectedSentiment, actual.Sentiment)
+			}
+			if diff := actual.Confidence - testCase.expectedConfidence; diff > 0.001 || diff < -0.001 {
+				t.Fatalf("Expected confidence %f, got %f", testCase.expectedConfidence, actual.Confidence)
+			}
+			if !reflect.DeepEqual(actual.Providers, testCase.expectedProviders) {
+				t.Fatalf("Expected providers %v, got %v", testCase.expectedProviders, actual.Providers)
+			}
+		})
+	}
+}
+
+func TestAnalyzeSentimentSentences(t *testing.T) {
+	members := []Member{
+		{Name: "a", Analyzer: analyzer(
+			sa.Neutral, 0.9,
+			sa.SentenceAnalysis{Text: "Kill the process.", Sentiment: sa.Negative, Confidence: 0.9},
+			sa.SentenceAnalysis{Text: "This is rubbish.", Sentiment: sa.Negative, Confidence: 0.9},
+		)},
+		{Name: "b", Analyzer: analyzer(
+			sa.Neutral, 0.9,
+			sa.SentenceAnalysis{Text: "kill the  process.", Sentiment: sa.Neutral, Confidence: 0.9},
+			sa.SentenceAnalysis{Text: "This is rubbish.", Sentiment: sa.Negative, Confidence: 0.9, SuggestedRewrite: "This needs work."},
+		)},
+		{Name: "c", Analyzer: analyzer(
+			sa.Neutral, 0.9,
+			sa.SentenceAnalysis{Text: "Kill the process.", Sentiment: sa.Neutral, Confidence: 0.9},
+		)},
+	}
+
+	actual, err := NewSentimentService(members).AnalyzeSentiment(context.Background(), "text")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(actual.SentenceAnalyses) != 2 {
+		t.Fatalf("Expected 2 sentences, got %d", len(actual.SentenceAnalyses))
+	}
+	if actual.SentenceAnalyses[0].Sentiment != sa.Neutral {
+		t.Fatalf("Expected the false positive to be outvoted, got %s", actual.SentenceAnalyses[0].Sentiment)
+	}
+	if actual.SentenceAnalyses[1].Sentiment != sa.Negative || actual.SentenceAnalyses[1].SuggestedRewrite != "This needs work." {
+		t.Fatalf("Unexpected second sentence: %+v", actual.SentenceAnalyses[1])
+	}
+}
+
+func TestAnalyzeSentimentQuorum(t *testing.T) {
+	members := []Member{
+		{Name: "a", Analyzer: fakeAnalyzer{err: fmt.Errorf("unavailable")}},
+		{Name: "b", Analyzer: analyzer(sa.Positive, 0.9)},
+	}
+
+	_, err := NewSentimentService(members, WithQuorum(2)).AnalyzeSentiment(context.Background(), "text")
+	if err == nil {
+		t.Fatalf("Expected error when quorum is not met")
+	}
+}
@@ -0,0 +1,256 @@
+// Package google is a sentiment provider for the Google Cloud Natural
+// Language API.
+package google
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	sa "github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer"
+)
+
+const (
+	defaultEndpoint  string        = "https://language.googleapis.com"
+	defaultTimeout   time.Duration = 30 * time.Second
+	defaultThreshold float32       = 0.25
+	// tokenFileTTL is how long a token read from a file is used before the
+	// file is read again.
+	tokenFileTTL time.Duration = time.Minute
+)
+
+// SentimentService is the Natural Language API.
+type SentimentService struct {
+	endpoint    string
+	apiKey      string
+	tokenSource oauth2.TokenSource
+	threshold   float32
+	httpClient  *http.Client
+}
+
+// Option configures optional settings of the SentimentService.
+type Option func(*SentimentService)
+
+// WithEndpoint overrides the Natural Language API endpoint.
+func WithEndpoint(endpoint string) Option {
+	return func(s *SentimentService) {
+		s.endpoint = strings.TrimRight(endpoint, "/")
+	}
+}
+
+// WithAccessToken authenticates with an OAuth2 access token, such as from a
+// service account, instead of an API key.
+func WithAccessToken(accessToken string) Option {
+	return func(s *SentimentService) {
+		s.tokenSource = oauth2.StaticTokenSource(&oauth2.Token{AccessToken: accessToken})
+	}
+}
+
+// WithAccessTokenFile authenticates with the OAuth2 access token in the file,
+// which is read again every minute, so that a token that an agent refreshes
+// before it expires keeps working.
+func WithAccessTokenFile(path string) Option {
+	return func(s *SentimentService) {
+		s.tokenSource = oauth2.ReuseTokenSource(nil, fileTokenSource{path: path})
+	}
+}
+
+// fileTokenSource reads the access token from a file.
+type fileTokenSource struct {
+	path string
+}
+
+// Token reads the access token from the file.
+func (f fileTokenSource) Token() (*oauth2.Token, error) {
+	data, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading access token file: %w", err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return nil, fmt.Errorf("access token file %s is empty", f.path)
+	}
+	return &oauth2.Token{AccessToken: token, Expiry: time.Now().Add(tokenFileTTL)}, nil
+}
+
+// WithThreshold sets the absolute score at which text is no longer considered
+// neutral.
+func WithThreshold(threshold float32) Option {
+	return func(s *SentimentService) {
+		s.threshold = threshold
+	}
+}
+
+// WithHTTPClient sets the HTTP client used for all calls to the API.
+func WithHTTPClient(client *http.Client) Option {
+	return func(s *SentimentService) {
+		s.httpClient = client
+	}
+}
+
+// WithTimeout sets the timeout of the default HTTP client.
+func WithTimeout(timeout time.Duration) Option {
+	return func(s *SentimentService) {
+		s.httpClient = &http.Client{Timeout: timeout}
+	}
+}
+
+type document struct {
+	Type    string `json:"type"`
+	Content string `json:"content"`
+}
+
+type analyzeSentimentRequest struct {
+	Document     document `json:"document"`
+	EncodingType string   `json:"encodingType"`
+}
+
+type sentiment struct {
+	Magnitude float32 `json:"magnitude"`
+	Score     float32 `json:"score"`
+}
+
+type textSpan struct {
+	Content     string `json:"content"`
+	BeginOffset int    `json:"beginOffset"`
+}
+
+type sentence struct {
+	Text      textSpan  `json:"text"`
+	Sentiment sentiment `json:"sentiment"`
+}
+
+type analyzeSentimentResponse struct {
+	DocumentSentiment *sentiment `json:"documentSentiment"`
+	Language          string     `json:"language"`
+	Sentences         []sentence `json:"sentences"`
+}
+
+type errorResponse struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+	} `json:"error"`
+}
+
+// NewSentimentService creates a Natural Language provider authenticated
+// with the API key.
+func NewSentimentService(apiKey string, opts ...Option) *SentimentService {
+	svc := &SentimentService{
+		endpoint:   defaultEndpoint,
+		apiKey:     apiKey,
+		threshold:  defaultThreshold,
+		httpClient: &http.Client{Timeout: defaultTimeout},
+	}
+	for _, opt := range opts {
+		opt(svc)
+	}
+	return svc
+}
+
+// AnalyzeSentiment calls analyzeSentiment for the text. Google scores range
+// from -1 to 1, so scores within the threshold of 0 are neutral. Confidence
+// is the absolute score for positive and negative results, and how close the
+// score is to 0 for neutral ones.
+func (s SentimentService) AnalyzeSentiment(ctx context.Context, text string) (*sa.Analysis, error) {
+	payload, err := json.Marshal(analyzeSentimentRequest{
+		Document:     document{Type: "PLAIN_TEXT", Content: text},
+		EncodingType: "UTF8",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating analyzeSentiment request: %w", err)
+	}
+
+	analyzeURL := fmt.Sprintf("%s/v1/documents:analyzeSentiment", s.endpoint)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, analyzeURL, bytes.NewBuffer(payload))
+	if err != nil {
+		return nil, fmt.Errorf("error creating new request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.tokenSource != nil {
+		token, err := s.tokenSource.Token()
+		if err != nil {
+			return nil, fmt.Errorf("error getting access token: %w", err)
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token.AccessToken))
+	} else {
+		// In a header rather than the query, so that the key is not in the
+		// URL that errors of the call include.
+		req.Header.Set("X-Goog-Api-Key", s.apiKey)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error calling Natural Language API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading Natural Language API response: %w", err)
+	}
+	if resp.StatusCode >= 400 {
+		errResp := errorResponse{}
+		if err := json.Unmarshal(body, &errResp); err == nil && errResp.Error.Message != "" {
+			return nil, fmt.Errorf(
+				"unexpected status from Natural Language API: HTTP %d: %s: %s",
+				resp.StatusCode,
+				errResp.Error.Status,
+				errResp.Error.Message,
+			)
+		}
+		return nil, fmt.Errorf("unexpected status from Natural Language API: HTTP %d", resp.StatusCode)
+	}
+
+	result := analyzeSentimentResponse{}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("error unmarshalling analyzeSentiment response: %w", err)
+	}
+	if result.DocumentSentiment == nil {
+		return nil, fmt.Errorf("unexpectedly no analysis returned")
+	}
+
+	resultSentiment, resultConfidence := s.fromScore(result.DocumentSentiment.Score)
+	analysis := &sa.Analysis{
+		Sentiment:        resultSentiment,
+		Confidence:       resultConfidence,
+		SentenceAnalyses: []sa.SentenceAnalysis{},
+	}
+	for _, sentence := range result.Sentences {
+		sentenceSentiment, sentenceConfidence := s.fromScore(sentence.Sentiment.Score)
+		analysis.SentenceAnalyses = append(analysis.SentenceAnalyses, sa.SentenceAnalysis{
+			Text:       sentence.Text.Content,
+			Sentiment:  sentenceSentiment,
+			Confidence: sentenceConfidence,
+		})
+	}
+
+	return analysis, nil
+}
+
+func (s SentimentService) fromScore(score float32) (sa.Sentiment, float32) {
+	absScore := score
+	if absScore < 0 {
+		absScore = -absScore
+	}
+	if absScore > 1 {
+		absScore = 1
+	}
+
+	switch {
+	case score >= s.threshold:
+		return sa.Positive, absScore
+	case score <= -s.threshold:
+		return sa.Negative, absScore
+	default:
+		return sa.Neutral, 1 - absScore
+	}
+}
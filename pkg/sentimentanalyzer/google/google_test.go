@@ -0,0 +1,167 @@
+package google
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	sa "github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer"
+)
+
+func newRecordedServer(t *testing.T, status int, responseFile string, checkAuth func(*http.Request)) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/documents:analyzeSentiment" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		checkAuth(r)
+
+		analyzeReq := analyzeSentimentRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&analyzeReq); err != nil || analyzeReq.Document.Type != "PLAIN_TEXT" {
+			t.Errorf("Unexpected request: %+v (%v)", analyzeReq, err)
+		}
+
+		response, err := ioutil.ReadFile(filepath.Join("testdata", responseFile))
+		if err != nil {
+			t.Fatalf("Unexpected error reading recorded response: %v", err)
+		}
+		w.WriteHeader(status)
+		// nolint: errcheck
+		w.Write(response)
+	}))
+}
+
+func TestAnalyzeSentiment(t *testing.T) {
+	server := newRecordedServer(t, http.StatusOK, "analyze_sentiment.json", func(r *http.Request) {
+		if r.Header.Get("X-Goog-Api-Key") != "apikey" || r.URL.RawQuery != "" {
+			t.Errorf("Expected API key in header, got '%s' and query '%s'", r.Header.Get("X-Goog-Api-Key"), r.URL.RawQuery)
+		}
+	})
+	defer server.Close()
+
+	analysis, err := NewSentimentService("apikey", WithEndpoint(server.URL)).AnalyzeSentiment(context.Background(), "text")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if analysis.Sentiment != sa.Neutral {
+		t.Fatalf("Expected Neutral, got %s", analysis.Sentiment)
+	}
+	if analysis.Confidence < 0.89 || analysis.Confidence > 0.91 {
+		t.Fatalf("Expected neutral confidence 0.9, got %f", analysis.Confidence)
+	}
+	expected := []sa.Sentiment{sa.Positive, sa.Negative, sa.Neutral}
+	if len(analysis.SentenceAnalyses) != len(expected) {
+		t.Fatalf("Expected %d sentences, got %d", len(expected), len(analysis.SentenceAnalyses))
+	}
+	for i, sentence := range analysis.SentenceAnalyses {
+		if sentence.Sentiment != expected[i] {
+			t.Fatalf("Expected sentence %d to be %s, got %s", i, expected[i], sentence.Sentiment)
+		}
+	}
+	if len(analysis.NegativeSentences()) != 1 || analysis.NegativeSentences()[0].Confidence < 0.79 {
+		t.Fatalf("Unexpected negative sentences: %+v", analysis.NegativeSentences())
+	}
+}
+
+func TestAnalyzeSentimentAccessToken(t *testing.T) {
+	server := newRecordedServer(t, http.StatusOK, "analyze_sentiment.json", func(r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" || r.Header.Get("X-Goog-Api-Key") != "" {
+			t.Errorf("Expected bearer token only, got '%s' '%s'", r.Header.Get("Authorization"), r.URL.RawQuery)
+		}
+	})
+	defer server.Close()
+
+	svc := NewSentimentService("", WithEndpoint(server.URL), WithAccessToken("token"))
+	if _, err := svc.AnalyzeSentiment(context.Background(), "text"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestAnalyzeSentimentAccessTokenFile(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := ioutil.WriteFile(tokenFile, []byte("first\n"), 0o600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	server := newRecordedServer(t, http.StatusOK, "analyze_sentiment.json", func(r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer first" || r.Header.Get("X-Goog-Api-Key") != "" {
+			t.Errorf("Expected bearer token only, got '%s' '%s'", r.Header.Get("Authorization"), r.URL.RawQuery)
+		}
+	})
+	defer server.Close()
+
+	svc := NewSentimentService("", WithEndpoint(server.URL), WithAccessTokenFile(tokenFile))
+	if _, err := svc.AnalyzeSentiment(context.Background(), "text"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// A refreshed token is read once the previous one is due for renewal.
+	if err := ioutil.WriteFile(tokenFile, []byte("second"), 0o600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	token, err := fileTokenSource{path: tokenFile}.Token()
+	if err != nil || token.AccessToken != "second" || !token.Expiry.After(time.Now()) {
+		t.Fatalf("Unexpected token %+v: %v", token, err)
+	}
+
+	if err := ioutil.WriteFile(tokenFile, nil, 0o600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := (fileTokenSource{path: tokenFile}).Token(); err == nil {
+		t.Fatalf("Expected an error for an empty token file")
+	}
+}
+
+func TestAnalyzeSentimentError(t *testing.T) {
+	server := newRecordedServer(t, http.StatusBadRequest, "invalid_argument.json", func(r *http.Request) {})
+	defer server.Close()
+
+	_, err := NewSentimentService("apikey", WithEndpoint(server.URL)).AnalyzeSentiment(context.Background(), "text")
+	if err == nil || !strings.Contains(err.Error(), "INVALID_ARGUMENT") {
+		t.Fatalf("Expected error with status, got %v", err)
+	}
+}
+
+func TestAnalyzeSentimentTransportErrorHidesKey(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Close()
+
+	_, err := NewSentimentService("secret-api-key", WithEndpoint(server.URL)).AnalyzeSentiment(context.Background(), "text")
+	if err == nil || strings.Contains(err.Error(), "secret-api-key") {
+		t.Fatalf("Expected an error without the API key, got %v", err)
+	}
+}
+
+func TestFromScore(t *testing.T) {
+	testCases := []struct {
+		name               string
+		score              float32
+		expectedSentiment  sa.Sentiment
+		expectedConfidence float32
+	}{
+		{name: "strongly_positive", score: 0.8, expectedSentiment: sa.Positive, expectedConfidence: 0.8},
+		{name: "threshold_positive", score: 0.25, expectedSentiment: sa.Positive, expectedConfidence: 0.25},
+		{name: "neutral", score: 0, expectedSentiment: sa.Neutral, expectedConfidence: 1},
+		{name: "slightly_negative", score: -0.2, expectedSentiment: sa.Neutral, expectedConfidence: 0.8},
+		{name: "negative", score: -0.6, expectedSentiment: sa.Negative, expectedConfidence: 0.6},
+	}
+
+	svc := NewSentimentService("")
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			sentiment, confidence := svc.fromScore(testCase.score)
+			if sentiment != testCase.expectedSentiment {
+				t.Fatalf("Expected %s, got %s", testCase.expectedSentiment, sentiment)
+			}
+			if confidence < testCase.expectedConfidence-0.001 || confidence > testCase.expectedConfidence+0.001 {
+				t.Fatalf("Expected confidence %f, got %f", testCase.expectedConfidence, confidence)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package sentimentanalyzer
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	htmlCommentRegex = regexp.MustCompile(`(?s)<!--.*?-->`)
+	codeFenceRegex   = regexp.MustCompile("^ {0,3}(```|~~~)")
+)
+
+// NormalizeComment removes the parts of a markdown comment that carry no
+// sentiment, which are fenced code blocks and HTML comments, and normalizes
+// the whitespace. Comments that only differ in those parts normalize to the
+// same text.
+func NormalizeComment(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = htmlCommentRegex.ReplaceAllString(text, "")
+
+	lines := []string{}
+	fence := ""
+	blank := false
+	for _, line := range strings.Split(text, "\n") {
+		if match := codeFenceRegex.FindStringSubmatch(line); match != nil {
+			if fence == "" {
+				// A removed block still separates the text around it.
+				fence = match[1]
+				blank = len(lines) > 0
+				continue
+			}
+			if match[1] == fence {
+				fence = ""
+				continue
+			}
+		}
+		if fence != "" {
+			continue
+		}
+
+		line = strings.Join(strings.Fields(line), " ")
+		if line == "" {
+			blank = len(lines) > 0
+			continue
+		}
+		if blank {
+			lines = append(lines, "")
+			blank = false
+		}
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,55 @@
+package sentimentanalyzer
+
+import "testing"
+
+func TestNormalizeComment(t *testing.T) {
+	testCases := []struct {
+		name     string
+		text     string
+		expected string
+	}{
+		{
+			name:     "whitespace",
+			text:     "  LGTM  \r\n\r\n\r\n  thanks   a lot ",
+			expected: "LGTM\n\nthanks a lot",
+		},
+		{
+			name:     "code_block",
+			text:     "This fails:\n\n```go\nfunc main() {\n\tpanic(\"die\")\n}\n```\n\nAny ideas?",
+			expected: "This fails:\n\nAny ideas?",
+		},
+		{
+			name:     "nested_fence",
+			text:     "Before\n~~~\n```\ncode\n~~~\nAfter",
+			expected: "Before\n\nAfter",
+		},
+		{
+			name:     "unterminated_code_block",
+			text:     "Output:\n```\nkill -9 1234",
+			expected: "Output:",
+		},
+		{
+			name:     "html_comment",
+			text:     "Thanks!<!-- template\nplease fill in -->\n",
+			expected: "Thanks!",
+		},
+		{
+			name:     "only_code",
+			text:     "```\nrm -rf build\n```",
+			expected: "",
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			actual := NormalizeComment(testCase.text)
+			if actual != testCase.expected {
+				t.Fatalf("Expected '%s', got '%s'", testCase.expected, actual)
+			}
+			if NormalizeComment(actual) != actual {
+				t.Fatalf("Normalizing '%s' again changed it", actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,289 @@
+// Package openai is a sentiment provider for any OpenAI-compatible chat
+// completions endpoint, such as a local llama.cpp or vLLM server.
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	sa "github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer"
+)
+
+const defaultTimeout time.Duration = 60 * time.Second
+
+const systemPrompt string = `You analyze the sentiment of comments left on GitHub issues and pull requests.
+Split the comment into sentences and classify the comment as a whole and each sentence as "positive", "negative" or "neutral", with a confidence between 0 and 1.
+Technical language such as "kill the process" or "this test fails" is neutral unless the author is being negative towards people.
+Also score the whole comment from 0 to 1 for each kind of incivility: insult, profanity, identity_attack, threat and dismissiveness. A comment can be negative without being uncivil.
+Respond only with a JSON object of the form:
+{"sentiment": "neutral", "confidence": 0.9, "sentences": [{"text": "...", "sentiment": "neutral", "confidence": 0.9%s}], "toxicity": {"insult": 0, "profanity": 0, "identity_attack": 0, "threat": 0, "dismissiveness": 0}}`
+
+const rewriteInstruction string = `, "suggested_rewrite": "..."`
+
+const rewritePrompt string = `
+For every negative sentence, set suggested_rewrite to a more constructive way of saying the same thing that keeps its technical meaning. Leave suggested_rewrite empty for other sentences.`
+
+// SentimentService is a chat completions endpoint.
+type SentimentService struct {
+	endpoint        string
+	model           string
+	key             string
+	httpClient      *http.Client
+	suggestRewrites bool
+}
+
+// Option configures optional settings of the SentimentService.
+type Option func(*SentimentService)
+
+// WithHTTPClient sets the HTTP client used for all calls to the endpoint.
+func WithHTTPClient(client *http.Client) Option {
+	return func(s *SentimentService) {
+		s.httpClient = client
+	}
+}
+
+// WithTimeout sets the timeout of the default HTTP client.
+func WithTimeout(timeout time.Duration) Option {
+	return func(s *SentimentService) {
+		s.httpClient = &http.Client{Timeout: timeout}
+	}
+}
+
+// WithSuggestedRewrites asks the model to suggest a rewrite for each negative
+// sentence.
+func WithSuggestedRewrites(suggestRewrites bool) Option {
+	return func(s *SentimentService) {
+		s.suggestRewrites = suggestRewrites
+	}
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type responseFormat struct {
+	Type string `json:"type"`
+}
+
+type chatRequest struct {
+	Model          string          `json:"model"`
+	Messages       []chatMessage   `json:"messages"`
+	Temperature    float32         `json:"temperature"`
+	ResponseFormat *responseFormat `json:"response_format,omitempty"`
+}
+
+type chatResponse struct {
+	Choices []struct {
+		Message chatMessage `json:"message"`
+	} `json:"choices"`
+}
+
+type errorResponse struct {
+	Error struct {
+		Message string      `json:"message"`
+		Type    string      `json:"type"`
+		Code    interface{} `json:"code"`
+	} `json:"error"`
+}
+
+type sentenceResult struct {
+	Text             string  `json:"text"`
+	Sentiment        string  `json:"sentiment"`
+	Confidence       float32 `json:"confidence"`
+	SuggestedRewrite string  `json:"suggested_rewrite"`
+}
+
+type analysisResult struct {
+	Sentiment  string             `json:"sentiment"`
+	Confidence float32            `json:"confidence"`
+	Sentences  []sentenceResult   `json:"sentences"`
+	Toxicity   map[string]float32 `json:"toxicity"`
+}
+
+var toxicityNames = map[sa.ToxicityCategory]string{
+	sa.Insult:         "insult",
+	sa.Profanity:      "profanity",
+	sa.IdentityAttack: "identity_attack",
+	sa.Threat:         "threat",
+	sa.Dismissiveness: "dismissiveness",
+}
+
+// NewSentimentService creates a provider for the chat completions API at
+// endpoint, which is the API base URL such as http://localhost:8000/v1. The
+// key is optional as local servers usually do not require one.
+func NewSentimentService(endpoint, model, key string, opts ...Option) *SentimentService {
+	svc := &SentimentService{
+		endpoint:   strings.TrimRight(endpoint, "/"),
+		model:      model,
+		key:        key,
+		httpClient: &http.Client{Timeout: defaultTimeout},
+	}
+	for _, opt := range opts {
+		opt(svc)
+	}
+	return svc
+}
+
+// AnalyzeSentiment asks the model for a structured sentiment analysis of the
+// text.
+func (s SentimentService) AnalyzeSentiment(ctx context.Context, text string) (*sa.Analysis, error) {
+	content, err := s.complete(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+
+	result := analysisResult{}
+	if err := json.Unmarshal([]byte(extractJSON(content)), &result); err != nil {
+		return nil, fmt.Errorf("error unmarshalling model response: %w", err)
+	}
+
+	resultSentiment, err := sentimentFromString(result.Sentiment)
+	if err != nil {
+		return nil, err
+	}
+	analysis := &sa.Analysis{
+		Sentiment:        resultSentiment,
+		Confidence:       clampConfidence(result.Confidence),
+		SentenceAnalyses: []sa.SentenceAnalysis{},
+	}
+	for _, sentence := range result.Sentences {
+		sentenceSentiment, err := sentimentFromString(sentence.Sentiment)
+		if err != nil {
+			return nil, err
+		}
+		sentenceAnalysis := sa.SentenceAnalysis{
+			Text:       strings.TrimSpace(sentence.Text),
+			Sentiment:  sentenceSentiment,
+			Confidence: clampConfidence(sentence.Confidence),
+		}
+		if s.suggestRewrites && sentenceSentiment == sa.Negative {
+			sentenceAnalysis.SuggestedRewrite = strings.TrimSpace(sentence.SuggestedRewrite)
+		}
+		analysis.SentenceAnalyses = append(analysis.SentenceAnalyses, sentenceAnalysis)
+	}
+
+	// Toxicity is only kept when the model scored every category, otherwise
+	// it is left for the local classifier.
+	toxicity := []sa.ToxicityScore{}
+	for _, category := range sa.ToxicityCategories {
+		score, ok := result.Toxicity[toxicityNames[category]]
+		if !ok {
+			toxicity = nil
+			break
+		}
+		toxicity = append(toxicity, sa.ToxicityScore{
+			Category: category,
+			Score:    clampConfidence(score),
+		})
+	}
+	analysis.Toxicity = toxicity
+
+	return analysis, nil
+}
+
+// complete sends the chat completion request and returns the content of the
+// first choice.
+func (s SentimentService) complete(ctx context.Context, text string) (string, error) {
+	prompt := fmt.Sprintf(systemPrompt, "")
+	if s.suggestRewrites {
+		prompt = fmt.Sprintf(systemPrompt, rewriteInstruction) + rewritePrompt
+	}
+
+	payload, err := json.Marshal(chatRequest{
+		Model: s.model,
+		Messages: []chatMessage{
+			{Role: "system", Content: prompt},
+			{Role: "user", Content: text},
+		},
+		ResponseFormat: &responseFormat{Type: "json_object"},
+	})
+	if err != nil {
+		return "", fmt.Errorf("error creating chat request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		fmt.Sprintf("%s/chat/completions", s.endpoint),
+		bytes.NewBuffer(payload),
+	)
+	if err != nil {
+		return "", fmt.Errorf("error creating new request: %w", err)
+	}
+	req.Header.Add("Content-Type", "application/json")
+	if s.key != "" {
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", s.key))
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error calling chat completions: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("error reading chat completions response: %w", err)
+	}
+	if resp.StatusCode >= 400 {
+		errResp := errorResponse{}
+		if err := json.Unmarshal(body, &errResp); err == nil && errResp.Error.Message != "" {
+			return "", fmt.Errorf(
+				"unexpected status from chat completions: HTTP %d: %s",
+				resp.StatusCode,
+				errResp.Error.Message,
+			)
+		}
+		return "", fmt.Errorf("unexpected status from chat completions: HTTP %d", resp.StatusCode)
+	}
+
+	completion := chatResponse{}
+	if err := json.Unmarshal(body, &completion); err != nil {
+		return "", fmt.Errorf("error unmarshalling chat completions response: %w", err)
+	}
+	if len(completion.Choices) == 0 {
+		return "", fmt.Errorf("unexpectedly no choices returned")
+	}
+	return completion.Choices[0].Message.Content, nil
+}
+
+// extractJSON returns the JSON object in the model output. Models that do not
+// support JSON mode tend to wrap the object in prose or a code fence.
+func extractJSON(content string) string {
+	start := strings.Index(content, "{")
+	end := strings.LastIndex(content, "}")
+	if start < 0 || end < start {
+		return content
+	}
+	return content[start : end+1]
+}
+
+func sentimentFromString(rawSentiment string) (sa.Sentiment, error) {
+	switch strings.ToLower(strings.TrimSpace(rawSentiment)) {
+	case "positive":
+		return sa.Positive, nil
+	case "negative":
+		return sa.Negative, nil
+	case "neutral", "mixed":
+		return sa.Neutral, nil
+	default:
+		return sa.Neutral, fmt.Errorf("unknown sentiment from model: '%s'", rawSentiment)
+	}
+}
+
+func clampConfidence(confidence float32) float32 {
+	if confidence < 0 {
+		return 0
+	}
+	if confidence > 1 {
+		return 1
+	}
+	return confidence
+}
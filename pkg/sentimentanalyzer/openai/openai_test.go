@@ -0,0 +1,157 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	sa "github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer"
+)
+
+func newChatServer(t *testing.T, content string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		chatReq := chatRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&chatReq); err != nil {
+			t.Errorf("Unexpected error decoding request: %v", err)
+		}
+		if chatReq.Model != "test-model" || len(chatReq.Messages) != 2 {
+			t.Errorf("Unexpected chat request: %+v", chatReq)
+		}
+		// nolint: errcheck
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{
+				{"message": map[string]string{"role": "assistant", "content": content}},
+			},
+		})
+	}))
+}
+
+func TestAnalyzeSentiment(t *testing.T) {
+	testCases := []struct {
+		name            string
+		content         string
+		suggestRewrites bool
+		expected        sa.Analysis
+	}{
+		{
+			name:    "json_mode",
+			content: `{"sentiment": "neutral", "confidence": 0.8, "sentences": [{"text": "Kill the process.", "sentiment": "neutral", "confidence": 0.8}]}`,
+			expected: sa.Analysis{
+				Sentiment:  sa.Neutral,
+				Confidence: 0.8,
+				SentenceAnalyses: []sa.SentenceAnalysis{
+					{Text: "Kill the process.", Sentiment: sa.Neutral, Confidence: 0.8},
+				},
+			},
+		},
+		{
+			name:            "code_fence_with_rewrite",
+			suggestRewrites: true,
+			content: "Here you go:\n```json\n" +
+				`{"sentiment": "negative", "confidence": 1.2, "sentences": [{"text": "This is garbage.", "sentiment": "negative", "confidence": 0.95, "suggested_rewrite": "This needs more work."}]}` +
+				"\n```",
+			expected: sa.Analysis{
+				Sentiment:  sa.Negative,
+				Confidence: 1,
+				SentenceAnalyses: []sa.SentenceAnalysis{
+					{
+						Text:             "This is garbage.",
+						Sentiment:        sa.Negative,
+						Confidence:       0.95,
+						SuggestedRewrite: "This needs more work.",
+					},
+				},
+			},
+		},
+		{
+			name:    "rewrite_ignored_when_disabled",
+			content: `{"sentiment": "negative", "confidence": 0.9, "sentences": [{"text": "This is garbage.", "sentiment": "negative", "confidence": 0.9, "suggested_rewrite": "This needs more work."}]}`,
+			expected: sa.Analysis{
+				Sentiment:  sa.Negative,
+				Confidence: 0.9,
+				SentenceAnalyses: []sa.SentenceAnalysis{
+					{Text: "This is garbage.", Sentiment: sa.Negative, Confidence: 0.9},
+				},
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			server := newChatServer(t, testCase.content)
+			defer server.Close()
+
+			svc := NewSentimentService(
+				server.URL+"/v1/",
+				"test-model",
+				"",
+				WithSuggestedRewrites(testCase.suggestRewrites),
+			)
+			actual, err := svc.AnalyzeSentiment(context.Background(), "comment")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if actual.Sentiment != testCase.expected.Sentiment || actual.Confidence != testCase.expected.Confidence {
+				t.Fatalf("Expected %+v, got %+v", testCase.expected, *actual)
+			}
+			if len(actual.SentenceAnalyses) != len(testCase.expected.SentenceAnalyses) {
+				t.Fatalf("Expected %d sentences, got %d", len(testCase.expected.SentenceAnalyses), len(actual.SentenceAnalyses))
+			}
+			for i, sentence := range actual.SentenceAnalyses {
+				if sentence != testCase.expected.SentenceAnalyses[i] {
+					t.Fatalf("Expected sentence %+v, got %+v", testCase.expected.SentenceAnalyses[i], sentence)
+				}
+			}
+		})
+	}
+}
+
+func TestAnalyzeSentimentToxicity(t *testing.T) {
+	server := newChatServer(t, `{"sentiment": "negative", "confidence": 0.9, "sentences": [], "toxicity": {"insult": 0.8, "profanity": 0.1, "identity_attack": 0, "threat": 0, "dismissiveness": 0.6}}`)
+	defer server.Close()
+
+	analysis, err := NewSentimentService(server.URL+"/v1", "test-model", "").AnalyzeSentiment(context.Background(), "comment")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(analysis.Toxicity) != len(sa.ToxicityCategories) {
+		t.Fatalf("Expected every category to be scored, got %+v", analysis.Toxicity)
+	}
+	if analysis.ToxicityScore(sa.Insult) != 0.8 || analysis.ToxicityScore(sa.Dismissiveness) != 0.6 {
+		t.Fatalf("Unexpected toxicity scores: %+v", analysis.Toxicity)
+	}
+}
+
+func TestAnalyzeSentimentInvalidSentiment(t *testing.T) {
+	server := newChatServer(t, `{"sentiment": "angry", "confidence": 0.9, "sentences": []}`)
+	defer server.Close()
+
+	_, err := NewSentimentService(server.URL+"/v1", "test-model", "").AnalyzeSentiment(context.Background(), "comment")
+	if err == nil || !strings.Contains(err.Error(), "angry") {
+		t.Fatalf("Expected unknown sentiment error, got %v", err)
+	}
+}
+
+func TestAnalyzeSentimentErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("Unexpected authorization header '%s'", r.Header.Get("Authorization"))
+		}
+		w.WriteHeader(http.StatusNotFound)
+		// nolint: errcheck
+		w.Write([]byte(`{"error": {"message": "model not found", "type": "invalid_request_error"}}`))
+	}))
+	defer server.Close()
+
+	_, err := NewSentimentService(server.URL+"/v1", "test-model", "secret").AnalyzeSentiment(context.Background(), "comment")
+	if err == nil || !strings.Contains(err.Error(), "model not found") {
+		t.Fatalf("Expected error with message, got %v", err)
+	}
+}
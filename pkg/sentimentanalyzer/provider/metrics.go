@@ -0,0 +1,28 @@
+package provider
+
+import (
+	"context"
+	"time"
+
+	"github.com/trstringer/comment-sentiment/pkg/metrics"
+	sa "github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer"
+)
+
+// instrumentedAnalyzer records the latency and the errors of a provider.
+type instrumentedAnalyzer struct {
+	analyzer sa.Analyzer
+	name     string
+}
+
+// AnalyzeSentiment analyzes the text with the provider.
+func (a instrumentedAnalyzer) AnalyzeSentiment(ctx context.Context, text string) (*sa.Analysis, error) {
+	start := time.Now()
+	analysis, err := a.analyzer.AnalyzeSentiment(ctx, text)
+	metrics.AnalyzerSeconds.WithLabelValues(a.name).Observe(time.Since(start).Seconds())
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	metrics.AnalyzerRequests.WithLabelValues(a.name, result).Inc()
+	return analysis, err
+}
@@ -0,0 +1,216 @@
+// Package provider creates sentiment analyzers by name so that the provider
+// can be picked through configuration.
+package provider
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	sa "github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer"
+	"github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer/aws"
+	"github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer/azure"
+	"github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer/bayes"
+	"github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer/ensemble"
+	"github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer/google"
+	"github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer/openai"
+)
+
+const (
+	// Azure is the Azure Cognitive Services language provider.
+	Azure string = "azure"
+	// OpenAI is the OpenAI-compatible chat completions provider.
+	OpenAI string = "openai"
+	// AWS is the Amazon Comprehend provider.
+	AWS string = "aws"
+	// Google is the Google Cloud Natural Language provider.
+	Google string = "google"
+	// Ensemble combines several of the other providers.
+	Ensemble string = "ensemble"
+	// Bayes is the local Naive Bayes model.
+	Bayes string = "bayes"
+)
+
+// Factory creates an analyzer from its section of the Config.
+type Factory func(Config) (sa.Analyzer, error)
+
+// Config holds the settings for every provider. Only the section of the
+// provider that is created needs to be filled in.
+type Config struct {
+	Azure    AzureConfig
+	OpenAI   OpenAIConfig
+	AWS      AWSConfig
+	Google   GoogleConfig
+	Ensemble EnsembleConfig
+	Bayes    BayesConfig
+}
+
+// AzureConfig is the Azure language resource.
+type AzureConfig struct {
+	Endpoint string
+	Options  []azure.Option
+}
+
+// OpenAIConfig is the chat completions endpoint and model.
+type OpenAIConfig struct {
+	Endpoint string
+	Model    string
+	Key      string
+	Options  []openai.Option
+}
+
+// AWSConfig is the Comprehend region and credentials.
+type AWSConfig struct {
+	Region      string
+	Credentials aws.Credentials
+	Options     []aws.Option
+}
+
+// GoogleConfig is the Natural Language API key, or the file of an access
+// token, which is read again as it is refreshed.
+type GoogleConfig struct {
+	APIKey    string
+	TokenFile string
+	Options   []google.Option
+}
+
+// EnsembleConfig lists the providers to combine. Weights are keyed by
+// provider name.
+type EnsembleConfig struct {
+	Providers []string
+	Weights   map[string]float32
+	Options   []ensemble.Option
+}
+
+// BayesConfig is the model file created by the train command.
+type BayesConfig struct {
+	ModelFile string
+}
+
+var factories = map[string]Factory{}
+
+func init() {
+	factories[Azure] = newAzure
+	factories[OpenAI] = newOpenAI
+	factories[AWS] = newAWS
+	factories[Google] = newGoogle
+	factories[Ensemble] = newEnsemble
+	factories[Bayes] = newBayes
+}
+
+// Register adds a provider factory to the registry, replacing any provider
+// with the same name.
+func Register(name string, factory Factory) {
+	factories[name] = factory
+}
+
+// Names returns the names of all registered providers.
+func Names() []string {
+	names := []string{}
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New creates the named provider, which records its latency and errors in
+// the analyzer metrics.
+func New(name string, config Config) (sa.Analyzer, error) {
+	factory, ok := factories[name]
+	if !ok {
+		return nil, fmt.Errorf(
+			"unknown sentiment provider %s (available: %s)",
+			name,
+			strings.Join(Names(), ", "),
+		)
+	}
+
+	analyzer, err := factory(config)
+	if err != nil {
+		return nil, fmt.Errorf("error creating %s provider: %w", name, err)
+	}
+	return instrumentedAnalyzer{analyzer: analyzer, name: name}, nil
+}
+
+func newAzure(config Config) (sa.Analyzer, error) {
+	if config.Azure.Endpoint == "" {
+		return nil, fmt.Errorf("language endpoint is required")
+	}
+	return azure.NewSentimentService(config.Azure.Endpoint, "", config.Azure.Options...), nil
+}
+
+func newOpenAI(config Config) (sa.Analyzer, error) {
+	if config.OpenAI.Endpoint == "" {
+		return nil, fmt.Errorf("chat completions endpoint is required")
+	}
+	if config.OpenAI.Model == "" {
+		return nil, fmt.Errorf("model is required")
+	}
+	return openai.NewSentimentService(
+		config.OpenAI.Endpoint,
+		config.OpenAI.Model,
+		config.OpenAI.Key,
+		config.OpenAI.Options...,
+	), nil
+}
+
+func newAWS(config Config) (sa.Analyzer, error) {
+	if config.AWS.Region == "" {
+		return nil, fmt.Errorf("region is required")
+	}
+	if config.AWS.Credentials.AccessKeyID == "" || config.AWS.Credentials.SecretAccessKey == "" {
+		return nil, fmt.Errorf("access key ID and secret access key are required")
+	}
+	return aws.NewSentimentService(
+		config.AWS.Region,
+		config.AWS.Credentials,
+		config.AWS.Options...,
+	), nil
+}
+
+func newGoogle(config Config) (sa.Analyzer, error) {
+	if config.Google.APIKey == "" && config.Google.TokenFile == "" {
+		return nil, fmt.Errorf("API key or access token file is required")
+	}
+	opts := config.Google.Options
+	if config.Google.TokenFile != "" {
+		opts = append(append([]google.Option{}, opts...), google.WithAccessTokenFile(config.Google.TokenFile))
+	}
+	return google.NewSentimentService(config.Google.APIKey, opts...), nil
+}
+
+func newEnsemble(config Config) (sa.Analyzer, error) {
+	if len(config.Ensemble.Providers) == 0 {
+		return nil, fmt.Errorf("at least one member provider is required")
+	}
+
+	members := []ensemble.Member{}
+	for _, name := range config.Ensemble.Providers {
+		if name == Ensemble {
+			return nil, fmt.Errorf("an ensemble cannot contain another ensemble")
+		}
+		analyzer, err := New(name, config)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, ensemble.Member{
+			Name:     name,
+			Analyzer: analyzer,
+			Weight:   config.Ensemble.Weights[name],
+		})
+	}
+
+	return ensemble.NewSentimentService(members, config.Ensemble.Options...), nil
+}
+
+func newBayes(config Config) (sa.Analyzer, error) {
+	if config.Bayes.ModelFile == "" {
+		return nil, fmt.Errorf("model file is required")
+	}
+	model, err := bayes.LoadFile(config.Bayes.ModelFile)
+	if err != nil {
+		return nil, err
+	}
+	return bayes.NewSentimentService(model), nil
+}
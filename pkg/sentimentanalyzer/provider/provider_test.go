@@ -0,0 +1,34 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer/google"
+)
+
+func TestNewGoogleCredentials(t *testing.T) {
+	testCases := []struct {
+		name        string
+		config      GoogleConfig
+		expectError bool
+	}{
+		{name: "api_key", config: GoogleConfig{APIKey: "key"}},
+		{name: "token_file", config: GoogleConfig{TokenFile: "token"}},
+		{name: "none", config: GoogleConfig{}, expectError: true},
+		{
+			name:        "only_options",
+			config:      GoogleConfig{Options: []google.Option{google.WithEndpoint("http://localhost")}},
+			expectError: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			_, err := New(Google, Config{Google: testCase.config})
+			if (err != nil) != testCase.expectError {
+				t.Fatalf("Expected error %t, got %v", testCase.expectError, err)
+			}
+		})
+	}
+}
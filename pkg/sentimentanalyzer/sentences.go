@@ -0,0 +1,42 @@
+package sentimentanalyzer
+
+import (
+	"strings"
+	"unicode"
+)
+
+// SplitSentences splits text into sentences for providers that only analyze
+// a document as a whole. Sentences end at terminal punctuation followed by
+// whitespace, or at a line break.
+func SplitSentences(text string) []string {
+	sentences := []string{}
+	runes := []rune(text)
+	start := 0
+
+	appendSentence := func(end int) {
+		sentence := strings.TrimSpace(string(runes[start:end]))
+		if sentence != "" {
+			sentences = append(sentences, sentence)
+		}
+		start = end
+	}
+
+	for i := 0; i < len(runes); i++ {
+		switch {
+		case runes[i] == '\n':
+			appendSentence(i + 1)
+		case runes[i] == '.' || runes[i] == '!' || runes[i] == '?':
+			end := i + 1
+			for end < len(runes) && strings.ContainsRune(".!?\"')", runes[end]) {
+				end++
+			}
+			if end == len(runes) || unicode.IsSpace(runes[end]) {
+				appendSentence(end)
+				i = end - 1
+			}
+		}
+	}
+	appendSentence(len(runes))
+
+	return sentences
+}
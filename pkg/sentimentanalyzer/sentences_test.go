@@ -0,0 +1,55 @@
+package sentimentanalyzer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitSentences(t *testing.T) {
+	testCases := []struct {
+		name     string
+		text     string
+		expected []string
+	}{
+		{
+			name:     "empty",
+			text:     "  ",
+			expected: []string{},
+		},
+		{
+			name:     "single_sentence_no_punctuation",
+			text:     "looks good to me",
+			expected: []string{"looks good to me"},
+		},
+		{
+			name:     "multiple_sentences",
+			text:     "This is great! Does it work? I think so...  Thanks.",
+			expected: []string{"This is great!", "Does it work?", "I think so...", "Thanks."},
+		},
+		{
+			name:     "line_breaks",
+			text:     "First line\n\nSecond line.",
+			expected: []string{"First line", "Second line."},
+		},
+		{
+			name:     "no_split_inside_tokens",
+			text:     "Bump to v1.2.3 in main.go please.",
+			expected: []string{"Bump to v1.2.3 in main.go please."},
+		},
+		{
+			name:     "closing_quote",
+			text:     `He said "stop." Then left.`,
+			expected: []string{`He said "stop."`, "Then left."},
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			actual := SplitSentences(testCase.text)
+			if !reflect.DeepEqual(actual, testCase.expected) {
+				t.Fatalf("Expected %q, got %q", testCase.expected, actual)
+			}
+		})
+	}
+}
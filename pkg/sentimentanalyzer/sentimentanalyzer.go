@@ -1,5 +1,11 @@
 package sentimentanalyzer
 
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
 // Sentiment is the type representation of a sentiment.
 type Sentiment int
 
@@ -15,6 +21,16 @@ type Analysis struct {
 	Sentiment        Sentiment
 	Confidence       float32
 	SentenceAnalyses []SentenceAnalysis
+	// Toxicity scores the comment on each incivility category. It is empty
+	// when nothing scored the comment.
+	Toxicity []ToxicityScore
+	// Providers are the names of the providers that contributed to a combined
+	// analysis.
+	Providers []string
+	// Degraded is set when the analysis came from a fallback instead of the
+	// configured provider, such as when a quota is exceeded. Degraded analyses
+	// are not cached.
+	Degraded bool
 }
 
 // SentenceAnalysis represents individual sentence analysis.
@@ -22,16 +38,20 @@ type SentenceAnalysis struct {
 	Sentiment  Sentiment
 	Confidence float32
 	Text       string
+	// SuggestedRewrite is a more positive way to phrase the sentence, for
+	// providers that are able to suggest one.
+	SuggestedRewrite string
 }
 
-type sentimentAnalyzer interface {
-	analyzeSentiment(string) (Analysis, error)
+// Analyzer is a sentiment analysis provider.
+type Analyzer interface {
+	AnalyzeSentiment(ctx context.Context, text string) (*Analysis, error)
 }
 
 // GetSentiment calls a sentimentService and retrieves the corresponding
 // analysis.
-func GetSentiment(svc sentimentAnalyzer, comment string) (Analysis, error) {
-	return svc.analyzeSentiment(comment)
+func GetSentiment(ctx context.Context, svc Analyzer, comment string) (*Analysis, error) {
+	return svc.AnalyzeSentiment(ctx, comment)
 }
 
 // NegativeSentences returns any negative sentences.
@@ -45,3 +65,28 @@ func (a Analysis) NegativeSentences() []SentenceAnalysis {
 
 	return negativeSentences
 }
+
+// HasSuggestedRewrites indicates if any negative sentence has a suggested
+// rewrite.
+func (a Analysis) HasSuggestedRewrites() bool {
+	for _, sentenceAnalysis := range a.NegativeSentences() {
+		if sentenceAnalysis.SuggestedRewrite != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseSentiment converts a sentiment name, in any case, to a Sentiment.
+func ParseSentiment(name string) (Sentiment, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "positive":
+		return Positive, nil
+	case "negative":
+		return Negative, nil
+	case "neutral":
+		return Neutral, nil
+	default:
+		return Neutral, fmt.Errorf("unknown sentiment '%s'", name)
+	}
+}
@@ -0,0 +1,61 @@
+package sentimentanalyzer
+
+// ToxicityCategory is a kind of incivility, which is separate from sentiment
+// as a comment can be negative without being rude.
+type ToxicityCategory int
+
+//go:generate stringer -type=ToxicityCategory
+const (
+	Insult ToxicityCategory = iota
+	Profanity
+	IdentityAttack
+	Threat
+	Dismissiveness
+)
+
+// DefaultToxicityThreshold is the score at which a category counts as
+// uncivil.
+const DefaultToxicityThreshold float32 = 0.5
+
+// ToxicityCategories lists every toxicity category.
+var ToxicityCategories = []ToxicityCategory{
+	Insult,
+	Profanity,
+	IdentityAttack,
+	Threat,
+	Dismissiveness,
+}
+
+// ToxicityScore is the likelihood, from 0 to 1, that text falls into a
+// toxicity category.
+type ToxicityScore struct {
+	Category ToxicityCategory
+	Score    float32
+}
+
+// ToxicityScore returns the score for the category, or 0 if it was not
+// scored.
+func (a Analysis) ToxicityScore(category ToxicityCategory) float32 {
+	for _, toxicityScore := range a.Toxicity {
+		if toxicityScore.Category == category {
+			return toxicityScore.Score
+		}
+	}
+	return 0
+}
+
+// UncivilCategories returns the toxicity scores at or above the threshold.
+func (a Analysis) UncivilCategories(threshold float32) []ToxicityScore {
+	uncivil := []ToxicityScore{}
+	for _, toxicityScore := range a.Toxicity {
+		if toxicityScore.Score >= threshold {
+			uncivil = append(uncivil, toxicityScore)
+		}
+	}
+	return uncivil
+}
+
+// IsUncivil indicates if any toxicity category is at or above the threshold.
+func (a Analysis) IsUncivil(threshold float32) bool {
+	return len(a.UncivilCategories(threshold)) > 0
+}
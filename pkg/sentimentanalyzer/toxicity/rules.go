@@ -0,0 +1,55 @@
+package toxicity
+
+import (
+	"regexp"
+
+	sa "github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer"
+)
+
+// defaultPatterns are deliberately aimed at people rather than at code, so
+// that technical phrases like "kill the process" or "this hack is ugly" are
+// not flagged.
+var defaultPatterns = []struct {
+	category sa.ToxicityCategory
+	pattern  string
+	weight   float32
+}{
+	{sa.Insult, `\byou(\s+are|'re|r)\s+(an?\s+|so\s+|such\s+an?\s+)?(idiot|moron|imbecile|stupid|dumb|incompetent|clueless|useless|pathetic|joke|clown|fool)\b`, 0.9},
+	{sa.Insult, `\b(idiot|moron|imbecile|dumbass|nitwit|halfwit|loser)s?\b`, 0.6},
+	{sa.Insult, `\bwho\s+(wrote|approved|merged)\s+this\s+(garbage|crap|trash|mess)\b`, 0.6},
+	{sa.Insult, `\b(are\s+you|you)\s+(even\s+)?(blind|illiterate|serious)\b`, 0.5},
+
+	{sa.Profanity, `\bf+u+c+k+(ing|ed|er|s)?\b`, 0.9},
+	{sa.Profanity, `\b(shit|shitty|bullshit|asshole|bastard|bitch|dickhead|wtf|stfu)\b`, 0.8},
+	{sa.Profanity, `\b(crap|crappy|damn|damned|piss(ed)?)\b`, 0.4},
+
+	{sa.IdentityAttack, `\b(people\s+like\s+you|your\s+kind|you\s+people)\b`, 0.6},
+	{sa.IdentityAttack, `\bgo\s+back\s+to\s+(your|where\s+you)\b`, 0.8},
+	{sa.IdentityAttack, `\b(because|since)\s+(you'?re|you\s+are)\s+an?\s+(woman|girl|foreigner|immigrant)\b`, 0.8},
+
+	{sa.Threat, `\bi('ll|\s+will|\s+am\s+going\s+to|'m\s+going\s+to|\s+gonna)\s+(find|hurt|kill|destroy|end)\s+you\b`, 0.95},
+	{sa.Threat, `\b(watch|better\s+watch)\s+your\s+back\b`, 0.8},
+	{sa.Threat, `\byou('ll|\s+will)\s+regret\b`, 0.6},
+	{sa.Threat, `\bkill\s+yourself\b|\bkys\b`, 0.95},
+
+	{sa.Dismissiveness, `\brtfm\b`, 0.7},
+	{sa.Dismissiveness, `\b(just\s+)?(google|search)\s+it\b`, 0.5},
+	{sa.Dismissiveness, `\bdid\s+you\s+(even|actually)\s+(read|try|test|look)\b`, 0.6},
+	{sa.Dismissiveness, `\b(nobody|no\s+one|who)\s+cares\b`, 0.6},
+	{sa.Dismissiveness, `\b(this|that|it)\s+is\s+(a\s+)?(garbage|trash|rubbish|nonsense|joke|pointless)\b`, 0.5},
+	{sa.Dismissiveness, `\b(waste\s+of\s+(my\s+)?time|learn\s+(how\s+)?to\s+(code|read|program))\b`, 0.6},
+	{sa.Dismissiveness, `\b(obviously|clearly)\s+you\b`, 0.4},
+}
+
+// DefaultRules returns the built-in rules. Patterns are case insensitive.
+func DefaultRules() []Rule {
+	rules := []Rule{}
+	for _, pattern := range defaultPatterns {
+		rules = append(rules, Rule{
+			Category: pattern.category,
+			Pattern:  regexp.MustCompile(`(?i)` + pattern.pattern),
+			Weight:   pattern.weight,
+		})
+	}
+	return rules
+}
@@ -0,0 +1,84 @@
+// Package toxicity scores comments for incivility with keyword and regular
+// expression rules, so that no external service is needed.
+package toxicity
+
+import (
+	"context"
+	"regexp"
+
+	sa "github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer"
+)
+
+// Rule is a pattern that is evidence of a toxicity category. Weight is how
+// strong that evidence is, from 0 to 1.
+type Rule struct {
+	Category sa.ToxicityCategory
+	Pattern  *regexp.Regexp
+	Weight   float32
+}
+
+// Classifier scores text against a set of rules.
+type Classifier struct {
+	rules []Rule
+}
+
+// NewClassifier creates a classifier with the rules, or the default rules if
+// none are passed.
+func NewClassifier(rules ...Rule) *Classifier {
+	if len(rules) == 0 {
+		rules = DefaultRules()
+	}
+	return &Classifier{rules: rules}
+}
+
+// Classify scores the text on every category. Each matching rule raises the
+// score of its category towards 1, so several weak signals add up to a
+// strong one.
+func (c Classifier) Classify(text string) []sa.ToxicityScore {
+	remaining := map[sa.ToxicityCategory]float32{}
+	for _, category := range sa.ToxicityCategories {
+		remaining[category] = 1
+	}
+	for _, rule := range c.rules {
+		if rule.Pattern.MatchString(text) {
+			remaining[rule.Category] *= 1 - rule.Weight
+		}
+	}
+
+	scores := []sa.ToxicityScore{}
+	for _, category := range sa.ToxicityCategories {
+		scores = append(scores, sa.ToxicityScore{
+			Category: category,
+			Score:    1 - remaining[category],
+		})
+	}
+	return scores
+}
+
+// Analyzer fills in the toxicity of analyses from a provider that does not
+// score toxicity itself.
+type Analyzer struct {
+	analyzer   sa.Analyzer
+	classifier *Classifier
+}
+
+// NewAnalyzer wraps the analyzer with the classifier.
+func NewAnalyzer(analyzer sa.Analyzer, classifier *Classifier) *Analyzer {
+	return &Analyzer{
+		analyzer:   analyzer,
+		classifier: classifier,
+	}
+}
+
+// AnalyzeSentiment analyzes the text with the wrapped analyzer and classifies
+// its toxicity if the analyzer did not.
+func (a Analyzer) AnalyzeSentiment(ctx context.Context, text string) (*sa.Analysis, error) {
+	analysis, err := a.analyzer.AnalyzeSentiment(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+	if analysis != nil && len(analysis.Toxicity) == 0 {
+		analysis.Toxicity = a.classifier.Classify(text)
+	}
+	return analysis, nil
+}
@@ -0,0 +1,99 @@
+package toxicity
+
+import (
+	"context"
+	"testing"
+
+	sa "github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer"
+)
+
+func TestClassify(t *testing.T) {
+	testCases := []struct {
+		name     string
+		text     string
+		expected []sa.ToxicityCategory
+	}{
+		{
+			name:     "technical_language",
+			text:     "Kill the process and then nuke the cache. This hack is ugly but the test fails without it.",
+			expected: []sa.ToxicityCategory{},
+		},
+		{
+			name:     "negative_but_civil",
+			text:     "This change breaks the build and I really don't like the new API.",
+			expected: []sa.ToxicityCategory{},
+		},
+		{
+			name:     "insult",
+			text:     "You're an idiot if you think this works.",
+			expected: []sa.ToxicityCategory{sa.Insult},
+		},
+		{
+			name:     "profanity_and_dismissiveness",
+			text:     "WTF, did you even test this? RTFM.",
+			expected: []sa.ToxicityCategory{sa.Profanity, sa.Dismissiveness},
+		},
+		{
+			name:     "threat",
+			text:     "Merge this again and you'll regret it, I will find you.",
+			expected: []sa.ToxicityCategory{sa.Threat},
+		},
+		{
+			name:     "identity_attack",
+			text:     "People like you should go back to where you came from.",
+			expected: []sa.ToxicityCategory{sa.IdentityAttack},
+		},
+	}
+
+	classifier := NewClassifier()
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			analysis := sa.Analysis{Toxicity: classifier.Classify(testCase.text)}
+			if len(analysis.Toxicity) != len(sa.ToxicityCategories) {
+				t.Fatalf("Expected every category to be scored, got %+v", analysis.Toxicity)
+			}
+
+			uncivil := analysis.UncivilCategories(sa.DefaultToxicityThreshold)
+			if len(uncivil) != len(testCase.expected) {
+				t.Fatalf("Expected categories %v, got %+v", testCase.expected, uncivil)
+			}
+			for i, toxicityScore := range uncivil {
+				if toxicityScore.Category != testCase.expected[i] {
+					t.Fatalf("Expected categories %v, got %+v", testCase.expected, uncivil)
+				}
+			}
+		})
+	}
+}
+
+type fakeAnalyzer struct {
+	analysis sa.Analysis
+}
+
+func (f fakeAnalyzer) AnalyzeSentiment(ctx context.Context, text string) (*sa.Analysis, error) {
+	analysis := f.analysis
+	return &analysis, nil
+}
+
+func TestAnalyzerKeepsProviderToxicity(t *testing.T) {
+	provided := []sa.ToxicityScore{{Category: sa.Threat, Score: 0.7}}
+	analyzer := NewAnalyzer(fakeAnalyzer{analysis: sa.Analysis{Toxicity: provided}}, NewClassifier())
+
+	analysis, err := analyzer.AnalyzeSentiment(context.Background(), "you're an idiot")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(analysis.Toxicity) != 1 || analysis.ToxicityScore(sa.Threat) != 0.7 {
+		t.Fatalf("Expected provider toxicity to be kept, got %+v", analysis.Toxicity)
+	}
+
+	analyzer = NewAnalyzer(fakeAnalyzer{}, NewClassifier())
+	analysis, err = analyzer.AnalyzeSentiment(context.Background(), "you're an idiot")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if analysis.ToxicityScore(sa.Insult) < sa.DefaultToxicityThreshold {
+		t.Fatalf("Expected classifier to fill in toxicity, got %+v", analysis.Toxicity)
+	}
+}
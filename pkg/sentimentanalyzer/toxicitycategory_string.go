@@ -0,0 +1,27 @@
+// Code generated by "stringer -type=ToxicityCategory"; DO NOT EDIT.
+
+package sentimentanalyzer
+
+import "strconv"
+
+func _() {
+	// An "invalid array index" compiler error signifies that the constant values have changed.
+	// Re-run the stringer command to generate them again.
+	var x [1]struct{}
+	_ = x[Insult-0]
+	_ = x[Profanity-1]
+	_ = x[IdentityAttack-2]
+	_ = x[Threat-3]
+	_ = x[Dismissiveness-4]
+}
+
+const _ToxicityCategory_name = "InsultProfanityIdentityAttackThreatDismissiveness"
+
+var _ToxicityCategory_index = [...]uint8{0, 6, 15, 29, 35, 49}
+
+func (i ToxicityCategory) String() string {
+	if i < 0 || i >= ToxicityCategory(len(_ToxicityCategory_index)-1) {
+		return "ToxicityCategory(" + strconv.FormatInt(int64(i), 10) + ")"
+	}
+	return _ToxicityCategory_name[_ToxicityCategory_index[i]:_ToxicityCategory_index[i+1]]
+}
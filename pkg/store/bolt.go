@@ -0,0 +1,339 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/trstringer/comment-sentiment/pkg/budget"
+)
+
+var (
+	metaBucket     = []byte("meta")
+	analysesBucket = []byte("analyses")
+	usageBucket    = []byte("usage")
+	// commentsBucket indexes the analyses by comment, with keys of the
+	// comment key followed by the analysis ID.
+	commentsBucket = []byte("comments")
+
+	schemaVersionKey = []byte("schema_version")
+)
+
+// migration upgrades the schema to its version.
+type migration struct {
+	version uint64
+	migrate func(tx *bolt.Tx) error
+}
+
+// migrations are applied in order to bring a database up to date. Existing
+// migrations must never change, add a new one instead.
+var migrations = []migration{
+	{
+		version: 1,
+		migrate: func(tx *bolt.Tx) error {
+			for _, bucket := range [][]byte{analysesBucket, usageBucket} {
+				if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		version: 2,
+		migrate: func(tx *bolt.Tx) error {
+			comments, err := tx.CreateBucketIfNotExists(commentsBucket)
+			if err != nil {
+				return err
+			}
+			return tx.Bucket(analysesBucket).ForEach(func(key, value []byte) error {
+				record := AnalysisRecord{}
+				if err := json.Unmarshal(value, &record); err != nil {
+					return fmt.Errorf("error unmarshalling analysis %d: %w", binary.BigEndian.Uint64(key), err)
+				}
+				return comments.Put(commentIndexKey(record.CommentKey(), record.ID), nil)
+			})
+		},
+	},
+}
+
+// Bolt is an AnalysisRepository and budget.UsageStore in an embedded bbolt
+// database file.
+type Bolt struct {
+	db *bolt.DB
+}
+
+var (
+	_ AnalysisRepository = &Bolt{}
+	_ budget.UsageStore  = &Bolt{}
+)
+
+// OpenBolt opens the database at path, creating and migrating it as needed.
+func OpenBolt(path string) (*Bolt, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("error opening database: %w", err)
+	}
+
+	if err := migrate(db); err != nil {
+		// nolint: errcheck
+		db.Close()
+		return nil, err
+	}
+	return &Bolt{db: db}, nil
+}
+
+// SchemaVersion returns the version of the last migration applied.
+func (b *Bolt) SchemaVersion() (uint64, error) {
+	var version uint64
+	err := b.db.View(func(tx *bolt.Tx) error {
+		version = schemaVersion(tx)
+		return nil
+	})
+	return version, err
+}
+
+func schemaVersion(tx *bolt.Tx) uint64 {
+	meta := tx.Bucket(metaBucket)
+	if meta == nil {
+		return 0
+	}
+	value := meta.Get(schemaVersionKey)
+	if len(value) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(value)
+}
+
+func migrate(db *bolt.DB) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists(metaBucket)
+		if err != nil {
+			return fmt.Errorf("error creating meta bucket: %w", err)
+		}
+
+		current := schemaVersion(tx)
+		latest := migrations[len(migrations)-1].version
+		if current > latest {
+			return fmt.Errorf("database schema version %d is newer than the supported version %d", current, latest)
+		}
+		for _, m := range migrations {
+			if m.version <= current {
+				continue
+			}
+			if err := m.migrate(tx); err != nil {
+				return fmt.Errorf("error migrating database to version %d: %w", m.version, err)
+			}
+			if err := meta.Put(schemaVersionKey, itob(m.version)); err != nil {
+				return fmt.Errorf("error saving schema version: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// SaveAnalysis stores the record and sets its ID.
+func (b *Bolt) SaveAnalysis(ctx context.Context, record *AnalysisRecord) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(analysesBucket)
+		id, err := bucket.NextSequence()
+		if err != nil {
+			return fmt.Errorf("error getting analysis ID: %w", err)
+		}
+		record.ID = id
+
+		data, err := json.Marshal(record)
+		if err != nil {
+			return fmt.Errorf("error marshalling analysis: %w", err)
+		}
+		if err := bucket.Put(itob(id), data); err != nil {
+			return fmt.Errorf("error saving analysis: %w", err)
+		}
+		if err := tx.Bucket(commentsBucket).Put(commentIndexKey(record.CommentKey(), id), nil); err != nil {
+			return fmt.Errorf("error indexing analysis: %w", err)
+		}
+		return nil
+	})
+}
+
+// ListAnalyses returns the records selected by the filter, oldest first.
+func (b *Bolt) ListAnalyses(ctx context.Context, filter Filter) ([]AnalysisRecord, error) {
+	records := []AnalysisRecord{}
+	err := b.EachAnalysis(ctx, filter, func(record AnalysisRecord) error {
+		records = append(records, record)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// EachAnalysis calls fn with the records selected by the filter, oldest
+// first, without loading them all in memory. An error from fn stops the
+// iteration and is returned.
+func (b *Bolt) EachAnalysis(ctx context.Context, filter Filter, fn func(AnalysisRecord) error) error {
+	return b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(analysesBucket).ForEach(func(key, value []byte) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			record := AnalysisRecord{}
+			if err := json.Unmarshal(value, &record); err != nil {
+				return fmt.Errorf("error unmarshalling analysis %d: %w", binary.BigEndian.Uint64(key), err)
+			}
+			if !filter.Matches(record) {
+				return nil
+			}
+			return fn(record)
+		})
+	})
+}
+
+// CommentHistory returns the records of every version of the comment with
+// the key, oldest first.
+func (b *Bolt) CommentHistory(ctx context.Context, commentKey string) ([]AnalysisRecord, error) {
+	records := []AnalysisRecord{}
+	prefix := commentIndexKey(commentKey, 0)[:len(commentKey)+1]
+	err := b.db.View(func(tx *bolt.Tx) error {
+		analyses := tx.Bucket(analysesBucket)
+		cursor := tx.Bucket(commentsBucket).Cursor()
+		for key, _ := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, _ = cursor.Next() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			id := key[len(prefix):]
+			record := AnalysisRecord{}
+			if err := json.Unmarshal(analyses.Get(id), &record); err != nil {
+				return fmt.Errorf("error unmarshalling analysis %d: %w", binary.BigEndian.Uint64(id), err)
+			}
+			records = append(records, record)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// PruneAnalyses deletes the records analyzed before the time, and returns how
+// many were deleted.
+func (b *Bolt) PruneAnalyses(ctx context.Context, before time.Time) (int, error) {
+	pruned := 0
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		analyses := tx.Bucket(analysesBucket)
+		comments := tx.Bucket(commentsBucket)
+		cursor := analyses.Cursor()
+		for key, value := cursor.First(); key != nil; {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			record := AnalysisRecord{}
+			if err := json.Unmarshal(value, &record); err != nil {
+				return fmt.Errorf("error unmarshalling analysis %d: %w", binary.BigEndian.Uint64(key), err)
+			}
+			if !record.AnalyzedAt.Before(before) {
+				key, value = cursor.Next()
+				continue
+			}
+			if err := comments.Delete(commentIndexKey(record.CommentKey(), record.ID)); err != nil {
+				return fmt.Errorf("error deleting index of analysis %d: %w", record.ID, err)
+			}
+			if err := cursor.Delete(); err != nil {
+				return fmt.Errorf("error deleting analysis %d: %w", record.ID, err)
+			}
+			pruned++
+			// Deleting moves the cursor to the next key.
+			key, value = cursor.Seek(key)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return pruned, nil
+}
+
+// Usage returns the budget usage of the key.
+func (b *Bolt) Usage(key string) (budget.Usage, error) {
+	usage := budget.Usage{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(usageBucket).Get([]byte(key))
+		if value == nil {
+			return nil
+		}
+		return json.Unmarshal(value, &usage)
+	})
+	if err != nil {
+		return usage, fmt.Errorf("error reading usage: %w", err)
+	}
+	return usage, nil
+}
+
+// AddUsage adds to the budget usage of the key.
+func (b *Bolt) AddUsage(key string, usage budget.Usage) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(usageBucket)
+		current := budget.Usage{}
+		if value := bucket.Get([]byte(key)); value != nil {
+			if err := json.Unmarshal(value, &current); err != nil {
+				return fmt.Errorf("error reading usage: %w", err)
+			}
+		}
+		current.Characters += usage.Characters
+		current.Records += usage.Records
+
+		data, err := json.Marshal(current)
+		if err != nil {
+			return fmt.Errorf("error marshalling usage: %w", err)
+		}
+		return bucket.Put([]byte(key), data)
+	})
+}
+
+// ListUsage returns the budget usage of every key with the prefix.
+func (b *Bolt) ListUsage(prefix string) (map[string]budget.Usage, error) {
+	usages := map[string]budget.Usage{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(usageBucket).Cursor()
+		for key, value := cursor.Seek([]byte(prefix)); key != nil && strings.HasPrefix(string(key), prefix); key, value = cursor.Next() {
+			usage := budget.Usage{}
+			if err := json.Unmarshal(value, &usage); err != nil {
+				return fmt.Errorf("error reading usage of %s: %w", key, err)
+			}
+			usages[string(key)] = usage
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return usages, nil
+}
+
+// Close closes the database.
+func (b *Bolt) Close() error {
+	return b.db.Close()
+}
+
+// commentIndexKey is the key of an analysis in the comments bucket. The
+// separator keeps the analyses of a comment from matching the prefix of
+// another comment, such as comment 1 and comment 12.
+func commentIndexKey(commentKey string, id uint64) []byte {
+	key := append([]byte(commentKey), 0)
+	return append(key, itob(id)...)
+}
+
+// itob encodes an ID so that keys sort in numeric order.
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
@@ -0,0 +1,174 @@
+// Package store persists the analysis of every processed comment, so that
+// analytics and reporting can be built on top of it.
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	gh "github.com/trstringer/comment-sentiment/pkg/github"
+	sa "github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer"
+)
+
+// AnalysisRecord is the analysis of one version of a comment. Every
+// processed event adds a record, so edits of a comment are kept as separate
+// records.
+type AnalysisRecord struct {
+	ID           uint64             `json:"id"`
+	Installation string             `json:"installation"`
+	Repo         string             `json:"repo"`
+	ThreadNumber int                `json:"thread_number"`
+	ThreadTitle  string             `json:"thread_title"`
+	ThreadURL    string             `json:"thread_url"`
+	CommentID    int64              `json:"comment_id"`
+	CommentURL   string             `json:"comment_url"`
+	CommentType  string             `json:"comment_type"`
+	Action       string             `json:"action"`
+	Author       string             `json:"author"`
+	Provider     string             `json:"provider"`
+	Providers    []string           `json:"providers,omitempty"`
+	Sentiment    string             `json:"sentiment"`
+	Confidence   float32            `json:"confidence"`
+	Sentences    []SentenceRecord   `json:"sentences"`
+	Toxicity     map[string]float32 `json:"toxicity,omitempty"`
+	Annotated    bool               `json:"annotated"`
+	// Shadow is set for records made in shadow mode, where comments are not
+	// edited. Annotated is then whether the analysis would have been added,
+	// and ShadowComment is the text the comment would have been edited to,
+	// empty if it would not have been edited.
+	Shadow           bool      `json:"shadow,omitempty"`
+	ShadowComment    string    `json:"shadow_comment,omitempty"`
+	CommentCreatedAt time.Time `json:"comment_created_at"`
+	CommentUpdatedAt time.Time `json:"comment_updated_at"`
+	AnalyzedAt       time.Time `json:"analyzed_at"`
+}
+
+// CommentKey identifies the comment of the record, which is shared by the
+// records of every version of the comment.
+func (r AnalysisRecord) CommentKey() string {
+	return fmt.Sprintf("%s/%s/%d", r.Repo, r.CommentType, r.CommentID)
+}
+
+// SentenceRecord is the analysis of a sentence.
+type SentenceRecord struct {
+	Text       string  `json:"text"`
+	Sentiment  string  `json:"sentiment"`
+	Confidence float32 `json:"confidence"`
+}
+
+// NewAnalysisRecord creates the record of analyzing the comment of the
+// payload. Annotated is whether the analysis was added to the comment.
+// Backfilled comments are recorded as analyzed when they were last updated,
+// so that they count towards the time they were written.
+func NewAnalysisRecord(commentPayload gh.CommentPayload, analysis sa.Analysis, provider string, annotated bool) AnalysisRecord {
+	threadNumber, threadTitle, threadURL := commentPayload.Thread()
+	commentType, _ := commentPayload.CommentType()
+
+	record := AnalysisRecord{
+		Installation:     commentPayload.InstallationKey(),
+		Repo:             commentPayload.Repository.FullName,
+		ThreadNumber:     threadNumber,
+		ThreadTitle:      threadTitle,
+		ThreadURL:        threadURL,
+		CommentID:        commentPayload.Comment.ID,
+		CommentURL:       commentPayload.Comment.HTMLURL,
+		CommentType:      commentType.String(),
+		Action:           commentPayload.Action,
+		Author:           commentPayload.Comment.CommentUser.Login,
+		Provider:         provider,
+		Providers:        analysis.Providers,
+		Sentiment:        analysis.Sentiment.String(),
+		Confidence:       analysis.Confidence,
+		Sentences:        []SentenceRecord{},
+		Annotated:        annotated,
+		CommentCreatedAt: commentPayload.Comment.CreatedAt,
+		CommentUpdatedAt: commentPayload.Comment.UpdatedAt,
+		AnalyzedAt:       time.Now().UTC(),
+	}
+	if commentPayload.Action == gh.ActionBackfill {
+		record.AnalyzedAt = commentPayload.Comment.UpdatedAt.UTC()
+		if record.AnalyzedAt.IsZero() {
+			record.AnalyzedAt = commentPayload.Comment.CreatedAt.UTC()
+		}
+	}
+	for _, sentence := range analysis.SentenceAnalyses {
+		record.Sentences = append(record.Sentences, SentenceRecord{
+			Text:       sentence.Text,
+			Sentiment:  sentence.Sentiment.String(),
+			Confidence: sentence.Confidence,
+		})
+	}
+	if len(analysis.Toxicity) > 0 {
+		record.Toxicity = map[string]float32{}
+		for _, score := range analysis.Toxicity {
+			record.Toxicity[score.Category.String()] = score.Score
+		}
+	}
+	return record
+}
+
+// Filter selects records. Empty fields match every record.
+type Filter struct {
+	Installation string
+	// Owner selects the repos of a user or organization.
+	Owner       string
+	Repo        string
+	Author      string
+	CommentType string
+	Sentiment   string
+	// Shadow selects the records made in shadow mode, or the others, if set.
+	Shadow *bool
+	// Since and Until bound the analysis time, Since inclusive and Until
+	// exclusive.
+	Since time.Time
+	Until time.Time
+}
+
+// Matches indicates if the record is selected by the filter.
+func (f Filter) Matches(record AnalysisRecord) bool {
+	switch {
+	case f.Installation != "" && record.Installation != f.Installation:
+		return false
+	case f.Owner != "" && !strings.EqualFold(repoOwner(record.Repo), f.Owner):
+		return false
+	case f.Repo != "" && record.Repo != f.Repo:
+		return false
+	case f.Author != "" && record.Author != f.Author:
+		return false
+	case f.CommentType != "" && record.CommentType != f.CommentType:
+		return false
+	case f.Sentiment != "" && !strings.EqualFold(record.Sentiment, f.Sentiment):
+		return false
+	case f.Shadow != nil && record.Shadow != *f.Shadow:
+		return false
+	case !f.Since.IsZero() && record.AnalyzedAt.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && !record.AnalyzedAt.Before(f.Until):
+		return false
+	default:
+		return true
+	}
+}
+
+// repoOwner returns the owner of a repo full name such as octo/repo.
+func repoOwner(fullName string) string {
+	owner, _, _ := strings.Cut(fullName, "/")
+	return owner
+}
+
+// AnalysisRepository stores analysis records.
+type AnalysisRepository interface {
+	// SaveAnalysis stores the record and sets its ID.
+	SaveAnalysis(ctx context.Context, record *AnalysisRecord) error
+	// ListAnalyses returns the records selected by the filter, oldest first.
+	ListAnalyses(ctx context.Context, filter Filter) ([]AnalysisRecord, error)
+	// EachAnalysis calls fn with the records selected by the filter, oldest
+	// first, and stops at the first error.
+	EachAnalysis(ctx context.Context, filter Filter, fn func(AnalysisRecord) error) error
+	// CommentHistory returns the records of every version of the comment
+	// with the key, oldest first.
+	CommentHistory(ctx context.Context, commentKey string) ([]AnalysisRecord, error)
+	Close() error
+}
@@ -0,0 +1,239 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/trstringer/comment-sentiment/pkg/budget"
+	gh "github.com/trstringer/comment-sentiment/pkg/github"
+	sa "github.com/trstringer/comment-sentiment/pkg/sentimentanalyzer"
+)
+
+func openTestBolt(t *testing.T, path string) *Bolt {
+	db, err := OpenBolt(path)
+	if err != nil {
+		t.Fatalf("Unexpected error opening database: %v", err)
+	}
+	return db
+}
+
+func TestNewAnalysisRecord(t *testing.T) {
+	commentPayload := gh.CommentPayload{
+		Action:       "edited",
+		Comment:      gh.Comment{ID: 42, CommentUser: gh.CommentUser{Login: "octocat"}},
+		Issue:        &gh.Issue{Number: 7, Title: "Crash on start"},
+		Repository:   gh.Repository{FullName: "octo/repo"},
+		Installation: &gh.Installation{ID: 99},
+	}
+	analysis := sa.Analysis{
+		Sentiment:        sa.Negative,
+		Confidence:       0.8,
+		SentenceAnalyses: []sa.SentenceAnalysis{{Text: "Ugh.", Sentiment: sa.Negative, Confidence: 0.8}},
+		Toxicity:         []sa.ToxicityScore{{Category: sa.Insult, Score: 0.1}},
+		Providers:        []string{"azure", "bayes"},
+	}
+
+	record := NewAnalysisRecord(commentPayload, analysis, "ensemble", true)
+	if record.Installation != "99" || record.Repo != "octo/repo" || record.ThreadNumber != 7 ||
+		record.CommentID != 42 || record.CommentType != "issue_comment" || record.Author != "octocat" ||
+		record.Action != "edited" || record.Sentiment != "Negative" || !record.Annotated {
+		t.Fatalf("Unexpected record %+v", record)
+	}
+	if len(record.Sentences) != 1 || record.Sentences[0].Sentiment != "Negative" {
+		t.Fatalf("Unexpected sentences %+v", record.Sentences)
+	}
+	if record.Toxicity["Insult"] != 0.1 {
+		t.Fatalf("Unexpected toxicity %+v", record.Toxicity)
+	}
+	if record.Provider != "ensemble" || strings.Join(record.Providers, ",") != "azure,bayes" {
+		t.Fatalf("Unexpected providers %s %v", record.Provider, record.Providers)
+	}
+}
+
+func TestNewAnalysisRecordBackfill(t *testing.T) {
+	updatedAt := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	commentPayload := gh.CommentPayload{
+		Action:     gh.ActionBackfill,
+		Comment:    gh.Comment{ID: 42, CreatedAt: updatedAt.Add(-time.Hour), UpdatedAt: updatedAt},
+		Discussion: &gh.Discussion{Number: 3, Title: "Ideas"},
+		Repository: gh.Repository{FullName: "octo/repo"},
+	}
+
+	record := NewAnalysisRecord(commentPayload, sa.Analysis{Sentiment: sa.Positive}, "azure", false)
+	if !record.AnalyzedAt.Equal(updatedAt) || record.CommentType != "discussion_comment" || record.ThreadNumber != 3 {
+		t.Fatalf("Unexpected record %+v", record)
+	}
+}
+
+func TestBoltAnalyses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db := openTestBolt(t, path)
+
+	start := time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC)
+	records := []AnalysisRecord{
+		{Repo: "octo/a", Author: "alice", Sentiment: "Negative", AnalyzedAt: start},
+		{Repo: "octo/a", Author: "bob", Sentiment: "Positive", AnalyzedAt: start.Add(time.Hour)},
+		{Repo: "octo/b", Author: "alice", Sentiment: "Neutral", Shadow: true, AnalyzedAt: start.Add(2 * time.Hour)},
+		{Repo: "other/a", Author: "carol", Sentiment: "Neutral", AnalyzedAt: start.Add(3 * time.Hour)},
+	}
+	for i := range records {
+		if err := db.SaveAnalysis(context.Background(), &records[i]); err != nil {
+			t.Fatalf("Unexpected error saving: %v", err)
+		}
+		if records[i].ID != uint64(i+1) {
+			t.Fatalf("Expected ID %d, got %d", i+1, records[i].ID)
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Unexpected error closing: %v", err)
+	}
+
+	// Reopening runs the migrations again, which must not lose data.
+	db = openTestBolt(t, path)
+	defer db.Close()
+	version, err := db.SchemaVersion()
+	if err != nil || version != migrations[len(migrations)-1].version {
+		t.Fatalf("Unexpected schema version %d: %v", version, err)
+	}
+
+	shadow, live := true, false
+	testCases := []struct {
+		name        string
+		filter      Filter
+		expectedIDs []uint64
+	}{
+		{name: "all", filter: Filter{}, expectedIDs: []uint64{1, 2, 3, 4}},
+		{name: "owner", filter: Filter{Owner: "Octo"}, expectedIDs: []uint64{1, 2, 3}},
+		{name: "repo", filter: Filter{Repo: "octo/a"}, expectedIDs: []uint64{1, 2}},
+		{name: "author", filter: Filter{Author: "alice"}, expectedIDs: []uint64{1, 3}},
+		{name: "sentiment", filter: Filter{Sentiment: "positive"}, expectedIDs: []uint64{2}},
+		{name: "shadow", filter: Filter{Shadow: &shadow}, expectedIDs: []uint64{3}},
+		{name: "live", filter: Filter{Shadow: &live}, expectedIDs: []uint64{1, 2, 4}},
+		{name: "time_range", filter: Filter{Since: start.Add(time.Hour), Until: start.Add(2 * time.Hour)}, expectedIDs: []uint64{2}},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			actual, err := db.ListAnalyses(context.Background(), testCase.filter)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(actual) != len(testCase.expectedIDs) {
+				t.Fatalf("Expected %d records, got %+v", len(testCase.expectedIDs), actual)
+			}
+			for i, record := range actual {
+				if record.ID != testCase.expectedIDs[i] {
+					t.Fatalf("Expected ID %d at %d, got %d", testCase.expectedIDs[i], i, record.ID)
+				}
+			}
+		})
+	}
+}
+
+func TestBoltUsage(t *testing.T) {
+	db := openTestBolt(t, filepath.Join(t.TempDir(), "test.db"))
+	defer db.Close()
+
+	for _, key := range []string{"global/day/2022-05-01", "global/day/2022-05-01", "installation/1/day/2022-05-01"} {
+		if err := db.AddUsage(key, budget.Usage{Characters: 10, Records: 1}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	usage, err := db.Usage("global/day/2022-05-01")
+	if err != nil || usage != (budget.Usage{Characters: 20, Records: 2}) {
+		t.Fatalf("Unexpected usage %+v: %v", usage, err)
+	}
+	usages, err := db.ListUsage("installation/")
+	if err != nil || len(usages) != 1 {
+		t.Fatalf("Unexpected installation usage %+v: %v", usages, err)
+	}
+}
+
+func TestBoltCommentHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db := openTestBolt(t, path)
+
+	records := []AnalysisRecord{
+		{Repo: "octo/a", CommentType: "issue_comment", CommentID: 1, Sentiment: "Negative"},
+		{Repo: "octo/a", CommentType: "issue_comment", CommentID: 12, Sentiment: "Neutral"},
+		{Repo: "octo/a", CommentType: "issue_comment", CommentID: 1, Sentiment: "Positive"},
+	}
+	for i := range records {
+		if err := db.SaveAnalysis(context.Background(), &records[i]); err != nil {
+			t.Fatalf("Unexpected error saving: %v", err)
+		}
+	}
+
+	// A database from before the comment index is indexed by the migration.
+	err := db.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(commentsBucket); err != nil {
+			return err
+		}
+		return tx.Bucket(metaBucket).Put(schemaVersionKey, itob(1))
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error downgrading: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Unexpected error closing: %v", err)
+	}
+	db = openTestBolt(t, path)
+	defer db.Close()
+
+	history, err := db.CommentHistory(context.Background(), records[0].CommentKey())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(history) != 2 || history[0].ID != 1 || history[1].ID != 3 {
+		t.Fatalf("Unexpected history %+v", history)
+	}
+}
+
+func TestBoltPruneAnalyses(t *testing.T) {
+	db := openTestBolt(t, filepath.Join(t.TempDir(), "test.db"))
+	defer db.Close()
+
+	start := time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC)
+	// Backfilled records are analyzed at the time of the comment, so they are
+	// not in the order of their IDs.
+	records := []AnalysisRecord{
+		{Repo: "octo/a", CommentType: "issue_comment", CommentID: 1, AnalyzedAt: start},
+		{Repo: "octo/a", CommentType: "issue_comment", CommentID: 1, AnalyzedAt: start.Add(2 * time.Hour)},
+		{Repo: "octo/a", CommentType: "issue_comment", CommentID: 2, AnalyzedAt: start.Add(-time.Hour)},
+		{Repo: "octo/a", CommentType: "issue_comment", CommentID: 3, AnalyzedAt: start.Add(-2 * time.Hour)},
+		{Repo: "octo/a", CommentType: "issue_comment", CommentID: 4, AnalyzedAt: start.Add(3 * time.Hour)},
+	}
+	for i := range records {
+		if err := db.SaveAnalysis(context.Background(), &records[i]); err != nil {
+			t.Fatalf("Unexpected error saving: %v", err)
+		}
+	}
+
+	pruned, err := db.PruneAnalyses(context.Background(), start.Add(time.Hour))
+	if err != nil || pruned != 3 {
+		t.Fatalf("Expected 3 records pruned, got %d: %v", pruned, err)
+	}
+
+	remaining, err := db.ListAnalyses(context.Background(), Filter{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(remaining) != 2 || remaining[0].ID != 2 || remaining[1].ID != 5 {
+		t.Fatalf("Unexpected remaining records %+v", remaining)
+	}
+	history, err := db.CommentHistory(context.Background(), records[0].CommentKey())
+	if err != nil || len(history) != 1 || history[0].ID != 2 {
+		t.Fatalf("Unexpected history %+v: %v", history, err)
+	}
+	history, err = db.CommentHistory(context.Background(), records[2].CommentKey())
+	if err != nil || len(history) != 0 {
+		t.Fatalf("Expected the history of a pruned comment to be empty, got %+v: %v", history, err)
+	}
+}